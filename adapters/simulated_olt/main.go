@@ -121,14 +121,14 @@ func (rw *adapter) stop() {
 	// TODO:  More cleanup
 }
 
-func newKVClient(storeType string, address string, timeout int) (kvstore.Client, error) {
+func newKVClient(storeType string, address string, timeout int, security *kvstore.SecurityConfig) (kvstore.Client, error) {
 
 	log.Infow("kv-store-type", log.Fields{"store": storeType})
 	switch storeType {
 	case "consul":
-		return kvstore.NewConsulClient(address, timeout)
+		return kvstore.NewConsulClientWithSecurity(address, timeout, security)
 	case "etcd":
-		return kvstore.NewEtcdClient(address, timeout)
+		return kvstore.NewEtcdClientWithSecurity(address, timeout, security)
 	}
 	return nil, errors.New("unsupported-kv-store")
 }
@@ -151,7 +151,15 @@ func newKafkaClient(clientType string, host string, port int) (kafka.Client, err
 
 func (a *adapter) setKVClient() error {
 	addr := a.config.KVStoreHost + ":" + strconv.Itoa(a.config.KVStorePort)
-	client, err := newKVClient(a.config.KVStoreType, addr, a.config.KVStoreTimeout)
+	security := &kvstore.SecurityConfig{
+		CertFile: a.config.KVStoreCert,
+		KeyFile:  a.config.KVStoreKey,
+		CAFile:   a.config.KVStoreCA,
+		Username: a.config.KVStoreUsername,
+		Password: a.config.KVStorePassword,
+		Token:    a.config.KVStoreToken,
+	}
+	client, err := newKVClient(a.config.KVStoreType, addr, a.config.KVStoreTimeout, security)
 	if err != nil {
 		a.kvClient = nil
 		log.Error(err)
@@ -34,12 +34,22 @@ const (
 	default_KVStoreTimeout   = 5 //in seconds
 	default_KVStoreHost      = "127.0.0.1"
 	default_KVStorePort      = 2379 // Consul = 8500; Etcd = 2379
+	default_KVStoreCert      = ""
+	default_KVStoreKey       = ""
+	default_KVStoreCA        = ""
+	default_KVStoreUsername  = ""
 	default_LogLevel         = 0
 	default_Banner           = false
 	default_Topic            = "simulated_onu"
 	default_CoreTopic        = "rwcore"
 )
 
+// Environment variables used to supply KV store secrets without exposing them on the command line
+const (
+	KVStorePasswordEnv = "KV_STORE_PASSWORD"
+	KVStoreTokenEnv    = "KV_STORE_TOKEN"
+)
+
 // AdapterFlags represents the set of configurations used by the read-write adaptercore service
 type AdapterFlags struct {
 	// Command line parameters
@@ -52,6 +62,12 @@ type AdapterFlags struct {
 	KVStoreTimeout   int // in seconds
 	KVStoreHost      string
 	KVStorePort      int
+	KVStoreCert      string
+	KVStoreKey       string
+	KVStoreCA        string
+	KVStoreUsername  string
+	KVStorePassword  string
+	KVStoreToken     string
 	Topic            string
 	CoreTopic        string
 	LogLevel         int
@@ -74,6 +90,12 @@ func NewAdapterFlags() *AdapterFlags {
 		KVStoreTimeout:   default_KVStoreTimeout,
 		KVStoreHost:      default_KVStoreHost,
 		KVStorePort:      default_KVStorePort,
+		KVStoreCert:      default_KVStoreCert,
+		KVStoreKey:       default_KVStoreKey,
+		KVStoreCA:        default_KVStoreCA,
+		KVStoreUsername:  default_KVStoreUsername,
+		KVStorePassword:  os.Getenv(KVStorePasswordEnv),
+		KVStoreToken:     os.Getenv(KVStoreTokenEnv),
 		Topic:            default_Topic,
 		CoreTopic:        default_CoreTopic,
 		LogLevel:         default_LogLevel,
@@ -117,6 +139,24 @@ func (so *AdapterFlags) ParseCommandArguments() {
 	help = fmt.Sprintf("KV store port")
 	flag.IntVar(&(so.KVStorePort), "kv_store_port", default_KVStorePort, help)
 
+	help = fmt.Sprintf("KV store client certificate file (enables TLS)")
+	flag.StringVar(&(so.KVStoreCert), "kv_store_cert", default_KVStoreCert, help)
+
+	help = fmt.Sprintf("KV store client key file")
+	flag.StringVar(&(so.KVStoreKey), "kv_store_key", default_KVStoreKey, help)
+
+	help = fmt.Sprintf("KV store certificate authority file used to verify the server")
+	flag.StringVar(&(so.KVStoreCA), "kv_store_ca", default_KVStoreCA, help)
+
+	help = fmt.Sprintf("KV store username (etcd)")
+	flag.StringVar(&(so.KVStoreUsername), "kv_store_username", default_KVStoreUsername, help)
+
+	help = fmt.Sprintf("KV store password (etcd); defaults to $%s", KVStorePasswordEnv)
+	flag.StringVar(&(so.KVStorePassword), "kv_store_password", os.Getenv(KVStorePasswordEnv), help)
+
+	help = fmt.Sprintf("KV store ACL token (consul); defaults to $%s", KVStoreTokenEnv)
+	flag.StringVar(&(so.KVStoreToken), "kv_store_token", os.Getenv(KVStoreTokenEnv), help)
+
 	help = fmt.Sprintf("Log level")
 	flag.IntVar(&(so.LogLevel), "log_level", default_LogLevel, help)
 
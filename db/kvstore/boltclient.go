@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/opencord/voltha-go/common/log"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+var (
+	boltDataBucket  = []byte("kv")
+	boltMetaBucket  = []byte("meta")
+	boltRevisionKey = []byte("revision")
+)
+
+// boltOpenTimeout bounds the wait for the file lock, which is held by any other process using the database
+const boltOpenTimeout = 1 * time.Second
+
+// BoltClient represents a KV store client for single-node deployments.  The content of the store is held in
+// memory, as with the MemoryClient, and every change is written through to a bbolt database file so that it
+// survives restarts.  Leases do not survive a restart: reservations and locks are dropped when the file is
+// opened again.  The file can only be used by one process at a time; the clients of that process share it.
+type BoltClient struct {
+	*MemoryClient
+	path string
+}
+
+// boltPersistence writes the changes of a memory store to a bbolt database
+type boltPersistence struct {
+	db      *bolt.DB
+	clients int
+}
+
+var boltStores = make(map[string]*memoryStore)
+var boltStoresLock sync.Mutex
+
+// NewBoltClient returns a new client for the KV store saved in the database file at path, creating the file
+// if needed.  The timeout is accepted for consistency with the other clients but has no effect.
+func NewBoltClient(path string, timeout int) (*BoltClient, error) {
+	store, err := getBoltStore(path)
+	if err != nil {
+		log.Errorw("cannot-open-kv-store", log.Fields{"path": path, "error": err})
+		return nil, err
+	}
+	return &BoltClient{
+		MemoryClient: &MemoryClient{
+			store:           store,
+			watchedChannels: make(map[string][]*memoryWatcher),
+			keyReservations: make(map[string]*memoryLease),
+			keyLocks:        make(map[string]*memoryLease),
+		},
+		path: path,
+	}, nil
+}
+
+// getBoltStore returns the store saved at path, loading it from the database file on first use
+func getBoltStore(path string) (*memoryStore, error) {
+	boltStoresLock.Lock()
+	defer boltStoresLock.Unlock()
+	if store, ok := boltStores[path]; ok {
+		store.persistence.(*boltPersistence).clients++
+		return store, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	store := &memoryStore{
+		data:     make(map[string]*memoryEntry),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+	if err = loadBoltStore(db, store); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store.flushed = store.revision
+	store.persistence = &boltPersistence{db: db, clients: 1}
+	boltStores[path] = store
+	log.Debugw("kv-store-loaded", log.Fields{"path": path, "keys": len(store.data), "revision": store.revision})
+	return store, nil
+}
+
+// loadBoltStore reads the content of a database into a memory store
+func loadBoltStore(db *bolt.DB, store *memoryStore) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		data, err := tx.CreateBucketIfNotExists(boltDataBucket)
+		if err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+		if err != nil {
+			return err
+		}
+		if revision := meta.Get(boltRevisionKey); revision != nil {
+			store.revision = int64(binary.BigEndian.Uint64(revision))
+		}
+		return data.ForEach(func(k []byte, v []byte) error {
+			entry, err := decodeBoltEntry(v)
+			if err != nil {
+				return err
+			}
+			store.data[string(k)] = entry
+			return nil
+		})
+	})
+}
+
+// releaseBoltStore closes the database of a store once its last client is closed
+func releaseBoltStore(path string) {
+	boltStoresLock.Lock()
+	defer boltStoresLock.Unlock()
+	store, ok := boltStores[path]
+	if !ok {
+		return
+	}
+	store.Lock()
+	defer store.Unlock()
+	persistence := store.persistence.(*boltPersistence)
+	persistence.clients--
+	if persistence.clients > 0 {
+		return
+	}
+	store.commit()
+	if err := persistence.close(); err != nil {
+		log.Errorw("cannot-close-kv-store", log.Fields{"path": path, "error": err})
+	}
+	// Leases still pending would otherwise write to the closed database
+	store.persistence = nil
+	delete(boltStores, path)
+}
+
+// An entry is saved as its modification revision followed by its value
+func encodeBoltEntry(entry *memoryEntry) []byte {
+	buf := make([]byte, 8+len(entry.value))
+	binary.BigEndian.PutUint64(buf, uint64(entry.modRevision))
+	copy(buf[8:], entry.value)
+	return buf
+}
+
+func decodeBoltEntry(buf []byte) (*memoryEntry, error) {
+	if len(buf) < 8 {
+		return nil, errors.New("corrupted-entry")
+	}
+	return &memoryEntry{
+		modRevision: int64(binary.BigEndian.Uint64(buf)),
+		value:       copyBytes(buf[8:]),
+	}, nil
+}
+
+func (p *boltPersistence) write(changes []*storeChange, revision int64) error {
+	return p.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltDataBucket)
+		for _, change := range changes {
+			var err error
+			if change.entry == nil {
+				err = data.Delete([]byte(change.key))
+			} else {
+				err = data.Put([]byte(change.key), encodeBoltEntry(change.entry))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(revision))
+		return tx.Bucket(boltMetaBucket).Put(boltRevisionKey, buf)
+	})
+}
+
+func (p *boltPersistence) close() error {
+	return p.db.Close()
+}
+
+// Close closes the KV store client.  The database file is closed along with the last client using it.
+func (c *BoltClient) Close() {
+	c.MemoryClient.Close()
+	releaseBoltStore(c.path)
+}
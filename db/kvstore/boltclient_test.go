@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestBoltPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kvstore-bolt")
+	assert.Nil(t, err)
+	return filepath.Join(dir, "voltha.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestBoltClientConformance(t *testing.T) {
+	path, cleanup := newTestBoltPath(t)
+	defer cleanup()
+	runConformanceSuite(t, &conformanceHarness{
+		newClient: func(t *testing.T) Client {
+			client, err := NewBoltClient(path, 0)
+			assert.Nil(t, err)
+			return client
+		},
+		ttl:           1,
+		expiryTimeout: 3 * time.Second,
+	})
+}
+
+func TestBoltClientPersistence(t *testing.T) {
+	path, cleanup := newTestBoltPath(t)
+	defer cleanup()
+
+	client, err := NewBoltClient(path, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, client.Put("a", "1", 0))
+	assert.Nil(t, client.Put("b", "2", 0))
+	assert.Nil(t, client.Put("b", "3", 0))
+	assert.Nil(t, client.Put("c", "4", 0))
+	assert.Nil(t, client.Delete("c", 0))
+	_, err = client.Reserve("reserved", "owner", 60)
+	assert.Nil(t, err)
+	before, err := client.Get("b", 0)
+	assert.Nil(t, err)
+
+	// A second client shares the open database
+	other, err := NewBoltClient(path, 0)
+	assert.Nil(t, err)
+	client.Close()
+	kvp, err := other.Get("a", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, kvp)
+	other.Close()
+
+	client, err = NewBoltClient(path, 0)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	kvp, err = client.Get("a", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(kvp.Value.([]byte)))
+	kvp, err = client.Get("b", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(kvp.Value.([]byte)))
+	assert.Equal(t, before.Version, kvp.Version)
+	kvp, err = client.Get("c", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+
+	// Leases do not survive a restart
+	kvp, err = client.Get("reserved", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+
+	// Revisions keep increasing across restarts
+	assert.Nil(t, client.Put("d", "5", 0))
+	kvp, err = client.Get("d", 0)
+	assert.Nil(t, err)
+	assert.True(t, kvp.Version > before.Version)
+}
+
+func TestBoltClientInvalidPath(t *testing.T) {
+	path, cleanup := newTestBoltPath(t)
+	defer cleanup()
+	_, err := NewBoltClient(filepath.Join(path, "missing", "voltha.db"), 0)
+	assert.NotNil(t, err)
+}
+
+// failingPersistence rejects the changes while failing is set
+type failingPersistence struct {
+	storePersistence
+	failing bool
+}
+
+func (p *failingPersistence) write(changes []*storeChange, revision int64) error {
+	if p.failing {
+		return errors.New("disk-full")
+	}
+	return p.storePersistence.write(changes, revision)
+}
+
+func TestBoltClientPersistenceFailure(t *testing.T) {
+	path, cleanup := newTestBoltPath(t)
+	defer cleanup()
+
+	client, err := NewBoltClient(path, 0)
+	assert.Nil(t, err)
+	defer client.Close()
+	assert.Nil(t, client.Put("a", "1", 0))
+	before, err := client.Get("a", 0)
+	assert.Nil(t, err)
+
+	persistence := &failingPersistence{storePersistence: client.store.persistence, failing: true}
+	client.store.Lock()
+	client.store.persistence = persistence
+	client.store.Unlock()
+	defer func() {
+		client.store.Lock()
+		client.store.persistence = persistence.storePersistence
+		client.store.Unlock()
+	}()
+	ch := client.Watch("")
+
+	// The changes which cannot be persisted are neither applied nor announced
+	assert.NotNil(t, client.Put("a", "2", 0))
+	assert.NotNil(t, client.Put("b", "1", 0))
+	_, err = client.Txn([]*TxnOp{
+		NewTxnOp(TXN_PUT, "c", "1", AnyVersion),
+		NewTxnOp(TXN_DELETE, "a", nil, AnyVersion),
+	}, 0)
+	assert.NotNil(t, err)
+	_, err = client.Reserve("reserved", "owner", 60)
+	assert.NotNil(t, err)
+	kvp, err := client.Get("a", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(kvp.Value.([]byte)))
+	assert.Equal(t, before.Version, kvp.Version)
+	for _, key := range []string{"b", "c", "reserved"} {
+		kvp, err = client.Get(key, 0)
+		assert.Nil(t, err)
+		assert.Nil(t, kvp, key)
+	}
+
+	persistence.failing = false
+	assert.Nil(t, client.Put("b", "2", 0))
+	event := waitForEvent(t, ch)
+	assert.Equal(t, "b", event.Key)
+	assert.Equal(t, before.Version+1, event.Version)
+}
@@ -16,6 +16,7 @@
 package kvstore
 
 import (
+	"errors"
 	"github.com/opencord/voltha-go/common/log"
 )
 
@@ -34,12 +35,34 @@ const (
 	UNKNOWN
 )
 
-// KVPair is a common wrapper for key-value pairs returned from the KV store
+// These constants represent the operation types of a KV transaction
+const (
+	TXN_PUT = iota
+	TXN_DELETE
+	TXN_CHECK
+)
+
+// AnyVersion is used in a transaction operation that does not depend on the version of its key
+const AnyVersion int64 = -1
+
+// ErrVersionMismatch is returned when a conditional operation finds a key at another version than the
+// one expected
+var ErrVersionMismatch = errors.New("version-mismatch")
+
+// ErrTxnTooLarge is returned when a transaction holds more operations than the KV store accepts, see MaxTxnOps
+var ErrTxnTooLarge = errors.New("txn-too-large")
+
+// ErrLockTimeout is returned when a lock could not be acquired within the allotted time
+var ErrLockTimeout = errors.New("lock-timeout")
+
+// KVPair is a common wrapper for key-value pairs returned from the KV store.  Version identifies the last
+// modification made to the key; a version of 0 means the key does not exist.
 type KVPair struct {
 	Key     string
 	Value   interface{}
 	Session string
 	Lease   int64
+	Version int64
 }
 
 func init() {
@@ -56,11 +79,48 @@ func NewKVPair(key string, value interface{}, session string, lease int64) *KVPa
 	return kv
 }
 
-// Event is generated by the KV client when a key change is detected
+// TxnOp is a single operation of a KV transaction.  Unless the version is AnyVersion, the operation only
+// applies if the key is at that version.  A TXN_CHECK operation only verifies the version of its key.
+type TxnOp struct {
+	Type    int
+	Key     string
+	Value   interface{}
+	Version int64
+}
+
+// NewTxnOp creates a new TxnOp object
+func NewTxnOp(opType int, key string, value interface{}, version int64) *TxnOp {
+	op := new(TxnOp)
+	op.Type = opType
+	op.Key = key
+	op.Value = value
+	op.Version = version
+	return op
+}
+
+// ListOptions controls a paginated listing.  At most Limit pairs are returned per page, starting with the
+// first key greater than or equal to StartKey.  When KeysOnly is set, the values are not retrieved and the
+// returned pairs hold a nil Value.  A Limit of 0 or less returns all the remaining pairs.
+type ListOptions struct {
+	Limit    int
+	StartKey string
+	KeysOnly bool
+}
+
+// KVPage is one page of a paginated listing.  Pairs are sorted by key.  NextKey is the StartKey to use to
+// retrieve the following page; it is empty when there are no more pairs.
+type KVPage struct {
+	Pairs   []*KVPair
+	NextKey string
+}
+
+// Event is generated by the KV client when a key change is detected.  The version is the store revision at
+// which the key was changed, as the version of a KVPair, or 0 when the store does not report it.
 type Event struct {
 	EventType int
 	Key       interface{}
 	Value     interface{}
+	Version   int64
 }
 
 // NewEvent creates a new Event object
@@ -73,16 +133,34 @@ func NewEvent(eventType int, key interface{}, value interface{}) *Event {
 	return evnt
 }
 
-// Client represents the set of APIs  a KV Client must implement
+// Client represents the set of APIs  a KV Client must implement.  Every implementation behaves the same way, as
+// verified by the conformance suite run against each of them:
+//   - Delete, List and Watch apply to every key with the given prefix
+//   - Reserve only succeeds on a key which does not exist.  The reservation belongs to the client which made
+//     it; another client reserving the same key with the same value gets that value back but cannot renew
+//     or release the reservation.  Each reservation expires, is renewed and is released independently, and the
+//     key is removed when its reservation expires or is released.
+//   - A watch delivers the changes of a key in the order in which they were made, although the changes made
+//     in quick succession may be coalesced into the last one.  A CONNECTIONDOWN event is pushed when the watch
+//     loses its connection to the KV store.
+//   - Txn rejects with ErrTxnTooLarge, without applying any of them, more operations than MaxTxnOps.  A
+//     MaxTxnOps of 0 means the number of operations is not limited.
 type Client interface {
 	List(key string, timeout int) (map[string]*KVPair, error)
+	ListPage(key string, options *ListOptions, timeout int) (*KVPage, error)
 	Get(key string, timeout int) (*KVPair, error)
 	Put(key string, value interface{}, timeout int) error
 	Delete(key string, timeout int) error
+	PutIfVersion(key string, value interface{}, version int64, timeout int) (int64, error)
+	DeleteIfVersion(key string, version int64, timeout int) error
+	Txn(ops []*TxnOp, timeout int) (int64, error)
+	MaxTxnOps() int
 	Reserve(key string, value interface{}, ttl int64) (interface{}, error)
 	ReleaseReservation(key string) error
 	ReleaseAllReservations() error
 	RenewReservation(key string) error
+	Lock(key string, ttl int64, timeout int) (int64, error)
+	Unlock(key string) error
 	Watch(key string) chan *Event
 	CloseWatch(key string, ch chan *Event)
 	Close()
@@ -0,0 +1,548 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conformanceHarness describes how to run the conformance suite against an implementation of the Client interface
+type conformanceHarness struct {
+	// newClient returns a new client of the store under test.  All the clients of a harness share the same store.
+	newClient func(t *testing.T) Client
+	// ttl is the reservation ttl used by the suite; it must be honoured by the store
+	ttl int64
+	// expiryTimeout bounds the time taken by the store to remove a key once its reservation ttl is over
+	expiryTimeout time.Duration
+	// interrupt, when set, cuts the connection between the clients and the store
+	interrupt func()
+}
+
+// runConformanceSuite verifies that a Client implementation honours the contract shared by all the KV stores
+func runConformanceSuite(t *testing.T, h *conformanceHarness) {
+	// Keys are unique to a run so that a shared server may be reused
+	prefix := fmt.Sprintf("conformance-%d/", time.Now().UnixNano())
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h *conformanceHarness, prefix string)
+	}{
+		{"PutGetDelete", conformancePutGetDelete},
+		{"ListAndListPage", conformanceList},
+		{"ConditionalWrites", conformanceConditionalWrites},
+		{"LargeTxn", conformanceLargeTxn},
+		{"WatchOrdering", conformanceWatchOrdering},
+		{"ReservationOwnership", conformanceReservationOwnership},
+		{"ReservationsAreIndependent", conformanceReservationsAreIndependent},
+		{"ReservationExpiry", conformanceReservationExpiry},
+		{"ReservationRenewal", conformanceReservationRenewal},
+		{"ReleaseAllReservations", conformanceReleaseAllReservations},
+		{"ConcurrentPutDelete", conformanceConcurrentPutDelete},
+		// Last, as the connection to the store is not restored
+		{"ConnectionDown", conformanceConnectionDown},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, h, prefix+test.name+"/")
+		})
+	}
+}
+
+func newConformanceClient(t *testing.T, h *conformanceHarness) Client {
+	client := h.newClient(t)
+	if client == nil {
+		t.Fatal("no client created")
+	}
+	return client
+}
+
+func waitForKeyRemoval(t *testing.T, client Client, key string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		kvp, err := client.Get(key, 0)
+		assert.Nil(t, err)
+		if kvp == nil {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+// waitForWatchedValue returns the values pushed for a key until the expected one is seen
+func waitForWatchedValue(t *testing.T, ch chan *Event, key string, expected string) []string {
+	var values []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-ch:
+			eventKey, err := ToString(event.Key)
+			assert.Nil(t, err)
+			if event.EventType != PUT || eventKey != key {
+				continue
+			}
+			value, err := ToString(event.Value)
+			assert.Nil(t, err)
+			values = append(values, value)
+			if value == expected {
+				return values
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for value %s of key %s, received %v", expected, key, values)
+			return values
+		}
+	}
+}
+
+func conformancePutGetDelete(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	assert.Nil(t, client.Put(prefix+"a", "one", 0))
+	assert.Nil(t, client.Put(prefix+"ab", []byte("two"), 0))
+
+	kvp, err := client.Get(prefix+"a", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, prefix+"a", kvp.Key)
+	assert.Equal(t, []byte("one"), kvp.Value)
+	assert.NotEqual(t, int64(0), kvp.Version)
+
+	kvp, err = client.Get(prefix+"missing", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+
+	// Delete applies to every key with the prefix
+	assert.Nil(t, client.Delete(prefix+"a", 0))
+	for _, key := range []string{prefix + "a", prefix + "ab"} {
+		kvp, err = client.Get(key, 0)
+		assert.Nil(t, err)
+		assert.Nil(t, kvp)
+	}
+	assert.Nil(t, client.Delete(prefix+"missing", 0))
+}
+
+func conformanceList(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, client.Put(fmt.Sprintf("%sdevices/%d", prefix, i), fmt.Sprintf("device-%d", i), 0))
+	}
+	assert.Nil(t, client.Put(prefix+"ports/0", "port-0", 0))
+
+	pairs, err := client.List(prefix+"devices/", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(pairs))
+
+	var keys []string
+	options := &ListOptions{Limit: 2}
+	for {
+		page, err := client.ListPage(prefix+"devices/", options, 0)
+		assert.Nil(t, err)
+		assert.True(t, len(page.Pairs) <= 2)
+		for _, pair := range page.Pairs {
+			keys = append(keys, pair.Key)
+			assert.Equal(t, pairs[pair.Key].Value, pair.Value)
+		}
+		if page.NextKey == "" {
+			break
+		}
+		options.StartKey = page.NextKey
+	}
+	assert.Equal(t, 5, len(keys))
+	assert.True(t, sort.StringsAreSorted(keys))
+}
+
+func conformanceConditionalWrites(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+	key := prefix + "key"
+
+	version, err := client.PutIfVersion(key, "v1", 0, 0)
+	assert.Nil(t, err)
+	_, err = client.PutIfVersion(key, "v2", 0, 0)
+	assert.Equal(t, ErrVersionMismatch, err)
+	newVersion, err := client.PutIfVersion(key, "v2", version, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrVersionMismatch, client.DeleteIfVersion(key, version, 0))
+
+	// A failed check aborts the whole transaction
+	_, err = client.Txn([]*TxnOp{
+		NewTxnOp(TXN_PUT, prefix+"other", "value", AnyVersion),
+		NewTxnOp(TXN_CHECK, key, nil, version),
+	}, 0)
+	assert.Equal(t, ErrVersionMismatch, err)
+	kvp, err := client.Get(prefix+"other", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+
+	assert.Nil(t, client.DeleteIfVersion(key, newVersion, 0))
+	kvp, err = client.Get(key, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+}
+
+func conformanceLargeTxn(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	newOps := func(count int) []*TxnOp {
+		ops := make([]*TxnOp, count)
+		for i := range ops {
+			ops[i] = NewTxnOp(TXN_PUT, fmt.Sprintf("%skey-%03d", prefix, i), "value", AnyVersion)
+		}
+		return ops
+	}
+
+	// More operations than the 64 of a consul transaction
+	count := 65
+	if max := client.MaxTxnOps(); max > 0 && max < count {
+		_, err := client.Txn(newOps(count), 0)
+		assert.Equal(t, ErrTxnTooLarge, err)
+		page, err := client.ListPage(prefix, &ListOptions{KeysOnly: true}, 0)
+		assert.Nil(t, err)
+		assert.Empty(t, page.Pairs)
+		count = max
+	} else if max > 0 {
+		_, err := client.Txn(newOps(max+1), 0)
+		assert.Equal(t, ErrTxnTooLarge, err)
+	}
+
+	_, err := client.Txn(newOps(count), 0)
+	assert.Nil(t, err)
+	page, err := client.ListPage(prefix, &ListOptions{KeysOnly: true}, 0)
+	assert.Nil(t, err)
+	assert.Len(t, page.Pairs, count)
+}
+
+func conformanceWatchOrdering(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+	key := prefix + "key"
+
+	ch := client.Watch(prefix)
+	defer client.CloseWatch(prefix, ch)
+	// Give the watch time to be established by the store
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, client.Put(key, fmt.Sprintf("v%d", i), 0))
+	}
+	values := waitForWatchedValue(t, ch, key, "v9")
+	// Changes may be coalesced but never reordered
+	previous := -1
+	for _, value := range values {
+		var index int
+		fmt.Sscanf(value, "v%d", &index)
+		assert.True(t, index > previous, "out of order values %v", values)
+		previous = index
+	}
+
+	// Keys created under the watched prefix are reported, as are deletions
+	assert.Nil(t, client.Put(prefix+"other", "created", 0))
+	waitForWatchedValue(t, ch, prefix+"other", "created")
+	assert.Nil(t, client.Delete(key, 0))
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-ch:
+			eventKey, _ := ToString(event.Key)
+			if event.EventType == DELETE && eventKey == key {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for delete event")
+			return
+		}
+	}
+}
+
+func conformanceReservationOwnership(t *testing.T, h *conformanceHarness, prefix string) {
+	owner := newConformanceClient(t, h)
+	defer owner.Close()
+	other := newConformanceClient(t, h)
+	defer other.Close()
+	key := prefix + "key"
+
+	value, err := owner.Reserve(key, "owner", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "owner"))
+
+	// The owner may reserve its key again
+	value, err = owner.Reserve(key, "owner", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "owner"))
+	assert.Nil(t, owner.RenewReservation(key))
+
+	value, err = other.Reserve(key, "other", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "owner"))
+
+	// Holding the same value does not transfer the ownership
+	value, err = other.Reserve(key, "owner", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "owner"))
+	assert.NotNil(t, other.RenewReservation(key))
+	assert.NotNil(t, other.ReleaseReservation(key))
+	kvp, err := owner.Get(key, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, kvp)
+
+	// A key which already exists cannot be reserved
+	assert.Nil(t, owner.Put(prefix+"plain", "plain", 0))
+	value, err = other.Reserve(prefix+"plain", "other", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "plain"))
+	assert.NotNil(t, other.ReleaseReservation(prefix+"plain"))
+
+	// Releasing removes the key, which can then be reserved by someone else
+	assert.Nil(t, owner.ReleaseReservation(key))
+	kvp, err = owner.Get(key, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+	value, err = other.Reserve(key, "other", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "other"))
+	assert.Nil(t, other.ReleaseReservation(key))
+}
+
+func conformanceReservationsAreIndependent(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	for _, key := range []string{prefix + "first", prefix + "second"} {
+		value, err := client.Reserve(key, "value", h.ttl)
+		assert.Nil(t, err)
+		assert.True(t, isEqual(value, "value"))
+	}
+	assert.Nil(t, client.ReleaseReservation(prefix+"first"))
+
+	kvp, err := client.Get(prefix+"second", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, kvp)
+	assert.Nil(t, client.RenewReservation(prefix+"second"))
+	assert.Nil(t, client.ReleaseReservation(prefix+"second"))
+}
+
+func conformanceReservationExpiry(t *testing.T, h *conformanceHarness, prefix string) {
+	owner := newConformanceClient(t, h)
+	defer owner.Close()
+	other := newConformanceClient(t, h)
+	defer other.Close()
+	key := prefix + "key"
+
+	value, err := owner.Reserve(key, "owner", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "owner"))
+
+	assert.True(t, waitForKeyRemoval(t, other, key, h.expiryTimeout), "reservation did not expire")
+	assert.NotNil(t, owner.RenewReservation(key))
+
+	value, err = other.Reserve(key, "other", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "other"))
+	assert.Nil(t, other.ReleaseReservation(key))
+}
+
+func conformanceReservationRenewal(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+	key := prefix + "key"
+
+	value, err := client.Reserve(key, "value", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "value"))
+
+	ttl := time.Duration(h.ttl) * time.Second
+	deadline := time.Now().Add(2 * ttl)
+	for time.Now().Before(deadline) {
+		time.Sleep(ttl / 4)
+		assert.Nil(t, client.RenewReservation(key))
+	}
+	kvp, err := client.Get(key, 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, kvp, "renewed reservation expired")
+	assert.Nil(t, client.ReleaseReservation(key))
+}
+
+func conformanceReleaseAllReservations(t *testing.T, h *conformanceHarness, prefix string) {
+	owner := newConformanceClient(t, h)
+	defer owner.Close()
+	other := newConformanceClient(t, h)
+	defer other.Close()
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprintf("%skey-%d", prefix, i)
+		keys = append(keys, key)
+		value, err := owner.Reserve(key, "owner", h.ttl)
+		assert.Nil(t, err)
+		assert.True(t, isEqual(value, "owner"))
+	}
+	value, err := other.Reserve(prefix+"other", "other", h.ttl)
+	assert.Nil(t, err)
+	assert.True(t, isEqual(value, "other"))
+
+	assert.Nil(t, owner.ReleaseAllReservations())
+	for _, key := range keys {
+		kvp, err := other.Get(key, 0)
+		assert.Nil(t, err)
+		assert.Nil(t, kvp)
+		assert.NotNil(t, owner.RenewReservation(key))
+	}
+	// The reservations of other clients are left untouched
+	assert.Nil(t, other.RenewReservation(prefix+"other"))
+	assert.Nil(t, other.ReleaseAllReservations())
+}
+
+func conformanceConcurrentPutDelete(t *testing.T, h *conformanceHarness, prefix string) {
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	const workers = 8
+	const keysPerWorker = 10
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWorker; i++ {
+				key := fmt.Sprintf("%skeys/%d-%d", prefix, w, i)
+				assert.Nil(t, client.Put(key, "value", 0))
+				if i%2 == 0 {
+					assert.Nil(t, client.Delete(key, 0))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	pairs, err := client.List(prefix+"keys/", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, workers*keysPerWorker/2, len(pairs))
+
+	// Concurrent writers of the same key leave it with one of their values, which is the last one watched
+	key := prefix + "shared"
+	ch := client.Watch(key)
+	defer client.CloseWatch(key, ch)
+	time.Sleep(500 * time.Millisecond)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWorker; i++ {
+				assert.Nil(t, client.Put(key, fmt.Sprintf("%d-%d", w, i), 0))
+			}
+		}(w)
+	}
+	wg.Wait()
+	kvp, err := client.Get(key, 0)
+	assert.Nil(t, err)
+	final, err := ToString(kvp.Value)
+	assert.Nil(t, err)
+	waitForWatchedValue(t, ch, key, final)
+}
+
+func conformanceConnectionDown(t *testing.T, h *conformanceHarness, prefix string) {
+	if h.interrupt == nil {
+		t.Skip("connection cannot be interrupted")
+	}
+	client := newConformanceClient(t, h)
+	defer client.Close()
+
+	ch := client.Watch(prefix)
+	time.Sleep(500 * time.Millisecond)
+	h.interrupt()
+
+	timeout := time.After(2 * GetDuration(0))
+	for {
+		select {
+		case event := <-ch:
+			if event.EventType == CONNECTIONDOWN {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for connection down event")
+			return
+		}
+	}
+}
+
+// testProxy is a stand-in between the clients and a KV store server, forwarding TCP connections until it is
+// interrupted
+type testProxy struct {
+	listener net.Listener
+	target   string
+	mutex    sync.Mutex
+	conns    []net.Conn
+}
+
+func newTestProxy(t *testing.T, target string) *testProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProxy{listener: listener, target: target}
+	go p.serve()
+	return p
+}
+
+func (p *testProxy) addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *testProxy) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("tcp", p.target)
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		p.mutex.Lock()
+		p.conns = append(p.conns, conn, upstream)
+		p.mutex.Unlock()
+		go p.forward(conn, upstream)
+		go p.forward(upstream, conn)
+	}
+}
+
+func (p *testProxy) forward(dst net.Conn, src net.Conn) {
+	io.Copy(dst, src)
+	dst.Close()
+	src.Close()
+}
+
+// interrupt closes all the connections and refuses new ones
+func (p *testProxy) interrupt() {
+	p.listener.Close()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
@@ -19,7 +19,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	log "github.com/opencord/voltha-go/common/log"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 	//log "ciena.com/coordinator/common"
@@ -32,25 +35,49 @@ type channelContextMap struct {
 	cancel  context.CancelFunc
 }
 
+// maxConsulTxnOps is the largest number of operations consul accepts in a single transaction
+const maxConsulTxnOps = 64
+
 // ConsulClient represents the consul KV store client
 type ConsulClient struct {
-	session                *consulapi.Session
-	sessionID              string
 	consul                 *consulapi.Client
 	doneCh                 *chan int
-	keyReservations        map[string]interface{}
+	keyReservations        map[string]string
+	keyLocks               map[string]string
 	watchedChannelsContext map[string][]*channelContextMap
 	writeLock              sync.Mutex
 }
 
 // NewConsulClient returns a new client for the Consul KV store
 func NewConsulClient(addr string, timeout int) (*ConsulClient, error) {
+	return NewConsulClientWithSecurity(addr, timeout, nil)
+}
+
+// NewConsulClientWithSecurity returns a new client for the Consul KV store which connects over HTTPS and/or
+// presents an ACL token, as described by security
+func NewConsulClientWithSecurity(addr string, timeout int, security *SecurityConfig) (*ConsulClient, error) {
 
 	duration := GetDuration(timeout)
 
 	config := consulapi.DefaultConfig()
 	config.Address = addr
 	config.WaitTime = duration
+	if security != nil {
+		if security.TLSEnabled() {
+			if (security.CertFile == "") != (security.KeyFile == "") {
+				err := errors.New("cert-and-key-must-be-set-together")
+				log.Errorw("invalid-tls-config", log.Fields{"error": err})
+				return nil, err
+			}
+			config.Scheme = "https"
+			config.TLSConfig = consulapi.TLSConfig{
+				CAFile:   security.CAFile,
+				CertFile: security.CertFile,
+				KeyFile:  security.KeyFile,
+			}
+		}
+		config.Token = security.Token
+	}
 	consul, err := consulapi.NewClient(config)
 	if err != nil {
 		log.Error(err)
@@ -59,8 +86,9 @@ func NewConsulClient(addr string, timeout int) (*ConsulClient, error) {
 
 	doneCh := make(chan int, 1)
 	wChannelsContext := make(map[string][]*channelContextMap)
-	reservations := make(map[string]interface{})
-	return &ConsulClient{consul: consul, doneCh: &doneCh, watchedChannelsContext: wChannelsContext, keyReservations: reservations}, nil
+	reservations := make(map[string]string)
+	return &ConsulClient{consul: consul, doneCh: &doneCh, watchedChannelsContext: wChannelsContext, keyReservations: reservations,
+		keyLocks: make(map[string]string)}, nil
 }
 
 // List returns an array of key-value pairs with key as a prefix.  Timeout defines how long the function will
@@ -79,11 +107,89 @@ func (c *ConsulClient) List(key string, timeout int) (map[string]*KVPair, error)
 	}
 	m := make(map[string]*KVPair)
 	for _, kvp := range kvps {
-		m[string(kvp.Key)] = NewKVPair(string(kvp.Key), kvp.Value, string(kvp.Session), 0)
+		pair := NewKVPair(string(kvp.Key), kvp.Value, string(kvp.Session), 0)
+		pair.Version = int64(kvp.ModifyIndex)
+		m[string(kvp.Key)] = pair
 	}
 	return m, nil
 }
 
+// ListPage returns a page of the key-value pairs with key as a prefix, sorted by key.  Consul cannot limit a
+// listing, so the keys are retrieved first and the values of the page are then read in batches of
+// transactions.  Timeout defines how long the function will wait for a response
+func (c *ConsulClient) ListPage(key string, options *ListOptions, timeout int) (*KVPage, error) {
+	duration := GetDuration(timeout)
+
+	kv := c.consul.KV()
+	var queryOptions consulapi.QueryOptions
+	queryOptions.WaitTime = duration
+	keys, _, err := kv.Keys(key, "", &queryOptions)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	sort.Strings(keys)
+	selected, nextKey := PageKeys(keys, options)
+
+	page := &KVPage{Pairs: make([]*KVPair, 0, len(selected)), NextKey: nextKey}
+	if options != nil && options.KeysOnly {
+		for _, k := range selected {
+			page.Pairs = append(page.Pairs, NewKVPair(k, nil, "", 0))
+		}
+		return page, nil
+	}
+	for start := 0; start < len(selected); start += maxConsulTxnOps {
+		end := start + maxConsulTxnOps
+		if end > len(selected) {
+			end = len(selected)
+		}
+		pairs, err := c.getBatch(selected[start:end], &queryOptions)
+		if err != nil {
+			return nil, err
+		}
+		page.Pairs = append(page.Pairs, pairs...)
+	}
+	return page, nil
+}
+
+// getBatch reads a set of keys in a single transaction.  If one of the keys was removed since it was listed
+// the transaction fails, in which case the keys are read one by one and the missing ones are skipped.
+func (c *ConsulClient) getBatch(keys []string, queryOptions *consulapi.QueryOptions) ([]*KVPair, error) {
+	kv := c.consul.KV()
+	var txnOps consulapi.KVTxnOps
+	for _, k := range keys {
+		txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVGet, Key: k})
+	}
+	var kvps []*consulapi.KVPair
+	ok, response, _, err := kv.Txn(txnOps, queryOptions)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if ok {
+		kvps = response.Results
+	} else {
+		log.Debugw("batch-get-fallback", log.Fields{"keys": len(keys)})
+		for _, k := range keys {
+			kvp, _, err := kv.Get(k, queryOptions)
+			if err != nil {
+				log.Error(err)
+				return nil, err
+			}
+			if kvp != nil {
+				kvps = append(kvps, kvp)
+			}
+		}
+	}
+	pairs := make([]*KVPair, 0, len(kvps))
+	for _, kvp := range kvps {
+		pair := NewKVPair(string(kvp.Key), kvp.Value, string(kvp.Session), 0)
+		pair.Version = int64(kvp.ModifyIndex)
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
 // Get returns a key-value pair for a given key. Timeout defines how long the function will
 // wait for a response
 func (c *ConsulClient) Get(key string, timeout int) (*KVPair, error) {
@@ -100,7 +206,9 @@ func (c *ConsulClient) Get(key string, timeout int) (*KVPair, error) {
 		return nil, err
 	}
 	if kvp != nil {
-		return NewKVPair(string(kvp.Key), kvp.Value, string(kvp.Session), 0), nil
+		pair := NewKVPair(string(kvp.Key), kvp.Value, string(kvp.Session), 0)
+		pair.Version = int64(kvp.ModifyIndex)
+		return pair, nil
 	}
 
 	return nil, nil
@@ -140,7 +248,8 @@ func (c *ConsulClient) Delete(key string, timeout int) error {
 	var writeOptions consulapi.WriteOptions
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
-	_, err := kv.Delete(key, &writeOptions)
+	// Like etcd, remove every key with the prefix
+	_, err := kv.DeleteTree(key, &writeOptions)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -148,24 +257,156 @@ func (c *ConsulClient) Delete(key string, timeout int) error {
 	return nil
 }
 
-func (c *ConsulClient) deleteSession() {
-	if c.sessionID != "" {
-		log.Debug("cleaning-up-session")
-		session := c.consul.Session()
-		_, err := session.Destroy(c.sessionID, nil)
-		if err != nil {
-			log.Errorw("error-cleaning-session", log.Fields{"session": c.sessionID, "error": err})
+// PutIfVersion writes a key-value pair to the KV store only if the key is at the specified version, a version
+// of 0 meaning the key must not exist.  The new version of the key is returned on success and
+// ErrVersionMismatch when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *ConsulClient) PutIfVersion(key string, value interface{}, version int64, timeout int) (int64, error) {
+	var val []byte
+	var er error
+	if val, er = ToByte(value); er != nil {
+		log.Error(er)
+		return 0, er
+	}
+
+	kvp := consulapi.KVPair{Key: key, Value: val, ModifyIndex: uint64(version)}
+	kv := c.consul.KV()
+	var writeOptions consulapi.WriteOptions
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	result, _, err := kv.CAS(&kvp, &writeOptions)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	if !result {
+		log.Debugw("conditional-put-version-mismatch", log.Fields{"key": key, "version": version})
+		return 0, ErrVersionMismatch
+	}
+
+	// Consul does not return the index of a write; read it back
+	var queryOptions consulapi.QueryOptions
+	queryOptions.WaitTime = GetDuration(timeout)
+	pair, _, err := kv.Get(key, &queryOptions)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	if pair == nil {
+		return 0, ErrVersionMismatch
+	}
+	return int64(pair.ModifyIndex), nil
+}
+
+// DeleteIfVersion removes a key from the KV store only if it is at the specified version.  ErrVersionMismatch
+// is returned when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *ConsulClient) DeleteIfVersion(key string, version int64, timeout int) error {
+	kvp := consulapi.KVPair{Key: key, ModifyIndex: uint64(version)}
+	kv := c.consul.KV()
+	var writeOptions consulapi.WriteOptions
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	result, _, err := kv.DeleteCAS(&kvp, &writeOptions)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if !result {
+		log.Debugw("conditional-delete-version-mismatch", log.Fields{"key": key, "version": version})
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// Txn atomically applies a list of operations.  Either all the operations are applied or, when one of the
+// keys is not at its expected version, none of them is and ErrVersionMismatch is returned.  The version of the
+// keys put by the transaction is returned.  Timeout defines how long the function will wait for a response
+func (c *ConsulClient) Txn(ops []*TxnOp, timeout int) (int64, error) {
+	var txnOps consulapi.KVTxnOps
+	for _, op := range ops {
+		switch op.Type {
+		case TXN_PUT:
+			val, err := ToByte(op.Value)
+			if err != nil {
+				log.Error(err)
+				return 0, err
+			}
+			if op.Version == AnyVersion {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVSet, Key: op.Key, Value: val})
+			} else {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVCAS, Key: op.Key, Value: val, Index: uint64(op.Version)})
+			}
+		case TXN_DELETE:
+			if op.Version == AnyVersion {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVDelete, Key: op.Key})
+			} else {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVDeleteCAS, Key: op.Key, Index: uint64(op.Version)})
+			}
+		case TXN_CHECK:
+			if op.Version == 0 {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVCheckNotExists, Key: op.Key})
+			} else if op.Version != AnyVersion {
+				txnOps = append(txnOps, &consulapi.KVTxnOp{Verb: consulapi.KVCheckIndex, Key: op.Key, Index: uint64(op.Version)})
+			}
+		default:
+			return 0, fmt.Errorf("unexpected-operation-%d", op.Type)
 		}
 	}
-	c.sessionID = ""
-	c.session = nil
+
+	if len(txnOps) > maxConsulTxnOps {
+		log.Warnw("transaction-too-large", log.Fields{"operations": len(txnOps), "max": maxConsulTxnOps})
+		return 0, ErrTxnTooLarge
+	}
+
+	kv := c.consul.KV()
+	var queryOptions consulapi.QueryOptions
+	queryOptions.WaitTime = GetDuration(timeout)
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	ok, response, _, err := kv.Txn(txnOps, &queryOptions)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	if !ok {
+		if response != nil {
+			log.Debugw("transaction-version-mismatch", log.Fields{"errors": response.Errors})
+		}
+		return 0, ErrVersionMismatch
+	}
+	// The keys written by a transaction are all at the index of the transaction
+	var version int64
+	for _, pair := range response.Results {
+		if pair != nil && int64(pair.ModifyIndex) > version {
+			version = int64(pair.ModifyIndex)
+		}
+	}
+	return version, nil
 }
 
-func (c *ConsulClient) createSession(ttl int64, retries int) (*consulapi.Session, string, error) {
+// MaxTxnOps returns the largest number of operations of a transaction
+func (c *ConsulClient) MaxTxnOps() int {
+	return maxConsulTxnOps
+}
+
+func (c *ConsulClient) destroySession(sessionID string) {
+	log.Debug("cleaning-up-session")
+	if _, err := c.consul.Session().Destroy(sessionID, nil); err != nil {
+		log.Errorw("error-cleaning-session", log.Fields{"session": sessionID, "error": err})
+	}
+}
+
+// createSession creates a session whose keys are removed when it is destroyed or expires.  Consul enforces a
+// minimum ttl of 10 seconds.
+func (c *ConsulClient) createSession(ttl int64, retries int) (string, error) {
+	if ttl < 10 {
+		ttl = 10
+	}
 	session := c.consul.Session()
 	entry := &consulapi.SessionEntry{
 		Behavior: consulapi.SessionBehaviorDelete,
-		TTL:      "10s", // strconv.FormatInt(ttl, 10) + "s", // disable ttl
+		TTL:      strconv.FormatInt(ttl, 10) + "s",
 	}
 
 	for {
@@ -173,20 +414,20 @@ func (c *ConsulClient) createSession(ttl int64, retries int) (*consulapi.Session
 		if err != nil {
 			log.Errorw("create-session-error", log.Fields{"error": err})
 			if retries == 0 {
-				return nil, "", err
+				return "", err
 			}
 		} else if meta.RequestTime == 0 {
 			log.Errorw("create-session-bad-meta-data", log.Fields{"meta-data": meta})
 			if retries == 0 {
-				return nil, "", errors.New("bad-meta-data")
+				return "", errors.New("bad-meta-data")
 			}
 		} else if id == "" {
 			log.Error("create-session-nil-id")
 			if retries == 0 {
-				return nil, "", errors.New("ID-nil")
+				return "", errors.New("ID-nil")
 			}
 		} else {
-			return session, id, nil
+			return id, nil
 		}
 		// If retry param is -1 we will retry indefinitely
 		if retries > 0 {
@@ -197,15 +438,82 @@ func (c *ConsulClient) createSession(ttl int64, retries int) (*consulapi.Session
 	}
 }
 
-// Helper function to verify mostly whether the content of two interface types are the same.  Focus is []byte and
-// string types
-func isEqual(val1 interface{}, val2 interface{}) bool {
-	b1, err := ToByte(val1)
-	b2, er := ToByte(val2)
-	if err == nil && er == nil {
-		return bytes.Equal(b1, b2)
+// Lock acquires an exclusive lock on a key, waiting up to timeout seconds for its current holder to release it.
+// The lock is held by a dedicated session and is therefore released once the ttl expires, consul enforcing a
+// minimum of 10 seconds, unless Unlock is invoked before.  The returned fencing token is the index at which the
+// lock was acquired; it increases with every acquisition, allowing writes made by a stale holder to be rejected.
+func (c *ConsulClient) Lock(key string, ttl int64, timeout int) (int64, error) {
+	if ttl < 10 {
+		ttl = 10
+	}
+	session := c.consul.Session()
+	entry := &consulapi.SessionEntry{
+		Behavior: consulapi.SessionBehaviorDelete,
+		TTL:      strconv.FormatInt(ttl, 10) + "s",
+		// Stale holders are detected through the fencing token; no need to delay the next holder
+		LockDelay: time.Millisecond,
+	}
+	sessionID, _, err := session.Create(entry, nil)
+	if err != nil {
+		log.Errorw("create-session-error", log.Fields{"error": err})
+		return 0, err
+	}
+
+	kv := c.consul.KV()
+	deadline := time.Now().Add(GetDuration(timeout))
+	for {
+		acquired, _, err := kv.Acquire(&consulapi.KVPair{Key: key, Session: sessionID}, nil)
+		if err != nil {
+			log.Errorw("lock-failed", log.Fields{"key": key, "error": err})
+			session.Destroy(sessionID, nil)
+			return 0, err
+		}
+
+		pair, meta, err := kv.Get(key, nil)
+		if err != nil {
+			log.Errorw("lock-failed", log.Fields{"key": key, "error": err})
+			session.Destroy(sessionID, nil)
+			return 0, err
+		}
+		if acquired && pair != nil && pair.Session == sessionID {
+			c.writeLock.Lock()
+			c.keyLocks[key] = sessionID
+			c.writeLock.Unlock()
+			log.Debugw("lock-acquired", log.Fields{"key": key, "token": pair.ModifyIndex})
+			return int64(pair.ModifyIndex), nil
+		}
+
+		// Wait for the current holder to release the lock
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Debugw("lock-timeout", log.Fields{"key": key})
+			session.Destroy(sessionID, nil)
+			return 0, ErrLockTimeout
+		}
+		if pair != nil {
+			queryOptions := &consulapi.QueryOptions{WaitIndex: meta.LastIndex, WaitTime: remaining}
+			if _, _, err = kv.Get(key, queryOptions); err != nil {
+				log.Warnw("lock-wait-failed", log.Fields{"key": key, "error": err})
+			}
+		}
 	}
-	return val1 == val2
+}
+
+// Unlock releases a lock previously acquired with Lock
+func (c *ConsulClient) Unlock(key string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	sessionID, ok := c.keyLocks[key]
+	if !ok {
+		return errors.New("key-not-locked")
+	}
+	delete(c.keyLocks, key)
+	// The session behavior removes the key along with the session
+	if _, err := c.consul.Session().Destroy(sessionID, nil); err != nil {
+		log.Errorw("cannot-release-lock", log.Fields{"key": key, "error": err})
+		return err
+	}
+	return nil
 }
 
 // Reserve is invoked to acquire a key and set it to a given value. Value can only be a string or []byte since
@@ -223,55 +531,55 @@ func (c *ConsulClient) Reserve(key string, value interface{}, ttl int64) (interf
 		return nil, er
 	}
 
-	// Cleanup any existing session and recreate new ones.  A key is reserved against a session
-	if c.sessionID != "" {
-		c.deleteSession()
-	}
-
-	// Clear session if reservation is not successful
-	reservationSuccessful := false
-	defer func() {
-		if !reservationSuccessful {
-			log.Debug("deleting-session")
-			c.deleteSession()
-		}
-	}()
-
-	session, sessionID, err := c.createSession(ttl, -1)
+	// Each reservation is held by its own session so that reservations expire, are renewed and are released
+	// independently of each other
+	sessionID, err := c.createSession(ttl, -1)
 	if err != nil {
 		log.Errorw("no-session-created", log.Fields{"error": err})
 		return "", errors.New("no-session-created")
 	}
 	log.Debugw("session-created", log.Fields{"session-id": sessionID})
-	c.sessionID = sessionID
-	c.session = session
 
-	// Try to grap the Key using the session
+	// Try to grap the Key using the session.  Like a reservation made in etcd, it only succeeds if the key
+	// does not exist yet.
 	kv := c.consul.KV()
-	kvp := consulapi.KVPair{Key: key, Value: val, Session: c.sessionID}
-	result, _, err := kv.Acquire(&kvp, nil)
+	txnOps := consulapi.KVTxnOps{
+		&consulapi.KVTxnOp{Verb: consulapi.KVCheckNotExists, Key: key},
+		&consulapi.KVTxnOp{Verb: consulapi.KVLock, Key: key, Value: val, Session: sessionID},
+	}
+	acquired, _, _, err := kv.Txn(txnOps, nil)
 	if err != nil {
 		log.Errorw("error-acquiring-keys", log.Fields{"error": err})
+		c.destroySession(sessionID)
 		return nil, err
 	}
 
-	log.Debugw("key-acquired", log.Fields{"key": key, "status": result})
+	log.Debugw("key-acquired", log.Fields{"key": key, "status": acquired})
+
+	if acquired {
+		// My reservation is successful - register it.  For now, support is only for 1 reservation per key
+		// per session.
+		c.writeLock.Lock()
+		c.keyReservations[key] = sessionID
+		c.writeLock.Unlock()
+		return value, nil
+	}
 
-	// Irrespective whether we were successful in acquiring the key, let's read it back and see if it's us.
+	// The key is already reserved; the new session is not needed
+	c.destroySession(sessionID)
 	m, err := c.Get(key, defaultKVGetTimeout)
 	if err != nil {
 		return nil, err
 	}
 	if m != nil {
 		log.Debugw("response-received", log.Fields{"key": m.Key, "m.value": string(m.Value.([]byte)), "value": value})
-		if m.Key == key && isEqual(m.Value, value) {
-			// My reservation is successful - register it.  For now, support is only for 1 reservation per key
-			// per session.
-			reservationSuccessful = true
-			c.writeLock.Lock()
-			c.keyReservations[key] = m.Value
-			c.writeLock.Unlock()
-			return m.Value, nil
+		// Verify whether we are already the owner of that Key.  Another client holding the same value does
+		// not make this client the owner.
+		c.writeLock.Lock()
+		ownSessionID, owned := c.keyReservations[key]
+		c.writeLock.Unlock()
+		if owned && m.Session == ownSessionID && isEqual(m.Value, value) {
+			return value, nil
 		}
 		// My reservation has failed.  Return the owner of that key
 		return m.Value, nil
@@ -281,24 +589,16 @@ func (c *ConsulClient) Reserve(key string, value interface{}, ttl int64) (interf
 
 // ReleaseAllReservations releases all key reservations previously made (using Reserve API)
 func (c *ConsulClient) ReleaseAllReservations() error {
-	kv := c.consul.KV()
-	var kvp consulapi.KVPair
-	var result bool
-	var err error
-
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
 
-	for key, value := range c.keyReservations {
-		kvp = consulapi.KVPair{Key: key, Value: value.([]byte), Session: c.sessionID}
-		result, _, err = kv.Release(&kvp, nil)
-		if err != nil {
+	session := c.consul.Session()
+	for key, sessionID := range c.keyReservations {
+		// The session behavior removes the key along with the session
+		if _, err := session.Destroy(sessionID, nil); err != nil {
 			log.Errorw("cannot-release-reservation", log.Fields{"key": key, "error": err})
 			return err
 		}
-		if !result {
-			log.Errorw("cannot-release-reservation", log.Fields{"key": key})
-		}
 		delete(c.keyReservations, key)
 	}
 	return nil
@@ -307,26 +607,18 @@ func (c *ConsulClient) ReleaseAllReservations() error {
 // ReleaseReservation releases reservation for a specific key.
 func (c *ConsulClient) ReleaseReservation(key string) error {
 	var ok bool
-	var reservedValue interface{}
+	var sessionID string
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
-	if reservedValue, ok = c.keyReservations[key]; !ok {
+	if sessionID, ok = c.keyReservations[key]; !ok {
 		return errors.New("key-not-reserved:" + key)
 	}
-	// Release the reservation
-	kv := c.consul.KV()
-	kvp := consulapi.KVPair{Key: key, Value: reservedValue.([]byte), Session: c.sessionID}
-
-	result, _, er := kv.Release(&kvp, nil)
-	if er != nil {
-		return er
-	}
-	// Remove that key entry on success
-	if result {
-		delete(c.keyReservations, key)
-		return nil
+	// Release the reservation.  The session behavior removes the key along with the session
+	if _, err := c.consul.Session().Destroy(sessionID, nil); err != nil {
+		return err
 	}
-	return errors.New("key-cannot-be-unreserved")
+	delete(c.keyReservations, key)
+	return nil
 }
 
 // RenewReservation renews a reservation.  A reservation will go stale after the specified TTL (Time To Live)
@@ -338,18 +630,20 @@ func (c *ConsulClient) RenewReservation(key string) error {
 	defer c.writeLock.Unlock()
 
 	// Verify the key was reserved
-	if _, ok := c.keyReservations[key]; !ok {
+	sessionID, ok := c.keyReservations[key]
+	if !ok {
 		return errors.New("key-not-reserved")
 	}
 
-	if c.session == nil {
-		return errors.New("no-session-exist")
-	}
-
 	var writeOptions consulapi.WriteOptions
-	if _, _, err := c.session.Renew(c.sessionID, &writeOptions); err != nil {
+	entry, _, err := c.consul.Session().Renew(sessionID, &writeOptions)
+	if err != nil {
 		return err
 	}
+	if entry == nil {
+		// Consul reports an unknown session without an error
+		return errors.New("lease-expired")
+	}
 	return nil
 }
 
@@ -392,9 +686,8 @@ func (c *ConsulClient) CloseWatch(key string, ch chan *Event) {
 	for i, chCtxMap := range watchedChannelsContexts {
 		if chCtxMap.channel == ch {
 			log.Debug("channel-found")
+			// The channel is closed by its listener once it sees the context is done, as it may be sending onto it
 			chCtxMap.cancel()
-			//close the channel
-			close(ch)
 			pos = i
 			break
 		}
@@ -423,31 +716,38 @@ func (c *ConsulClient) isKVEqual(kv1 *consulapi.KVPair, kv2 *consulapi.KVPair) b
 	return true
 }
 
+// listenForKeyChange watches every key with the given prefix, like an etcd watch does.  Consul blocking queries
+// report the state reached after the latest change; changes made in between are coalesced.
 func (c *ConsulClient) listenForKeyChange(watchContext context.Context, key string, ch chan *Event) {
 	log.Debugw("start-watching-channel", log.Fields{"key": key, "channel": ch})
 
+	// Only the listener sends onto the channel, hence closes it
+	defer close(ch)
 	defer c.CloseWatch(key, ch)
 	duration := GetDuration(defaultKVGetTimeout)
 	kv := c.consul.KV()
 	var queryOptions consulapi.QueryOptions
 	queryOptions.WaitTime = duration
 
-	// Get the existing value, if any
-	previousKVPair, meta, err := kv.Get(key, &queryOptions)
+	// Get the existing values, if any
+	var lastIndex uint64
+	previousPairs := make(map[string]*consulapi.KVPair)
+	pairs, meta, err := kv.List(key, &queryOptions)
 	if err != nil {
 		log.Debug(err)
+	} else {
+		for _, pair := range pairs {
+			previousPairs[pair.Key] = pair
+		}
+		lastIndex = meta.LastIndex
 	}
-	lastIndex := meta.LastIndex
 
 	// Wait for change.  Push any change onto the channel and keep waiting for new update
-	//var waitOptions consulapi.QueryOptions
-	var pair *consulapi.KVPair
-	//watchContext, _ := context.WithCancel(context.Background())
+	connected := true
 	waitOptions := queryOptions.WithContext(watchContext)
 	for {
-		//waitOptions = consulapi.QueryOptions{WaitIndex: lastIndex}
 		waitOptions.WaitIndex = lastIndex
-		pair, meta, err = kv.Get(key, waitOptions)
+		pairs, meta, err = kv.List(key, waitOptions)
 		select {
 		case <-watchContext.Done():
 			log.Debug("done-event-received-exiting")
@@ -455,8 +755,13 @@ func (c *ConsulClient) listenForKeyChange(watchContext context.Context, key stri
 		default:
 			if err != nil {
 				log.Warnw("error-from-watch", log.Fields{"error": err})
-				ch <- NewEvent(CONNECTIONDOWN, key, []byte(""))
+				// Report the outage once, not at every attempt to reach the server
+				if connected && !c.sendEvent(watchContext, ch, NewEvent(CONNECTIONDOWN, key, []byte(""))) {
+					return
+				}
+				connected = false
 			} else {
+				connected = true
 				log.Debugw("index-state", log.Fields{"lastindex": lastIndex, "newindex": meta.LastIndex, "key": key})
 			}
 		}
@@ -467,21 +772,65 @@ func (c *ConsulClient) listenForKeyChange(watchContext context.Context, key stri
 		} else if meta.LastIndex <= lastIndex {
 			log.Info("no-index-change-or-negative")
 		} else {
-			log.Debugw("update-received", log.Fields{"pair": pair})
-			if pair == nil {
-				ch <- NewEvent(DELETE, key, []byte(""))
-			} else if !c.isKVEqual(pair, previousKVPair) {
-				// Push the change onto the channel if the data has changed
-				// For now just assume it's a PUT change
-				log.Debugw("pair-details", log.Fields{"session": pair.Session, "key": pair.Key, "value": pair.Value})
-				ch <- NewEvent(PUT, pair.Key, pair.Value)
+			currentPairs := make(map[string]*consulapi.KVPair)
+			for _, pair := range pairs {
+				currentPairs[pair.Key] = pair
 			}
-			previousKVPair = pair
+			for _, event := range c.diffPairs(previousPairs, currentPairs) {
+				if !c.sendEvent(watchContext, ch, event) {
+					return
+				}
+			}
+			previousPairs = currentPairs
 			lastIndex = meta.LastIndex
 		}
 	}
 }
 
+// sendEvent pushes an event onto a watch channel unless the watch is closed first, in which case false is returned
+func (c *ConsulClient) sendEvent(watchContext context.Context, ch chan *Event, event *Event) bool {
+	select {
+	case ch <- event:
+		return true
+	case <-watchContext.Done():
+		log.Debug("done-event-received-exiting")
+		return false
+	}
+}
+
+// diffPairs returns the events leading from the previous to the current content of a watched prefix.  Deletions
+// come first, followed by the modifications in the order in which they were made.
+func (c *ConsulClient) diffPairs(previousPairs map[string]*consulapi.KVPair,
+	currentPairs map[string]*consulapi.KVPair) []*Event {
+	var deleted []string
+	for key := range previousPairs {
+		if _, ok := currentPairs[key]; !ok {
+			deleted = append(deleted, key)
+		}
+	}
+	sort.Strings(deleted)
+	var modified []*consulapi.KVPair
+	for key, pair := range currentPairs {
+		if !c.isKVEqual(pair, previousPairs[key]) {
+			modified = append(modified, pair)
+		}
+	}
+	sort.Slice(modified, func(i, j int) bool {
+		return modified[i].ModifyIndex < modified[j].ModifyIndex
+	})
+
+	events := make([]*Event, 0, len(deleted)+len(modified))
+	for _, key := range deleted {
+		events = append(events, NewEvent(DELETE, key, []byte("")))
+	}
+	for _, pair := range modified {
+		event := NewEvent(PUT, pair.Key, pair.Value)
+		event.Version = int64(pair.ModifyIndex)
+		events = append(events, event)
+	}
+	return events
+}
+
 // Close closes the KV store client
 func (c *ConsulClient) Close() {
 	var writeOptions consulapi.WriteOptions
@@ -492,8 +841,17 @@ func (c *ConsulClient) Close() {
 		close(*c.doneCh)
 	}
 
-	// Clear the sessionID
-	if _, err := c.consul.Session().Destroy(c.sessionID, &writeOptions); err != nil {
-		log.Errorw("error-closing-client", log.Fields{"error": err})
+	// Clear the sessions, releasing the reservations and locks still held
+	for key, sessionID := range c.keyReservations {
+		if _, err := c.consul.Session().Destroy(sessionID, &writeOptions); err != nil {
+			log.Errorw("error-closing-client", log.Fields{"key": key, "error": err})
+		}
+		delete(c.keyReservations, key)
+	}
+	for key, sessionID := range c.keyLocks {
+		if _, err := c.consul.Session().Destroy(sessionID, &writeOptions); err != nil {
+			log.Errorw("error-closing-client", log.Fields{"key": key, "error": err})
+		}
+		delete(c.keyLocks, key)
 	}
 }
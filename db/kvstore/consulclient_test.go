@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"fmt"
+	"github.com/hashicorp/consul/testutil"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// consulTestAddrEnv holds the address of a consul agent to run the conformance suite against, e.g. localhost:8500.
+// A consul test agent, which requires the consul binary in the PATH, is started when it is not set.
+const consulTestAddrEnv = "VOLTHA_TEST_CONSUL_ADDR"
+
+// startConsulAgent returns the address of the consul agent the tests run against, and a function stopping it
+func startConsulAgent(t *testing.T) (string, func()) {
+	if addr := os.Getenv(consulTestAddrEnv); addr != "" {
+		return addr, func() {}
+	}
+	server, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.Stdout = ioutil.Discard
+		c.Stderr = ioutil.Discard
+	})
+	if err != nil {
+		t.Fatalf("cannot start the consul agent: %s", err)
+	}
+	return server.HTTPAddr, func() {
+		server.Stop()
+	}
+}
+
+func TestConsulClientConformance(t *testing.T) {
+	addr, stop := startConsulAgent(t)
+	defer stop()
+	// The clients reach the agent through a proxy so that the connection can be cut
+	proxy := newTestProxy(t, addr)
+	defer proxy.interrupt()
+	runConformanceSuite(t, &conformanceHarness{
+		newClient: func(t *testing.T) Client {
+			client, err := NewConsulClient(proxy.addr(), 5)
+			assert.Nil(t, err)
+			return client
+		},
+		// Consul enforces a minimum session ttl of 10 seconds and may take twice the ttl to expire a session
+		ttl:           10,
+		expiryTimeout: 30 * time.Second,
+		interrupt:     proxy.interrupt,
+	})
+}
+
+func TestConsulClientCloseWatchWhileSending(t *testing.T) {
+	addr, stop := startConsulAgent(t)
+	defer stop()
+	client, err := NewConsulClient(addr, 5)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	prefix := fmt.Sprintf("close-watch-%d/", time.Now().UnixNano())
+	ch := client.Watch(prefix)
+	time.Sleep(500 * time.Millisecond)
+
+	// More changes than the channel holds, made at once: the listener blocks sending them
+	var ops []*TxnOp
+	for i := 0; i < 2*maxClientChannelBufferSize; i++ {
+		ops = append(ops, NewTxnOp(TXN_PUT, fmt.Sprintf("%s%d", prefix, i), "value", AnyVersion))
+	}
+	_, err = client.Txn(ops, 0)
+	assert.Nil(t, err)
+	time.Sleep(500 * time.Millisecond)
+
+	client.CloseWatch(prefix, ch)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch channel not closed")
+		}
+	}
+}
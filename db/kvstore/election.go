@@ -0,0 +1,274 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	log "github.com/opencord/voltha-go/common/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidTTL is returned when creating an election whose leadership would not survive a second
+var ErrInvalidTTL = errors.New("invalid-ttl")
+
+// Separates the candidate from the nonce making each reservation of the election key unique, so that a
+// candidate does not take the reservation of another instance with the same id, or a stale one, for its own
+const reservationSeparator = "#"
+
+// Election allows a set of candidates, typically the voltha cores of a cluster, to elect a single leader
+// for a given key.  Leadership is held through a reservation of the key, i.e. an etcd lease or a consul
+// session, which is renewed periodically by the leader and expires when the leader goes away.
+//
+// Note that a consul client holds a single session, hence a consul client dedicated to the election
+// should be used when the same core also makes other reservations (e.g. transactions).
+type Election struct {
+	client    Client
+	key       string
+	candidate string
+	ttl       int64
+	mutex     sync.Mutex
+	leader    bool
+	resign    chan struct{}
+	done      chan struct{}
+}
+
+// NewElection creates an election on a key for a candidate.  The TTL, in seconds, defines how long the
+// leadership survives a leader which stopped renewing it and must be at least one second.
+func NewElection(client Client, key string, candidate string, ttl int64) (*Election, error) {
+	if ttl < 1 {
+		return nil, ErrInvalidTTL
+	}
+	return &Election{
+		client:    client,
+		key:       key,
+		candidate: candidate,
+		ttl:       ttl,
+	}, nil
+}
+
+// Campaign blocks until the candidate is elected leader or the context is done
+func (e *Election) Campaign(ctx context.Context) error {
+	for {
+		if e.IsLeader() {
+			return nil
+		}
+		elected, err := e.tryAcquire()
+		if err != nil {
+			log.Warnw("campaign-failed", log.Fields{"key": e.key, "candidate": e.candidate, "error": err})
+		} else if elected {
+			log.Infow("elected-leader", log.Fields{"key": e.key, "candidate": e.candidate})
+			return nil
+		}
+		if err := e.waitForVacancy(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Resign gives up the leadership, allowing another candidate to be elected
+func (e *Election) Resign() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.leader {
+		return errors.New("not-leader")
+	}
+	e.leader = false
+	close(e.resign)
+	close(e.done)
+	log.Infow("resigned-leadership", log.Fields{"key": e.key, "candidate": e.candidate})
+	return e.client.ReleaseReservation(e.key)
+}
+
+// IsLeader indicates whether the candidate currently holds the leadership
+func (e *Election) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leader
+}
+
+// Done returns a channel which is closed when the current leadership ends, either because the candidate
+// resigned or because it failed to renew it.  Nil is returned when the candidate is not the leader.
+func (e *Election) Done() <-chan struct{} {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if !e.leader {
+		return nil
+	}
+	return e.done
+}
+
+// Leader returns the current leader of the election, or an empty string when there is none
+func (e *Election) Leader() (string, error) {
+	kvp, err := e.client.Get(e.key, defaultKVGetTimeout)
+	if err != nil || kvp == nil {
+		return "", err
+	}
+	return candidateOf(kvp.Value)
+}
+
+// candidateOf returns the candidate holding a reservation of the election key
+func candidateOf(reservation interface{}) (string, error) {
+	value, err := ToString(reservation)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.LastIndex(value, reservationSeparator); i >= 0 {
+		value = value[:i]
+	}
+	return value, nil
+}
+
+// Observe returns a channel onto which the successive leaders of the election are pushed, starting with
+// the current one.  An empty string is pushed when the election has no leader.  The channel is closed
+// when the context is done.
+func (e *Election) Observe(ctx context.Context) <-chan string {
+	ch := make(chan string, maxClientChannelBufferSize)
+	events := e.client.Watch(e.key)
+	go e.observe(ctx, events, ch)
+	return ch
+}
+
+func (e *Election) observe(ctx context.Context, events chan *Event, ch chan string) {
+	defer close(ch)
+	defer e.client.CloseWatch(e.key, events)
+
+	current, err := e.Leader()
+	if err != nil {
+		log.Warnw("cannot-read-leader", log.Fields{"key": e.key, "error": err})
+	}
+	select {
+	case ch <- current:
+	case <-ctx.Done():
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			leader := ""
+			if event.EventType == PUT {
+				if leader, err = candidateOf(event.Value); err != nil {
+					continue
+				}
+			}
+			if leader == current {
+				continue
+			}
+			current = leader
+			select {
+			case ch <- current:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// tryAcquire attempts to reserve the election key and starts renewing the reservation when successful
+func (e *Election) tryAcquire() (bool, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return false, err
+	}
+	reservation := e.candidate + reservationSeparator + hex.EncodeToString(nonce)
+	value, err := e.client.Reserve(e.key, reservation, e.ttl)
+	if err != nil || value == nil {
+		return false, err
+	}
+	if owner, err := ToString(value); err != nil || owner != reservation {
+		return false, err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.leader = true
+	e.resign = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.keepAlive(e.resign)
+	return true, nil
+}
+
+// waitForVacancy returns when the election key is released, when its reservation may have expired, or
+// when the context is done
+func (e *Election) waitForVacancy(ctx context.Context) error {
+	events := e.client.Watch(e.key)
+	defer e.client.CloseWatch(e.key, events)
+
+	// The key may have been released before the watch was set
+	if kvp, err := e.client.Get(e.key, defaultKVGetTimeout); err == nil && kvp == nil {
+		return nil
+	}
+
+	timeout := time.After(time.Duration(e.ttl) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return nil
+		case event, ok := <-events:
+			if !ok || event.EventType == DELETE {
+				return nil
+			}
+		}
+	}
+}
+
+// keepAlive renews the reservation of the election key until the candidate resigns or the renewal fails
+func (e *Election) keepAlive(resign chan struct{}) {
+	interval := time.Duration(e.ttl) * time.Second / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-resign:
+			return
+		case <-ticker.C:
+			if err := e.client.RenewReservation(e.key); err != nil {
+				e.lost(resign, err)
+				return
+			}
+		}
+	}
+}
+
+// lost ends the leadership after a failed renewal, unless the candidate has resigned in the meantime
+func (e *Election) lost(resign chan struct{}, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	select {
+	case <-resign:
+		return
+	default:
+	}
+	log.Warnw("leadership-lost", log.Fields{"key": e.key, "candidate": e.candidate, "error": err})
+	e.leader = false
+	close(e.resign)
+	close(e.done)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func waitForLeader(t *testing.T, ch <-chan string) string {
+	select {
+	case leader := <-ch:
+		return leader
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for leader")
+	}
+	return ""
+}
+
+func newTestElection(t *testing.T, client Client, key string, candidate string, ttl int64) *Election {
+	e, err := NewElection(client, key, candidate, ttl)
+	if err != nil {
+		t.Fatalf("failed to create the election: %s", err)
+	}
+	return e
+}
+
+func TestElectionInvalidTTL(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	e, err := NewElection(client, "leader", "core1", 0)
+	assert.Nil(t, e)
+	assert.Equal(t, ErrInvalidTTL, err)
+}
+
+func TestElectionCampaignAndResign(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	e1 := newTestElection(t, client1, "leader", "core1", 2)
+	e2 := newTestElection(t, client2, "leader", "core2", 2)
+
+	assert.Nil(t, e1.Campaign(context.Background()))
+	assert.True(t, e1.IsLeader())
+	leader, err := e2.Leader()
+	assert.Nil(t, err)
+	assert.Equal(t, "core1", leader)
+
+	elected := make(chan error, 1)
+	go func() {
+		elected <- e2.Campaign(context.Background())
+	}()
+
+	select {
+	case <-elected:
+		t.Fatal("second candidate elected while the first holds the leadership")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	done := e1.Done()
+	assert.Nil(t, e1.Resign())
+	assert.False(t, e1.IsLeader())
+	_, open := <-done
+	assert.False(t, open)
+
+	select {
+	case err := <-elected:
+		assert.Nil(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("second candidate not elected")
+	}
+	assert.True(t, e2.IsLeader())
+	assert.Nil(t, e2.Resign())
+	assert.NotNil(t, e2.Resign())
+}
+
+func TestElectionCampaignCancelled(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	e1 := newTestElection(t, client1, "leader", "core1", 2)
+	assert.Nil(t, e1.Campaign(context.Background()))
+	defer e1.Resign()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	e2 := newTestElection(t, client2, "leader", "core2", 2)
+	assert.Equal(t, context.DeadlineExceeded, e2.Campaign(ctx))
+	assert.False(t, e2.IsLeader())
+}
+
+func TestElectionKeepsLeadership(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	e := newTestElection(t, client, "leader", "core1", 1)
+	assert.Nil(t, e.Campaign(context.Background()))
+	time.Sleep(1500 * time.Millisecond)
+	assert.True(t, e.IsLeader())
+	leader, err := e.Leader()
+	assert.Nil(t, err)
+	assert.Equal(t, "core1", leader)
+	assert.Nil(t, e.Resign())
+}
+
+func TestElectionObserve(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e1 := newTestElection(t, client1, "leader", "core1", 2)
+	ch := newTestElection(t, client2, "leader", "core2", 2).Observe(ctx)
+	assert.Equal(t, "", waitForLeader(t, ch))
+
+	assert.Nil(t, e1.Campaign(context.Background()))
+	assert.Equal(t, "core1", waitForLeader(t, ch))
+	assert.Nil(t, e1.Resign())
+	assert.Equal(t, "", waitForLeader(t, ch))
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestElectionSameCandidate(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	// Two instances of the same candidate, e.g. a core restarted while its reservation has not expired
+	e1 := newTestElection(t, client1, "leader", "core1", 2)
+	assert.Nil(t, e1.Campaign(context.Background()))
+	defer e1.Resign()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	e2 := newTestElection(t, client2, "leader", "core1", 2)
+	assert.Equal(t, context.DeadlineExceeded, e2.Campaign(ctx))
+	assert.False(t, e2.IsLeader())
+
+	leader, err := e2.Leader()
+	assert.Nil(t, err)
+	assert.Equal(t, "core1", leader)
+}
@@ -28,31 +28,54 @@ import (
 	"sync"
 )
 
+// maxEtcdTxnOps is the largest number of operations etcd accepts in a single transaction, unless its
+// --max-txn-ops option is raised
+const maxEtcdTxnOps = 128
+
 // EtcdClient represents the Etcd KV store client
 type EtcdClient struct {
 	ectdAPI         *v3Client.Client
 	leaderRev       v3Client.Client
 	keyReservations map[string]*v3Client.LeaseID
+	keyLocks        map[string]v3Client.LeaseID
 	watchedChannels map[string][]map[chan *Event]v3Client.Watcher
 	writeLock       sync.Mutex
 }
 
 // NewEtcdClient returns a new client for the Etcd KV store
 func NewEtcdClient(addr string, timeout int) (*EtcdClient, error) {
+	return NewEtcdClientWithSecurity(addr, timeout, nil)
+}
+
+// NewEtcdClientWithSecurity returns a new client for the Etcd KV store which connects over TLS and/or
+// authenticates with a username and password, as described by security
+func NewEtcdClientWithSecurity(addr string, timeout int, security *SecurityConfig) (*EtcdClient, error) {
 
 	duration := GetDuration(timeout)
 
-	c, err := v3Client.New(v3Client.Config{
+	config := v3Client.Config{
 		Endpoints:   []string{addr},
 		DialTimeout: duration,
-	})
+	}
+	if security != nil {
+		tlsConfig, err := security.TLSConfig()
+		if err != nil {
+			log.Errorw("invalid-tls-config", log.Fields{"error": err})
+			return nil, err
+		}
+		config.TLS = tlsConfig
+		config.Username = security.Username
+		config.Password = security.Password
+	}
+	c, err := v3Client.New(config)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
 	wc := make(map[string][]map[chan *Event]v3Client.Watcher)
 	reservations := make(map[string]*v3Client.LeaseID)
-	return &EtcdClient{ectdAPI: c, watchedChannels: wc, keyReservations: reservations}, nil
+	locks := make(map[string]v3Client.LeaseID)
+	return &EtcdClient{ectdAPI: c, watchedChannels: wc, keyReservations: reservations, keyLocks: locks}, nil
 }
 
 // List returns an array of key-value pairs with key as a prefix.  Timeout defines how long the function will
@@ -69,11 +92,68 @@ func (c *EtcdClient) List(key string, timeout int) (map[string]*KVPair, error) {
 	}
 	m := make(map[string]*KVPair)
 	for _, ev := range resp.Kvs {
-		m[string(ev.Key)] = NewKVPair(string(ev.Key), ev.Value, "", ev.Lease)
+		kvp := NewKVPair(string(ev.Key), ev.Value, "", ev.Lease)
+		kvp.Version = ev.ModRevision
+		m[string(ev.Key)] = kvp
 	}
 	return m, nil
 }
 
+// ListPage returns a page of the key-value pairs with key as a prefix, sorted by key.  Timeout defines how
+// long the function will wait for a response
+func (c *EtcdClient) ListPage(key string, options *ListOptions, timeout int) (*KVPage, error) {
+	duration := GetDuration(timeout)
+
+	startKey := key
+	limit := 0
+	keysOnly := false
+	if options != nil {
+		if options.StartKey > startKey {
+			startKey = options.StartKey
+		}
+		limit = options.Limit
+		keysOnly = options.KeysOnly
+	}
+	if startKey == "" {
+		// An empty prefix covers the whole key space
+		startKey = "\x00"
+	}
+	opts := []v3Client.OpOption{
+		v3Client.WithRange(v3Client.GetPrefixRangeEnd(key)),
+		v3Client.WithSort(v3Client.SortByKey, v3Client.SortAscend),
+	}
+	if limit > 0 {
+		// Fetch one more pair to learn where the next page starts
+		opts = append(opts, v3Client.WithLimit(int64(limit+1)))
+	}
+	if keysOnly {
+		opts = append(opts, v3Client.WithKeysOnly())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	resp, err := c.ectdAPI.Get(ctx, startKey, opts...)
+	cancel()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	page := &KVPage{Pairs: make([]*KVPair, 0, len(resp.Kvs))}
+	for i, ev := range resp.Kvs {
+		if limit > 0 && i == limit {
+			page.NextKey = string(ev.Key)
+			break
+		}
+		var value interface{}
+		if !keysOnly {
+			value = ev.Value
+		}
+		kvp := NewKVPair(string(ev.Key), value, "", ev.Lease)
+		kvp.Version = ev.ModRevision
+		page.Pairs = append(page.Pairs, kvp)
+	}
+	return page, nil
+}
+
 // Get returns a key-value pair for a given key. Timeout defines how long the function will
 // wait for a response
 func (c *EtcdClient) Get(key string, timeout int) (*KVPair, error) {
@@ -88,7 +168,9 @@ func (c *EtcdClient) Get(key string, timeout int) (*KVPair, error) {
 	}
 	for _, ev := range resp.Kvs {
 		// Only one value is returned
-		return NewKVPair(string(ev.Key), ev.Value, "", ev.Lease), nil
+		kvp := NewKVPair(string(ev.Key), ev.Value, "", ev.Lease)
+		kvp.Version = ev.ModRevision
+		return kvp, nil
 	}
 	return nil, nil
 }
@@ -170,6 +252,115 @@ func (c *EtcdClient) Delete(key string, timeout int) error {
 	return nil
 }
 
+// PutIfVersion writes a key-value pair to the KV store only if the key is at the specified version, a version
+// of 0 meaning the key must not exist.  The new version of the key is returned on success and
+// ErrVersionMismatch when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *EtcdClient) PutIfVersion(key string, value interface{}, version int64, timeout int) (int64, error) {
+	var val string
+	var er error
+	if val, er = ToString(value); er != nil {
+		return 0, fmt.Errorf("unexpected-type-%T", value)
+	}
+
+	duration := GetDuration(timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	txn := c.ectdAPI.Txn(ctx)
+	txn = txn.If(v3Client.Compare(v3Client.ModRevision(key), "=", version))
+	txn = txn.Then(v3Client.OpPut(key, val))
+	result, err := txn.Commit()
+	if err != nil {
+		log.Warnw("conditional-put-failed", log.Fields{"key": key, "error": err})
+		return 0, err
+	}
+	if !result.Succeeded {
+		log.Debugw("conditional-put-version-mismatch", log.Fields{"key": key, "version": version})
+		return 0, ErrVersionMismatch
+	}
+	return result.Header.Revision, nil
+}
+
+// DeleteIfVersion removes a key from the KV store only if it is at the specified version.  ErrVersionMismatch
+// is returned when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *EtcdClient) DeleteIfVersion(key string, version int64, timeout int) error {
+	duration := GetDuration(timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	txn := c.ectdAPI.Txn(ctx)
+	txn = txn.If(v3Client.Compare(v3Client.ModRevision(key), "=", version))
+	txn = txn.Then(v3Client.OpDelete(key))
+	result, err := txn.Commit()
+	if err != nil {
+		log.Warnw("conditional-delete-failed", log.Fields{"key": key, "error": err})
+		return err
+	}
+	if !result.Succeeded {
+		log.Debugw("conditional-delete-version-mismatch", log.Fields{"key": key, "version": version})
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// Txn atomically applies a list of operations.  Either all the operations are applied or, when one of the
+// keys is not at its expected version, none of them is and ErrVersionMismatch is returned.  The version of the
+// keys put by the transaction is returned.  Timeout defines how long the function will wait for a response
+func (c *EtcdClient) Txn(ops []*TxnOp, timeout int) (int64, error) {
+	if len(ops) > maxEtcdTxnOps {
+		log.Warnw("transaction-too-large", log.Fields{"operations": len(ops), "max": maxEtcdTxnOps})
+		return 0, ErrTxnTooLarge
+	}
+	var cmps []v3Client.Cmp
+	var thenOps []v3Client.Op
+	for _, op := range ops {
+		if op.Version != AnyVersion {
+			cmps = append(cmps, v3Client.Compare(v3Client.ModRevision(op.Key), "=", op.Version))
+		}
+		switch op.Type {
+		case TXN_PUT:
+			val, err := ToString(op.Value)
+			if err != nil {
+				return 0, fmt.Errorf("unexpected-type-%T", op.Value)
+			}
+			thenOps = append(thenOps, v3Client.OpPut(op.Key, val))
+		case TXN_DELETE:
+			thenOps = append(thenOps, v3Client.OpDelete(op.Key))
+		case TXN_CHECK:
+		default:
+			return 0, fmt.Errorf("unexpected-operation-%d", op.Type)
+		}
+	}
+
+	duration := GetDuration(timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	result, err := c.ectdAPI.Txn(ctx).If(cmps...).Then(thenOps...).Commit()
+	if err != nil {
+		log.Warnw("transaction-failed", log.Fields{"error": err})
+		return 0, err
+	}
+	if !result.Succeeded {
+		log.Debug("transaction-version-mismatch")
+		return 0, ErrVersionMismatch
+	}
+	return result.Header.Revision, nil
+}
+
+// MaxTxnOps returns the largest number of operations of a transaction
+func (c *EtcdClient) MaxTxnOps() int {
+	return maxEtcdTxnOps
+}
+
 // Reserve is invoked to acquire a key and set it to a given value. Value can only be a string or []byte since
 // the etcd API accepts only a string.  Timeout defines how long the function will wait for a response.  TTL
 // defines how long that reservation is valid.  When TTL expires the key is unreserved by the KV store itself.
@@ -189,70 +380,60 @@ func (c *EtcdClient) Reserve(key string, value interface{}, ttl int64) (interfac
 		log.Error(err)
 		return nil, err
 	}
-	// Register the lease id
-	c.writeLock.Lock()
-	c.keyReservations[key] = &resp.ID
-	c.writeLock.Unlock()
-
-	// Revoke lease if reservation is not successful
-	reservationSuccessful := false
-	defer func() {
-		if !reservationSuccessful {
-			if err = c.ReleaseReservation(key); err != nil {
-				log.Errorf("cannot-release-lease")
-			}
-		}
-	}()
 
 	// Try to grap the Key with the above lease
-	c.ectdAPI.Txn(context.Background())
 	txn := c.ectdAPI.Txn(context.Background())
 	txn = txn.If(v3Client.Compare(v3Client.Version(key), "=", 0))
 	txn = txn.Then(v3Client.OpPut(key, val, v3Client.WithLease(resp.ID)))
 	txn = txn.Else(v3Client.OpGet(key))
 	result, er := txn.Commit()
 	if er != nil {
+		c.revokeUnusedLease(resp.ID)
 		return nil, er
 	}
 
-	if !result.Succeeded {
-		// Verify whether we are already the owner of that Key
-		if len(result.Responses) > 0 &&
-			len(result.Responses[0].GetResponseRange().Kvs) > 0 {
-			kv := result.Responses[0].GetResponseRange().Kvs[0]
-			if string(kv.Value) == val {
-				reservationSuccessful = true
-				return value, nil
-			}
-			return kv.Value, nil
-		}
-	} else {
-		// Read the Key to ensure this is our Key
-		m, err := c.Get(key, defaultKVGetTimeout)
-		if err != nil {
-			return nil, err
-		}
-		if m != nil {
-			if m.Key == key && isEqual(m.Value, value) {
-				// My reservation is successful - register it.  For now, support is only for 1 reservation per key
-				// per session.
-				reservationSuccessful = true
-				return value, nil
-			}
-			// My reservation has failed.  Return the owner of that key
-			return m.Value, nil
+	if result.Succeeded {
+		// My reservation is successful - register it.  For now, support is only for 1 reservation per key
+		// per session.
+		c.writeLock.Lock()
+		c.keyReservations[key] = &resp.ID
+		c.writeLock.Unlock()
+		return value, nil
+	}
+
+	// The key is already reserved; the new lease is not needed
+	c.revokeUnusedLease(resp.ID)
+	if len(result.Responses) > 0 &&
+		len(result.Responses[0].GetResponseRange().Kvs) > 0 {
+		kv := result.Responses[0].GetResponseRange().Kvs[0]
+		// Verify whether we are already the owner of that Key.  Another client holding the same value does
+		// not make this client the owner.
+		c.writeLock.Lock()
+		leaseID, owned := c.keyReservations[key]
+		c.writeLock.Unlock()
+		if owned && leaseID != nil && int64(*leaseID) == kv.Lease && string(kv.Value) == val {
+			return value, nil
 		}
+		// My reservation has failed.  Return the owner of that key
+		return kv.Value, nil
 	}
 	return nil, nil
 }
 
+// revokeUnusedLease revokes a lease granted for a reservation that did not succeed
+func (c *EtcdClient) revokeUnusedLease(leaseID v3Client.LeaseID) {
+	if _, err := c.ectdAPI.Revoke(context.Background(), leaseID); err != nil {
+		log.Errorw("cannot-release-lease", log.Fields{"lease": leaseID, "error": err})
+	}
+}
+
 // ReleaseAllReservations releases all key reservations previously made (using Reserve API)
 func (c *EtcdClient) ReleaseAllReservations() error {
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
 	for key, leaseID := range c.keyReservations {
 		_, err := c.ectdAPI.Revoke(context.Background(), *leaseID)
-		if err != nil {
+		if err != nil && err != v3rpcTypes.ErrLeaseNotFound {
 			log.Errorw("cannot-release-reservation", log.Fields{"key": key, "error": err})
 			return err
 		}
@@ -272,8 +453,9 @@ func (c *EtcdClient) ReleaseReservation(key string) error {
 		return errors.New("key-not-reserved")
 	}
 	if leaseID != nil {
+		// A lease which already expired has released the key
 		_, err := c.ectdAPI.Revoke(context.Background(), *leaseID)
-		if err != nil {
+		if err != nil && err != v3rpcTypes.ErrLeaseNotFound {
 			log.Error(err)
 			return err
 		}
@@ -306,11 +488,87 @@ func (c *EtcdClient) RenewReservation(key string) error {
 	return nil
 }
 
+// Lock acquires an exclusive lock on a key, waiting up to timeout seconds for its current holder to release it.
+// The lock is attached to a lease and is therefore released after ttl seconds unless Unlock is invoked before.
+// The returned fencing token is the revision at which the lock was acquired; it increases with every
+// acquisition, allowing writes made by a stale holder to be rejected.
+func (c *EtcdClient) Lock(key string, ttl int64, timeout int) (int64, error) {
+	duration := GetDuration(timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	resp, err := c.ectdAPI.Grant(ctx, ttl)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	for {
+		txn := c.ectdAPI.Txn(ctx)
+		txn = txn.If(v3Client.Compare(v3Client.CreateRevision(key), "=", 0))
+		txn = txn.Then(v3Client.OpPut(key, "", v3Client.WithLease(resp.ID)))
+		txn = txn.Else(v3Client.OpGet(key))
+		result, err := txn.Commit()
+		if err != nil {
+			log.Errorw("lock-failed", log.Fields{"key": key, "error": err})
+			c.ectdAPI.Revoke(context.Background(), resp.ID)
+			return 0, err
+		}
+		if result.Succeeded {
+			c.writeLock.Lock()
+			c.keyLocks[key] = resp.ID
+			c.writeLock.Unlock()
+			log.Debugw("lock-acquired", log.Fields{"key": key, "token": result.Header.Revision})
+			return result.Header.Revision, nil
+		}
+
+		// Wait for the current holder to release the lock
+		if !c.waitForDelete(ctx, key, result.Header.Revision+1) {
+			log.Debugw("lock-timeout", log.Fields{"key": key})
+			c.ectdAPI.Revoke(context.Background(), resp.ID)
+			return 0, ErrLockTimeout
+		}
+	}
+}
+
+// waitForDelete blocks until a key is deleted after a given revision, returning false when the context
+// expires before that
+func (c *EtcdClient) waitForDelete(ctx context.Context, key string, revision int64) bool {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for wresp := range c.ectdAPI.Watch(wctx, key, v3Client.WithRev(revision)) {
+		for _, ev := range wresp.Events {
+			if ev.Type == v3Client.EventTypeDelete {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unlock releases a lock previously acquired with Lock
+func (c *EtcdClient) Unlock(key string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	leaseID, ok := c.keyLocks[key]
+	if !ok {
+		return errors.New("key-not-locked")
+	}
+	delete(c.keyLocks, key)
+	if _, err := c.ectdAPI.Revoke(context.Background(), leaseID); err != nil {
+		log.Errorw("cannot-release-lock", log.Fields{"key": key, "error": err})
+		return err
+	}
+	return nil
+}
+
 // Watch provides the watch capability on a given key.  It returns a channel onto which the callee needs to
 // listen to receive Events.
 func (c *EtcdClient) Watch(key string) chan *Event {
 	w := v3Client.NewWatcher(c.ectdAPI)
-	channel := w.Watch(context.Background(), key, v3Client.WithPrefix())
+	// Requiring a leader makes the watch fail, rather than silently stall, when the member is cut off from the
+	// cluster
+	channel := w.Watch(v3Client.WithRequireLeader(context.Background()), key, v3Client.WithPrefix())
 
 	// Create a new channel
 	ch := make(chan *Event, maxClientChannelBufferSize)
@@ -324,7 +582,7 @@ func (c *EtcdClient) Watch(key string) chan *Event {
 
 	log.Debugw("watched-channels", log.Fields{"channels": c.watchedChannels[key]})
 	// Launch a go routine to listen for updates
-	go c.listenForKeyChange(channel, ch)
+	go c.listenForKeyChange(key, channel, ch)
 
 	return ch
 
@@ -364,12 +622,18 @@ func (c *EtcdClient) CloseWatch(key string, ch chan *Event) {
 	log.Infow("watcher-channel-exiting", log.Fields{"key": key, "channel": c.watchedChannels[key]})
 }
 
-func (c *EtcdClient) listenForKeyChange(channel v3Client.WatchChan, ch chan<- *Event) {
+func (c *EtcdClient) listenForKeyChange(key string, channel v3Client.WatchChan, ch chan<- *Event) {
 	log.Infow("start-listening-on-channel", log.Fields{"channel": ch})
 	for resp := range channel {
+		if err := resp.Err(); err != nil && err != context.Canceled {
+			log.Warnw("error-from-watch", log.Fields{"key": key, "error": err})
+			ch <- NewEvent(CONNECTIONDOWN, key, []byte(""))
+		}
 		for _, ev := range resp.Events {
 			//log.Debugf("%s %q : %q\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
-			ch <- NewEvent(getEventType(ev), ev.Kv.Key, ev.Kv.Value)
+			event := NewEvent(getEventType(ev), ev.Kv.Key, ev.Kv.Value)
+			event.Version = ev.Kv.ModRevision
+			ch <- event
 		}
 	}
 	log.Info("stop-listening-on-channel")
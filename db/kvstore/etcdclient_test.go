@@ -0,0 +1,94 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/embed"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// etcdTestAddrEnv holds the address of an etcd server to run the conformance suite against, e.g. localhost:2379.
+// An etcd server is started in-process when it is not set.
+const etcdTestAddrEnv = "VOLTHA_TEST_ETCD_ADDR"
+
+// freeLocalURL returns a URL on a local port nothing listens on
+func freeLocalURL(t *testing.T) url.URL {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("no free port: %s", err)
+	}
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// startTestEtcdServer starts a single node etcd server in-process and returns its client address along with the
+// function stopping it
+func startTestEtcdServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "voltha-etcd")
+	if err != nil {
+		t.Fatalf("cannot create the etcd directory: %s", err)
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	clientURL, peerURL := freeLocalURL(t), freeLocalURL(t)
+	cfg.LCUrls, cfg.ACUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("cannot start the etcd server: %s", err)
+	}
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		server.Close()
+		os.RemoveAll(dir)
+		t.Fatal("timeout waiting for the etcd server")
+	}
+	return clientURL.Host, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEtcdClientConformance(t *testing.T) {
+	addr := os.Getenv(etcdTestAddrEnv)
+	if addr == "" {
+		var stop func()
+		addr, stop = startTestEtcdServer(t)
+		defer stop()
+	}
+	// The etcd client keeps retrying when the server cannot be reached; only the loss of the cluster leader
+	// is reported, which cannot be triggered from here.  The connection is therefore not interrupted.
+	runConformanceSuite(t, &conformanceHarness{
+		newClient: func(t *testing.T) Client {
+			client, err := NewEtcdClient(addr, 5)
+			assert.Nil(t, err)
+			return client
+		},
+		ttl:           3,
+		expiryTimeout: 15 * time.Second,
+	})
+}
@@ -16,7 +16,9 @@
 package kvstore
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"time"
 )
 
@@ -54,3 +56,28 @@ func ToByte(value interface{}) ([]byte, error) {
 		return nil, fmt.Errorf("unexpected-type-%T", t)
 	}
 }
+
+// PageKeys selects the keys of a page from a sorted list of keys, according to the listing options.  It
+// returns the selected keys along with the start key of the following page, which is empty on the last page.
+func PageKeys(keys []string, options *ListOptions) ([]string, string) {
+	if options == nil {
+		return keys, ""
+	}
+	start := sort.SearchStrings(keys, options.StartKey)
+	keys = keys[start:]
+	if options.Limit <= 0 || len(keys) <= options.Limit {
+		return keys, ""
+	}
+	return keys[:options.Limit], keys[options.Limit]
+}
+
+// Helper function to verify mostly whether the content of two interface types are the same.  Focus is []byte and
+// string types
+func isEqual(val1 interface{}, val2 interface{}) bool {
+	b1, err := ToByte(val1)
+	b2, er := ToByte(val2)
+	if err == nil && er == nil {
+		return bytes.Equal(b1, b2)
+	}
+	return val1 == val2
+}
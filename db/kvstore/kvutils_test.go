@@ -80,3 +80,19 @@ func TestToStringForErrorCase(t *testing.T) {
 	assert.Equal(t, expectedResult, actualResult)
 	assert.NotEqual(t, error, nil)
 }
+
+func TestPageKeys(t *testing.T) {
+	keys := []string{"a", "b", "c", "d"}
+
+	selected, next := PageKeys(keys, nil)
+	assert.Equal(t, keys, selected)
+	assert.Equal(t, "", next)
+
+	selected, next = PageKeys(keys, &ListOptions{Limit: 3})
+	assert.Equal(t, []string{"a", "b", "c"}, selected)
+	assert.Equal(t, "d", next)
+
+	selected, next = PageKeys(keys, &ListOptions{Limit: 3, StartKey: "bb"})
+	assert.Equal(t, []string{"c", "d"}, selected)
+	assert.Equal(t, "", next)
+}
@@ -0,0 +1,802 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	log "github.com/opencord/voltha-go/common/log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a value held by the in-memory store along with the lease it is attached to, if any
+type memoryEntry struct {
+	value       []byte
+	lease       *memoryLease
+	modRevision int64
+}
+
+// memoryLease mimics an etcd lease.  All the keys attached to a lease are removed when it expires or
+// when it is revoked
+type memoryLease struct {
+	id       int64
+	ttl      time.Duration
+	deadline time.Time
+	timer    *time.Timer
+	keys     map[string]struct{}
+	expired  bool
+}
+
+// memoryStore holds the data shared by all the memory clients created with the same address
+type memoryStore struct {
+	sync.Mutex
+	data     map[string]*memoryEntry
+	watchers map[*memoryWatcher]struct{}
+	leaseID  int64
+	revision int64
+	// inTxn is set while a transaction is applied, so that all its changes are made at the same revision
+	inTxn      bool
+	txnChanged bool
+	// persistence, when set, receives the changes made to the keys which are not attached to a lease
+	persistence storePersistence
+	pending     []*storeChange
+	flushed     int64
+	// The changes of the operation being made are announced once persisted, and undone if they cannot be
+	undo          []*storeUndo
+	undoRevision  int64
+	announcements []*Event
+}
+
+// storeUndo is the entry a key held before being changed by the operation being made, nil if it did not exist
+type storeUndo struct {
+	key   string
+	entry *memoryEntry
+}
+
+// storeChange is a change of a key to be persisted; a nil entry stands for the removal of the key
+type storeChange struct {
+	key   string
+	entry *memoryEntry
+}
+
+// storePersistence saves the content of a memory store so that it survives restarts
+type storePersistence interface {
+	write(changes []*storeChange, revision int64) error
+	close() error
+}
+
+var memoryStores = make(map[string]*memoryStore)
+var memoryStoresLock sync.Mutex
+
+func getMemoryStore(addr string) *memoryStore {
+	memoryStoresLock.Lock()
+	defer memoryStoresLock.Unlock()
+	if store, ok := memoryStores[addr]; ok {
+		return store
+	}
+	store := &memoryStore{
+		data:     make(map[string]*memoryEntry),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+	memoryStores[addr] = store
+	return store
+}
+
+// notify queues the announcement of a change, made to the watchers once the change is persisted.  The store
+// lock must be held.
+func (s *memoryStore) notify(eventType int, key string, value []byte) {
+	event := NewEvent(eventType, key, copyBytes(value))
+	event.Version = s.revision
+	s.announcements = append(s.announcements, event)
+}
+
+// announce pushes the changes of the operation made to every watcher interested in their key.  The store lock
+// must be held.
+func (s *memoryStore) announce() {
+	for _, event := range s.announcements {
+		for w := range s.watchers {
+			if strings.HasPrefix(event.Key.(string), w.key) {
+				announced := NewEvent(event.EventType, event.Key, copyBytes(event.Value.([]byte)))
+				announced.Version = event.Version
+				w.push(announced)
+			}
+		}
+	}
+	s.announcements = nil
+	s.undo = nil
+}
+
+// record saves the entry of a key about to be changed by the operation being made.  The store lock must be
+// held.
+func (s *memoryStore) record(key string) {
+	if len(s.undo) == 0 {
+		s.undoRevision = s.revision
+	}
+	s.undo = append(s.undo, &storeUndo{key: key, entry: s.data[key]})
+}
+
+// rollback undoes the changes of the operation being made, which are never announced.  The store lock must be
+// held.
+func (s *memoryStore) rollback() {
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		undo := s.undo[i]
+		if current, ok := s.data[undo.key]; ok && current.lease != nil {
+			delete(current.lease.keys, undo.key)
+		}
+		if undo.entry == nil {
+			delete(s.data, undo.key)
+			continue
+		}
+		s.data[undo.key] = undo.entry
+		if undo.entry.lease != nil && !undo.entry.lease.expired {
+			undo.entry.lease.keys[undo.key] = struct{}{}
+		}
+	}
+	if len(s.undo) > 0 {
+		s.revision = s.undoRevision
+	}
+	s.undo = nil
+	s.pending = nil
+	s.announcements = nil
+}
+
+// advance moves the store to the revision of a change.  The store lock must be held.
+func (s *memoryStore) advance() {
+	if s.inTxn {
+		if s.txnChanged {
+			return
+		}
+		s.txnChanged = true
+	}
+	s.revision++
+}
+
+// remove deletes a key and announces it.  The store lock must be held.
+func (s *memoryStore) remove(key string) {
+	entry, ok := s.data[key]
+	if !ok {
+		return
+	}
+	s.record(key)
+	if entry.lease != nil {
+		delete(entry.lease.keys, key)
+	} else if s.persistence != nil {
+		s.pending = append(s.pending, &storeChange{key: key})
+	}
+	delete(s.data, key)
+	s.advance()
+	s.notify(DELETE, key, []byte(""))
+}
+
+// version returns the revision at which a key was last modified, 0 if it does not exist.  The store lock
+// must be held.
+func (s *memoryStore) version(key string) int64 {
+	if entry, ok := s.data[key]; ok {
+		return entry.modRevision
+	}
+	return 0
+}
+
+// put stores a key, detaching it from any previous lease the same way etcd does.  The store lock
+// must be held.
+func (s *memoryStore) put(key string, value []byte, lease *memoryLease) {
+	s.record(key)
+	if entry, ok := s.data[key]; ok && entry.lease != nil {
+		delete(entry.lease.keys, key)
+	}
+	s.advance()
+	entry := &memoryEntry{value: value, lease: lease, modRevision: s.revision}
+	s.data[key] = entry
+	if lease != nil {
+		lease.keys[key] = struct{}{}
+		if s.persistence != nil {
+			// Leases do not survive a restart; neither does a key which was persisted before being leased
+			s.pending = append(s.pending, &storeChange{key: key})
+		}
+	} else if s.persistence != nil {
+		s.pending = append(s.pending, &storeChange{key: key, entry: entry})
+	}
+	s.notify(PUT, key, value)
+}
+
+// flush persists the changes of the operation made before announcing them.  When they cannot be persisted,
+// they are rolled back and never announced, so that no one sees a change which would not survive a restart.
+// The store lock must be held.
+func (s *memoryStore) flush() error {
+	if err := s.persist(); err != nil {
+		s.rollback()
+		return err
+	}
+	s.announce()
+	return nil
+}
+
+// commit persists and announces the changes of an operation which cannot be undone, such as the expiry of a
+// lease.  Only the revision is at stake as the keys attached to a lease are not persisted; when it cannot be
+// persisted, it is by the next operation.  The store lock must be held.
+func (s *memoryStore) commit() {
+	s.persist()
+	s.announce()
+}
+
+// persist saves the changes of the operation made.  The revision is persisted as well, even if only leased
+// keys changed, so that versions and fencing tokens keep increasing across restarts.  The store lock must be
+// held.
+func (s *memoryStore) persist() error {
+	if s.persistence == nil || (len(s.pending) == 0 && s.flushed == s.revision) {
+		return nil
+	}
+	if err := s.persistence.write(s.pending, s.revision); err != nil {
+		log.Errorw("kv-store-persist-failed", log.Fields{"revision": s.revision, "error": err})
+		return err
+	}
+	s.pending = nil
+	s.flushed = s.revision
+	return nil
+}
+
+// discard terminates a lease whose keys were rolled back.  The store lock must be held.
+func (s *memoryStore) discard(lease *memoryLease) {
+	lease.expired = true
+	lease.timer.Stop()
+}
+
+// grant creates a new lease which expires after the ttl.  The store lock must be held.
+func (s *memoryStore) grant(ttl int64) *memoryLease {
+	s.leaseID++
+	lease := &memoryLease{
+		id:   s.leaseID,
+		ttl:  time.Duration(ttl) * time.Second,
+		keys: make(map[string]struct{}),
+	}
+	lease.deadline = time.Now().Add(lease.ttl)
+	lease.timer = time.AfterFunc(lease.ttl, func() {
+		s.expire(lease)
+	})
+	return lease
+}
+
+// expire is invoked when the ttl of a lease has elapsed
+func (s *memoryStore) expire(lease *memoryLease) {
+	s.Lock()
+	defer s.Unlock()
+	// The lease may have been renewed while the timer was firing
+	if time.Now().Before(lease.deadline) {
+		return
+	}
+	log.Debugw("lease-expired", log.Fields{"lease": lease.id})
+	s.revoke(lease)
+	s.commit()
+}
+
+// revoke terminates a lease and removes all the keys attached to it.  The store lock must be held.
+func (s *memoryStore) revoke(lease *memoryLease) {
+	if lease.expired {
+		return
+	}
+	lease.expired = true
+	lease.timer.Stop()
+	keys := make([]string, 0, len(lease.keys))
+	for key := range lease.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.remove(key)
+	}
+}
+
+// memoryWatcher forwards the events of a watched key to its channel.  Events are queued so that
+// writers are never blocked by a slow listener.
+type memoryWatcher struct {
+	key     string
+	channel chan *Event
+	mutex   sync.Mutex
+	pending []*Event
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newMemoryWatcher(key string) *memoryWatcher {
+	return &memoryWatcher{
+		key:     key,
+		channel: make(chan *Event, maxClientChannelBufferSize),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (w *memoryWatcher) push(event *Event) {
+	w.mutex.Lock()
+	w.pending = append(w.pending, event)
+	w.mutex.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) forward() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		}
+		for {
+			w.mutex.Lock()
+			if len(w.pending) == 0 {
+				w.mutex.Unlock()
+				break
+			}
+			event := w.pending[0]
+			w.pending = w.pending[1:]
+			w.mutex.Unlock()
+
+			select {
+			case w.channel <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// stop terminates the forwarding routine and closes the channel
+func (w *memoryWatcher) stop() {
+	close(w.done)
+	<-w.stopped
+	close(w.channel)
+}
+
+// MemoryClient represents an in-process KV store client.  It follows the etcd semantics and is meant
+// for standalone deployments and unit tests.  Clients created with the same address share the same
+// data, much like separate clients connected to the same KV server.
+type MemoryClient struct {
+	store           *memoryStore
+	keyReservations map[string]*memoryLease
+	keyLocks        map[string]*memoryLease
+	watchedChannels map[string][]*memoryWatcher
+	writeLock       sync.Mutex
+}
+
+// NewMemoryClient returns a new client for the in-memory KV store.  The address identifies the store
+// to attach to; the timeout is accepted for consistency with the other clients but has no effect.
+func NewMemoryClient(addr string, timeout int) (*MemoryClient, error) {
+	wc := make(map[string][]*memoryWatcher)
+	reservations := make(map[string]*memoryLease)
+	locks := make(map[string]*memoryLease)
+	return &MemoryClient{store: getMemoryStore(addr), watchedChannels: wc, keyReservations: reservations,
+		keyLocks: locks}, nil
+}
+
+// List returns an array of key-value pairs with key as a prefix.  Timeout defines how long the function will
+// wait for a response
+func (c *MemoryClient) List(key string, timeout int) (map[string]*KVPair, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	m := make(map[string]*KVPair)
+	for k, entry := range c.store.data {
+		if strings.HasPrefix(k, key) {
+			m[k] = entry.kvPair(k)
+		}
+	}
+	return m, nil
+}
+
+// ListPage returns a page of the key-value pairs with key as a prefix, sorted by key.  Timeout defines how
+// long the function will wait for a response
+func (c *MemoryClient) ListPage(key string, options *ListOptions, timeout int) (*KVPage, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	var keys []string
+	for k := range c.store.data {
+		if strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	selected, nextKey := PageKeys(keys, options)
+
+	page := &KVPage{Pairs: make([]*KVPair, 0, len(selected)), NextKey: nextKey}
+	for _, k := range selected {
+		kvp := c.store.data[k].kvPair(k)
+		if options != nil && options.KeysOnly {
+			kvp.Value = nil
+		}
+		page.Pairs = append(page.Pairs, kvp)
+	}
+	return page, nil
+}
+
+// Get returns a key-value pair for a given key. Timeout defines how long the function will
+// wait for a response
+func (c *MemoryClient) Get(key string, timeout int) (*KVPair, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	if entry, ok := c.store.data[key]; ok {
+		return entry.kvPair(key), nil
+	}
+	return nil, nil
+}
+
+// Put writes a key-value pair to the KV store.  Value can only be a string or []byte.  Timeout defines how
+// long the function will wait for a response
+func (c *MemoryClient) Put(key string, value interface{}, timeout int) error {
+	val, err := ToByte(value)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	c.store.put(key, copyBytes(val), nil)
+	return c.store.flush()
+}
+
+// Delete removes a key, and any key using it as a prefix, from the KV store. Timeout defines how long
+// the function will wait for a response
+func (c *MemoryClient) Delete(key string, timeout int) error {
+	c.store.Lock()
+	defer c.store.Unlock()
+	keys := make([]string, 0)
+	for k := range c.store.data {
+		if strings.HasPrefix(k, key) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		c.store.remove(k)
+	}
+	log.Debugw("delete-keys", log.Fields{"key": key, "count": len(keys)})
+	return c.store.flush()
+}
+
+// PutIfVersion writes a key-value pair to the KV store only if the key is at the specified version, a version
+// of 0 meaning the key must not exist.  The new version of the key is returned on success and
+// ErrVersionMismatch when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *MemoryClient) PutIfVersion(key string, value interface{}, version int64, timeout int) (int64, error) {
+	val, err := ToByte(value)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	if c.store.version(key) != version {
+		log.Debugw("conditional-put-version-mismatch", log.Fields{"key": key, "version": version})
+		return 0, ErrVersionMismatch
+	}
+	c.store.put(key, copyBytes(val), nil)
+	if err := c.store.flush(); err != nil {
+		return 0, err
+	}
+	return c.store.revision, nil
+}
+
+// DeleteIfVersion removes a key from the KV store only if it is at the specified version.  ErrVersionMismatch
+// is returned when the key was modified by someone else.  Timeout defines how long the function will
+// wait for a response
+func (c *MemoryClient) DeleteIfVersion(key string, version int64, timeout int) error {
+	c.store.Lock()
+	defer c.store.Unlock()
+	if c.store.version(key) != version {
+		log.Debugw("conditional-delete-version-mismatch", log.Fields{"key": key, "version": version})
+		return ErrVersionMismatch
+	}
+	c.store.remove(key)
+	return c.store.flush()
+}
+
+// Txn atomically applies a list of operations.  Either all the operations are applied or, when one of the
+// keys is not at its expected version, none of them is and ErrVersionMismatch is returned.  The version of the
+// keys put by the transaction is returned.  Timeout defines how long the function will wait for a response
+func (c *MemoryClient) Txn(ops []*TxnOp, timeout int) (int64, error) {
+	values := make([][]byte, len(ops))
+	for i, op := range ops {
+		switch op.Type {
+		case TXN_PUT:
+			val, err := ToByte(op.Value)
+			if err != nil {
+				log.Error(err)
+				return 0, err
+			}
+			values[i] = copyBytes(val)
+		case TXN_DELETE, TXN_CHECK:
+		default:
+			return 0, fmt.Errorf("unexpected-operation-%d", op.Type)
+		}
+	}
+
+	c.store.Lock()
+	defer c.store.Unlock()
+	for _, op := range ops {
+		if op.Version != AnyVersion && c.store.version(op.Key) != op.Version {
+			log.Debugw("transaction-version-mismatch", log.Fields{"key": op.Key, "version": op.Version})
+			return 0, ErrVersionMismatch
+		}
+	}
+	// As with etcd, the keys put by a transaction are all at the revision of the transaction
+	c.store.inTxn = true
+	for i, op := range ops {
+		switch op.Type {
+		case TXN_PUT:
+			c.store.put(op.Key, values[i], nil)
+		case TXN_DELETE:
+			c.store.remove(op.Key)
+		}
+	}
+	c.store.inTxn = false
+	c.store.txnChanged = false
+	if err := c.store.flush(); err != nil {
+		return 0, err
+	}
+	return c.store.revision, nil
+}
+
+// MaxTxnOps returns 0: the number of operations of a transaction is not limited
+func (c *MemoryClient) MaxTxnOps() int {
+	return 0
+}
+
+// Reserve is invoked to acquire a key and set it to a given value. Value can only be a string or []byte.
+// TTL defines how long that reservation is valid.  When TTL expires the key is removed from the store.
+// If the key is acquired then the value returned will be the value passed in.  If the key is already acquired
+// then the value assigned to that key will be returned.
+func (c *MemoryClient) Reserve(key string, value interface{}, ttl int64) (interface{}, error) {
+	val, err := ToByte(value)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.store.Lock()
+	defer c.store.Unlock()
+
+	if entry, ok := c.store.data[key]; ok {
+		if bytes.Equal(entry.value, val) {
+			return value, nil
+		}
+		// My reservation has failed.  Return the owner of that key
+		return copyBytes(entry.value), nil
+	}
+
+	lease := c.store.grant(ttl)
+	c.store.put(key, copyBytes(val), lease)
+	if err := c.store.flush(); err != nil {
+		c.store.discard(lease)
+		return nil, err
+	}
+	c.keyReservations[key] = lease
+	return value, nil
+}
+
+// ReleaseAllReservations releases all key reservations previously made (using Reserve API)
+func (c *MemoryClient) ReleaseAllReservations() error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.store.Lock()
+	defer c.store.Unlock()
+	for key, lease := range c.keyReservations {
+		c.store.revoke(lease)
+		delete(c.keyReservations, key)
+	}
+	c.store.commit()
+	return nil
+}
+
+// ReleaseReservation releases reservation for a specific key.
+func (c *MemoryClient) ReleaseReservation(key string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	lease, ok := c.keyReservations[key]
+	if !ok {
+		return errors.New("key-not-reserved")
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	c.store.revoke(lease)
+	delete(c.keyReservations, key)
+	c.store.commit()
+	return nil
+}
+
+// RenewReservation renews a reservation.  A reservation will go stale after the specified TTL (Time To Live)
+// period specified when reserving the key
+func (c *MemoryClient) RenewReservation(key string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	lease, ok := c.keyReservations[key]
+	if !ok {
+		return errors.New("key-not-reserved")
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	if lease.expired {
+		return errors.New("lease-expired")
+	}
+	lease.deadline = time.Now().Add(lease.ttl)
+	lease.timer.Reset(lease.ttl)
+	return nil
+}
+
+// Lock acquires an exclusive lock on a key, waiting up to timeout seconds for its current holder to release it.
+// The lock is released after ttl seconds unless Unlock is invoked before.  The returned fencing token is the
+// revision at which the lock was acquired; it increases with every acquisition, allowing writes made by a
+// stale holder to be rejected.
+func (c *MemoryClient) Lock(key string, ttl int64, timeout int) (int64, error) {
+	w := newMemoryWatcher(key)
+	c.store.Lock()
+	c.store.watchers[w] = struct{}{}
+	c.store.Unlock()
+	go w.forward()
+	defer c.closeWatcher(w)
+
+	expiry := time.After(GetDuration(timeout))
+	for {
+		token, acquired, err := c.tryLock(key, ttl)
+		if err != nil {
+			return 0, err
+		}
+		if acquired {
+			log.Debugw("lock-acquired", log.Fields{"key": key, "token": token})
+			return token, nil
+		}
+		if !waitForDelete(w, key, expiry) {
+			log.Debugw("lock-timeout", log.Fields{"key": key})
+			return 0, ErrLockTimeout
+		}
+	}
+}
+
+// tryLock creates the lock key if it does not exist
+func (c *MemoryClient) tryLock(key string, ttl int64) (int64, bool, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.store.Lock()
+	defer c.store.Unlock()
+
+	if _, exists := c.store.data[key]; exists {
+		return 0, false, nil
+	}
+	lease := c.store.grant(ttl)
+	c.store.put(key, []byte(""), lease)
+	if err := c.store.flush(); err != nil {
+		c.store.discard(lease)
+		return 0, false, err
+	}
+	c.keyLocks[key] = lease
+	return c.store.revision, true, nil
+}
+
+// waitForDelete blocks until a watcher reports the deletion of a key, returning false on expiry
+func waitForDelete(w *memoryWatcher, key string, expiry <-chan time.Time) bool {
+	for {
+		select {
+		case event := <-w.channel:
+			if event.EventType == DELETE && event.Key == key {
+				return true
+			}
+		case <-expiry:
+			return false
+		}
+	}
+}
+
+// Unlock releases a lock previously acquired with Lock
+func (c *MemoryClient) Unlock(key string) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	lease, ok := c.keyLocks[key]
+	if !ok {
+		return errors.New("key-not-locked")
+	}
+	c.store.Lock()
+	defer c.store.Unlock()
+	c.store.revoke(lease)
+	delete(c.keyLocks, key)
+	c.store.commit()
+	return nil
+}
+
+// Watch provides the watch capability on a given key.  It returns a channel onto which the callee needs to
+// listen to receive Events.
+func (c *MemoryClient) Watch(key string) chan *Event {
+	w := newMemoryWatcher(key)
+
+	c.writeLock.Lock()
+	c.watchedChannels[key] = append(c.watchedChannels[key], w)
+	c.writeLock.Unlock()
+
+	c.store.Lock()
+	c.store.watchers[w] = struct{}{}
+	c.store.Unlock()
+
+	go w.forward()
+
+	return w.channel
+}
+
+// CloseWatch closes a specific watch. Both the key and the channel are required when closing a watch as there
+// may be multiple listeners on the same key.  The previously created channel serves as a key
+func (c *MemoryClient) CloseWatch(key string, ch chan *Event) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	watchers, ok := c.watchedChannels[key]
+	if !ok {
+		log.Warnw("key-has-no-watched-channels", log.Fields{"key": key})
+		return
+	}
+	for i, w := range watchers {
+		if w.channel == ch {
+			c.closeWatcher(w)
+			c.watchedChannels[key] = append(watchers[:i], watchers[i+1:]...)
+			break
+		}
+	}
+	log.Debugw("watched-channel-exiting", log.Fields{"key": key})
+}
+
+// closeWatcher detaches a watcher from the store and closes its channel
+func (c *MemoryClient) closeWatcher(w *memoryWatcher) {
+	c.store.Lock()
+	delete(c.store.watchers, w)
+	c.store.Unlock()
+	w.stop()
+}
+
+// Close closes the KV store client.  Reservations are left to expire as they would with a remote store.
+func (c *MemoryClient) Close() {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	for key, watchers := range c.watchedChannels {
+		for _, w := range watchers {
+			c.closeWatcher(w)
+		}
+		delete(c.watchedChannels, key)
+	}
+}
+
+func (e *memoryEntry) kvPair(key string) *KVPair {
+	kvp := NewKVPair(key, copyBytes(e.value), "", e.leaseID())
+	kvp.Version = e.modRevision
+	return kvp
+}
+
+func (e *memoryEntry) leaseID() int64 {
+	if e.lease != nil {
+		return e.lease.id
+	}
+	return 0
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
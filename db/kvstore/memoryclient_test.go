@@ -0,0 +1,306 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestMemoryClient(t *testing.T) *MemoryClient {
+	client, err := NewMemoryClient(t.Name(), defaultKVGetTimeout)
+	assert.Nil(t, err)
+	return client
+}
+
+func waitForEvent(t *testing.T, ch chan *Event) *Event {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for event")
+	}
+	return nil
+}
+
+func TestMemoryClientPutGetDelete(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	assert.Nil(t, client.Put("devices/1", "one", 0))
+	assert.Nil(t, client.Put("devices/2", []byte("two"), 0))
+
+	kvp, err := client.Get("devices/1", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("one"), kvp.Value)
+
+	m, err := client.List("devices/", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(m))
+
+	assert.Nil(t, client.Delete("devices/", 0))
+	kvp, err = client.Get("devices/2", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+}
+
+func TestMemoryClientPutWithInvalidType(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	assert.NotNil(t, client.Put("key", 200, 0))
+}
+
+func TestMemoryClientSharedStore(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	assert.Nil(t, client1.Put("key", "value", 0))
+	kvp, err := client2.Get("key", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), kvp.Value)
+}
+
+func TestMemoryClientReserve(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	value, err := client1.Reserve("txn", "core1", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "core1", value)
+
+	value, err = client2.Reserve("txn", "core2", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("core1"), value)
+
+	assert.NotNil(t, client2.ReleaseReservation("txn"))
+	assert.Nil(t, client1.ReleaseReservation("txn"))
+
+	value, err = client2.Reserve("txn", "core2", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "core2", value)
+	assert.Nil(t, client2.ReleaseAllReservations())
+
+	kvp, err := client1.Get("txn", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+}
+
+func TestMemoryClientReservationExpiry(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	_, err := client.Reserve("txn", "core1", 1)
+	assert.Nil(t, err)
+	ch := client.Watch("txn")
+
+	event := waitForEvent(t, ch)
+	assert.Equal(t, DELETE, event.EventType)
+	assert.Equal(t, "lease-expired", client.RenewReservation("txn").Error())
+}
+
+func TestMemoryClientRenewReservation(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	_, err := client.Reserve("txn", "core1", 1)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		time.Sleep(600 * time.Millisecond)
+		assert.Nil(t, client.RenewReservation("txn"))
+	}
+	kvp, err := client.Get("txn", 0)
+	assert.Nil(t, err)
+	assert.NotNil(t, kvp)
+}
+
+func TestMemoryClientWatch(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	ch := client.Watch("devices")
+	assert.Nil(t, client.Put("devices/1", "one", 0))
+	assert.Nil(t, client.Put("adapters/1", "ignored", 0))
+	assert.Nil(t, client.Delete("devices/1", 0))
+
+	event := waitForEvent(t, ch)
+	assert.Equal(t, PUT, event.EventType)
+	assert.Equal(t, "devices/1", event.Key)
+	assert.Equal(t, []byte("one"), event.Value)
+	version := event.Version
+
+	event = waitForEvent(t, ch)
+	assert.Equal(t, DELETE, event.EventType)
+	assert.Equal(t, "devices/1", event.Key)
+	assert.True(t, event.Version > version)
+
+	client.CloseWatch("devices", ch)
+	_, open := <-ch
+	assert.False(t, open)
+}
+
+func TestMemoryClientPutIfVersion(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	version, err := client.PutIfVersion("key", "one", 0, 0)
+	assert.Nil(t, err)
+	_, err = client.PutIfVersion("key", "two", 0, 0)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	kvp, err := client.Get("key", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, version, kvp.Version)
+
+	newVersion, err := client.PutIfVersion("key", "two", version, 0)
+	assert.Nil(t, err)
+	assert.True(t, newVersion > version)
+	_, err = client.PutIfVersion("key", "three", version, 0)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	assert.Equal(t, ErrVersionMismatch, client.DeleteIfVersion("key", version, 0))
+	assert.Nil(t, client.DeleteIfVersion("key", newVersion, 0))
+	kvp, err = client.Get("key", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp)
+}
+
+func TestMemoryClientTxn(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	assert.Nil(t, client.Put("a", "one", 0))
+	kvp, err := client.Get("a", 0)
+	assert.Nil(t, err)
+
+	// A stale version aborts the whole transaction
+	_, err = client.Txn([]*TxnOp{
+		NewTxnOp(TXN_PUT, "b", "two", 0),
+		NewTxnOp(TXN_DELETE, "a", nil, kvp.Version+1),
+	}, 0)
+	assert.Equal(t, ErrVersionMismatch, err)
+	kvp2, err := client.Get("b", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, kvp2)
+
+	version, err := client.Txn([]*TxnOp{
+		NewTxnOp(TXN_CHECK, "c", nil, 0),
+		NewTxnOp(TXN_PUT, "b", "two", 0),
+		NewTxnOp(TXN_DELETE, "a", nil, kvp.Version),
+	}, 0)
+	assert.Nil(t, err)
+	m, err := client.List("", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(m))
+	assert.Equal(t, []byte("two"), m["b"].Value)
+	assert.Equal(t, version, m["b"].Version)
+}
+
+func TestMemoryClientLock(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	token1, err := client1.Lock("lock", 10, 1)
+	assert.Nil(t, err)
+	_, err = client2.Lock("lock", 10, 1)
+	assert.Equal(t, ErrLockTimeout, err)
+
+	acquired := make(chan int64, 1)
+	go func() {
+		token, _ := client2.Lock("lock", 10, 2)
+		acquired <- token
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, client1.Unlock("lock"))
+	assert.NotNil(t, client1.Unlock("lock"))
+
+	select {
+	case token2 := <-acquired:
+		assert.True(t, token2 > token1)
+	case <-time.After(3 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+	assert.Nil(t, client2.Unlock("lock"))
+}
+
+func TestMemoryClientLockExpiry(t *testing.T) {
+	client1 := newTestMemoryClient(t)
+	defer client1.Close()
+	client2 := newTestMemoryClient(t)
+	defer client2.Close()
+
+	token1, err := client1.Lock("lock", 1, 1)
+	assert.Nil(t, err)
+	token2, err := client2.Lock("lock", 1, 3)
+	assert.Nil(t, err)
+	assert.True(t, token2 > token1)
+}
+
+func TestMemoryClientListPage(t *testing.T) {
+	client := newTestMemoryClient(t)
+	defer client.Close()
+
+	for _, id := range []string{"3", "1", "5", "2", "4"} {
+		assert.Nil(t, client.Put("devices/"+id, "device-"+id, 0))
+	}
+	assert.Nil(t, client.Put("ports/1", "port-1", 0))
+
+	page, err := client.ListPage("devices/", &ListOptions{Limit: 2}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Pairs))
+	assert.Equal(t, "devices/1", page.Pairs[0].Key)
+	assert.Equal(t, "devices/2", page.Pairs[1].Key)
+	assert.Equal(t, []byte("device-1"), page.Pairs[0].Value)
+	assert.Equal(t, "devices/3", page.NextKey)
+
+	page, err = client.ListPage("devices/", &ListOptions{Limit: 2, StartKey: page.NextKey, KeysOnly: true}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(page.Pairs))
+	assert.Equal(t, "devices/3", page.Pairs[0].Key)
+	assert.Nil(t, page.Pairs[0].Value)
+	assert.NotEqual(t, int64(0), page.Pairs[0].Version)
+	assert.Equal(t, "devices/5", page.NextKey)
+
+	page, err = client.ListPage("devices/", &ListOptions{Limit: 2, StartKey: page.NextKey}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(page.Pairs))
+	assert.Equal(t, "", page.NextKey)
+
+	page, err = client.ListPage("devices/", nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(page.Pairs))
+	assert.Equal(t, "", page.NextKey)
+}
+
+func TestMemoryClientConformance(t *testing.T) {
+	addr := t.Name()
+	runConformanceSuite(t, &conformanceHarness{
+		newClient: func(t *testing.T) Client {
+			client, err := NewMemoryClient(addr, 0)
+			assert.Nil(t, err)
+			return client
+		},
+		ttl:           1,
+		expiryTimeout: 3 * time.Second,
+	})
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// SecurityConfig holds the transport and authentication settings used to reach a secured KV store.
+// A nil or zero-valued config yields a plain, unauthenticated connection.
+type SecurityConfig struct {
+	// CertFile and KeyFile hold the client certificate presented to the server
+	CertFile string
+	KeyFile  string
+	// CAFile holds the certificate authority used to verify the server
+	CAFile string
+	// Username and Password are used for etcd role based authentication
+	Username string
+	Password string
+	// Token is the consul ACL token sent with every request
+	Token string
+}
+
+// TLSEnabled returns true if any TLS setting has been provided
+func (s *SecurityConfig) TLSEnabled() bool {
+	return s != nil && (s.CertFile != "" || s.KeyFile != "" || s.CAFile != "")
+}
+
+// TLSConfig builds the tls.Config described by the security settings.  It returns nil when TLS is not enabled.
+func (s *SecurityConfig) TLSConfig() (*tls.Config, error) {
+	if !s.TLSEnabled() {
+		return nil, nil
+	}
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return nil, errors.New("cert-and-key-must-be-set-together")
+	}
+	config := &tls.Config{}
+	if s.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if s.CAFile != "" {
+		pem, err := ioutil.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("invalid-ca-certificate")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package kvstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kvstore-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
+
+func TestSecurityConfigDisabled(t *testing.T) {
+	var nilConfig *SecurityConfig
+	assert.False(t, nilConfig.TLSEnabled())
+	tlsConfig, err := nilConfig.TLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+
+	authOnly := &SecurityConfig{Username: "root", Password: "secret"}
+	assert.False(t, authOnly.TLSEnabled())
+	tlsConfig, err = authOnly.TLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+}
+
+func TestSecurityConfigTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvstore-security")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	security := &SecurityConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile}
+	assert.True(t, security.TLSEnabled())
+	tlsConfig, err := security.TLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(tlsConfig.Certificates))
+	assert.NotNil(t, tlsConfig.RootCAs)
+
+	caOnly := &SecurityConfig{CAFile: certFile}
+	tlsConfig, err = caOnly.TLSConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tlsConfig.Certificates))
+	assert.NotNil(t, tlsConfig.RootCAs)
+}
+
+func TestSecurityConfigInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvstore-security")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, _ := writeTestCertificate(t, dir)
+
+	_, err = (&SecurityConfig{CertFile: certFile}).TLSConfig()
+	assert.NotNil(t, err)
+
+	_, err = (&SecurityConfig{CAFile: filepath.Join(dir, "missing.pem")}).TLSConfig()
+	assert.NotNil(t, err)
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	assert.Nil(t, ioutil.WriteFile(garbage, []byte("not a certificate"), 0600))
+	_, err = (&SecurityConfig{CAFile: garbage}).TLSConfig()
+	assert.NotNil(t, err)
+}
@@ -17,40 +17,75 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/opencord/voltha-go/common/log"
 	"github.com/opencord/voltha-go/db/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"hash/fnv"
+	"net"
+	"net/url"
 	"strconv"
 	"sync"
 	"time"
 )
 
-//TODO: missing cache stuff
-//TODO: missing retry stuff
 //TODO: missing proper logging
 
+// default_ListPageSize is the number of items retrieved per request when iterating over a key prefix
+const default_ListPageSize = 500
+
+// keyLockStripes is the number of locks the keys of a backend are spread over
+const keyLockStripes = 64
+
+// ErrCircuitOpen is returned when the KV store is deemed unavailable after sustained failures
+var ErrCircuitOpen = errors.New("kv-circuit-open")
+
 // Backend structure holds details for accessing the kv store
 type Backend struct {
 	sync.RWMutex
-	Client     kvstore.Client
-	StoreType  string
-	Host       string
-	Port       int
-	Timeout    int
-	PathPrefix string
+	Client         kvstore.Client
+	StoreType      string
+	Host           string
+	Port           int
+	Timeout        int
+	PathPrefix     string
+	ListPageSize   int
+	Security       *kvstore.SecurityConfig
+	RetryPolicy    *RetryPolicy
+	CircuitBreaker *CircuitBreaker
+	cache          *backendCache
+	writeBehind    *writeBehind
+	writes         *writeTracker
+	fences         map[string]*fenceGuard
+
+	// keyLocks serialize the operations made on a key, while those made on other keys run concurrently
+	keyLocks [keyLockStripes]sync.Mutex
 }
 
 // NewBackend creates a new instance of a Backend structure
 func NewBackend(storeType string, host string, port int, timeout int, pathPrefix string) *Backend {
+	return NewSecureBackend(storeType, host, port, timeout, pathPrefix, nil)
+}
+
+// NewSecureBackend creates a new instance of a Backend structure whose kv client connects using the
+// provided TLS and authentication settings
+func NewSecureBackend(storeType string, host string, port int, timeout int, pathPrefix string,
+	security *kvstore.SecurityConfig) *Backend {
 	var err error
 
 	b := &Backend{
-		StoreType:  storeType,
-		Host:       host,
-		Port:       port,
-		Timeout:    timeout,
-		PathPrefix: pathPrefix,
+		StoreType:      storeType,
+		Host:           host,
+		Port:           port,
+		Timeout:        timeout,
+		PathPrefix:     pathPrefix,
+		ListPageSize:   default_ListPageSize,
+		Security:       security,
+		RetryPolicy:    NewRetryPolicy(),
+		CircuitBreaker: NewCircuitBreaker(default_CircuitFailureThreshold, default_CircuitResetTimeout),
 	}
 
 	address := host + ":" + strconv.Itoa(port)
@@ -61,12 +96,35 @@ func NewBackend(storeType string, host string, port int, timeout int, pathPrefix
 	return b
 }
 
+// NewBackendFromClient creates a new instance of a Backend structure on top of a kv client created by the
+// caller, e.g. to share the client, or the database file of a bolt store, with other components
+func NewBackendFromClient(client kvstore.Client, storeType string, timeout int, pathPrefix string) *Backend {
+	return &Backend{
+		Client:         client,
+		StoreType:      storeType,
+		Timeout:        timeout,
+		PathPrefix:     pathPrefix,
+		ListPageSize:   default_ListPageSize,
+		RetryPolicy:    NewRetryPolicy(),
+		CircuitBreaker: NewCircuitBreaker(default_CircuitFailureThreshold, default_CircuitResetTimeout),
+	}
+}
+
 func (b *Backend) newClient(address string, timeout int) (kvstore.Client, error) {
 	switch b.StoreType {
 	case "consul":
-		return kvstore.NewConsulClient(address, timeout)
+		return kvstore.NewConsulClientWithSecurity(address, timeout, b.Security)
 	case "etcd":
-		return kvstore.NewEtcdClient(address, timeout)
+		return kvstore.NewEtcdClientWithSecurity(address, timeout, b.Security)
+	case "memory":
+		return kvstore.NewMemoryClient(address, timeout)
+	case "bolt":
+		// The host holds the path of the database file
+		client, err := kvstore.NewBoltClient(b.Host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
 	}
 	return nil, errors.New("Unsupported KV store")
 }
@@ -76,52 +134,374 @@ func (b *Backend) makePath(key string) string {
 	return path
 }
 
-// List retrieves one or more items that match the specified key
-func (b *Backend) List(key string) (map[string]*kvstore.KVPair, error) {
+// EnableCache turns on caching of the items read from the kv store.  The cache is kept coherent by watching
+// for changes under the backend path prefix; changes made by other parties are therefore seen with the delay
+// of the watch notification.
+func (b *Backend) EnableCache() {
 	b.Lock()
 	defer b.Unlock()
 
-	formattedPath := b.makePath(key)
-	log.Debugf("List key: %s, path: %s", key, formattedPath)
+	if b.cache != nil {
+		return
+	}
+	watchKey := b.makePath("")
+	b.cache = newBackendCache(watchKey, b.Client.Watch(watchKey))
+	go b.cache.monitor()
 
-	return b.Client.List(formattedPath, b.Timeout)
+	log.Debugw("cache-enabled", log.Fields{"key": watchKey})
 }
 
-// Get retrieves an item that matches the specified key
-func (b *Backend) Get(key string) (*kvstore.KVPair, error) {
+// DisableCache turns off caching and stops watching the kv store
+func (b *Backend) DisableCache() {
 	b.Lock()
 	defer b.Unlock()
 
+	if b.cache == nil {
+		return
+	}
+	b.cache.close()
+	b.Client.CloseWatch(b.cache.watchKey, b.cache.watchCh)
+	b.cache = nil
+
+	log.Debugw("cache-disabled", log.Fields{"key": b.makePath("")})
+}
+
+// keyLock returns the lock serializing the operations made on a key
+func (b *Backend) keyLock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &b.keyLocks[h.Sum32()%keyLockStripes]
+}
+
+func (b *Backend) getWriteTracker() *writeTracker {
+	b.RLock()
+	defer b.RUnlock()
+	return b.writes
+}
+
+func (b *Backend) getCache() *backendCache {
+	b.RLock()
+	defer b.RUnlock()
+	return b.cache
+}
+
+// CircuitState reports whether the backend currently lets requests through to the kv store
+func (b *Backend) CircuitState() CircuitState {
+	if b.CircuitBreaker == nil {
+		return CIRCUIT_CLOSED
+	}
+	return b.CircuitBreaker.State()
+}
+
+// isRetryable indicates whether an error may be caused by a transient condition of the kv store, i.e. a
+// timeout or a store which cannot be reached.  Any other error, e.g. a version mismatch or a value of an
+// unexpected type, would be returned again by retrying.
+func isRetryable(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	// The consul client reports the failures of its HTTP requests as URL errors
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if netErr, ok := err.(net.Error); ok {
+		_, opErr := netErr.(*net.OpError)
+		return opErr || netErr.Timeout() || netErr.Temporary()
+	}
+	// The etcd client reports timeouts and unavailable servers as gRPC status errors
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return true
+		}
+	}
+	return false
+}
+
+// execute runs a kv store operation according to the retry policy and the state of the circuit breaker
+func (b *Backend) execute(operation string, key string, op func() error) error {
+	maxAttempts := 1
+	var deadline time.Time
+	if b.RetryPolicy != nil {
+		if b.RetryPolicy.MaxAttempts > 1 {
+			maxAttempts = b.RetryPolicy.MaxAttempts
+		}
+		if b.RetryPolicy.Deadline > 0 {
+			deadline = time.Now().Add(b.RetryPolicy.Deadline)
+		}
+	}
+
+	keyLock := b.keyLock(key)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if b.CircuitBreaker != nil && !b.CircuitBreaker.Allow() {
+			log.Debugw("kv-operation-rejected", log.Fields{"operation": operation, "key": key})
+			return ErrCircuitOpen
+		}
+
+		keyLock.Lock()
+		err = op()
+		keyLock.Unlock()
+
+		if err == nil || !isRetryable(err) {
+			if b.CircuitBreaker != nil {
+				b.CircuitBreaker.Success()
+			}
+			return err
+		}
+		if b.CircuitBreaker != nil {
+			b.CircuitBreaker.Failure()
+		}
+
+		if attempt >= maxAttempts {
+			break
+		}
+		backoff := b.RetryPolicy.Backoff(attempt)
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			log.Debugw("kv-operation-deadline-exceeded", log.Fields{"operation": operation, "key": key, "attempt": attempt})
+			break
+		}
+		log.Debugw("kv-operation-retry", log.Fields{"operation": operation, "key": key, "attempt": attempt,
+			"backoff": backoff, "error": err})
+		time.Sleep(backoff)
+	}
+
+	log.Warnw("kv-operation-failed", log.Fields{"operation": operation, "key": key, "error": err})
+	return err
+}
+
+// List retrieves one or more items that match the specified key
+func (b *Backend) List(key string) (map[string]*kvstore.KVPair, error) {
+	formattedPath := b.makePath(key)
+	log.Debugf("List key: %s, path: %s", key, formattedPath)
+
+	if err := b.Flush(); err != nil {
+		log.Warnw("write-behind-flush-failed", log.Fields{"key": key, "error": err})
+	}
+
+	var generation uint64
+	cache := b.getCache()
+	if cache != nil {
+		if pairs, hit := cache.list(formattedPath); hit {
+			GetProfiling().AddToCacheHitCount()
+			return pairs, nil
+		}
+		GetProfiling().AddToCacheMissCount()
+		generation = cache.snapshot()
+	}
+
+	var pairs map[string]*kvstore.KVPair
+	err := b.execute("list", formattedPath, func() error {
+		var err error
+		pairs, err = b.Client.List(formattedPath, b.Timeout)
+		return err
+	})
+	if err == nil && cache != nil {
+		cache.addList(formattedPath, pairs, generation)
+	}
+	return pairs, err
+}
+
+// ListPage retrieves one page of the items that match the specified key, sorted by key.  The start key of the
+// options, and the NextKey of the returned page, are complete kv store keys.  Pages are never cached.
+func (b *Backend) ListPage(key string, options *kvstore.ListOptions) (*kvstore.KVPage, error) {
+	formattedPath := b.makePath(key)
+	log.Debugf("ListPage key: %s, path: %s", key, formattedPath)
+
+	if options == nil || options.StartKey == "" {
+		// Later pages follow the writes flushed for the first one
+		if err := b.Flush(); err != nil {
+			log.Warnw("write-behind-flush-failed", log.Fields{"key": key, "error": err})
+		}
+	}
+
+	var page *kvstore.KVPage
+	err := b.execute("list-page", formattedPath, func() error {
+		var err error
+		page, err = b.Client.ListPage(formattedPath, options, b.Timeout)
+		return err
+	})
+	return page, err
+}
+
+// Iterate calls the handler for every item that matches the specified key, in key order, while holding no
+// more than a page of items in memory.  A page size of 0 or less uses the ListPageSize of the backend.  The
+// iteration stops at the first error returned by the kv store or by the handler.
+func (b *Backend) Iterate(key string, pageSize int, keysOnly bool, handler func(*kvstore.KVPair) error) error {
+	if pageSize <= 0 {
+		pageSize = b.ListPageSize
+	}
+	options := &kvstore.ListOptions{Limit: pageSize, KeysOnly: keysOnly}
+	for {
+		page, err := b.ListPage(key, options)
+		if err != nil {
+			return err
+		}
+		for _, pair := range page.Pairs {
+			if err := handler(pair); err != nil {
+				return err
+			}
+		}
+		if page.NextKey == "" {
+			return nil
+		}
+		options.StartKey = page.NextKey
+	}
+}
+
+// Get retrieves an item that matches the specified key.  The value of a deferred write yet to be made is
+// returned at the version of the key in the kv store, which a conditional write of the key must expect.
+func (b *Backend) Get(key string) (*kvstore.KVPair, error) {
 	formattedPath := b.makePath(key)
 	log.Debugf("Get key: %s, path: %s", key, formattedPath)
 
+	var value []byte
+	pending := false
+	if wb := b.getWriteBehind(); wb != nil {
+		value, pending = wb.get(key)
+	}
+	pair, err := b.get(formattedPath)
+	if err != nil || !pending {
+		return pair, err
+	}
+	if pair == nil {
+		return kvstore.NewKVPair(formattedPath, value, "", 0), nil
+	}
+	return &kvstore.KVPair{Key: pair.Key, Value: value, Session: pair.Session, Lease: pair.Lease,
+		Version: pair.Version}, nil
+}
+
+// get retrieves an item of the kv store, from the cache when enabled
+func (b *Backend) get(formattedPath string) (*kvstore.KVPair, error) {
+	var generation uint64
+	cache := b.getCache()
+	if cache != nil {
+		if pair, hit := cache.get(formattedPath); hit {
+			GetProfiling().AddToCacheHitCount()
+			return pair, nil
+		}
+		GetProfiling().AddToCacheMissCount()
+		generation = cache.snapshot()
+	}
+
+	var pair *kvstore.KVPair
 	start := time.Now()
-	err, pair := b.Client.Get(formattedPath, b.Timeout)
+	err := b.execute("get", formattedPath, func() error {
+		var err error
+		pair, err = b.Client.Get(formattedPath, b.Timeout)
+		return err
+	})
 	stop := time.Now()
 
 	GetProfiling().AddToDatabaseRetrieveTime(stop.Sub(start).Seconds())
 
-	return err, pair
+	if err == nil && cache != nil {
+		cache.add(formattedPath, pair, generation)
+	}
+	return pair, err
 }
 
 // Put stores an item value under the specifed key
 func (b *Backend) Put(key string, value interface{}) error {
-	b.Lock()
-	defer b.Unlock()
-
 	formattedPath := b.makePath(key)
 	log.Debugf("Put key: %s, value: %+v, path: %s", key, string(value.([]byte)), formattedPath)
 
-	return b.Client.Put(formattedPath, value, b.Timeout)
+	writes := b.getWriteTracker()
+	writes.begin(formattedPath, value, 0)
+	err := b.execute("put", formattedPath, func() error {
+		return b.Client.Put(formattedPath, value, b.Timeout)
+	})
+	writes.end(formattedPath, 0)
+	b.invalidate(formattedPath, false)
+	return err
+}
+
+// PutIfVersion stores an item value under the specified key only if the key is still at the given version.
+// kvstore.ErrVersionMismatch is returned when the item was modified by someone else.
+func (b *Backend) PutIfVersion(key string, value interface{}, version int64) (int64, error) {
+	formattedPath := b.makePath(key)
+	log.Debugf("PutIfVersion key: %s, version: %d, path: %s", key, version, formattedPath)
+
+	writes := b.getWriteTracker()
+	writes.begin(formattedPath, value, version)
+	var newVersion int64
+	err := b.execute("put-if-version", formattedPath, func() error {
+		var err error
+		newVersion, err = b.Client.PutIfVersion(formattedPath, value, version, b.Timeout)
+		return err
+	})
+	writes.end(formattedPath, newVersion)
+	b.invalidate(formattedPath, false)
+	return newVersion, err
+}
+
+// Txn applies a set of operations atomically; either all of them are applied or none is.  The keys of the
+// operations are relative to the path prefix of the backend.  The version of the keys put by the transaction
+// is returned.
+func (b *Backend) Txn(ops []*kvstore.TxnOp) (int64, error) {
+	formattedOps := make([]*kvstore.TxnOp, len(ops))
+	for i, op := range ops {
+		formattedOps[i] = kvstore.NewTxnOp(op.Type, b.makePath(op.Key), op.Value, op.Version)
+	}
+	formattedPath := b.makePath("")
+	log.Debugf("Txn operations: %d, path: %s", len(ops), formattedPath)
+
+	writes := b.getWriteTracker()
+	for _, op := range formattedOps {
+		writes.begin(op.Key, op.Value, op.Version)
+	}
+	var version int64
+	err := b.execute("txn", formattedPath, func() error {
+		var err error
+		version, err = b.Client.Txn(formattedOps, b.Timeout)
+		return err
+	})
+	for _, op := range formattedOps {
+		writes.end(op.Key, version)
+		b.invalidate(op.Key, false)
+	}
+	return version, err
 }
 
 // Delete removes an item under the specified key
 func (b *Backend) Delete(key string) error {
-	b.Lock()
-	defer b.Unlock()
-
 	formattedPath := b.makePath(key)
 	log.Debugf("Delete key: %s, path: %s", key, formattedPath)
 
-	return b.Client.Delete(formattedPath, b.Timeout)
+	if wb := b.getWriteBehind(); wb != nil {
+		wb.discard(key)
+	}
+
+	writes := b.getWriteTracker()
+	writes.begin(formattedPath, nil, 0)
+	err := b.execute("delete", formattedPath, func() error {
+		return b.Client.Delete(formattedPath, b.Timeout)
+	})
+	writes.end(formattedPath, 0)
+	b.invalidate(formattedPath, true)
+	return err
+}
+
+// DeleteIfVersion removes the item under the specified key, and only that one, if the key is still at the
+// given version.  kvstore.ErrVersionMismatch is returned when the item was modified by someone else.
+func (b *Backend) DeleteIfVersion(key string, version int64) error {
+	formattedPath := b.makePath(key)
+	log.Debugf("DeleteIfVersion key: %s, version: %d, path: %s", key, version, formattedPath)
+
+	writes := b.getWriteTracker()
+	writes.begin(formattedPath, nil, version)
+	err := b.execute("delete-if-version", formattedPath, func() error {
+		return b.Client.DeleteIfVersion(formattedPath, version, b.Timeout)
+	})
+	writes.end(formattedPath, 0)
+	b.invalidate(formattedPath, false)
+	return err
+}
+
+// invalidate drops the cached items affected by a write, without waiting for the kv store notification
+func (b *Backend) invalidate(formattedPath string, isPrefix bool) {
+	if cache := b.getCache(); cache != nil {
+		cache.invalidate(formattedPath, isPrefix)
+	}
 }
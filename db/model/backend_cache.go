@@ -0,0 +1,174 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"strings"
+	"sync"
+)
+
+// backendCache holds the items read from the kv store by a backend.  Entries are invalidated when the
+// kv store reports a change, or when the backend itself writes to the key.  Prefixes which were fully
+// listed are tracked so that subsequent List calls, and Get calls for missing keys, can be answered
+// without reaching the kv store.
+type backendCache struct {
+	sync.RWMutex
+	entries    map[string]*kvstore.KVPair
+	listed     map[string]struct{}
+	generation uint64
+	closed     bool
+	watchKey   string
+	watchCh    chan *kvstore.Event
+}
+
+func newBackendCache(watchKey string, watchCh chan *kvstore.Event) *backendCache {
+	return &backendCache{
+		entries:  make(map[string]*kvstore.KVPair),
+		listed:   make(map[string]struct{}),
+		watchKey: watchKey,
+		watchCh:  watchCh,
+	}
+}
+
+// covered indicates whether a key belongs to a prefix which was fully listed.  The cache lock must be held.
+func (c *backendCache) covered(key string) bool {
+	for prefix := range c.listed {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the cached item for a key.  A nil item with a hit means the key is known not to exist.
+func (c *backendCache) get(key string) (*kvstore.KVPair, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed {
+		return nil, false
+	}
+	if pair, ok := c.entries[key]; ok {
+		return copyPair(pair), true
+	}
+	return nil, c.covered(key)
+}
+
+// list returns the cached items matching a prefix, if that prefix was fully listed before
+func (c *backendCache) list(prefix string) (map[string]*kvstore.KVPair, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.closed || !c.covered(prefix) {
+		return nil, false
+	}
+	pairs := make(map[string]*kvstore.KVPair)
+	for key, pair := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			pairs[key] = copyPair(pair)
+		}
+	}
+	return pairs, true
+}
+
+// snapshot returns the current generation of the cache.  It must be taken before reading from the kv
+// store so that a result which raced with an invalidation is not cached.
+func (c *backendCache) snapshot() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.generation
+}
+
+// add caches an item read from the kv store
+func (c *backendCache) add(key string, pair *kvstore.KVPair, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed || generation != c.generation || pair == nil {
+		return
+	}
+	c.entries[key] = copyPair(pair)
+}
+
+// addList caches the complete set of items matching a prefix
+func (c *backendCache) addList(prefix string, pairs map[string]*kvstore.KVPair, generation uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed || generation != c.generation {
+		return
+	}
+	for key, pair := range pairs {
+		c.entries[key] = copyPair(pair)
+	}
+	c.listed[prefix] = struct{}{}
+}
+
+// invalidate drops a key, or all the keys matching a prefix, along with the listed prefixes they belong to
+func (c *backendCache) invalidate(key string, isPrefix bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.generation++
+	if isPrefix {
+		for k := range c.entries {
+			if strings.HasPrefix(k, key) {
+				delete(c.entries, k)
+			}
+		}
+	} else {
+		delete(c.entries, key)
+	}
+	for prefix := range c.listed {
+		if strings.HasPrefix(key, prefix) || (isPrefix && strings.HasPrefix(prefix, key)) {
+			delete(c.listed, prefix)
+		}
+	}
+}
+
+// close empties the cache and stops it from serving or accepting items
+func (c *backendCache) close() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.closed = true
+	c.generation++
+	c.entries = make(map[string]*kvstore.KVPair)
+	c.listed = make(map[string]struct{})
+}
+
+// monitor invalidates the entries reported as changed by the kv store.  The cache cannot be kept coherent
+// once the watch ends, so it is closed at that point.
+func (c *backendCache) monitor() {
+	for event := range c.watchCh {
+		key, err := kvstore.ToString(event.Key)
+		if err != nil {
+			log.Warnw("cache-unexpected-key-type", log.Fields{"key": event.Key})
+			continue
+		}
+		c.invalidate(key, false)
+	}
+	log.Debugw("cache-watch-closed", log.Fields{"key": c.watchKey})
+	c.close()
+}
+
+func copyPair(pair *kvstore.KVPair) *kvstore.KVPair {
+	p := *pair
+	return &p
+}
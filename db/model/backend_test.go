@@ -16,14 +16,23 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/url"
 	"testing"
+	"time"
 )
 
 const (
 	ETCD_KV    = "etcd"
 	CONSUL_KV  = "consul"
+	MEMORY_KV  = "memory"
 	INVALID_KV = "invalid"
 
 	etcd_host = "10.104.149.247"
@@ -36,6 +45,8 @@ const (
 	*/
 	//etcd_host   = "localhost"
 	//etcd_port   = 22379
+	memory_host = "localhost"
+	memory_port = 0
 	consul_host = "k8s-consul"
 	consul_port = 30080
 	timeout     = 5
@@ -47,6 +58,7 @@ const (
 var (
 	etcd_backend   *Backend
 	consul_backend *Backend
+	memory_backend *Backend
 )
 
 func Test_Etcd_Backend_New(t *testing.T) {
@@ -127,3 +139,453 @@ func Test_Consul_Backend_Delete(t *testing.T) {
 	//	t.Errorf("backend delete failed - %s", err.Error())
 	//}
 }
+
+func Test_Memory_Backend_New(t *testing.T) {
+	memory_backend = NewBackend(MEMORY_KV, memory_host, memory_port, timeout, prefix)
+	if memory_backend.Client == nil {
+		t.Error("memory backend has no client")
+	}
+}
+
+func Test_Memory_Backend_Put(t *testing.T) {
+	if err := memory_backend.Put(key, []byte(value)); err != nil {
+		t.Errorf("backend put failed - %s", err.Error())
+	}
+}
+
+func Test_Memory_Backend_Get(t *testing.T) {
+	if pair, err := memory_backend.Get(key); err != nil {
+		t.Errorf("backend get failed - %s", err.Error())
+	} else if pair == nil {
+		t.Errorf("backend get returned nothing - key: %s", key)
+	} else {
+		if pair.Key != (prefix + "/" + key) {
+			t.Errorf("backend key differs - key: %s, expected: %s", pair.Key, key)
+		}
+
+		v := fmt.Sprintf("%s", pair.Value)
+		if v != value {
+			t.Errorf("backend value differs - value: %s, expected:%s", pair.Value, value)
+		}
+	}
+}
+
+func Test_Memory_Backend_Delete(t *testing.T) {
+	if err := memory_backend.Delete(key); err != nil {
+		t.Errorf("backend delete failed - %s", err.Error())
+	}
+	if pair, _ := memory_backend.Get(key); pair != nil {
+		t.Errorf("backend delete failed - key still present: %s", key)
+	}
+}
+
+func Test_Invalid_Backend_New(t *testing.T) {
+	if invalid := NewBackend(INVALID_KV, memory_host, memory_port, timeout, prefix); invalid.Client != nil {
+		t.Error("invalid backend should not have a client")
+	}
+}
+
+// flakyClient fails a number of Get requests before letting them through to the wrapped client
+type flakyClient struct {
+	kvstore.Client
+	failures int
+	calls    int
+	err      error
+}
+
+func (c *flakyClient) Get(key string, timeout int) (*kvstore.KVPair, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, c.err
+	}
+	return c.Client.Get(key, timeout)
+}
+
+func newFlakyBackend(t *testing.T, failures int) (*Backend, *flakyClient) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	// As reported by the etcd client
+	err := status.Error(codes.Unavailable, "etcdserver: request timed out")
+	client := &flakyClient{Client: b.Client, failures: failures, err: err}
+	b.Client = client
+	b.RetryPolicy.InitialBackoff = time.Millisecond
+	b.RetryPolicy.MaxBackoff = 5 * time.Millisecond
+	return b, client
+}
+
+func Test_Backend_Retry_Recovers(t *testing.T) {
+	b, client := newFlakyBackend(t, 2)
+	if err := b.Put(key, []byte(value)); err != nil {
+		t.Errorf("backend put failed - %s", err.Error())
+	}
+	if pair, err := b.Get(key); err != nil || pair == nil {
+		t.Errorf("backend get failed after retries - err: %v", err)
+	}
+	if client.calls != 3 {
+		t.Errorf("unexpected number of attempts - calls: %d, expected: 3", client.calls)
+	}
+}
+
+func Test_Backend_Retry_Exhausted(t *testing.T) {
+	b, client := newFlakyBackend(t, 10)
+	if _, err := b.Get(key); err == nil {
+		t.Error("backend get should have failed")
+	}
+	if client.calls != b.RetryPolicy.MaxAttempts {
+		t.Errorf("unexpected number of attempts - calls: %d, expected: %d", client.calls, b.RetryPolicy.MaxAttempts)
+	}
+}
+
+func Test_Backend_Retry_Deadline(t *testing.T) {
+	b, client := newFlakyBackend(t, 10)
+	b.RetryPolicy.MaxAttempts = 10
+	b.RetryPolicy.InitialBackoff = 20 * time.Millisecond
+	b.RetryPolicy.Jitter = 0
+	b.RetryPolicy.Deadline = 50 * time.Millisecond
+	if _, err := b.Get(key); err == nil {
+		t.Error("backend get should have failed")
+	}
+	if client.calls >= b.RetryPolicy.MaxAttempts {
+		t.Errorf("deadline was not enforced - calls: %d", client.calls)
+	}
+}
+
+func Test_Backend_Retry_Transient(t *testing.T) {
+	transient := []error{
+		context.DeadlineExceeded,
+		status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+		&url.Error{Op: "Get", URL: "http://localhost:8500", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}},
+	}
+	for _, err := range transient {
+		b, client := newFlakyBackend(t, 1)
+		client.err = err
+		if _, err := b.Get(key); err != nil {
+			t.Errorf("backend get failed after retries - err: %v", err)
+		}
+		if client.calls != 2 {
+			t.Errorf("transient error not retried - err: %v, calls: %d", err, client.calls)
+		}
+	}
+}
+
+func Test_Backend_Retry_Deterministic(t *testing.T) {
+	deterministic := []error{
+		kvstore.ErrVersionMismatch,
+		kvstore.ErrTxnTooLarge,
+		ErrCircuitOpen,
+		fmt.Errorf("unexpected-type-%T", 0),
+	}
+	for _, err := range deterministic {
+		b, client := newFlakyBackend(t, 1)
+		client.err = err
+		if _, got := b.Get(key); got != err {
+			t.Errorf("unexpected error - err: %v, expected: %v", got, err)
+		}
+		if client.calls != 1 {
+			t.Errorf("deterministic error retried - err: %v, calls: %d", err, client.calls)
+		}
+	}
+}
+
+func Test_Backend_Circuit_Opens(t *testing.T) {
+	b, client := newFlakyBackend(t, 100)
+	b.RetryPolicy.MaxAttempts = 1
+	b.CircuitBreaker = NewCircuitBreaker(3, time.Hour)
+	for i := 0; i < 3; i++ {
+		b.Get(key)
+	}
+	if b.CircuitState() != CIRCUIT_OPEN {
+		t.Errorf("circuit should be open - state: %s", b.CircuitState())
+	}
+	if _, err := b.Get(key); err != ErrCircuitOpen {
+		t.Errorf("backend get should have been rejected - err: %v", err)
+	}
+	if client.calls != 3 {
+		t.Errorf("rejected request reached the client - calls: %d", client.calls)
+	}
+}
+
+func waitForCacheInvalidation(b *Backend, key string) bool {
+	for i := 0; i < 100; i++ {
+		if _, hit := b.getCache().get(b.makePath(key)); !hit {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func Test_Backend_Cache_Get(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	b.EnableCache()
+	defer b.DisableCache()
+	GetProfiling().Reset()
+
+	b.Put(key, []byte(value))
+	b.Get(key)
+	b.Get(key)
+	if GetProfiling().CacheMissCount != 1 || GetProfiling().CacheHitCount != 1 {
+		t.Errorf("unexpected cache counts - hits: %d, misses: %d", GetProfiling().CacheHitCount,
+			GetProfiling().CacheMissCount)
+	}
+
+	// A change made by someone else is seen once the watch notification is received
+	b.Client.Put(b.makePath(key), "other", timeout)
+	if !waitForCacheInvalidation(b, key) {
+		t.Fatal("cache entry was not invalidated")
+	}
+	if pair, _ := b.Get(key); pair == nil || string(pair.Value.([]byte)) != "other" {
+		t.Errorf("backend get returned stale data - pair: %+v", pair)
+	}
+}
+
+func Test_Backend_Cache_List(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	b.EnableCache()
+	defer b.DisableCache()
+	GetProfiling().Reset()
+
+	b.Put("devices/1", []byte("one"))
+	b.Put("devices/2", []byte("two"))
+	if pairs, _ := b.List("devices"); len(pairs) != 2 {
+		t.Errorf("unexpected number of items - items: %d", len(pairs))
+	}
+	if pairs, _ := b.List("devices"); len(pairs) != 2 {
+		t.Errorf("unexpected number of cached items - items: %d", len(pairs))
+	}
+	// Missing keys under a listed prefix are known not to exist
+	if pair, _ := b.Get("devices/3"); pair != nil {
+		t.Errorf("unexpected item - pair: %+v", pair)
+	}
+	if GetProfiling().CacheMissCount != 1 || GetProfiling().CacheHitCount != 2 {
+		t.Errorf("unexpected cache counts - hits: %d, misses: %d", GetProfiling().CacheHitCount,
+			GetProfiling().CacheMissCount)
+	}
+
+	b.Delete("devices/1")
+	if pairs, _ := b.List("devices"); len(pairs) != 1 {
+		t.Errorf("unexpected number of items after delete - items: %d", len(pairs))
+	}
+}
+
+func Test_Backend_Iterate(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	b.ListPageSize = 2
+
+	for i := 5; i > 0; i-- {
+		b.Put(fmt.Sprintf("devices/%d", i), []byte(fmt.Sprintf("device-%d", i)))
+	}
+
+	var keys []string
+	if err := b.Iterate("devices", 0, false, func(pair *kvstore.KVPair) error {
+		keys = append(keys, pair.Key)
+		return nil
+	}); err != nil {
+		t.Errorf("backend iterate failed - %s", err.Error())
+	}
+	if len(keys) != 5 || keys[0] != prefix+"/devices/1" || keys[4] != prefix+"/devices/5" {
+		t.Errorf("unexpected iteration - keys: %+v", keys)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	if err := b.Iterate("devices", 1, true, func(pair *kvstore.KVPair) error {
+		if pair.Value != nil {
+			t.Errorf("unexpected value in keys only iteration - pair: %+v", pair)
+		}
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	}); err != stop || count != 3 {
+		t.Errorf("iteration did not stop - error: %v, count: %d", err, count)
+	}
+}
+
+type txnCountingClient struct {
+	kvstore.Client
+	txns   int
+	maxOps int
+}
+
+func (c *txnCountingClient) Txn(ops []*kvstore.TxnOp, timeout int) (int64, error) {
+	c.txns++
+	if c.maxOps > 0 && len(ops) > c.maxOps {
+		return 0, kvstore.ErrTxnTooLarge
+	}
+	return c.Client.Txn(ops, timeout)
+}
+
+func (c *txnCountingClient) MaxTxnOps() int {
+	return c.maxOps
+}
+
+func newWriteBehindBackend(t *testing.T) (*Backend, *txnCountingClient) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	client := &txnCountingClient{Client: b.Client}
+	b.Client = client
+	b.EnableWriteBehind(&WriteBehindPolicy{MaxBatch: 100, Delay: 50 * time.Millisecond})
+	return b, client
+}
+
+func Test_Backend_WriteBehind_Batches(t *testing.T) {
+	b, client := newWriteBehindBackend(t)
+	defer b.DisableWriteBehind()
+
+	versions := make(chan int64, 11)
+	done := func(version int64, err error) error {
+		if err != nil {
+			t.Errorf("deferred write failed - %s", err.Error())
+		}
+		versions <- version
+		return err
+	}
+	for i := 0; i < 10; i++ {
+		b.PutBehind(fmt.Sprintf("devices/%d", i), []byte(fmt.Sprintf("device-%d", i)), 0, done)
+	}
+	// Writes to a key waiting to be made are coalesced
+	b.PutBehind("devices/0", []byte("device-0-updated"), 0, done)
+
+	if !b.IsWritePending("devices/0") {
+		t.Error("write should be pending")
+	}
+	if pair, _ := b.Get("devices/0"); pair == nil || string(pair.Value.([]byte)) != "device-0-updated" ||
+		pair.Key != b.makePath("devices/0") || pair.Version != 0 {
+		t.Errorf("backend get should return the pending value - pair: %+v", pair)
+	}
+
+	if err := b.Flush(); err != nil {
+		t.Fatalf("backend flush failed - %s", err.Error())
+	}
+	if client.txns != 1 {
+		t.Errorf("writes were not batched - transactions: %d", client.txns)
+	}
+	if pair, _ := b.Client.Get(b.makePath("devices/0"), timeout); pair == nil ||
+		string(pair.Value.([]byte)) != "device-0-updated" {
+		t.Errorf("coalesced value was not stored - pair: %+v", pair)
+	}
+	first := <-versions
+	for i := 1; i < 11; i++ {
+		if version := <-versions; version != first || version == 0 {
+			t.Errorf("unexpected version of batched write - version: %d, expected: %d", version, first)
+		}
+	}
+
+	// The pending value of a stored key is at the version of the stored one
+	b.PutBehind("devices/1", []byte("device-1-updated"), first, nil)
+	if pair, _ := b.Get("devices/1"); pair == nil || string(pair.Value.([]byte)) != "device-1-updated" ||
+		pair.Version != first {
+		t.Errorf("backend get should return the pending value at the stored version - pair: %+v", pair)
+	}
+}
+
+func Test_Backend_WriteBehind_TxnLimit(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	client := &txnCountingClient{Client: b.Client, maxOps: 4}
+	b.Client = client
+	b.EnableWriteBehind(&WriteBehindPolicy{MaxBatch: 100, Delay: 50 * time.Millisecond})
+	defer b.DisableWriteBehind()
+
+	for i := 0; i < 10; i++ {
+		b.PutBehind(fmt.Sprintf("devices/%d", i), []byte(fmt.Sprintf("device-%d", i)), 0, nil)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("backend flush failed - %s", err.Error())
+	}
+	if client.txns != 3 {
+		t.Errorf("batches not limited to the transactions of the KV store - transactions: %d", client.txns)
+	}
+	if pairs, _ := b.List("devices"); len(pairs) != 10 {
+		t.Errorf("unexpected stored writes - pairs: %d", len(pairs))
+	}
+}
+
+func Test_Backend_WriteBehind_Conflicts(t *testing.T) {
+	b, _ := newWriteBehindBackend(t)
+	defer b.DisableWriteBehind()
+
+	// A write expecting the version replaced by the previous write of its key, before its writers know the
+	// version, is rebased
+	b.PutBehind("devices/1", []byte("one"), 0, func(version int64, err error) error {
+		b.PutBehind("devices/1", []byte("one-updated"), 0, nil)
+		return err
+	})
+	b.PutBehind("devices/2", []byte("two"), 0, nil)
+	if err := b.Flush(); err != nil {
+		t.Fatalf("backend flush failed - %s", err.Error())
+	}
+	if err := b.Flush(); err != nil {
+		t.Errorf("stale expected version was not rebased - %s", err.Error())
+	}
+	// The versions are no longer tracked once the writers know them
+	wb := b.getWriteBehind()
+	wb.Lock()
+	if len(wb.versions) != 0 {
+		t.Errorf("versions still tracked - versions: %+v", wb.versions)
+	}
+	wb.Unlock()
+
+	// The key modified by someone else fails, without failing the others of the batch
+	one, _ := b.Get("devices/1")
+	two, _ := b.Get("devices/2")
+	b.Client.Put(b.makePath("devices/2"), []byte("other"), timeout)
+	var conflict error
+	b.PutBehind("devices/1", []byte("one-again"), one.Version, nil)
+	b.PutBehind("devices/2", []byte("two-updated"), two.Version, func(version int64, err error) error {
+		conflict = err
+		return err
+	})
+	if err := b.Flush(); err != kvstore.ErrVersionMismatch {
+		t.Errorf("backend flush should report the conflict - err: %v", err)
+	}
+	if conflict != kvstore.ErrVersionMismatch {
+		t.Errorf("deferred write should have failed - err: %v", conflict)
+	}
+	if pair, _ := b.Get("devices/1"); pair == nil || string(pair.Value.([]byte)) != "one-again" {
+		t.Errorf("write batched with a conflict was not stored - pair: %+v", pair)
+	}
+
+	// A conflict resolved by its writer is not reported
+	two, _ = b.Get("devices/2")
+	b.Client.Put(b.makePath("devices/2"), []byte("other-again"), timeout)
+	b.PutBehind("devices/2", []byte("two-resolved"), two.Version, func(version int64, err error) error {
+		return nil
+	})
+	if err := b.Flush(); err != nil {
+		t.Errorf("backend flush should not report a resolved conflict - err: %v", err)
+	}
+
+	if err := b.DisableWriteBehind(); err != nil {
+		t.Errorf("backend write-behind disabling failed - %s", err.Error())
+	}
+	if b.PutBehind("devices/1", []byte("one-disabled"), kvstore.AnyVersion, nil) {
+		t.Error("write should not be deferred once write-behind is disabled")
+	}
+}
+
+func Test_Backend_WriteBehind_Delete(t *testing.T) {
+	b, _ := newWriteBehindBackend(t)
+	defer b.DisableWriteBehind()
+
+	discarded := make(chan error, 1)
+	b.PutBehind("devices/1", []byte("one"), 0, func(version int64, err error) error {
+		discarded <- err
+		return nil
+	})
+	b.Delete("devices")
+
+	select {
+	case err := <-discarded:
+		if err != ErrWriteDiscarded {
+			t.Errorf("unexpected outcome of discarded write - err: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("discarded write was not completed")
+	}
+	if err := b.Flush(); err != nil {
+		t.Errorf("backend flush failed - %s", err.Error())
+	}
+	if pair, _ := b.Get("devices/1"); pair != nil {
+		t.Errorf("discarded write was stored - pair: %+v", pair)
+	}
+}
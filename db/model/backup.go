@@ -0,0 +1,302 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"io"
+	"strings"
+	"time"
+)
+
+// BackupFormatVersion identifies the layout of the backup archives produced by this version
+const BackupFormatVersion = 1
+
+// BackupArchive is the portable representation of the content of a backend.  Keys are relative to the
+// path prefix of the backend they were exported from, so that an archive can be restored under another
+// prefix and into another type of kv store.
+type BackupArchive struct {
+	FormatVersion int
+	Created       time.Time
+	StoreType     string
+	PathPrefix    string
+	Entries       []*BackupEntry
+}
+
+// BackupEntry holds a single item of a backup archive.  The key of an item stored by the data model is the
+// hash of the revision it holds; the checksum protects the value itself.
+type BackupEntry struct {
+	Key      string
+	Value    []byte
+	Version  int64
+	Checksum string
+}
+
+func checksum(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// backupHeader is the part of a BackupArchive preceding its entries
+type backupHeader struct {
+	FormatVersion int
+	Created       time.Time
+	StoreType     string
+	PathPrefix    string
+}
+
+// Backup exports all the items under the path prefix of the backend to a gzip compressed archive.  Items
+// attached to a lease or a session (e.g. transaction reservations) are ephemeral and are left out.  The items
+// are streamed page by page to the archive, in key order, so that the size of the kv store does not bound the
+// memory used.  The number of exported items is returned.
+func (b *Backend) Backup(w io.Writer) (int, error) {
+	zw := gzip.NewWriter(w)
+	header, err := json.Marshal(&backupHeader{
+		FormatVersion: BackupFormatVersion,
+		Created:       time.Now().UTC(),
+		StoreType:     b.StoreType,
+		PathPrefix:    b.PathPrefix,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// The entries are appended to the fields of the header, as they would be encoded in a BackupArchive
+	if _, err := zw.Write(header[:len(header)-1]); err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(zw, `,"Entries":[`); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	basePath := b.makePath("")
+	err = b.Iterate("", 0, false, func(pair *kvstore.KVPair) error {
+		if pair.Lease != 0 || pair.Session != "" {
+			log.Debugw("backup-skipping-ephemeral-key", log.Fields{"key": pair.Key})
+			return nil
+		}
+		value, err := kvstore.ToByte(pair.Value)
+		if err != nil {
+			return fmt.Errorf("unexpected-value-type-for-key-%s", pair.Key)
+		}
+		entry, err := json.Marshal(&BackupEntry{
+			Key:      strings.TrimPrefix(pair.Key, basePath),
+			Value:    value,
+			Version:  pair.Version,
+			Checksum: checksum(value),
+		})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			if _, err := io.WriteString(zw, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := zw.Write(entry); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := io.WriteString(zw, "]}\n"); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	log.Infow("backup-complete", log.Fields{"prefix": b.PathPrefix, "entries": count})
+	return count, nil
+}
+
+// ReadBackupArchive decodes and verifies an archive produced by Backup
+func ReadBackupArchive(r io.Reader) (*BackupArchive, error) {
+	archive := &BackupArchive{}
+	header, err := readBackupArchive(r, func(entry *BackupEntry) error {
+		archive.Entries = append(archive.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	archive.FormatVersion = header.FormatVersion
+	archive.Created = header.Created
+	archive.StoreType = header.StoreType
+	archive.PathPrefix = header.PathPrefix
+	return archive, nil
+}
+
+// readBackupArchive decodes an archive produced by Backup one entry at a time.  The handler is called for
+// every entry, once its checksum is verified; the decoding stops at the first error it returns.
+func readBackupArchive(r io.Reader, handler func(*BackupEntry) error) (*backupHeader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	header := &backupHeader{}
+	checkFormat := func() error {
+		if header.FormatVersion != BackupFormatVersion {
+			return fmt.Errorf("unsupported-backup-format-%d", header.FormatVersion)
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(zr)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		var field interface{}
+		switch token {
+		case "FormatVersion":
+			field = &header.FormatVersion
+		case "Created":
+			field = &header.Created
+		case "StoreType":
+			field = &header.StoreType
+		case "PathPrefix":
+			field = &header.PathPrefix
+		case "Entries":
+			// The header precedes the entries, which are only handled once the format is known
+			if err := checkFormat(); err != nil {
+				return nil, err
+			}
+			if err := readBackupEntries(decoder, handler); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			field = &json.RawMessage{}
+		}
+		if err := decoder.Decode(field); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+	if err := checkFormat(); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// readBackupEntries decodes the list of entries of an archive
+func readBackupEntries(decoder *json.Decoder, handler func(*BackupEntry) error) error {
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("unexpected-backup-token-%v", token)
+	}
+	for decoder.More() {
+		entry := &BackupEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			return err
+		}
+		if checksum(entry.Value) != entry.Checksum {
+			return fmt.Errorf("corrupted-backup-entry-%s", entry.Key)
+		}
+		if err := handler(entry); err != nil {
+			return err
+		}
+	}
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, expected json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("unexpected-backup-token-%v", token)
+	}
+	return nil
+}
+
+// Restore imports the items of a backup archive under the path prefix of the backend.  The backend is
+// expected to be empty unless force is set, in which case existing items are overwritten.  Keys are
+// translated to the conventions of the kv store type of the backend.  The items are written as they are
+// read from the archive: a corrupted archive may be partially restored.  The number of restored items is
+// returned.
+func (b *Backend) Restore(r io.Reader, force bool) (int, error) {
+	if !force {
+		existing, err := b.ListPage("", &kvstore.ListOptions{Limit: 1, KeysOnly: true})
+		if err != nil {
+			return 0, err
+		}
+		if len(existing.Pairs) > 0 {
+			return 0, errors.New("backend-not-empty")
+		}
+	}
+
+	count := 0
+	header, err := readBackupArchive(r, func(entry *BackupEntry) error {
+		if err := b.Put(translateKey(entry.Key, b.StoreType), entry.Value); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if header.StoreType != b.StoreType {
+		log.Infow("restore-translated-store-type", log.Fields{"from": header.StoreType, "to": b.StoreType})
+	}
+
+	log.Infow("restore-complete", log.Fields{"prefix": b.PathPrefix, "entries": count,
+		"source-prefix": header.PathPrefix, "source-store": header.StoreType})
+	return count, nil
+}
+
+// translateKey adapts a key to the conventions of a kv store type.  Consul rejects keys starting with a
+// slash and empty path segments, both of which are accepted by etcd.
+func translateKey(key string, storeType string) string {
+	if storeType != "consul" {
+		return key
+	}
+	for strings.Contains(key, "//") {
+		key = strings.Replace(key, "//", "/", -1)
+	}
+	return strings.TrimPrefix(key, "/")
+}
+
+// NormalizePathPrefix adapts a backend path prefix to the conventions of a kv store type
+func NormalizePathPrefix(prefix string, storeType string) string {
+	return strings.TrimSuffix(translateKey(prefix, storeType), "/")
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+)
+
+func Test_Backup_Restore(t *testing.T) {
+	source := NewBackend(MEMORY_KV, t.Name()+"-source", memory_port, timeout, "service/voltha/data/core/0001")
+	source.Put("devices/1", []byte("one"))
+	source.Put("devices/2", []byte("two"))
+	source.Put("0123456789abcdef", []byte("root"))
+	// Ephemeral keys are not exported
+	source.Client.Reserve(source.makePath("transactions/1"), "core1", 10)
+
+	var archive bytes.Buffer
+	if count, err := source.Backup(&archive); err != nil {
+		t.Fatalf("backup failed - %s", err.Error())
+	} else if count != 3 {
+		t.Errorf("unexpected number of exported entries - count: %d", count)
+	}
+	content := archive.Bytes()
+
+	target := NewBackend(MEMORY_KV, t.Name()+"-target", memory_port, timeout, "voltha/restored")
+	if count, err := target.Restore(bytes.NewReader(content), false); err != nil {
+		t.Fatalf("restore failed - %s", err.Error())
+	} else if count != 3 {
+		t.Errorf("unexpected number of restored entries - count: %d", count)
+	}
+	if pair, _ := target.Get("devices/2"); pair == nil || string(pair.Value.([]byte)) != "two" {
+		t.Errorf("entry not restored - pair: %+v", pair)
+	}
+	if pair, _ := target.Get("transactions/1"); pair != nil {
+		t.Errorf("ephemeral entry restored - pair: %+v", pair)
+	}
+
+	if _, err := target.Restore(bytes.NewReader(content), false); err == nil {
+		t.Error("restore into a non-empty backend should fail")
+	}
+	if _, err := target.Restore(bytes.NewReader(content), true); err != nil {
+		t.Errorf("forced restore failed - %s", err.Error())
+	}
+}
+
+func Test_Backup_Paged(t *testing.T) {
+	source := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	source.ListPageSize = 1
+	source.Put("devices/2", []byte("two"))
+	source.Put("devices/1", []byte("one"))
+	source.Put("devices/3", []byte("three"))
+
+	var archive bytes.Buffer
+	if count, err := source.Backup(&archive); err != nil || count != 3 {
+		t.Fatalf("backup failed - count: %d, error: %v", count, err)
+	}
+	decoded, err := ReadBackupArchive(bytes.NewReader(archive.Bytes()))
+	if err != nil || len(decoded.Entries) != 3 {
+		t.Fatalf("cannot read archive - archive: %+v, error: %v", decoded, err)
+	}
+	for i, key := range []string{"devices/1", "devices/2", "devices/3"} {
+		if decoded.Entries[i].Key != key {
+			t.Errorf("unexpected entry - index: %d, entry: %+v", i, decoded.Entries[i])
+		}
+	}
+}
+
+func Test_Backup_Corrupted(t *testing.T) {
+	source := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	source.Put("devices/1", []byte("one"))
+
+	var archive bytes.Buffer
+	source.Backup(&archive)
+	decoded, _ := ReadBackupArchive(bytes.NewReader(archive.Bytes()))
+	if decoded == nil || len(decoded.Entries) != 1 {
+		t.Fatalf("cannot read archive - archive: %+v", decoded)
+	}
+
+	decoded.Entries[0].Value = []byte("altered")
+	var altered bytes.Buffer
+	zw := gzip.NewWriter(&altered)
+	json.NewEncoder(zw).Encode(decoded)
+	zw.Close()
+	if _, err := ReadBackupArchive(&altered); err == nil {
+		t.Error("corrupted archive should be rejected")
+	}
+}
+
+func Test_Backup_Translate_Key(t *testing.T) {
+	if key := translateKey("/devices//1", CONSUL_KV); key != "devices/1" {
+		t.Errorf("unexpected consul key - key: %s", key)
+	}
+	if key := translateKey("/devices//1", ETCD_KV); key != "/devices//1" {
+		t.Errorf("unexpected etcd key - key: %s", key)
+	}
+	if p := NormalizePathPrefix("/service/voltha/", CONSUL_KV); p != "service/voltha" {
+		t.Errorf("unexpected consul prefix - prefix: %s", p)
+	}
+}
@@ -37,7 +37,7 @@ type ModelTestConfig struct {
 var (
 	modelTestConfig = &ModelTestConfig{
 		DbPrefix: "service/voltha",
-		DbType:   "etcd",
+		DbType:   "memory",
 		DbHost:   "localhost",
 		//DbHost:    "10.106.153.44",
 		DbPort:    2379,
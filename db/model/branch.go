@@ -16,9 +16,11 @@
 
 package model
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
-// TODO: implement weak references or something equivalent
 // TODO: missing proper logging
 
 // Branch structure is used to classify a collection of transaction based revisions
@@ -29,6 +31,14 @@ type Branch struct {
 	Origin    Revision
 	Revisions map[string]Revision
 	Latest    Revision
+	History   []*RevisionInfo
+}
+
+// RevisionInfo identifies a revision which was the latest of a branch, and when it became the latest
+type RevisionInfo struct {
+	Hash     string
+	Time     time.Time
+	revision Revision
 }
 
 // NewBranch creates a new instance of the Branch structure
@@ -43,12 +53,58 @@ func NewBranch(node *node, txid string, origin Revision, autoPrune bool) *Branch
 	return b
 }
 
-// SetLatest assigns the latest revision for this branch
+// SetLatest assigns the latest revision for this branch and records it in the history of the branch
 func (b *Branch) SetLatest(latest Revision) {
 	b.Lock()
 	defer b.Unlock()
 
 	b.Latest = latest
+	if latest != nil {
+		b.History = append(b.History, &RevisionInfo{Hash: latest.GetHash(), Time: time.Now(), revision: latest})
+	}
+	// Transaction branches are short-lived and their origin is needed to merge them
+	if b.Txid == "" {
+		b.pruneHistory(GetRetentionPolicy(), time.Now())
+	}
+}
+
+// GetHistory returns the revisions which were the latest of the branch, oldest first
+func (b *Branch) GetHistory() []*RevisionInfo {
+	b.Lock()
+	defer b.Unlock()
+
+	history := make([]*RevisionInfo, len(b.History))
+	for i, info := range b.History {
+		history[i] = &RevisionInfo{Hash: info.Hash, Time: info.Time}
+	}
+	return history
+}
+
+// findInHistory returns the most recent revision of the history recorded with a hash
+func (b *Branch) findInHistory(hash string) Revision {
+	b.Lock()
+	defer b.Unlock()
+
+	for i := len(b.History) - 1; i >= 0; i-- {
+		if b.History[i].Hash == hash {
+			return b.History[i].revision
+		}
+	}
+	return nil
+}
+
+// hashInHistory returns the hash a revision was recorded with in the history, which differs from its current
+// hash once the revision is indexed by its parent
+func (b *Branch) hashInHistory(revision Revision) string {
+	b.Lock()
+	defer b.Unlock()
+
+	for i := len(b.History) - 1; i >= 0; i-- {
+		if b.History[i].revision == revision {
+			return b.History[i].Hash
+		}
+	}
+	return revision.GetHash()
 }
 
 // GetLatest retrieves the latest revision of the branch
@@ -79,11 +135,7 @@ func (b *Branch) GetRevision(hash string) Revision {
 	b.Lock()
 	defer b.Unlock()
 
-	if revision, ok := b.Revisions[hash]; !ok {
-		return revision
-	}
-
-	return nil
+	return b.Revisions[hash]
 }
 
 // SetRevision updates a revision entry at the specified hash
@@ -93,3 +145,93 @@ func (b *Branch) SetRevision(hash string, revision Revision) {
 
 	b.Revisions[hash] = revision
 }
+
+// prune drops the revisions of the branch which are no longer retained by a policy and returns their number
+func (b *Branch) prune(policy RetentionPolicy, now time.Time) int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.pruneHistory(policy, now)
+}
+
+// pruneHistory drops the oldest revisions of the history exceeding the number of revisions or which stopped
+// being the latest longer ago than the maximum age.  The branch lock must be held.
+func (b *Branch) pruneHistory(policy RetentionPolicy, now time.Time) int {
+	drop := 0
+	if policy.MaxRevisions > 0 && len(b.History) > policy.MaxRevisions {
+		drop = len(b.History) - policy.MaxRevisions
+	}
+	if policy.MaxAge > 0 {
+		for drop < len(b.History)-1 && now.Sub(b.History[drop+1].Time) > policy.MaxAge {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return 0
+	}
+	removed := b.History[:drop]
+	b.History = append([]*RevisionInfo(nil), b.History[drop:]...)
+	return len(b.dropUnretained(removed))
+}
+
+// evict removes an entry from the history and returns the revisions dropped as a result.  The latest revision
+// is never evicted.
+func (b *Branch) evict(info *RevisionInfo) []Revision {
+	b.Lock()
+	defer b.Unlock()
+
+	for i := 0; i < len(b.History)-1; i++ {
+		if b.History[i] == info {
+			b.History = append(b.History[:i:i], b.History[i+1:]...)
+			return b.dropUnretained([]*RevisionInfo{info})
+		}
+	}
+	return nil
+}
+
+// dropUnretained removes the revisions which are neither in the history nor the latest or origin of the
+// branch, and returns them along with the revisions of the removed history entries no longer retained.  The
+// branch lock must be held.
+func (b *Branch) dropUnretained(removed []*RevisionInfo) []Revision {
+	retained := make(map[Revision]struct{}, len(b.History)+2)
+	for _, info := range b.History {
+		retained[info.revision] = struct{}{}
+	}
+	retained[b.Latest] = struct{}{}
+	retained[b.Origin] = struct{}{}
+
+	var dropped []Revision
+	for hash, rev := range b.Revisions {
+		if _, exists := retained[rev]; !exists {
+			delete(b.Revisions, hash)
+			// Each dropped revision is reported once
+			retained[rev] = struct{}{}
+			dropped = append(dropped, rev)
+		}
+	}
+	for _, info := range removed {
+		if _, exists := retained[info.revision]; !exists {
+			retained[info.revision] = struct{}{}
+			dropped = append(dropped, info.revision)
+		}
+	}
+	return dropped
+}
+
+// retained returns the revisions held by the branch
+func (b *Branch) retained() []Revision {
+	b.RLock()
+	defer b.RUnlock()
+
+	revisions := make([]Revision, 0, len(b.Revisions)+len(b.History)+1)
+	for _, rev := range b.Revisions {
+		revisions = append(revisions, rev)
+	}
+	for _, info := range b.History {
+		revisions = append(revisions, info.revision)
+	}
+	if b.Latest != nil {
+		revisions = append(revisions, b.Latest)
+	}
+	return revisions
+}
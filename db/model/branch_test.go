@@ -19,6 +19,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"testing"
+	"time"
 )
 
 var (
@@ -69,3 +70,67 @@ func Test_ConfigBranch_OriginRevision(t *testing.T) {
 	rev := BRANCH.Origin
 	t.Logf("Got Origin revision:%+v\n", rev)
 }
+func Test_ConfigBranch_History(t *testing.T) {
+	branch := NewBranch(&node{}, "", nil, true)
+	first := &NonPersistedRevision{Config: &DataRevision{}, Hash: "first", Branch: branch}
+	second := &NonPersistedRevision{Config: &DataRevision{}, Hash: "second", Branch: branch}
+
+	branch.AddRevision(first)
+	branch.SetLatest(first)
+	branch.AddRevision(second)
+	branch.SetLatest(second)
+	// The hash of a revision changes once it is indexed by its parent
+	second.SetHash("devices/second")
+
+	history := branch.GetHistory()
+	if len(history) != 2 || history[0].Hash != "first" || history[1].Hash != "second" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if history[1].Time.Before(history[0].Time) {
+		t.Error("history is not ordered")
+	}
+	if branch.GetRevision("first") != first {
+		t.Error("revision not found by hash")
+	}
+	if branch.findInHistory("second") != second || branch.findInHistory("unknown") != nil {
+		t.Error("unexpected revision found in history")
+	}
+	if hash := branch.hashInHistory(second); hash != "second" {
+		t.Errorf("unexpected hash in history: %s", hash)
+	}
+}
+
+func Test_ConfigBranch_Prune(t *testing.T) {
+	defer SetRetentionPolicy(GetRetentionPolicy())
+	SetRetentionPolicy(RetentionPolicy{MaxRevisions: 3})
+
+	branch := NewBranch(&node{}, "", nil, true)
+	var revisions []Revision
+	for i := 0; i < 5; i++ {
+		rev := &NonPersistedRevision{Config: &DataRevision{}, Hash: fmt.Sprintf("rev-%d", i), Branch: branch}
+		revisions = append(revisions, rev)
+		branch.AddRevision(rev)
+		branch.SetLatest(rev)
+	}
+
+	history := branch.GetHistory()
+	if len(history) != 3 || history[0].Hash != "rev-2" || history[2].Hash != "rev-4" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if branch.GetRevision("rev-1") != nil || branch.GetRevision("rev-2") != revisions[2] {
+		t.Error("revisions not pruned along with the history")
+	}
+
+	// Revisions which stopped being the latest longer ago than the maximum age are dropped
+	if pruned := branch.prune(RetentionPolicy{MaxAge: time.Hour}, time.Now().Add(2*time.Hour)); pruned != 2 {
+		t.Errorf("unexpected number of revisions pruned: %d", pruned)
+	}
+	if branch.GetLatest() != revisions[4] || len(branch.GetHistory()) != 1 || len(branch.Revisions) != 1 {
+		t.Errorf("latest revision not retained: %+v", branch.GetHistory())
+	}
+
+	// The latest revision is never evicted
+	if dropped := branch.evict(branch.History[0]); len(dropped) != 0 {
+		t.Errorf("latest revision evicted: %+v", dropped)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/opencord/voltha-go/common/log"
+	"sync"
+	"time"
+)
+
+const (
+	default_CallbackWorkers = 8
+	default_CallbackTimeout = 10 * time.Second
+)
+
+// ErrCallbackTimeout is reported when an asynchronous callback does not complete within its timeout
+var ErrCallbackTimeout = errors.New("callback-timeout")
+
+// CallbackOptions select how a callback registered on a proxy is executed
+type CallbackOptions struct {
+	// Async hands the POST_* callbacks to the callback dispatcher, which runs them on a pool of workers in the
+	// order of the changes made at the path of the proxy.  Other callbacks are always executed inline.
+	Async bool
+	// Timeout after which an asynchronous callback is reported as failed; the dispatcher default when 0
+	Timeout time.Duration
+}
+
+// CallbackFailure describes an asynchronous callback which panicked, returned an error or timed out
+type CallbackFailure struct {
+	Path     string
+	Type     CallbackType
+	Callback string
+	Err      error
+}
+
+// CallbackDispatcherStats reports the activity of a callback dispatcher
+type CallbackDispatcherStats struct {
+	Pending  int
+	Executed int
+	Failed   int
+	TimedOut int
+}
+
+// callbackTask is the execution of a callback for a change made at a path
+type callbackTask struct {
+	path         string
+	callbackType CallbackType
+	tuple        *CallbackTuple
+	context      []interface{}
+}
+
+// CallbackDispatcher executes the asynchronous callbacks of the data models on a pool of workers.  The callbacks
+// dispatched for a path are executed one at a time, in the order they were dispatched, while those of different
+// paths run concurrently.  A callback which times out is reported and left running: the next callback of its
+// path no longer waits for it.
+type CallbackDispatcher struct {
+	sync.Mutex
+	workers        int
+	timeout        time.Duration
+	failureHandler func(*CallbackFailure)
+
+	// queues holds the pending tasks of each path; ready lists the paths with pending tasks and no running task
+	queues  map[string][]*callbackTask
+	ready   []string
+	wakeup  *sync.Cond
+	stopped bool
+	started bool
+	wg      sync.WaitGroup
+
+	stats CallbackDispatcherStats
+}
+
+// NewCallbackDispatcher creates a dispatcher running callbacks on a number of workers, with a default timeout
+func NewCallbackDispatcher(workers int, timeout time.Duration) *CallbackDispatcher {
+	if workers <= 0 {
+		workers = default_CallbackWorkers
+	}
+	if timeout <= 0 {
+		timeout = default_CallbackTimeout
+	}
+	d := &CallbackDispatcher{
+		workers: workers,
+		timeout: timeout,
+		queues:  make(map[string][]*callbackTask),
+	}
+	d.wakeup = sync.NewCond(&d.Mutex)
+	return d
+}
+
+var callbackDispatcher = NewCallbackDispatcher(default_CallbackWorkers, default_CallbackTimeout)
+var callbackDispatcherLock sync.RWMutex
+
+// SetCallbackDispatcher sets the dispatcher executing the asynchronous callbacks of all the data models.  The
+// previous dispatcher is stopped once its pending callbacks are executed.
+func SetCallbackDispatcher(dispatcher *CallbackDispatcher) {
+	callbackDispatcherLock.Lock()
+	previous := callbackDispatcher
+	callbackDispatcher = dispatcher
+	callbackDispatcherLock.Unlock()
+
+	previous.Stop()
+}
+
+// GetCallbackDispatcher returns the dispatcher executing the asynchronous callbacks of all the data models
+func GetCallbackDispatcher() *CallbackDispatcher {
+	callbackDispatcherLock.RLock()
+	defer callbackDispatcherLock.RUnlock()
+
+	return callbackDispatcher
+}
+
+// SetFailureHandler sets a function called with every callback failure, in addition to it being logged
+func (d *CallbackDispatcher) SetFailureHandler(handler func(*CallbackFailure)) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.failureHandler = handler
+}
+
+// GetStats returns the activity of the dispatcher
+func (d *CallbackDispatcher) GetStats() CallbackDispatcherStats {
+	d.Lock()
+	defer d.Unlock()
+
+	stats := d.stats
+	for _, tasks := range d.queues {
+		stats.Pending += len(tasks)
+	}
+	return stats
+}
+
+// dispatch queues a task behind the other tasks of its path.  It never blocks.
+func (d *CallbackDispatcher) dispatch(task *callbackTask) {
+	d.Lock()
+	defer d.Unlock()
+
+	if d.stopped {
+		log.Warnw("callback-dispatcher-stopped", log.Fields{"path": task.path, "callback": task.tuple.name})
+		return
+	}
+	if !d.started {
+		d.started = true
+		for i := 0; i < d.workers; i++ {
+			d.wg.Add(1)
+			go d.work()
+		}
+	}
+
+	queue, queued := d.queues[task.path]
+	d.queues[task.path] = append(queue, task)
+	if !queued {
+		d.ready = append(d.ready, task.path)
+		d.wakeup.Signal()
+	}
+}
+
+// Stop executes the pending callbacks and stops the workers.  Callbacks dispatched afterwards are dropped.
+func (d *CallbackDispatcher) Stop() {
+	d.Lock()
+	d.stopped = true
+	d.wakeup.Broadcast()
+	d.Unlock()
+
+	d.wg.Wait()
+}
+
+// work executes the next task of the ready paths until the dispatcher is stopped and no task is left.  The
+// path of a running task stays out of the ready list so that its tasks never run concurrently.
+func (d *CallbackDispatcher) work() {
+	defer d.wg.Done()
+
+	d.Lock()
+	for {
+		for len(d.ready) == 0 && !(d.stopped && len(d.queues) == 0) {
+			d.wakeup.Wait()
+		}
+		if len(d.ready) == 0 {
+			d.Unlock()
+			return
+		}
+		path := d.ready[0]
+		d.ready = d.ready[1:]
+		task := d.queues[path][0]
+		d.Unlock()
+
+		err := d.execute(task)
+
+		d.Lock()
+		d.stats.Executed++
+		if err != nil {
+			d.stats.Failed++
+			if err == ErrCallbackTimeout {
+				d.stats.TimedOut++
+			}
+		}
+		if remaining := d.queues[path][1:]; len(remaining) > 0 {
+			d.queues[path] = remaining
+			d.ready = append(d.ready, path)
+			d.wakeup.Signal()
+		} else {
+			delete(d.queues, path)
+			if d.stopped && len(d.queues) == 0 {
+				d.wakeup.Broadcast()
+			}
+		}
+		if err != nil {
+			d.report(task, err)
+		}
+	}
+}
+
+// execute runs the callback of a task within its timeout.  The dispatcher lock must not be held.
+func (d *CallbackDispatcher) execute(task *callbackTask) error {
+	timeout := task.tuple.options.Timeout
+	if timeout <= 0 {
+		timeout = d.timeout
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("callback-panic: %+v", r)
+			}
+		}()
+		result := task.tuple.Execute(task.context)
+		if err, ok := result.(error); ok && err != nil {
+			done <- err
+			return
+		}
+		done <- nil
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrCallbackTimeout
+	}
+}
+
+// report logs a callback failure and passes it to the failure handler.  The dispatcher lock must be held; it is
+// released while the handler runs.
+func (d *CallbackDispatcher) report(task *callbackTask, err error) {
+	failure := &CallbackFailure{Path: task.path, Type: task.callbackType, Callback: task.tuple.name, Err: err}
+	log.Errorw("callback-failed", log.Fields{"path": failure.Path, "type": failure.Type.String(),
+		"callback": failure.Callback, "error": err})
+
+	if handler := d.failureHandler; handler != nil {
+		d.Unlock()
+		handler(failure)
+		d.Lock()
+	}
+}
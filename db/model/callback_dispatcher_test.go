@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newDispatcherTestTask(path string, options CallbackOptions, callback CallbackFunction, context ...interface{}) *callbackTask {
+	return &callbackTask{
+		path:         path,
+		callbackType: POST_UPDATE,
+		tuple:        &CallbackTuple{callback: callback, name: "test-callback", options: options},
+		context:      context,
+	}
+}
+
+func Test_CallbackDispatcher_Order(t *testing.T) {
+	d := NewCallbackDispatcher(4, time.Second)
+
+	var lock sync.Mutex
+	executed := make(map[string][]int)
+	record := func(args ...interface{}) interface{} {
+		// Give the other workers a chance to run a callback of the same path out of order
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		defer lock.Unlock()
+		path := args[0].(string)
+		executed[path] = append(executed[path], args[1].(int))
+		return nil
+	}
+
+	paths := []string{"/devices/a", "/devices/b", "/devices/c"}
+	for i := 0; i < 20; i++ {
+		for _, path := range paths {
+			d.dispatch(newDispatcherTestTask(path, CallbackOptions{}, record, path, i))
+		}
+	}
+	d.Stop()
+
+	for _, path := range paths {
+		if len(executed[path]) != 20 {
+			t.Fatalf("callbacks of %s not all executed - count: %d", path, len(executed[path]))
+		}
+		for i, value := range executed[path] {
+			if value != i {
+				t.Errorf("callbacks of %s executed out of order - got: %v", path, executed[path])
+				break
+			}
+		}
+	}
+	if stats := d.GetStats(); stats.Executed != 60 || stats.Failed != 0 || stats.Pending != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func Test_CallbackDispatcher_Concurrency(t *testing.T) {
+	d := NewCallbackDispatcher(2, time.Second)
+	defer d.Stop()
+
+	// Each callback waits for the one of the other path: they only complete if both run at once
+	first := make(chan struct{})
+	second := make(chan struct{})
+	done := make(chan struct{}, 2)
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{}, func(args ...interface{}) interface{} {
+		close(first)
+		<-second
+		done <- struct{}{}
+		return nil
+	}))
+	d.dispatch(newDispatcherTestTask("/devices/b", CallbackOptions{}, func(args ...interface{}) interface{} {
+		close(second)
+		<-first
+		done <- struct{}{}
+		return nil
+	}))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("callbacks of different paths should run concurrently")
+		}
+	}
+}
+
+func Test_CallbackDispatcher_Failures(t *testing.T) {
+	d := NewCallbackDispatcher(1, time.Hour)
+
+	var lock sync.Mutex
+	var failures []*CallbackFailure
+	d.SetFailureHandler(func(failure *CallbackFailure) {
+		lock.Lock()
+		defer lock.Unlock()
+		failures = append(failures, failure)
+	})
+
+	release := make(chan struct{})
+	executed := false
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{}, func(args ...interface{}) interface{} {
+		return errors.New("failed")
+	}))
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{}, func(args ...interface{}) interface{} {
+		panic("panicked")
+	}))
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{Timeout: 10 * time.Millisecond},
+		func(args ...interface{}) interface{} {
+			<-release
+			return nil
+		}))
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{}, func(args ...interface{}) interface{} {
+		executed = true
+		return nil
+	}))
+	d.Stop()
+	close(release)
+
+	if !executed {
+		t.Errorf("callback following the failures should have been executed")
+	}
+	if len(failures) != 3 {
+		t.Fatalf("unexpected failures - count: %d", len(failures))
+	}
+	if failures[0].Err.Error() != "failed" || failures[0].Path != "/devices/a" || failures[0].Type != POST_UPDATE {
+		t.Errorf("unexpected failure: %+v", failures[0])
+	}
+	if failures[1].Err == nil || failures[1].Err == ErrCallbackTimeout {
+		t.Errorf("panic should have been reported - got: %v", failures[1].Err)
+	}
+	if failures[2].Err != ErrCallbackTimeout {
+		t.Errorf("timeout should have been reported - got: %v", failures[2].Err)
+	}
+	if stats := d.GetStats(); stats.Executed != 4 || stats.Failed != 3 || stats.TimedOut != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func Test_CallbackDispatcher_Stopped(t *testing.T) {
+	d := NewCallbackDispatcher(1, time.Second)
+	d.Stop()
+
+	executed := false
+	d.dispatch(newDispatcherTestTask("/devices/a", CallbackOptions{}, func(args ...interface{}) interface{} {
+		executed = true
+		return nil
+	}))
+	d.Stop()
+
+	if executed || d.GetStats().Pending != 0 {
+		t.Errorf("callbacks dispatched after stop should be dropped")
+	}
+}
@@ -48,6 +48,8 @@ type ChildType struct {
 	IsContainer bool
 	Key         string
 	KeyFromStr  func(s string) interface{}
+	// Indexes lists the string attributes, besides the key, by which the children can be looked up
+	Indexes []string
 }
 
 // ChildrenFields retrieves list of child objects associated to a given interface
@@ -120,6 +122,7 @@ func ChildrenFields(cls interface{}) map[string]*ChildType {
 						IsContainer: isContainer,
 						Key:         meta.(*common.ChildNode).GetKey(),
 						KeyFromStr:  keyFromStr,
+						Indexes:     meta.(*common.ChildNode).GetIndexes(),
 					}
 
 					names[field.GetName()] = &ct
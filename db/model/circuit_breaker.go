@@ -0,0 +1,136 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"github.com/opencord/voltha-go/common/log"
+	"sync"
+	"time"
+)
+
+// CircuitState is an enumerated value to express whether calls are let through a circuit breaker
+type CircuitState uint8
+
+// Enumerated list of circuit states
+const (
+	CIRCUIT_CLOSED CircuitState = iota
+	CIRCUIT_OPEN
+	CIRCUIT_HALF_OPEN
+)
+
+var enumCircuitStates = []string{
+	"CLOSED",
+	"OPEN",
+	"HALF_OPEN",
+}
+
+func (s CircuitState) String() string {
+	return enumCircuitStates[s]
+}
+
+// Default circuit breaker values
+const (
+	default_CircuitFailureThreshold = 5
+	default_CircuitResetTimeout     = 10 * time.Second
+)
+
+// CircuitBreaker stops calls to the KV store after a number of consecutive failures.  Once the reset
+// timeout has elapsed, a single trial call is let through; its success closes the circuit again
+// while its failure re-opens it.
+type CircuitBreaker struct {
+	sync.Mutex
+	FailureThreshold int
+	ResetTimeout     time.Duration
+	state            CircuitState
+	failures         int
+	openedAt         time.Time
+	trialInProgress  bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(failureThreshold int, resetTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		ResetTimeout:     resetTimeout,
+		state:            CIRCUIT_CLOSED,
+	}
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.Lock()
+	defer cb.Unlock()
+	return cb.state
+}
+
+// Allow indicates whether a call may proceed
+func (cb *CircuitBreaker) Allow() bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case CIRCUIT_OPEN:
+		if time.Since(cb.openedAt) < cb.ResetTimeout {
+			return false
+		}
+		cb.setState(CIRCUIT_HALF_OPEN)
+		cb.trialInProgress = true
+		return true
+	case CIRCUIT_HALF_OPEN:
+		if cb.trialInProgress {
+			return false
+		}
+		cb.trialInProgress = true
+		return true
+	}
+	return true
+}
+
+// Success records a call which reached the KV store
+func (cb *CircuitBreaker) Success() {
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.failures = 0
+	cb.trialInProgress = false
+	if cb.state != CIRCUIT_CLOSED {
+		cb.setState(CIRCUIT_CLOSED)
+	}
+}
+
+// Failure records a call which could not reach the KV store
+func (cb *CircuitBreaker) Failure() {
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.failures++
+	cb.trialInProgress = false
+	if cb.state == CIRCUIT_HALF_OPEN || (cb.state == CIRCUIT_CLOSED && cb.failures >= cb.FailureThreshold) {
+		cb.openedAt = time.Now()
+		cb.setState(CIRCUIT_OPEN)
+	}
+}
+
+// setState changes the state of the circuit.  The circuit lock must be held.
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if state == CIRCUIT_OPEN {
+		log.Warnw("kv-circuit-opened", log.Fields{"failures": cb.failures, "reset-timeout": cb.ResetTimeout})
+	} else {
+		log.Infow("kv-circuit-state-change", log.Fields{"from": cb.state.String(), "to": state.String()})
+	}
+	cb.state = state
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_CircuitBreaker_Trip(t *testing.T) {
+	cb := NewCircuitBreaker(2, time.Hour)
+	cb.Failure()
+	if cb.State() != CIRCUIT_CLOSED || !cb.Allow() {
+		t.Errorf("circuit should still be closed - state: %s", cb.State())
+	}
+	cb.Failure()
+	if cb.State() != CIRCUIT_OPEN || cb.Allow() {
+		t.Errorf("circuit should be open - state: %s", cb.State())
+	}
+}
+
+func Test_CircuitBreaker_Success_Resets_Failures(t *testing.T) {
+	cb := NewCircuitBreaker(2, time.Hour)
+	cb.Failure()
+	cb.Success()
+	cb.Failure()
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Errorf("circuit should be closed - state: %s", cb.State())
+	}
+}
+
+func Test_CircuitBreaker_Half_Open(t *testing.T) {
+	cb := NewCircuitBreaker(1, 10*time.Millisecond)
+	cb.Failure()
+	time.Sleep(20 * time.Millisecond)
+
+	if !cb.Allow() {
+		t.Error("trial request should be allowed")
+	}
+	if cb.State() != CIRCUIT_HALF_OPEN {
+		t.Errorf("circuit should be half open - state: %s", cb.State())
+	}
+	if cb.Allow() {
+		t.Error("only one trial request should be allowed")
+	}
+
+	cb.Failure()
+	if cb.State() != CIRCUIT_OPEN {
+		t.Errorf("failed trial should re-open the circuit - state: %s", cb.State())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	cb.Allow()
+	cb.Success()
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Errorf("successful trial should close the circuit - state: %s", cb.State())
+	}
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	p := NewRetryPolicy()
+	p.Jitter = 0
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, e := range expected {
+		if b := p.Backoff(i + 1); b != e {
+			t.Errorf("unexpected backoff - attempt: %d, backoff: %s, expected: %s", i+1, b, e)
+		}
+	}
+	if b := p.Backoff(10); b != p.MaxBackoff {
+		t.Errorf("backoff should be capped - backoff: %s, expected: %s", b, p.MaxBackoff)
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if b := p.Backoff(1); b < 50*time.Millisecond || b > 150*time.Millisecond {
+			t.Errorf("backoff out of jitter range - backoff: %s", b)
+		}
+	}
+}
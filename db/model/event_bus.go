@@ -17,16 +17,16 @@
 package model
 
 import (
-	"encoding/json"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/opencord/voltha-go/common/log"
 	"github.com/opencord/voltha-go/protos/voltha"
+	"reflect"
 )
 
 // EventBus contains the details required to communicate with the event bus mechanism
 type EventBus struct {
-	client *EventBusClient
-	topic  string
+	marshaler *jsonpb.Marshaler
 }
 
 // ignoredCallbacks keeps a list of callbacks that should not be advertised on the event bus
@@ -43,20 +43,23 @@ var (
 // NewEventBus creates a new instance of the EventBus structure
 func NewEventBus() *EventBus {
 	bus := &EventBus{
-		client: NewEventBusClient(),
-		topic:  "model-change-events",
+		marshaler: &jsonpb.Marshaler{OrigName: true},
 	}
 	return bus
 }
 
-// Advertise will publish the provided information to the event bus
+// Advertise will publish the provided information to the event bus, through the client set for the data models.
+// The arguments are the type of the change, the hash of the revision, the path of the changed data, e.g.
+// /devices/{id}/flows, the previous data and the latest data.
 func (bus *EventBus) Advertise(args ...interface{}) interface{} {
 	eventType := args[0].(CallbackType)
 	hash := args[1].(string)
-	data := args[2:]
+	path := args[2].(string)
+	data := args[3:]
 
 	if _, ok := ignoredCallbacks[eventType]; ok {
 		log.Debugf("ignoring event - type:%s, data:%+v", eventType, data)
+		return nil
 	}
 	var kind voltha.ConfigEventType_ConfigEventType
 	switch eventType {
@@ -68,27 +71,46 @@ func (bus *EventBus) Advertise(args ...interface{}) interface{} {
 		kind = voltha.ConfigEventType_update
 	}
 
-	var msg []byte
-	var err error
-	if IsProtoMessage(data) {
-		if msg, err = proto.Marshal(data[0].(proto.Message)); err != nil {
-			log.Debugf("problem marshalling proto data: %+v, err:%s", data[0], err.Error())
-		}
-	} else if data[0] != nil {
-		if msg, err = json.Marshal(data[0]); err != nil {
-			log.Debugf("problem marshalling json data: %+v, err:%s", data[0], err.Error())
+	// A removal is described by the data removed, other changes by the new data
+	var subject interface{}
+	if len(data) > 1 && data[1] != nil {
+		subject = data[1]
+	} else if len(data) > 0 {
+		subject = data[0]
+	}
+
+	var msg string
+	if IsProtoMessage(subject) {
+		var err error
+		if msg, err = bus.marshaler.MarshalToString(subject.(proto.Message)); err != nil {
+			log.Debugf("problem marshalling proto data: %+v, err:%s", subject, err.Error())
 		}
 	} else {
-		log.Debugf("no data to advertise : %+v", data[0])
+		log.Debugf("no data to advertise : %+v", subject)
 	}
 
 	event := voltha.ConfigEvent{
 		Type: kind,
 		Hash: hash,
-		Data: string(msg),
+		Data: msg,
 	}
 
-	bus.client.Publish(bus.topic, event)
+	client := GetEventBusClient()
+	client.Publish(client.Topic(), eventKey(path, subject), event)
 
 	return nil
 }
+
+// eventKey identifies the data an event is about by its path in the data model, e.g. /devices/{id}/flows, or by
+// its type for the root of the model.  The events of a path share the same key, which keeps them in order and
+// tells the consumers what changed.
+func eventKey(path string, data interface{}) string {
+	if path != "" {
+		return path
+	}
+	msg, ok := data.(proto.Message)
+	if !ok || reflect.ValueOf(msg).IsNil() {
+		return ""
+	}
+	return proto.MessageName(msg)
+}
@@ -18,19 +18,268 @@ package model
 
 import (
 	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/kafka"
 	"github.com/opencord/voltha-go/protos/voltha"
+	"sync"
+	"time"
 )
 
-// EventBusClient is an abstraction layer structure to communicate with an event bus mechanism
+const (
+	default_EventTopic      = "model-change-events"
+	default_EventQueueSize  = 1000
+	default_EventBatchSize  = 100
+	default_EventBatchDelay = 100 * time.Millisecond
+	default_EventRetries    = 3
+	default_EventRetryDelay = 500 * time.Millisecond
+)
+
+// EventBusClient is an abstraction layer structure to communicate with an event bus mechanism.  Events are
+// queued and published in batches by a single routine, so that the events of an object reach the bus in the
+// order they were published.  Events are only logged when no kafka client is set.
 type EventBusClient struct {
+	client     kafka.Client
+	topic      string
+	queueSize  int
+	batchSize  int
+	batchDelay time.Duration
+	retries    int
+	retryDelay time.Duration
+
+	queue     chan *busEvent
+	done      chan struct{}
+	stopped   bool
+	stateLock sync.RWMutex
+	startOnce sync.Once
+	wg        sync.WaitGroup
+
+	mutex     sync.Mutex
+	published int
+	dropped   int
+}
+
+// busEvent is an event waiting in the queue of a client
+type busEvent struct {
+	topic string
+	key   string
+	event *voltha.ConfigEvent
+}
+
+// EventBusClientOption configures an EventBusClient
+type EventBusClientOption func(*EventBusClient)
+
+// EventBusKafkaClient sets the kafka client through which the events are published
+func EventBusKafkaClient(client kafka.Client) EventBusClientOption {
+	return func(ebc *EventBusClient) {
+		ebc.client = client
+	}
+}
+
+// EventBusTopic sets the topic the events of the data model are published on
+func EventBusTopic(topic string) EventBusClientOption {
+	return func(ebc *EventBusClient) {
+		ebc.topic = topic
+	}
+}
+
+// EventBusQueueSize sets how many events can wait to be published; further events are dropped
+func EventBusQueueSize(size int) EventBusClientOption {
+	return func(ebc *EventBusClient) {
+		ebc.queueSize = size
+	}
+}
+
+// EventBusBatch sets the maximum number of events published at once and how long the first event of a batch
+// waits for others
+func EventBusBatch(size int, delay time.Duration) EventBusClientOption {
+	return func(ebc *EventBusClient) {
+		ebc.batchSize = size
+		ebc.batchDelay = delay
+	}
+}
+
+// EventBusRetries sets how many more times the publication of an event is attempted when it fails, and the delay
+// between the attempts
+func EventBusRetries(retries int, delay time.Duration) EventBusClientOption {
+	return func(ebc *EventBusClient) {
+		ebc.retries = retries
+		ebc.retryDelay = delay
+	}
 }
 
 // NewEventBusClient creates a new EventBusClient instance
-func NewEventBusClient() *EventBusClient {
-	return &EventBusClient{}
+func NewEventBusClient(opts ...EventBusClientOption) *EventBusClient {
+	ebc := &EventBusClient{
+		topic:      default_EventTopic,
+		queueSize:  default_EventQueueSize,
+		batchSize:  default_EventBatchSize,
+		batchDelay: default_EventBatchDelay,
+		retries:    default_EventRetries,
+		retryDelay: default_EventRetryDelay,
+	}
+	for _, option := range opts {
+		option(ebc)
+	}
+	ebc.queue = make(chan *busEvent, ebc.queueSize)
+	ebc.done = make(chan struct{})
+	return ebc
+}
+
+var eventBusClient = NewEventBusClient()
+var eventBusClientLock sync.RWMutex
+
+// SetEventBusClient sets the client through which the data models publish their events.  The previous client is
+// stopped once its pending events are published.
+func SetEventBusClient(client *EventBusClient) {
+	eventBusClientLock.Lock()
+	previous := eventBusClient
+	eventBusClient = client
+	eventBusClientLock.Unlock()
+
+	previous.Stop()
+}
+
+// GetEventBusClient returns the client through which the data models publish their events
+func GetEventBusClient() *EventBusClient {
+	eventBusClientLock.RLock()
+	defer eventBusClientLock.RUnlock()
+
+	return eventBusClient
+}
+
+// Publish sends a event to the bus.  Events published with the same key are delivered in order.
+func (ebc *EventBusClient) Publish(topic string, key string, event voltha.ConfigEvent) {
+	log.Debugf("publishing event:%+v, topic:%s, key:%s\n", event, topic, key)
+	if ebc.client == nil {
+		return
+	}
+	ebc.startOnce.Do(func() {
+		ebc.wg.Add(1)
+		go ebc.run()
+	})
+
+	// Events are not queued once the client has been stopped and its queue drained
+	ebc.stateLock.RLock()
+	defer ebc.stateLock.RUnlock()
+	if ebc.stopped {
+		ebc.drop(1)
+		log.Warnw("event-bus-client-stopped", log.Fields{"topic": topic, "key": key})
+		return
+	}
+	select {
+	case ebc.queue <- &busEvent{topic: topic, key: key, event: &event}:
+	default:
+		ebc.drop(1)
+		log.Errorw("event-queue-full", log.Fields{"topic": topic, "key": key, "size": ebc.queueSize})
+	}
+}
+
+// Stop publishes the events pending in the queue and stops the client.  Events published afterwards are dropped.
+func (ebc *EventBusClient) Stop() {
+	ebc.stateLock.Lock()
+	if !ebc.stopped {
+		ebc.stopped = true
+		close(ebc.done)
+	}
+	ebc.stateLock.Unlock()
+	ebc.wg.Wait()
 }
 
-// Publish sends a event to the bus
-func (ebc *EventBusClient) Publish(topic string, event voltha.ConfigEvent) {
-	log.Debugf("publishing event:%+v, topic:%s\n", event, topic)
+// Topic returns the topic the events of the data model are published on
+func (ebc *EventBusClient) Topic() string {
+	return ebc.topic
+}
+
+// Stats returns the number of events published and dropped by the client
+func (ebc *EventBusClient) Stats() (published int, dropped int) {
+	ebc.mutex.Lock()
+	defer ebc.mutex.Unlock()
+
+	return ebc.published, ebc.dropped
+}
+
+func (ebc *EventBusClient) drop(count int) {
+	ebc.mutex.Lock()
+	defer ebc.mutex.Unlock()
+
+	ebc.dropped += count
+}
+
+// run collects the queued events in batches and publishes them until the client is stopped
+func (ebc *EventBusClient) run() {
+	defer ebc.wg.Done()
+
+	for {
+		var batch []*busEvent
+		select {
+		case event := <-ebc.queue:
+			batch = ebc.collect(event)
+		case <-ebc.done:
+			ebc.send(ebc.drain())
+			return
+		}
+		ebc.send(batch)
+	}
+}
+
+// collect waits for the events following the first one of a batch
+func (ebc *EventBusClient) collect(first *busEvent) []*busEvent {
+	batch := []*busEvent{first}
+	timer := time.NewTimer(ebc.batchDelay)
+	defer timer.Stop()
+
+	for len(batch) < ebc.batchSize {
+		select {
+		case event := <-ebc.queue:
+			batch = append(batch, event)
+		case <-timer.C:
+			return batch
+		case <-ebc.done:
+			return batch
+		}
+	}
+	return batch
+}
+
+// drain returns the events left in the queue
+func (ebc *EventBusClient) drain() []*busEvent {
+	var batch []*busEvent
+	for {
+		select {
+		case event := <-ebc.queue:
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+}
+
+// send publishes a batch of events in order.  An event which cannot be delivered after the configured retries
+// is dropped.
+func (ebc *EventBusClient) send(batch []*busEvent) {
+	published := 0
+	for _, event := range batch {
+		var err error
+		for attempt := 0; attempt <= ebc.retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(ebc.retryDelay)
+			}
+			if err = ebc.client.Send(event.event, &kafka.Topic{Name: event.topic}, event.key); err == nil {
+				break
+			}
+			log.Warnw("failed-to-publish-event", log.Fields{"topic": event.topic, "key": event.key,
+				"attempt": attempt + 1, "error": err})
+		}
+		if err != nil {
+			ebc.drop(1)
+			log.Errorw("event-dropped", log.Fields{"topic": event.topic, "key": event.key, "hash": event.event.Hash,
+				"error": err})
+			continue
+		}
+		published++
+	}
+
+	ebc.mutex.Lock()
+	ebc.published += published
+	ebc.mutex.Unlock()
+	log.Debugw("events-published", log.Fields{"count": published, "batch": len(batch)})
 }
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/opencord/voltha-go/kafka"
+	ic "github.com/opencord/voltha-go/protos/inter_container"
+	"github.com/opencord/voltha-go/protos/openflow_13"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventTestKafkaClient records the messages sent and fails the configured number of attempts first
+type eventTestKafkaClient struct {
+	sync.Mutex
+	failures int
+	sent     []string
+	keys     []string
+}
+
+func (c *eventTestKafkaClient) Start() error { return nil }
+func (c *eventTestKafkaClient) Stop()        {}
+func (c *eventTestKafkaClient) CreateTopic(topic *kafka.Topic, numPartition int, repFactor int) error {
+	return nil
+}
+func (c *eventTestKafkaClient) DeleteTopic(topic *kafka.Topic) error { return nil }
+func (c *eventTestKafkaClient) Subscribe(topic *kafka.Topic) (<-chan *ic.InterContainerMessage, error) {
+	return nil, nil
+}
+func (c *eventTestKafkaClient) UnSubscribe(topic *kafka.Topic, ch <-chan *ic.InterContainerMessage) error {
+	return nil
+}
+func (c *eventTestKafkaClient) Send(msg interface{}, topic *kafka.Topic, keys ...string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("send-failed")
+	}
+	c.sent = append(c.sent, msg.(*voltha.ConfigEvent).Hash)
+	c.keys = append(c.keys, keys[0])
+	return nil
+}
+
+func Test_EventBusClient_Order(t *testing.T) {
+	kc := &eventTestKafkaClient{failures: 1}
+	ebc := NewEventBusClient(EventBusKafkaClient(kc), EventBusBatch(4, time.Millisecond),
+		EventBusRetries(1, time.Millisecond))
+	for i := 0; i < 10; i++ {
+		ebc.Publish(ebc.Topic(), fmt.Sprintf("voltha.Device/%d", i%2), voltha.ConfigEvent{Hash: fmt.Sprintf("%d", i)})
+	}
+	ebc.Stop()
+
+	if published, dropped := ebc.Stats(); published != 10 || dropped != 0 {
+		t.Errorf("Unexpected stats - published: %d, dropped: %d", published, dropped)
+	}
+	for i, hash := range kc.sent {
+		if hash != fmt.Sprintf("%d", i) || kc.keys[i] != fmt.Sprintf("voltha.Device/%d", i%2) {
+			t.Fatalf("Events published out of order: %v", kc.sent)
+		}
+	}
+
+	ebc.Publish(ebc.Topic(), "", voltha.ConfigEvent{})
+	if _, dropped := ebc.Stats(); dropped != 1 {
+		t.Error("Event published after the client was stopped")
+	}
+}
+
+func Test_EventBusClient_Drop(t *testing.T) {
+	kc := &eventTestKafkaClient{failures: 2}
+	ebc := NewEventBusClient(EventBusKafkaClient(kc), EventBusRetries(1, time.Millisecond))
+	ebc.Publish(ebc.Topic(), "a", voltha.ConfigEvent{Hash: "lost"})
+	ebc.Publish(ebc.Topic(), "a", voltha.ConfigEvent{Hash: "delivered"})
+	ebc.Stop()
+
+	if published, dropped := ebc.Stats(); published != 1 || dropped != 1 {
+		t.Errorf("Unexpected stats - published: %d, dropped: %d", published, dropped)
+	}
+	if len(kc.sent) != 1 || kc.sent[0] != "delivered" {
+		t.Errorf("Unexpected events published: %v", kc.sent)
+	}
+}
+
+func Test_EventBus_Key(t *testing.T) {
+	if key := eventKey("/devices/olt", &voltha.Device{Id: "olt"}); key != "/devices/olt" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	if key := eventKey("", &voltha.CoreInstance{}); key != "voltha.CoreInstance" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+	if key := eventKey("", nil); key != "" {
+		t.Errorf("Unexpected key: %s", key)
+	}
+}
+
+func Test_EventBus_ChangePath(t *testing.T) {
+	kc := &eventTestKafkaClient{}
+	SetEventBusClient(NewEventBusClient(EventBusKafkaClient(kc), EventBusBatch(1, time.Millisecond)))
+
+	proxy := NewRoot(&voltha.Voltha{}, nil).CreateProxy("/", false)
+	device := &voltha.Device{Id: "olt", Flows: &openflow_13.Flows{Items: []*openflow_13.OfpFlowStats{{Id: 1}}}}
+	if proxy.Add("/devices", device, "") == nil {
+		t.Fatal("Failed to add device")
+	}
+	flows := &openflow_13.Flows{Items: []*openflow_13.OfpFlowStats{{Id: 2}}}
+	if proxy.Update("/devices/olt/flows", flows, false, "") == nil {
+		t.Fatal("Failed to update flows")
+	}
+	SetEventBusClient(NewEventBusClient())
+
+	kc.Lock()
+	defer kc.Unlock()
+	expected := map[string]bool{"/devices/olt": false, "/devices/olt/flows": false}
+	for _, key := range kc.keys {
+		if _, exists := expected[key]; exists {
+			expected[key] = true
+		}
+	}
+	for key, published := range expected {
+		if !published {
+			t.Errorf("No event published for %s - keys: %v", key, kc.keys)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrStaleFencingToken is returned when a write is made with a fencing token older than one already used
+// to write to the same location
+var ErrStaleFencingToken = errors.New("stale-fencing-token")
+
+const (
+	// Suffix of the path prefix of the model giving the prefix of the kv store keys holding the latest fencing
+	// token used for each location.  The tokens are kept out of the keys of the model, watched and checked
+	// by the cores.
+	fenceSuffix = "_fences/"
+	// Number of attempts made to record a fencing token when racing with other writers
+	fenceMaxAttempts = 5
+)
+
+// fenceRegistry tracks the latest fencing token used to write to each location of the data model.  Tokens
+// are recorded in the kv store when the model is persisted so that all the cores share the same view.
+type fenceRegistry struct {
+	sync.Mutex
+	tokens map[string]int64
+	// writing holds the locations with a fenced write in progress, made one at a time
+	writing map[string]bool
+	written *sync.Cond
+}
+
+func newFenceRegistry() *fenceRegistry {
+	f := &fenceRegistry{tokens: make(map[string]int64), writing: make(map[string]bool)}
+	f.written = sync.NewCond(&f.Mutex)
+	return f
+}
+
+// check records a fencing token for a location unless a more recent one was already recorded
+func (f *fenceRegistry) check(kvStore *Backend, location string, token int64) error {
+	return f.write(kvStore, location, token, nil)
+}
+
+// write makes a write to a location on behalf of the holder of a fencing token, unless a more recent token was
+// already recorded for the location.  With a kv store, the entry of the location is written along with the
+// token, in a single transaction conditioned on the token recorded so far: a holder whose token was superseded
+// meanwhile cannot persist its write.  The write is then rejected, although it was made to the model in memory.
+func (f *fenceRegistry) write(kvStore *Backend, location string, token int64, write func()) error {
+	f.Lock()
+	for f.writing[location] {
+		f.written.Wait()
+	}
+	if token < f.tokens[location] {
+		f.Unlock()
+		return ErrStaleFencingToken
+	}
+	f.writing[location] = true
+	f.Unlock()
+
+	err := f.writePersisted(kvStore, location, token, write)
+
+	f.Lock()
+	if err == nil && token > f.tokens[location] {
+		f.tokens[location] = token
+	}
+	delete(f.writing, location)
+	f.written.Broadcast()
+	f.Unlock()
+	return err
+}
+
+func (f *fenceRegistry) writePersisted(kvStore *Backend, location string, token int64, write func()) error {
+	if kvStore == nil {
+		if write != nil {
+			write()
+		}
+		return nil
+	}
+	guard, err := kvStore.beginFence(location, token)
+	if err != nil {
+		return err
+	}
+	if write != nil {
+		write()
+	}
+	return kvStore.endFence(guard)
+}
+
+// fenceGuard is a fenced write in progress to a location of the data model.  The entry of the location is
+// written along with the fencing token, provided that the fence key is still at the version last seen.
+type fenceGuard struct {
+	location string
+	key      string
+	token    int64
+	version  int64
+	recorded bool
+	err      error
+}
+
+// fenceKey returns the kv store key holding the latest fencing token used for a location, outside the path
+// prefix of the model
+func fenceKey(kvStore *Backend, location string) string {
+	return kvStore.PathPrefix + fenceSuffix + location
+}
+
+// refresh reads the token recorded for the location of the guard; ErrStaleFencingToken is returned when it is
+// more recent than the token of the guard
+func (g *fenceGuard) refresh(kvStore *Backend) error {
+	var pair *kvstore.KVPair
+	err := kvStore.execute("get-fence", g.key, func() error {
+		var err error
+		pair, err = kvStore.Client.Get(g.key, kvStore.Timeout)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if pair == nil {
+		g.version = 0
+		return nil
+	}
+	current, err := kvstore.ToString(pair.Value)
+	if err != nil {
+		return err
+	}
+	currentToken, err := strconv.ParseInt(current, 10, 64)
+	if err != nil {
+		return err
+	}
+	if g.token < currentToken {
+		return ErrStaleFencingToken
+	}
+	g.version = pair.Version
+	g.recorded = g.token == currentToken
+	return nil
+}
+
+// beginFence checks a fencing token against the one recorded for a location and guards the writes made to the
+// entry of the location until endFence is called
+func (b *Backend) beginFence(location string, token int64) (*fenceGuard, error) {
+	// The fenced writes are not deferred: those deferred so far are made first
+	if err := b.Flush(); err != nil {
+		log.Warnw("write-behind-flush-failed", log.Fields{"location": location, "error": err})
+	}
+	guard := &fenceGuard{location: location, key: fenceKey(b, location), token: token}
+	if err := guard.refresh(b); err != nil {
+		return nil, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.fences == nil {
+		b.fences = make(map[string]*fenceGuard)
+	}
+	b.fences[location] = guard
+	return guard, nil
+}
+
+// endFence stops guarding the writes to the location of a guard.  The token is recorded on its own when the
+// entry of the location was not written.
+func (b *Backend) endFence(guard *fenceGuard) error {
+	b.Lock()
+	delete(b.fences, guard.location)
+	b.Unlock()
+
+	if guard.err != nil || guard.recorded {
+		return guard.err
+	}
+	value := strconv.FormatInt(guard.token, 10)
+	for attempt := 0; attempt < fenceMaxAttempts; attempt++ {
+		err := b.execute("put-fence", guard.key, func() error {
+			_, err := b.Client.PutIfVersion(guard.key, []byte(value), guard.version, b.Timeout)
+			return err
+		})
+		if err != kvstore.ErrVersionMismatch {
+			return err
+		}
+		log.Debugw("fencing-token-race", log.Fields{"location": guard.location, "token": guard.token,
+			"attempt": attempt})
+		if err := guard.refresh(b); err != nil || guard.recorded {
+			return err
+		}
+	}
+	return kvstore.ErrVersionMismatch
+}
+
+// getFence returns the guard of the fenced write in progress to the entry of a key, nil when there is none
+func (b *Backend) getFence(key string) *fenceGuard {
+	b.RLock()
+	defer b.RUnlock()
+	return b.fences[key]
+}
+
+// writeFenced applies an operation, TXN_PUT or TXN_DELETE, to the entry of a fenced location and records the
+// fencing token in the same transaction.  ErrStaleFencingToken is returned, and the write is not made, when a
+// more recent token was recorded meanwhile; kvstore.ErrVersionMismatch when the entry is not at the version.
+func (b *Backend) writeFenced(guard *fenceGuard, opType int, value interface{}, version int64) (int64, error) {
+	formattedPath := b.makePath(guard.location)
+	log.Debugf("Fenced write key: %s, token: %d, path: %s", guard.location, guard.token, formattedPath)
+
+	if wb := b.getWriteBehind(); wb != nil && opType == kvstore.TXN_DELETE {
+		wb.discard(guard.location)
+	}
+	token := []byte(strconv.FormatInt(guard.token, 10))
+	writes := b.getWriteTracker()
+	for attempt := 0; attempt < fenceMaxAttempts; attempt++ {
+		ops := []*kvstore.TxnOp{
+			kvstore.NewTxnOp(kvstore.TXN_PUT, guard.key, token, guard.version),
+			kvstore.NewTxnOp(opType, formattedPath, value, version),
+		}
+		writes.begin(formattedPath, value, version)
+		var newVersion int64
+		err := b.execute("fenced-txn", formattedPath, func() error {
+			var err error
+			newVersion, err = b.Client.Txn(ops, b.Timeout)
+			return err
+		})
+		if opType == kvstore.TXN_DELETE {
+			writes.end(formattedPath, 0)
+		} else {
+			writes.end(formattedPath, newVersion)
+		}
+		b.invalidate(formattedPath, false)
+
+		if err == nil {
+			guard.version = newVersion
+			guard.recorded = true
+			return newVersion, nil
+		}
+		if err != kvstore.ErrVersionMismatch {
+			return 0, err
+		}
+		// Either the fence key or the entry is not at the version expected
+		previous := guard.version
+		if err := guard.refresh(b); err != nil {
+			if err == ErrStaleFencingToken {
+				guard.err = err
+			}
+			return 0, err
+		}
+		if guard.version == previous {
+			return 0, kvstore.ErrVersionMismatch
+		}
+		log.Debugw("fencing-token-race", log.Fields{"location": guard.location, "token": guard.token,
+			"attempt": attempt})
+	}
+	return 0, kvstore.ErrVersionMismatch
+}
+
+// FencedProxy performs the write operations of a proxy on behalf of the holder of a lock obtained with
+// kvstore.Client.Lock.  A write is rejected when a more recent holder of a lock, i.e. a higher fencing token,
+// has already written to the same location; the location of a device, logical device or adapter covers all
+// the data beneath it.
+type FencedProxy struct {
+	proxy *Proxy
+	token int64
+}
+
+// WithFence returns a proxy whose write operations are guarded by a fencing token
+func (p *Proxy) WithFence(token int64) *FencedProxy {
+	return &FencedProxy{proxy: p, token: token}
+}
+
+// fence makes a write to a location of the data model guarded by the fencing token
+func (fp *FencedProxy) fence(effectivePath string, write func() interface{}) (interface{}, error) {
+	location, controlled := fp.proxy.parseForControlledPath(effectivePath)
+	if !controlled {
+		location = strings.Trim(effectivePath, "/")
+	}
+	r := fp.proxy.GetRoot()
+	var result interface{}
+	err := r.fences.write(r.KvStore, location, fp.token, func() {
+		result = write()
+	})
+	if err != nil {
+		log.Warnw("fenced-write-rejected", log.Fields{"location": location, "token": fp.token, "error": err})
+		return nil, err
+	}
+	return result, nil
+}
+
+// Update will modify information in the data model at the specified location with the provided data
+func (fp *FencedProxy) Update(path string, data interface{}, strict bool, txid string) (interface{}, error) {
+	return fp.fence(fp.proxy.getFullPath()+path, func() interface{} {
+		return fp.proxy.Update(path, data, strict, txid)
+	})
+}
+
+// AddWithID will insert new data at specified location with the ID of the data entry
+func (fp *FencedProxy) AddWithID(path string, id string, data interface{}, txid string) (interface{}, error) {
+	return fp.fence(fp.proxy.getFullPath()+path+"/"+id, func() interface{} {
+		return fp.proxy.AddWithID(path, id, data, txid)
+	})
+}
+
+// Add will insert new data at specified location
+func (fp *FencedProxy) Add(path string, data interface{}, txid string) (interface{}, error) {
+	return fp.fence(fp.proxy.getFullPath()+path, func() interface{} {
+		return fp.proxy.Add(path, data, txid)
+	})
+}
+
+// Remove will delete an entry at the specified location
+func (fp *FencedProxy) Remove(path string, txid string) (interface{}, error) {
+	return fp.fence(fp.proxy.getFullPath()+path, func() interface{} {
+		return fp.proxy.Remove(path, txid)
+	})
+}
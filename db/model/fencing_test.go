@@ -0,0 +1,128 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"github.com/opencord/voltha-go/db/kvstore"
+	"testing"
+)
+
+func Test_Fence_Local(t *testing.T) {
+	fences := newFenceRegistry()
+	if err := fences.check(nil, "devices/1", 5); err != nil {
+		t.Errorf("fencing token rejected - %s", err.Error())
+	}
+	if err := fences.check(nil, "devices/1", 5); err != nil {
+		t.Errorf("same fencing token rejected - %s", err.Error())
+	}
+	if err := fences.check(nil, "devices/1", 4); err != ErrStaleFencingToken {
+		t.Errorf("stale fencing token accepted - err: %v", err)
+	}
+	if err := fences.check(nil, "devices/2", 1); err != nil {
+		t.Errorf("fencing token of another location rejected - %s", err.Error())
+	}
+}
+
+func Test_Fence_Persisted(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+
+	// Two cores sharing the same kv store
+	core1 := newFenceRegistry()
+	core2 := newFenceRegistry()
+
+	if err := core1.check(b, "devices/1", 5); err != nil {
+		t.Errorf("fencing token rejected - %s", err.Error())
+	}
+	if err := core2.check(b, "devices/1", 7); err != nil {
+		t.Errorf("newer fencing token rejected - %s", err.Error())
+	}
+	if err := core1.check(b, "devices/1", 6); err != ErrStaleFencingToken {
+		t.Errorf("stale fencing token accepted - err: %v", err)
+	}
+
+	// The tokens are kept out of the keys of the model
+	if pairs, _ := b.List(""); len(pairs) != 0 {
+		t.Errorf("fencing tokens should not be stored with the model - %+v", pairs)
+	}
+}
+
+func Test_Fence_WriteWithToken(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+
+	guard, err := b.beginFence("devices/1", 5)
+	if err != nil {
+		t.Fatalf("fencing token rejected - %s", err.Error())
+	}
+	if b.getFence("devices/1") != guard {
+		t.Errorf("fenced write not guarded")
+	}
+	version, err := b.writeFenced(guard, kvstore.TXN_PUT, []byte("first"), 0)
+	if err != nil {
+		t.Fatalf("fenced write failed - %s", err.Error())
+	}
+	if err := b.endFence(guard); err != nil {
+		t.Errorf("fenced write not completed - %s", err.Error())
+	}
+	if b.getFence("devices/1") != nil {
+		t.Errorf("completed write still guarded")
+	}
+
+	// The entry and the token are written by the same transaction
+	pair, _ := b.Get("devices/1")
+	if pair == nil || pair.Version != version {
+		t.Errorf("entry not written at the version of the transaction - %+v, version: %d", pair, version)
+	}
+	if fence, _ := b.Client.Get(fenceKey(b, "devices/1"), b.Timeout); fence == nil || fence.Version != version {
+		t.Errorf("fencing token not written with the entry - %+v", fence)
+	}
+}
+
+func Test_Fence_StaleWriteRejected(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+
+	// A holder begins a write while a more recent holder, of another core, writes to the same location
+	guard, err := b.beginFence("devices/1", 5)
+	if err != nil {
+		t.Fatalf("fencing token rejected - %s", err.Error())
+	}
+	if err := newFenceRegistry().check(b, "devices/1", 7); err != nil {
+		t.Fatalf("newer fencing token rejected - %s", err.Error())
+	}
+
+	if _, err := b.writeFenced(guard, kvstore.TXN_PUT, []byte("stale"), 0); err != ErrStaleFencingToken {
+		t.Errorf("write of a stale holder accepted - err: %v", err)
+	}
+	if err := b.endFence(guard); err != ErrStaleFencingToken {
+		t.Errorf("write of a stale holder completed - err: %v", err)
+	}
+	if pair, _ := b.Get("devices/1"); pair != nil {
+		t.Errorf("write of a stale holder persisted - %+v", pair)
+	}
+}
+
+func Test_Fence_Write(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, prefix)
+	fences := newFenceRegistry()
+
+	written := false
+	if err := fences.write(b, "devices/1", 5, func() { written = true }); err != nil || !written {
+		t.Errorf("fenced write rejected - written: %t, err: %v", written, err)
+	}
+	written = false
+	if err := fences.write(b, "devices/1", 4, func() { written = true }); err != ErrStaleFencingToken || written {
+		t.Errorf("fenced write of a stale holder made - written: %t, err: %v", written, err)
+	}
+}
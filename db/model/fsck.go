@@ -0,0 +1,352 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrFsckWithoutKvStore is returned when checking a data model which is not persisted
+var ErrFsckWithoutKvStore = errors.New("fsck-without-kv-store")
+
+// FsckIssueType identifies the kind of inconsistency found between the data model and its KV store
+type FsckIssueType uint8
+
+const (
+	// FSCK_MISSING is a revision of the model with no entry in the KV store
+	FSCK_MISSING FsckIssueType = iota
+	// FSCK_ORPHANED is an entry of the KV store the model does not refer to
+	FSCK_ORPHANED
+	// FSCK_MISMATCHED is a revision whose hash or KV entry does not match its content
+	FSCK_MISMATCHED
+)
+
+var fsckIssueTypes = []string{"missing", "orphaned", "mismatched"}
+
+func (t FsckIssueType) String() string {
+	if int(t) < len(fsckIssueTypes) {
+		return fsckIssueTypes[t]
+	}
+	return fmt.Sprintf("unknown-%d", t)
+}
+
+// FsckIssue is an inconsistency found for a key of the KV store, e.g. devices/{id}
+type FsckIssue struct {
+	Type     FsckIssueType
+	Key      string
+	Detail   string
+	Repaired bool
+}
+
+// FsckReport is the outcome of a consistency check.  Checked is the number of revisions of the model checked
+// and Stored the number of entries of the KV store checked.
+type FsckReport struct {
+	Checked int
+	Stored  int
+	Issues  []*FsckIssue
+}
+
+// Repaired returns the number of issues which were repaired
+func (r *FsckReport) Repaired() int {
+	repaired := 0
+	for _, issue := range r.Issues {
+		if issue.Repaired {
+			repaired++
+		}
+	}
+	return repaired
+}
+
+// fsckCheck holds the state of a consistency check.  Referenced holds the keys of the KV store the model refers
+// to and expected the revisions whose content is compared with the entry of their key.
+type fsckCheck struct {
+	backend    *Backend
+	repair     bool
+	report     *FsckReport
+	referenced map[string]bool
+	expected   map[string][]*PersistedRevision
+}
+
+// Fsck compares the revisions of the data model with the entries of the KV store they are persisted to.  Every
+// revision reachable from the latest root revision is checked: its key, e.g. devices/{id} for a keyed child
+// or the hash of its content otherwise, is recomputed and the content of the entry is compared with the
+// revision for the keyed children of the root and the revisions written or read by this instance.  The root
+// entry, when present, must refer to the latest root revision and the entries the model does not refer to are
+// reported as orphaned.  When repair is set, the KV store is brought in line with the model: missing and
+// mismatched entries are written and orphaned ones are removed, unless they were modified by someone else in
+// the meantime.  The revisions of the model are left untouched.
+func (r *root) Fsck(repair bool) (*FsckReport, error) {
+	if r.KvStore == nil {
+		return nil, ErrFsckWithoutKvStore
+	}
+	b := r.KvStore
+	// The deferred writes would otherwise be reported as missing
+	if err := b.Flush(); err != nil {
+		log.Warnw("fsck-flush-failed", log.Fields{"error": err})
+	}
+
+	c := &fsckCheck{
+		backend:    b,
+		repair:     repair,
+		report:     &FsckReport{},
+		referenced: make(map[string]bool),
+		expected:   make(map[string][]*PersistedRevision),
+	}
+	latest := r.node.GetBranch(NONE).GetLatest()
+	c.walk(latest, true)
+	if err := c.checkRoot(r, latest); err != nil {
+		return nil, err
+	}
+	if err := c.checkStored(); err != nil {
+		return nil, err
+	}
+
+	report := c.report
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Key < report.Issues[j].Key
+	})
+
+	log.Infow("fsck-complete", log.Fields{
+		"checked":  report.Checked,
+		"stored":   report.Stored,
+		"issues":   len(report.Issues),
+		"repaired": report.Repaired(),
+	})
+	return report, nil
+}
+
+// walk checks the children of a revision and their descendants
+func (c *fsckCheck) walk(rev Revision, isRoot bool) {
+	if hash := rev.GetHash(); hash != "" {
+		c.referenced[hash] = true
+	}
+	fields := ChildrenFields(rev.GetData())
+	for name, children := range rev.GetChildren() {
+		field := fields[name]
+		for _, child := range children {
+			// The list of the parent may lag behind changes made through the proxy of the child
+			if child.GetBranch() != nil && child.GetBranch().GetLatest() != nil {
+				child = child.GetBranch().GetLatest()
+			}
+			pr, ok := child.(*PersistedRevision)
+			if !ok {
+				continue
+			}
+			keyed := field != nil && field.IsContainer && field.Key != ""
+			c.check(pr, name, field, isRoot && keyed)
+			c.walk(pr, false)
+		}
+	}
+}
+
+// check compares a revision with the entry of the KV store it is persisted to.  A revision which was never
+// finalized has no hash and is not persisted on its own.
+func (c *fsckCheck) check(pr *PersistedRevision, name string, field *ChildType, stored bool) {
+	var key string
+	if field != nil && field.IsContainer && field.Key != "" {
+		_, keyValue := GetAttributeValue(pr.GetData(), field.Key, 0)
+		key = name + "/" + keyValue.String()
+	} else if pr.GetHash() != "" {
+		key = fsckContentHash(pr)
+	}
+	if key == "" {
+		return
+	}
+	c.referenced[key] = true
+	c.report.Checked++
+
+	if pr.GetHash() != key {
+		issue := &FsckIssue{Type: FSCK_MISMATCHED, Key: key, Detail: "hash " + pr.GetHash()}
+		if c.repair {
+			issue.Repaired = fsckRepair(issue, c.store(pr, key))
+		}
+		c.report.Issues = append(c.report.Issues, issue)
+		return
+	}
+
+	if version, versionHash := pr.getVersion(); stored || (version != 0 && versionHash == key) {
+		c.expected[key] = append(c.expected[key], pr)
+	}
+}
+
+// checkRoot checks that the root entry, written when the root revision is made the latest, refers to it
+func (c *fsckCheck) checkRoot(r *root, latest Revision) error {
+	pair, err := c.backend.Get("root")
+	if err != nil {
+		return err
+	}
+	c.referenced["root"] = true
+	if pair == nil {
+		return nil
+	}
+	c.report.Checked++
+
+	tags := make(map[string]string)
+	for k, v := range r.node.Tags {
+		tags[k] = v.GetHash()
+	}
+	expected := &rootData{Latest: latest.GetHash(), Tags: tags}
+
+	var issue *FsckIssue
+	stored := &rootData{}
+	if blob, err := kvstore.ToByte(pair.Value); err != nil || json.Unmarshal(blob, stored) != nil {
+		issue = &FsckIssue{Type: FSCK_MISMATCHED, Key: "root", Detail: "undecodable content"}
+	} else if stored.Latest != expected.Latest || (len(stored.Tags) > 0 || len(tags) > 0) &&
+		!reflect.DeepEqual(stored.Tags, tags) {
+		issue = &FsckIssue{Type: FSCK_MISMATCHED, Key: "root", Detail: "latest " + stored.Latest}
+	}
+	if issue == nil {
+		return nil
+	}
+	if c.repair {
+		blob, err := json.Marshal(expected)
+		if err == nil {
+			_, err = c.backend.PutIfVersion("root", blob, pair.Version)
+		}
+		issue.Repaired = fsckRepair(issue, err)
+	}
+	c.report.Issues = append(c.report.Issues, issue)
+	return nil
+}
+
+// checkStored compares the entries of the KV store with the revisions expected in them
+func (c *fsckCheck) checkStored() error {
+	basePath := c.backend.makePath("")
+	err := c.backend.Iterate("", 0, false, func(pair *kvstore.KVPair) error {
+		if pair.Lease != 0 || pair.Session != "" {
+			return nil
+		}
+		key := strings.TrimPrefix(pair.Key, basePath)
+		c.report.Stored++
+
+		revisions, exists := c.expected[key]
+		if !exists {
+			if !c.referenced[key] {
+				issue := &FsckIssue{Type: FSCK_ORPHANED, Key: key, Detail: fmt.Sprintf("version %d", pair.Version)}
+				if c.repair {
+					issue.Repaired = fsckRepair(issue, c.backend.DeleteIfVersion(key, pair.Version))
+				}
+				c.report.Issues = append(c.report.Issues, issue)
+			}
+			return nil
+		}
+		delete(c.expected, key)
+
+		for _, pr := range revisions {
+			if issue := fsckCompare(pr, key, pair); issue != nil {
+				if c.repair {
+					issue.Repaired = fsckRepair(issue, fsckStore(pr, key, pair.Version))
+				}
+				c.report.Issues = append(c.report.Issues, issue)
+				// A single revision is written to a key
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, revisions := range c.expected {
+		issue := &FsckIssue{Type: FSCK_MISSING, Key: key}
+		if c.repair {
+			issue.Repaired = fsckRepair(issue, fsckStore(revisions[0], key, 0))
+		}
+		c.report.Issues = append(c.report.Issues, issue)
+	}
+	return nil
+}
+
+// store writes the content of a revision under a key other than its hash, as a new revision would be
+func (c *fsckCheck) store(pr *PersistedRevision, key string) error {
+	pair, err := c.backend.Get(key)
+	if err != nil {
+		return err
+	}
+	var version int64
+	if pair != nil {
+		version = pair.Version
+	}
+	return fsckStore(pr, key, version)
+}
+
+// fsckContentHash recomputes the hash of the content of a revision
+func fsckContentHash(pr *PersistedRevision) string {
+	npr, ok := pr.Revision.(*NonPersistedRevision)
+	if !ok {
+		return pr.GetHash()
+	}
+	npr.mutex.RLock()
+	defer npr.mutex.RUnlock()
+	return npr.hashContent()
+}
+
+// fsckCompare returns the issue of a KV entry whose content differs from the revision it is persisted from
+func fsckCompare(pr *PersistedRevision, key string, pair *kvstore.KVPair) *FsckIssue {
+	blob, err := kvstore.ToByte(pair.Value)
+	if err != nil {
+		return &FsckIssue{Type: FSCK_MISMATCHED, Key: key, Detail: "unexpected value type"}
+	}
+	stored, err := pr.decode(blob)
+	if err != nil {
+		return &FsckIssue{Type: FSCK_MISMATCHED, Key: key, Detail: "undecodable content - " + err.Error()}
+	}
+	if !proto.Equal(stored, pr.GetData().(proto.Message)) {
+		return &FsckIssue{Type: FSCK_MISMATCHED, Key: key, Detail: fmt.Sprintf("content at version %d", pair.Version)}
+	}
+	return nil
+}
+
+// fsckStore writes the config of a revision to a KV entry, expected to be at a version.  The version of the
+// revision is only recorded when the entry is the one of its hash.
+func fsckStore(pr *PersistedRevision, key string, version int64) error {
+	blob, err := pr.encode()
+	if err != nil {
+		return err
+	}
+
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	stored, err := pr.kvStore.PutIfVersion(key, blob, version)
+	if err != nil {
+		return err
+	}
+	if key == pr.GetHash() {
+		pr.setVersion(stored)
+	}
+	return nil
+}
+
+// fsckRepair logs the outcome of the repair of an issue and returns whether it succeeded
+func fsckRepair(issue *FsckIssue, err error) bool {
+	if err != nil {
+		log.Warnw("fsck-repair-failed", log.Fields{"type": issue.Type.String(), "key": issue.Key, "error": err})
+		return false
+	}
+	log.Infow("fsck-repaired", log.Fields{"type": issue.Type.String(), "key": issue.Key})
+	return true
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+)
+
+func Test_Fsck_NotPersisted(t *testing.T) {
+	if _, err := NewRoot(&voltha.Voltha{}, nil).Fsck(false); err != ErrFsckWithoutKvStore {
+		t.Errorf("fsck of a model without kv store should fail - err: %v", err)
+	}
+}
+
+func Test_Fsck_Repair(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "fsck/test")
+	r := NewRoot(&voltha.Voltha{}, b)
+	proxy := r.node.CreateProxy("/", false)
+	for _, id := range []string{"fsck-1", "fsck-2", "fsck-3"} {
+		if proxy.Add("/devices", &voltha.Device{Id: id, FirmwareVersion: "1"}, "") == nil {
+			t.Fatalf("failed to add device %s", id)
+		}
+	}
+
+	report, err := r.Fsck(false)
+	if err != nil {
+		t.Fatalf("fsck failed - %s", err.Error())
+	}
+	if report.Checked != 3 || report.Stored != 3 || len(report.Issues) != 0 {
+		t.Fatalf("unexpected report of a consistent model - %+v", report)
+	}
+
+	// Diverge the kv store from the model behind its back
+	other, _ := proto.Marshal(&voltha.Device{Id: "fsck-1", FirmwareVersion: "0"})
+	b.Client.Put(b.makePath("devices/fsck-1"), other, timeout)
+	b.Client.Delete(b.makePath("devices/fsck-2"), timeout)
+	ghost, _ := proto.Marshal(&voltha.Device{Id: "ghost"})
+	b.Client.Put(b.makePath("devices/ghost"), ghost, timeout)
+
+	expected := []struct {
+		issueType FsckIssueType
+		key       string
+	}{
+		{FSCK_MISMATCHED, "devices/fsck-1"},
+		{FSCK_MISSING, "devices/fsck-2"},
+		{FSCK_ORPHANED, "devices/ghost"},
+	}
+	for _, repair := range []bool{false, true} {
+		report, err := r.Fsck(repair)
+		if err != nil {
+			t.Fatalf("fsck failed - repair: %t, error: %s", repair, err.Error())
+		}
+		if len(report.Issues) != len(expected) {
+			t.Fatalf("unexpected issues - repair: %t, issues: %+v", repair, report.Issues)
+		}
+		for i, issue := range report.Issues {
+			if issue.Type != expected[i].issueType || issue.Key != expected[i].key || issue.Repaired != repair {
+				t.Errorf("unexpected issue - repair: %t, issue: %+v", repair, issue)
+			}
+		}
+	}
+
+	report, err = r.Fsck(false)
+	if err != nil {
+		t.Fatalf("fsck failed - %s", err.Error())
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("repaired model should be consistent - issues: %+v", report.Issues)
+	}
+	if pair, _ := b.Get("devices/fsck-1"); pair == nil {
+		t.Error("mismatched entry should have been rewritten")
+	} else if device := (&voltha.Device{}); proto.Unmarshal(pair.Value.([]byte), device) != nil ||
+		device.FirmwareVersion != "1" {
+		t.Errorf("mismatched entry should hold the model content - %+v", device)
+	}
+}
+
+// findIssue returns the issue reported for a key, nil if there is none
+func findIssue(report *FsckReport, key string) *FsckIssue {
+	for _, issue := range report.Issues {
+		if issue.Key == key {
+			return issue
+		}
+	}
+	return nil
+}
+
+func Test_Fsck_NestedAndRoot(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "fsck/nested")
+	r := NewRoot(&voltha.Voltha{}, b)
+	proxy := r.node.CreateProxy("/", false)
+	if proxy.Add("/devices", &voltha.Device{Id: "fsck-nested"}, "") == nil {
+		t.Fatal("failed to add device")
+	}
+	if proxy.Add("/devices/fsck-nested/ports", &voltha.Port{PortNo: 1, Label: "port-1"}, "") == nil {
+		t.Fatal("failed to add port")
+	}
+
+	// Diverge a nested entry and the root entry from the model
+	other, _ := proto.Marshal(&voltha.Port{PortNo: 1, Label: "other"})
+	b.Client.Put(b.makePath("ports/1"), other, timeout)
+	b.Client.Put(b.makePath("root"), []byte(`{"Latest":"stale"}`), timeout)
+
+	for _, repair := range []bool{false, true} {
+		report, err := r.Fsck(repair)
+		if err != nil {
+			t.Fatalf("fsck failed - repair: %t, error: %s", repair, err.Error())
+		}
+		for _, key := range []string{"ports/1", "root"} {
+			if issue := findIssue(report, key); issue == nil || issue.Type != FSCK_MISMATCHED ||
+				issue.Repaired != repair {
+				t.Errorf("unexpected issue - repair: %t, key: %s, issue: %+v", repair, key, issue)
+			}
+		}
+	}
+
+	report, err := r.Fsck(false)
+	if err != nil {
+		t.Fatalf("fsck failed - %s", err.Error())
+	}
+	for _, key := range []string{"ports/1", "root"} {
+		if issue := findIssue(report, key); issue != nil {
+			t.Errorf("repaired entry should be consistent - issue: %+v", issue)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrRevisionNotFound is returned when a revision hash is not part of the history of a location
+var ErrRevisionNotFound = errors.New("revision-not-found")
+
+// RevisionDiff describes the differences between two revisions of a location of the data model
+type RevisionDiff struct {
+	FromHash string
+	ToHash   string
+	// Fields lists the attributes of the location which changed, children excluded
+	Fields []*FieldDiff
+	// Children lists the children which were added, removed or changed
+	Children []*ChildDiff
+}
+
+// FieldDiff describes the change of an attribute, identified by its json name
+type FieldDiff struct {
+	Name          string
+	PreviousValue interface{}
+	LatestValue   interface{}
+}
+
+// ChildDiff describes the change of a child, identified by its path relative to the location.  The type is one
+// of POST_ADD, POST_UPDATE or POST_REMOVE.
+type ChildDiff struct {
+	Type CallbackType
+	Path string
+}
+
+// IsEmpty reports whether the two revisions hold the same content
+func (d *RevisionDiff) IsEmpty() bool {
+	return len(d.Fields) == 0 && len(d.Children) == 0
+}
+
+// History returns the revisions of the object at a path, oldest first.  The history is kept in memory from the
+// time the object was created or loaded by this instance; the path must not designate a list.
+func (r *root) History(path string) []*RevisionInfo {
+	if branch := r.historyBranch(path); branch != nil {
+		return branch.GetHistory()
+	}
+	return nil
+}
+
+// GetAtRevision returns the data of the object at a path as it was at a revision of its history, including its
+// children up to the specified depth; nil is returned when the revision is not found
+func (r *root) GetAtRevision(path string, hash string, depth int) interface{} {
+	branch := r.historyBranch(path)
+	if branch == nil {
+		return nil
+	}
+	if rev := branch.findInHistory(hash); rev != nil {
+		return revisionData(rev, depth)
+	}
+	return nil
+}
+
+// Diff compares two revisions from the history of the object at a path
+func (r *root) Diff(path string, fromHash string, toHash string) (*RevisionDiff, error) {
+	branch := r.historyBranch(path)
+	if branch == nil {
+		return nil, ErrRevisionNotFound
+	}
+	from := branch.findInHistory(fromHash)
+	to := branch.findInHistory(toHash)
+	if from == nil || to == nil {
+		return nil, ErrRevisionNotFound
+	}
+	return diffRevisions(fromHash, from, toHash, to), nil
+}
+
+// historyBranch returns the branch recording the history of the object at a path
+func (r *root) historyBranch(path string) *Branch {
+	if rev := r.node.revisionAt(path, ""); rev != nil {
+		return rev.GetNode().GetBranch(NONE)
+	}
+	return nil
+}
+
+// revisionData assembles the data of a revision from its own children rather than from the latest revision
+func revisionData(rev Revision, depth int) interface{} {
+	data := proto.Clone(rev.GetData().(proto.Message))
+	if depth == 0 {
+		return data
+	}
+
+	for fieldName, field := range ChildrenFields(data) {
+		childDataName, childDataHolder := GetAttributeValue(data, fieldName, 0)
+		children := rev.GetChildren()[fieldName]
+		if field.IsContainer {
+			holder := reflect.MakeSlice(childDataHolder.Type(), 0, len(children))
+			for _, child := range children {
+				holder = reflect.Append(holder, reflect.ValueOf(revisionData(child, depth-1)))
+			}
+			childDataHolder = holder
+		} else if len(children) > 0 && children[0] != nil {
+			childData := revisionData(children[0], depth-1)
+			if reflect.TypeOf(childData) == reflect.TypeOf(childDataHolder.Interface()) {
+				childDataHolder = reflect.ValueOf(childData)
+			}
+		}
+		reflect.ValueOf(data).Elem().FieldByName(childDataName).Set(childDataHolder)
+	}
+	return data
+}
+
+func diffRevisions(fromHash string, from Revision, toHash string, to Revision) *RevisionDiff {
+	diff := &RevisionDiff{FromHash: fromHash, ToHash: toHash}
+	if from == to {
+		return diff
+	}
+
+	fromData := reflect.ValueOf(from.GetData()).Elem()
+	toData := reflect.ValueOf(to.GetData()).Elem()
+	childrenFields := ChildrenFields(from.GetData())
+	for i := 0; i < fromData.NumField(); i++ {
+		field := fromData.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		if field.PkgPath != "" || strings.HasPrefix(field.Name, "XXX_") || childrenFields[name] != nil {
+			continue
+		}
+		if !equalValues(fromData.Field(i), toData.Field(i)) {
+			diff.Fields = append(diff.Fields, &FieldDiff{
+				Name:          name,
+				PreviousValue: fromData.Field(i).Interface(),
+				LatestValue:   toData.Field(i).Interface(),
+			})
+		}
+	}
+
+	for name, field := range childrenFields {
+		diff.Children = append(diff.Children,
+			diffChildren(name, field, from.GetChildren()[name], to.GetChildren()[name])...)
+	}
+	sort.Slice(diff.Children, func(i, j int) bool {
+		return diff.Children[i].Path < diff.Children[j].Path
+	})
+	return diff
+}
+
+func diffChildren(name string, field *ChildType, from []Revision, to []Revision) []*ChildDiff {
+	if !field.IsContainer || field.Key == "" {
+		if len(from) != len(to) {
+			return []*ChildDiff{{Type: POST_UPDATE, Path: name}}
+		}
+		for i := range from {
+			if !sameContent(from[i], to[i]) {
+				return []*ChildDiff{{Type: POST_UPDATE, Path: name}}
+			}
+		}
+		return nil
+	}
+
+	var changes []*ChildDiff
+	fromByKey := childrenByKey(field.Key, from)
+	toByKey := childrenByKey(field.Key, to)
+	for key, fromRev := range fromByKey {
+		if toRev, exists := toByKey[key]; !exists {
+			changes = append(changes, &ChildDiff{Type: POST_REMOVE, Path: name + "/" + key})
+		} else if !sameContent(fromRev, toRev) {
+			changes = append(changes, &ChildDiff{Type: POST_UPDATE, Path: name + "/" + key})
+		}
+	}
+	for key := range toByKey {
+		if _, exists := fromByKey[key]; !exists {
+			changes = append(changes, &ChildDiff{Type: POST_ADD, Path: name + "/" + key})
+		}
+	}
+	return changes
+}
+
+func childrenByKey(keyName string, revs []Revision) map[string]Revision {
+	byKey := make(map[string]Revision)
+	for _, rev := range revs {
+		if _, key := GetAttributeValue(rev.GetData(), keyName, 0); key.IsValid() {
+			byKey[fmt.Sprintf("%v", key.Interface())] = rev
+		}
+	}
+	return byKey
+}
+
+// sameContent reports whether two revisions hold the same data and children
+func sameContent(a Revision, b Revision) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.GetConfig().Hash != b.GetConfig().Hash {
+		return false
+	}
+	aChildren := a.GetChildren()
+	bChildren := b.GetChildren()
+	if len(aChildren) != len(bChildren) {
+		return false
+	}
+	for name, revs := range aChildren {
+		other := bChildren[name]
+		if len(revs) != len(other) {
+			return false
+		}
+		for i := range revs {
+			if !sameContent(revs[i], other[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// equalValues compares attribute values, using the protobuf semantics for messages
+func equalValues(a reflect.Value, b reflect.Value) bool {
+	if a.Kind() == reflect.Slice {
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equalValues(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	if aMsg, ok := a.Interface().(proto.Message); ok {
+		if bMsg, ok := b.Interface().(proto.Message); ok {
+			return proto.Equal(aMsg, bMsg)
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// History returns the revisions of the object at a path relative to the proxy, oldest first
+func (p *Proxy) History(path string) []*RevisionInfo {
+	return p.GetRoot().History(path)
+}
+
+// GetAtRevision returns the data of the object at a path relative to the proxy as it was at a revision of its
+// history
+func (p *Proxy) GetAtRevision(path string, hash string, depth int) interface{} {
+	return p.GetRoot().GetAtRevision(path, hash, depth)
+}
+
+// Diff compares two revisions from the history of the object at a path relative to the proxy
+func (p *Proxy) Diff(path string, fromHash string, toHash string) (*RevisionDiff, error) {
+	return p.GetRoot().Diff(path, fromHash, toHash)
+}
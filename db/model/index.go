@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/opencord/voltha-go/common/log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrIndexNotFound is returned when a list of the data model has no index for an attribute
+var ErrIndexNotFound = errors.New("index-not-found")
+
+// childIndex looks up the children of a keyed container by the attributes declared as indexes of the
+// container.  Children are tracked by node, which stays the same across their revisions.  The index follows
+// the changes made to the children and, when the container changes in a way it cannot follow, such as a
+// transaction being merged, it is rebuilt on the next lookup.
+type childIndex struct {
+	sync.RWMutex
+	key     string
+	fields  map[string]int
+	entries map[string]map[string]map[*node]struct{}
+	values  map[*node]map[string]string
+	// synced is the revision of the owner of the container the index is up to date with
+	synced Revision
+}
+
+func newChildIndex(field *ChildType) *childIndex {
+	structType := field.ClassType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	fields := make(map[string]int)
+	for _, name := range field.Indexes {
+		if index, ok := fieldByJSONName(structType, name); ok && structType.Field(index).Type.Kind() == reflect.String {
+			fields[name] = index
+		}
+	}
+	return &childIndex{key: field.Key, fields: fields}
+}
+
+// reset clears the index.  The index lock must be held.
+func (ci *childIndex) reset() {
+	for n := range ci.values {
+		n.setContainerIndex(nil)
+	}
+	ci.entries = make(map[string]map[string]map[*node]struct{})
+	ci.values = make(map[*node]map[string]string)
+	ci.synced = nil
+}
+
+// add indexes a child node with its data.  The index lock must be held.
+func (ci *childIndex) add(n *node, data interface{}) {
+	values := make(map[string]string, len(ci.fields))
+	for name, index := range ci.fields {
+		value := indexValue(data, index)
+		values[name] = value
+		if ci.entries[name] == nil {
+			ci.entries[name] = make(map[string]map[*node]struct{})
+		}
+		if ci.entries[name][value] == nil {
+			ci.entries[name][value] = make(map[*node]struct{})
+		}
+		ci.entries[name][value][n] = struct{}{}
+	}
+	ci.values[n] = values
+	n.setContainerIndex(ci)
+}
+
+// remove drops a child node from the index.  The index lock must be held.
+func (ci *childIndex) remove(n *node) {
+	for name, value := range ci.values[n] {
+		delete(ci.entries[name][value], n)
+		if len(ci.entries[name][value]) == 0 {
+			delete(ci.entries[name], value)
+		}
+	}
+	delete(ci.values, n)
+	n.setContainerIndex(nil)
+}
+
+// update re-indexes a child node whose data changed; nodes which are not children of the container are ignored
+func (ci *childIndex) update(n *node, data interface{}) {
+	ci.Lock()
+	defer ci.Unlock()
+
+	if _, member := ci.values[n]; member {
+		ci.remove(n)
+		ci.add(n, data)
+	}
+}
+
+// advance follows a change of the container from one revision of its owner to the next, with a child added or
+// removed.  The index is left to be rebuilt when it was not up to date with the previous revision.
+func (ci *childIndex) advance(previous Revision, latest Revision, added Revision, removed Revision) {
+	ci.Lock()
+	defer ci.Unlock()
+
+	if ci.synced == nil || ci.synced != previous {
+		return
+	}
+	if removed != nil {
+		ci.remove(removed.GetNode())
+	}
+	if added != nil {
+		ci.add(added.GetNode(), added.GetData())
+	}
+	ci.synced = latest
+}
+
+// lookup returns the children of a revision of the owner of the container whose attribute has a value,
+// rebuilding the index first when it is not up to date with that revision
+func (ci *childIndex) lookup(owner Revision, children []Revision, name string, value string) ([]*node, error) {
+	ci.Lock()
+	defer ci.Unlock()
+
+	if _, exists := ci.fields[name]; !exists {
+		return nil, ErrIndexNotFound
+	}
+	if ci.synced == nil || ci.synced != owner {
+		ci.reset()
+		for _, child := range children {
+			childNode := child.GetNode()
+			ci.add(childNode, childNode.GetBranch(NONE).GetLatest().GetData())
+		}
+		ci.synced = owner
+	}
+
+	nodes := make([]*node, 0, len(ci.entries[name][value]))
+	for n := range ci.entries[name][value] {
+		nodes = append(nodes, n)
+	}
+	// Return the children in the same order for the same content
+	sort.Slice(nodes, func(i, j int) bool {
+		return childKey(nodes[i], ci.key) < childKey(nodes[j], ci.key)
+	})
+	return nodes, nil
+}
+
+func childKey(n *node, key string) string {
+	_, value := GetAttributeValue(n.GetBranch(NONE).GetLatest().GetData(), key, 0)
+	if !value.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+// indexValue returns the value of an indexed attribute
+func indexValue(data interface{}, index int) string {
+	value := reflect.ValueOf(data)
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	return value.Field(index).String()
+}
+
+// getChildIndex returns the index of a container of the node, nil when the container declares no index
+func (n *node) getChildIndex(name string) *childIndex {
+	field := ChildrenFields(n.Type)[name]
+	if field == nil || !field.IsContainer || field.Key == "" || len(field.Indexes) == 0 {
+		return nil
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	if n.indexes == nil {
+		n.indexes = make(map[string]*childIndex)
+	}
+	if _, exists := n.indexes[name]; !exists {
+		n.indexes[name] = newChildIndex(field)
+	}
+	return n.indexes[name]
+}
+
+// advanceChildIndex lets the index of a container follow a change of the latest revision of the node
+func (n *node) advanceChildIndex(branch *Branch, name string, previous Revision, latest Revision,
+	added Revision, removed Revision) {
+	if branch.Txid != "" {
+		return
+	}
+	if ci := n.getChildIndex(name); ci != nil {
+		ci.advance(previous, latest, added, removed)
+	}
+}
+
+func (n *node) setContainerIndex(ci *childIndex) {
+	n.Lock()
+	defer n.Unlock()
+	n.containerIndex = ci
+}
+
+func (n *node) getContainerIndex() *childIndex {
+	n.Lock()
+	defer n.Unlock()
+	return n.containerIndex
+}
+
+// findByIndex returns the children of a container whose indexed attribute has a value
+func (n *node) findByIndex(name string, index string, value string) ([]*node, error) {
+	ci := n.getChildIndex(name)
+	if ci == nil {
+		return nil, ErrIndexNotFound
+	}
+	owner := n.GetBranch(NONE).GetLatest()
+	return ci.lookup(owner, owner.GetChildren()[name], index, value)
+}
+
+// GetByIndex returns the entries of the list at a path whose indexed attribute has a value, including their
+// children up to the specified depth
+func (r *root) GetByIndex(path string, index string, value string, depth int) ([]interface{}, error) {
+	owner, name, err := r.listAt(path, "")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := owner.GetNode().findByIndex(name, index, value)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]interface{}, 0, len(nodes))
+	for _, childNode := range nodes {
+		results = append(results, childNode.GetBranch(NONE).GetLatest().Get(depth))
+	}
+	return results, nil
+}
+
+// listAt returns the revision holding the list at a path along with the name of the list
+func (r *root) listAt(path string, txid string) (Revision, string, error) {
+	path = strings.Trim(path, "/")
+	ownerPath, name := "", path
+	if index := strings.LastIndex(path, "/"); index >= 0 {
+		ownerPath, name = path[:index], path[index+1:]
+	}
+
+	owner := r.node.revisionAt(ownerPath, txid)
+	if owner == nil {
+		// The path may designate an entry of a list rather than the list
+		if r.node.revisionAt(path, txid) != nil {
+			return nil, "", ErrQueryPathNotList
+		}
+		return nil, "", ErrQueryPathNotFound
+	}
+	field := ChildrenFields(owner.GetData())[name]
+	if field == nil {
+		return nil, "", ErrQueryPathNotFound
+	}
+	if !field.IsContainer {
+		return nil, "", ErrQueryPathNotList
+	}
+	return owner, name, nil
+}
+
+// GetByIndex retrieves the entries of the list at the specified path location whose indexed attribute has the
+// provided value, e.g. the devices with a parent id
+func (p *Proxy) GetByIndex(path string, index string, value string, depth int) ([]interface{}, error) {
+	var effectivePath string
+	if path == "/" {
+		effectivePath = p.getFullPath()
+	} else {
+		effectivePath = p.getFullPath() + path
+	}
+
+	pathLock, controlled := p.parseForControlledPath(effectivePath)
+
+	log.Debugf("Path: %s, Effective: %s, PathLock: %s", path, effectivePath, pathLock)
+
+	pac := PAC().ReservePath(effectivePath, p, pathLock)
+	defer PAC().ReleasePath(pathLock)
+	pac.SetProxy(p)
+
+	return pac.GetByIndex(path, index, value, depth, controlled)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"reflect"
+	"testing"
+)
+
+func newIndexTestChild(id string, parentId string) Revision {
+	n := &node{Branches: make(map[string]*Branch)}
+	n.Branches[NONE] = NewBranch(n, "", nil, false)
+	rev := NewNonPersistedRevision(nil, n.Branches[NONE], &queryTestEntry{Id: id, ParentId: parentId}, nil)
+	n.Branches[NONE].Latest = rev
+	return rev
+}
+
+func indexTestIds(nodes []*node) []string {
+	var ids []string
+	for _, n := range nodes {
+		ids = append(ids, n.GetBranch(NONE).GetLatest().GetData().(*queryTestEntry).Id)
+	}
+	return ids
+}
+
+func Test_Index_Lookup(t *testing.T) {
+	ci := newChildIndex(&ChildType{
+		ClassType: reflect.TypeOf(queryTestEntry{}),
+		Key:       "id",
+		Indexes:   []string{"parent_id", "port"},
+	})
+	a, b, c := newIndexTestChild("a", "olt1"), newIndexTestChild("b", "olt2"), newIndexTestChild("c", "olt1")
+	owner1 := NewNonPersistedRevision(nil, nil, &queryTestEntry{}, nil)
+	owner2 := NewNonPersistedRevision(nil, nil, &queryTestEntry{}, nil)
+
+	nodes, err := ci.lookup(owner1, []Revision{c, a, b}, "parent_id", "olt1")
+	if err != nil || !reflect.DeepEqual(indexTestIds(nodes), []string{"a", "c"}) {
+		t.Errorf("Unexpected lookup result: %v, %v", indexTestIds(nodes), err)
+	}
+	if _, err = ci.lookup(owner1, nil, "port", "1"); err != ErrIndexNotFound {
+		t.Errorf("Non-string attribute indexed: %v", err)
+	}
+
+	// A child changing its indexed attribute is moved without rebuilding the index
+	updated := NewNonPersistedRevision(nil, b.GetBranch(), &queryTestEntry{Id: "b", ParentId: "olt1"}, nil)
+	b.GetBranch().Latest = updated
+	b.GetNode().getContainerIndex().update(b.GetNode(), updated.GetData())
+	if nodes, _ = ci.lookup(owner1, nil, "parent_id", "olt1"); !reflect.DeepEqual(indexTestIds(nodes), []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected lookup result after update: %v", indexTestIds(nodes))
+	}
+
+	// Children added and removed by the next revision of the owner are followed
+	d := newIndexTestChild("d", "olt1")
+	ci.advance(owner1, owner2, d, a)
+	if nodes, _ = ci.lookup(owner2, nil, "parent_id", "olt1"); !reflect.DeepEqual(indexTestIds(nodes), []string{"b", "c", "d"}) {
+		t.Errorf("Unexpected lookup result after advance: %v", indexTestIds(nodes))
+	}
+	if a.GetNode().getContainerIndex() != nil {
+		t.Error("Removed child still refers to the index")
+	}
+
+	// A lookup on another revision of the owner rebuilds the index
+	if nodes, _ = ci.lookup(owner1, []Revision{a}, "parent_id", "olt1"); !reflect.DeepEqual(indexTestIds(nodes), []string{"a"}) {
+		t.Errorf("Unexpected lookup result after rebuild: %v", indexTestIds(nodes))
+	}
+}
+
+func Test_Index_Devices(t *testing.T) {
+	r := NewRoot(&voltha.Voltha{}, nil)
+	proxy := r.node.CreateProxy("/", false)
+	for i := 0; i < 4; i++ {
+		device := &voltha.Device{
+			Id:       fmt.Sprintf("index-%d", i),
+			ParentId: fmt.Sprintf("olt-%d", i%2),
+		}
+		if proxy.Add("/devices", device, "") == nil {
+			t.Fatalf("Failed to add device %s", device.Id)
+		}
+	}
+
+	devices, err := proxy.GetByIndex("/devices", "parent_id", "olt-0", 0)
+	if err != nil {
+		t.Fatalf("Failed to get devices by index: %s", err.Error())
+	}
+	if len(devices) != 2 || devices[0].(*voltha.Device).Id != "index-0" || devices[1].(*voltha.Device).Id != "index-2" {
+		t.Errorf("Unexpected devices: %+v", devices)
+	}
+
+	device := proxy.Get("/devices/index-1", 0, false, "").(*voltha.Device)
+	device.ParentId = "olt-0"
+	if proxy.Update("/devices/index-1", device, false, "") == nil {
+		t.Fatal("Failed to update device index-1")
+	}
+	if proxy.Remove("/devices/index-0", "") == nil {
+		t.Fatal("Failed to remove device index-0")
+	}
+	if devices, _ = proxy.GetByIndex("/devices", "parent_id", "olt-0", 0); len(devices) != 2 ||
+		devices[0].(*voltha.Device).Id != "index-1" || devices[1].(*voltha.Device).Id != "index-2" {
+		t.Errorf("Unexpected devices after changes: %+v", devices)
+	}
+
+	if devices, err = proxy.Query("/devices", &Query{Filter: "parent_id=olt-1"}, ""); err != nil || len(devices) != 1 {
+		t.Errorf("Unexpected devices queried through the index: %+v, %v", devices, err)
+	}
+	if _, err = proxy.GetByIndex("/devices", "vendor", "x", 0); err != ErrIndexNotFound {
+		t.Errorf("Unexpected error for an attribute which is not indexed: %v", err)
+	}
+}
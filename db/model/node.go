@@ -24,7 +24,6 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/opencord/voltha-go/common/log"
 	"reflect"
-	"runtime/debug"
 	"strings"
 	"sync"
 )
@@ -65,6 +64,17 @@ type node struct {
 	Proxy     *Proxy
 	EventBus  *EventBus
 	AutoPrune bool
+
+	// path locates the node in the data model, e.g. /devices/{id}/flows; it is empty for the root
+	path string
+
+	// indexes of the keyed containers of the node and index of the container holding the node
+	indexes        map[string]*childIndex
+	containerIndex *childIndex
+
+	// changeLock serializes the changes made to the latest revisions of the node.  A change below a child is
+	// made before the lock of the parent is taken, so that distinct subtrees can change concurrently.
+	changeLock sync.Mutex
 }
 
 // ChangeTuple holds details of modifications made to a revision
@@ -76,9 +86,14 @@ type ChangeTuple struct {
 
 // NewNode creates a new instance of the node data structure
 func NewNode(root *root, initialData interface{}, autoPrune bool, txid string) *node {
+	return newNode(root, "", initialData, autoPrune, txid)
+}
+
+func newNode(root *root, path string, initialData interface{}, autoPrune bool, txid string) *node {
 	n := &node{}
 
 	n.Root = root
+	n.path = path
 	n.Branches = make(map[string]*Branch)
 	n.Tags = make(map[string]Revision)
 	n.Proxy = nil
@@ -107,6 +122,47 @@ func (n *node) MakeNode(data interface{}, txid string) *node {
 	return NewNode(n.Root, data, true, txid)
 }
 
+// makeChildNode creates the node of a child held by a field of the node
+func (n *node) makeChildNode(name string, field *ChildType, data interface{}, txid string) *node {
+	return newNode(n.Root, n.childPath(name, field, data), data, true, txid)
+}
+
+// childPath returns the path of a child held by a field of the node, e.g. /devices/{id} for a keyed child
+func (n *node) childPath(name string, field *ChildType, data interface{}) string {
+	path := n.path + "/" + name
+	if field != nil && field.IsContainer && field.Key != "" {
+		_, key := GetAttributeValue(data, field.Key, 0)
+		path += "/" + key.String()
+	}
+	return path
+}
+
+// changePath returns the path of the data of a change made to the node, which is either the data of the node
+// or of one of its children
+func (n *node) changePath(change ChangeTuple) string {
+	data := change.LatestData
+	if data == nil {
+		data = change.PreviousData
+	}
+	dataType := reflect.TypeOf(data)
+	if dataType == nil || dataType == reflect.TypeOf(n.Type) {
+		return n.path
+	}
+	if dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	for name, field := range ChildrenFields(n.Type) {
+		fieldType := field.ClassType
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType == dataType {
+			return n.childPath(name, field, data)
+		}
+	}
+	return n.path
+}
+
 // MakeRevision create a new revision of the node in the tree
 func (n *node) MakeRevision(branch *Branch, data interface{}, children map[string][]Revision) Revision {
 	return n.GetRoot().MakeRevision(branch, data, children)
@@ -120,6 +176,10 @@ func (n *node) makeLatest(branch *Branch, revision Revision, changeAnnouncement
 		branch.SetLatest(revision)
 	}
 
+	if ci := n.getContainerIndex(); ci != nil && branch.Txid == "" {
+		ci.update(n, revision.GetData())
+	}
+
 	if changeAnnouncement != nil && branch.Txid == "" {
 		if n.GetProxy() != nil {
 			for _, change := range changeAnnouncement {
@@ -133,18 +193,21 @@ func (n *node) makeLatest(branch *Branch, revision Revision, changeAnnouncement
 					true,
 					change.PreviousData,
 					change.LatestData)
+				n.GetProxy().dispatchCallbacks(change.Type, change.PreviousData, change.LatestData)
 			}
 		}
 
+		// Changes are advertised right away, rather than by a callback running in its own routine, so that the
+		// events of an object are published in the order of its changes
 		for _, change := range changeAnnouncement {
 			log.Debugf("sending notification - changeType: %+v, previous:%+v, latest: %+v",
 				change.Type,
 				change.PreviousData,
 				change.LatestData)
-			n.GetRoot().AddNotificationCallback(
-				n.makeEventBus().Advertise,
+			n.makeEventBus().Advertise(
 				change.Type,
 				revision.GetHash(),
+				n.changePath(change),
 				change.PreviousData,
 				change.LatestData)
 		}
@@ -180,7 +243,7 @@ func (n *node) initialize(data interface{}, txid string) {
 					for i := 0; i < fieldValue.Len(); i++ {
 						v := fieldValue.Index(i)
 
-						if rev := n.MakeNode(v.Interface(), txid).Latest(txid); rev != nil {
+						if rev := n.makeChildNode(fieldName, field, v.Interface(), txid).Latest(txid); rev != nil {
 							children[fieldName] = append(children[fieldName], rev)
 						}
 
@@ -196,13 +259,13 @@ func (n *node) initialize(data interface{}, txid string) {
 				} else {
 					for i := 0; i < fieldValue.Len(); i++ {
 						v := fieldValue.Index(i)
-						if newNodeRev := n.MakeNode(v.Interface(), txid).Latest(); newNodeRev != nil {
+						if newNodeRev := n.makeChildNode(fieldName, field, v.Interface(), txid).Latest(); newNodeRev != nil {
 							children[fieldName] = append(children[fieldName], newNodeRev)
 						}
 					}
 				}
 			} else {
-				if newNodeRev := n.MakeNode(fieldValue.Interface(), txid).Latest(); newNodeRev != nil {
+				if newNodeRev := n.makeChildNode(fieldName, field, fieldValue.Interface(), txid).Latest(); newNodeRev != nil {
 					children[fieldName] = append(children[fieldName], newNodeRev)
 				}
 			}
@@ -223,11 +286,9 @@ func (n *node) initialize(data interface{}, txid string) {
 	}
 }
 
-// findRevByKey retrieves a specific revision from a node tree
+// findRevByKey retrieves a specific revision from a list of revisions.  It holds no lock: the list is never
+// changed once part of a revision.
 func (n *node) findRevByKey(revs []Revision, keyName string, value interface{}) (int, Revision) {
-	n.Lock()
-	defer n.Unlock()
-
 	for i, rev := range revs {
 		dataValue := reflect.ValueOf(rev.GetData())
 		dataStruct := GetAttributeStructure(rev.GetData(), keyName, 0)
@@ -266,6 +327,11 @@ func (n *node) Get(path string, hash string, depth int, deep bool, txid string)
 	} else {
 		rev = branch.GetLatest()
 	}
+	if rev == nil {
+		// The revision was pruned or never existed
+		log.Debugf("revision not found - hash: %s, txid: %s", hash, txid)
+		return nil
+	}
 
 	var result interface{}
 	if result = n.getPath(rev.GetBranch().GetLatest(), path, depth);
@@ -346,6 +412,61 @@ func (n *node) getPath(rev Revision, path string, depth int) interface{} {
 	return childNode.getPath(childRev, path, depth)
 }
 
+// revisionAt returns the revision found at a path, or nil, without invoking the proxy callbacks nor reading
+// from persistence
+func (n *node) revisionAt(path string, txid string) Revision {
+	for strings.HasPrefix(path, "/") {
+		path = path[1:]
+	}
+
+	var branch *Branch
+	if branch = n.GetBranch(txid); txid == "" || branch == nil {
+		branch = n.GetBranch(NONE)
+	}
+	if branch == nil {
+		return nil
+	}
+	rev := branch.GetLatest()
+	if path == "" {
+		return rev
+	}
+
+	partition := strings.SplitN(path, "/", 2)
+	name := partition[0]
+	if len(partition) < 2 {
+		path = ""
+	} else {
+		path = partition[1]
+	}
+
+	field := ChildrenFields(n.Type)[name]
+	if field == nil {
+		return nil
+	}
+	children := rev.GetChildren()[name]
+	if field.IsContainer {
+		if field.Key == "" || path == "" {
+			return nil
+		}
+		partition = strings.SplitN(path, "/", 2)
+		key := partition[0]
+		if len(partition) < 2 {
+			path = ""
+		} else {
+			path = partition[1]
+		}
+		_, childRev := n.findRevByKey(children, field.Key, field.KeyFromStr(key))
+		if childRev == nil {
+			return nil
+		}
+		return childRev.GetNode().revisionAt(path, txid)
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0].GetNode().revisionAt(path, txid)
+}
+
 // getData retrieves the data from a node revision
 func (n *node) getData(rev Revision, depth int) interface{} {
 	msg := rev.GetBranch().GetLatest().Get(depth)
@@ -409,10 +530,7 @@ func (n *node) Update(path string, data interface{}, strict bool, txid string, m
 			}
 			keyValue := field.KeyFromStr(key)
 
-			children = make([]Revision, len(rev.GetChildren()[name]))
-			copy(children, rev.GetChildren()[name])
-
-			idx, childRev := n.findRevByKey(children, field.Key, keyValue)
+			_, childRev := n.findRevByKey(rev.GetChildren()[name], field.Key, keyValue)
 			childNode := childRev.GetNode()
 
 			newChildRev := childNode.Update(path, data, strict, txid, makeBranch)
@@ -436,11 +554,26 @@ func (n *node) Update(path string, data interface{}, strict bool, txid string, m
 
 			// Prefix the hash value with the data type (e.g. devices, logical_devices, adapters)
 			newChildRev.SetHash(name + "/" + _keyValueType)
-			children[idx] = newChildRev
+
+			n.changeLock.Lock()
+			defer n.changeLock.Unlock()
+
+			rev = branch.GetLatest()
+			children = make([]Revision, len(rev.GetChildren()[name]))
+			copy(children, rev.GetChildren()[name])
+
+			idx, _ := n.findRevByKey(children, field.Key, keyValue)
+			if idx < 0 {
+				log.Errorf("child removed during update - %s/%s", name, _keyValueType)
+				return newChildRev
+			}
+			// The child may have changed again since this update: keep its latest revision
+			children[idx] = childNode.Latest(txid)
 
 			updatedRev := rev.UpdateChildren(name, children, branch)
-			branch.GetLatest().Drop(txid, false)
+			rev.Drop(txid, false)
 			n.makeLatest(branch, updatedRev, nil)
+			n.advanceChildIndex(branch, name, rev, updatedRev, nil, nil)
 
 			return newChildRev
 
@@ -451,7 +584,12 @@ func (n *node) Update(path string, data interface{}, strict bool, txid string, m
 		childRev := rev.GetChildren()[name][0]
 		childNode := childRev.GetNode()
 		newChildRev := childNode.Update(path, data, strict, txid, makeBranch)
-		updatedRev := rev.UpdateChildren(name, []Revision{newChildRev}, branch)
+
+		n.changeLock.Lock()
+		defer n.changeLock.Unlock()
+
+		rev = branch.GetLatest()
+		updatedRev := rev.UpdateChildren(name, []Revision{childNode.Latest(txid)}, branch)
 		rev.Drop(txid, false)
 		n.makeLatest(branch, updatedRev, nil)
 
@@ -462,9 +600,8 @@ func (n *node) Update(path string, data interface{}, strict bool, txid string, m
 }
 
 func (n *node) doUpdate(branch *Branch, data interface{}, strict bool) Revision {
-	log.Debugf("Comparing types - expected: %+v, actual: %+v &&&&&& %s", reflect.ValueOf(n.Type).Type(),
-		reflect.TypeOf(data),
-		string(debug.Stack()))
+	log.Debugf("Comparing types - expected: %+v, actual: %+v", reflect.ValueOf(n.Type).Type(),
+		reflect.TypeOf(data))
 
 	if reflect.TypeOf(data) != reflect.ValueOf(n.Type).Type() {
 		// TODO raise error
@@ -482,6 +619,9 @@ func (n *node) doUpdate(branch *Branch, data interface{}, strict bool) Revision
 		n.GetProxy().InvokeCallbacks(PRE_UPDATE, false, branch.GetLatest(), data)
 	}
 
+	n.changeLock.Lock()
+	defer n.changeLock.Unlock()
+
 	if branch.GetLatest().GetData().(proto.Message).String() != data.(proto.Message).String() {
 		if strict {
 			// TODO: checkAccessViolations(data, Branch.GetLatest.data)
@@ -543,6 +683,10 @@ func (n *node) Add(path string, data interface{}, txid string, makeBranch MakeBr
 					n.GetProxy().InvokeCallbacks(PRE_ADD, false, data)
 				}
 
+				n.changeLock.Lock()
+				defer n.changeLock.Unlock()
+
+				rev = branch.GetLatest()
 				children = make([]Revision, len(rev.GetChildren()[name]))
 				copy(children, rev.GetChildren()[name])
 
@@ -553,16 +697,18 @@ func (n *node) Add(path string, data interface{}, txid string, makeBranch MakeBr
 					log.Errorf("duplicate key found: %s", key.String())
 					return exists
 				}
-				childRev := n.MakeNode(data, txid).Latest(txid)
+				childRev := n.makeChildNode(name, field, data, txid).Latest(txid)
 
 				// Prefix the hash with the data type (e.g. devices, logical_devices, adapters)
 				childRev.SetHash(name + "/" + key.String())
 				children = append(children, childRev)
+				previous := rev
 				rev = rev.UpdateChildren(name, children, branch)
 				changes := []ChangeTuple{{POST_ADD, nil, childRev.GetData()}}
 
 				rev.Drop(txid, false)
 				n.makeLatest(branch, rev, changes)
+				n.advanceChildIndex(branch, name, previous, rev, childRev, nil)
 
 				return childRev
 			}
@@ -578,19 +724,31 @@ func (n *node) Add(path string, data interface{}, txid string, makeBranch MakeBr
 			}
 			keyValue := field.KeyFromStr(key)
 
-			children = make([]Revision, len(rev.GetChildren()[name]))
-			copy(children, rev.GetChildren()[name])
-
-			idx, childRev := n.findRevByKey(children, field.Key, keyValue)
+			_, childRev := n.findRevByKey(rev.GetChildren()[name], field.Key, keyValue)
 
 			childNode := childRev.GetNode()
 			newChildRev := childNode.Add(path, data, txid, makeBranch)
 
-			children[idx] = newChildRev
+			n.changeLock.Lock()
+			defer n.changeLock.Unlock()
+
+			// The revision returned is the one added below the child: the child itself is referred to by its
+			// latest revision
+			rev = branch.GetLatest()
+			children = make([]Revision, len(rev.GetChildren()[name]))
+			copy(children, rev.GetChildren()[name])
 
-			rev = rev.UpdateChildren(name, branch.GetLatest().GetChildren()[name], branch)
+			idx, _ := n.findRevByKey(children, field.Key, keyValue)
+			if idx < 0 {
+				log.Errorf("child removed during add - %s/%s", name, key)
+				return newChildRev
+			}
+			children[idx] = childNode.Latest(txid)
+
+			updatedRev := rev.UpdateChildren(name, children, branch)
 			rev.Drop(txid, false)
-			n.makeLatest(branch, rev.GetBranch().GetLatest(), nil)
+			n.makeLatest(branch, updatedRev, nil)
+			n.advanceChildIndex(branch, name, rev, updatedRev, nil, nil)
 
 			return newChildRev
 		} else {
@@ -645,32 +803,55 @@ func (n *node) Remove(path string, txid string, makeBranch MakeBranchFunction) R
 				path = partition[1]
 			}
 			keyValue := field.KeyFromStr(key)
-			children = make([]Revision, len(rev.GetChildren()[name]))
-			copy(children, rev.GetChildren()[name])
 			if path != "" {
-				idx, childRev := n.findRevByKey(children, field.Key, keyValue)
+				_, childRev := n.findRevByKey(rev.GetChildren()[name], field.Key, keyValue)
 				childNode := childRev.GetNode()
-				newChildRev := childNode.Remove(path, txid, makeBranch)
-				children[idx] = newChildRev
-				rev := rev.UpdateChildren(name, children, branch)
-				branch.GetLatest().Drop(txid, false)
-				n.makeLatest(branch, rev, nil)
-				return rev
+				childNode.Remove(path, txid, makeBranch)
+
+				n.changeLock.Lock()
+				defer n.changeLock.Unlock()
+
+				rev = branch.GetLatest()
+				children = make([]Revision, len(rev.GetChildren()[name]))
+				copy(children, rev.GetChildren()[name])
+
+				idx, _ := n.findRevByKey(children, field.Key, keyValue)
+				if idx < 0 {
+					log.Errorf("child removed during remove - %s/%s", name, key)
+					return nil
+				}
+				children[idx] = childNode.Latest(txid)
+				updatedRev := rev.UpdateChildren(name, children, branch)
+				rev.Drop(txid, false)
+				n.makeLatest(branch, updatedRev, nil)
+				n.advanceChildIndex(branch, name, rev, updatedRev, nil, nil)
+				return updatedRev
+			}
+			if _, childRev := n.findRevByKey(rev.GetChildren()[name], field.Key, keyValue); childRev != nil &&
+				n.GetProxy() != nil {
+				n.GetProxy().InvokeCallbacks(PRE_REMOVE, false, childRev.GetData())
 			}
+
+			n.changeLock.Lock()
+			defer n.changeLock.Unlock()
+
+			rev = branch.GetLatest()
+			children = make([]Revision, len(rev.GetChildren()[name]))
+			copy(children, rev.GetChildren()[name])
+
 			idx, childRev := n.findRevByKey(children, field.Key, keyValue)
-			if n.GetProxy() != nil {
-				data := childRev.GetData()
-				n.GetProxy().InvokeCallbacks(PRE_REMOVE, false, data)
-				postAnnouncement = append(postAnnouncement, ChangeTuple{POST_REMOVE, data, nil})
-			} else {
-				postAnnouncement = append(postAnnouncement, ChangeTuple{POST_REMOVE, childRev.GetData(), nil})
+			if idx < 0 {
+				log.Errorf("key not found - %s/%s", name, key)
+				return nil
 			}
+			postAnnouncement = append(postAnnouncement, ChangeTuple{POST_REMOVE, childRev.GetData(), nil})
 			childRev.Drop(txid, true)
 			children = append(children[:idx], children[idx+1:]...)
-			rev := rev.UpdateChildren(name, children, branch)
+			updatedRev := rev.UpdateChildren(name, children, branch)
 			branch.GetLatest().Drop(txid, false)
-			n.makeLatest(branch, rev, postAnnouncement)
-			return rev
+			n.makeLatest(branch, updatedRev, postAnnouncement)
+			n.advanceChildIndex(branch, name, rev, updatedRev, nil, childRev)
+			return updatedRev
 
 		}
 		log.Errorf("cannot add to non-keyed container")
@@ -837,6 +1018,8 @@ func (n *node) makeProxy(path string, fullPath string, parentNode *node, exclusi
 		KvStore:               n.Root.KvStore,
 		Loading:               n.Root.Loading,
 		RevisionClass:         n.Root.RevisionClass,
+		fences:                n.Root.fences,
+		watches:               n.Root.watches,
 	}
 
 	if n.Proxy == nil {
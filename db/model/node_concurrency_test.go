@@ -0,0 +1,113 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"fmt"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// newConcurrencyTestRoot creates a data model holding a number of devices
+func newConcurrencyTestRoot(t testing.TB, devices int) (*root, *Proxy, []string) {
+	r := NewRoot(&voltha.Voltha{}, nil)
+	proxy := r.node.CreateProxy("/", false)
+	ids := make([]string, devices)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("concurrency-%d", i)
+		if proxy.Add("/devices", &voltha.Device{Id: ids[i], FirmwareVersion: "0"}, "") == nil {
+			t.Fatalf("Failed to add device %s", ids[i])
+		}
+	}
+	return r, proxy, ids
+}
+
+// updateConcurrently updates each device from its own routine, through the proxy returned for the device
+func updateConcurrently(ids []string, updates int, proxyOf func(id string) (*Proxy, string)) {
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			proxy, path := proxyOf(id)
+			for i := 1; i <= updates; i++ {
+				proxy.Update(path, &voltha.Device{Id: id, FirmwareVersion: strconv.Itoa(i)}, false, "")
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+func Test_NodeConcurrency_DistinctDevices(t *testing.T) {
+	r, proxy, ids := newConcurrencyTestRoot(t, 8)
+	updateConcurrently(ids, 20, func(id string) (*Proxy, string) {
+		return proxy, "/devices/" + id
+	})
+
+	// Every device of the latest root revision must hold its last update
+	children := r.node.GetBranch(NONE).GetLatest().GetChildren()["devices"]
+	if len(children) != len(ids) {
+		t.Fatalf("Unexpected number of devices: %d", len(children))
+	}
+	for _, child := range children {
+		if device := child.GetData().(*voltha.Device); device.FirmwareVersion != "20" {
+			t.Errorf("Update lost for device %s - firmware: %s", device.Id, device.FirmwareVersion)
+		}
+	}
+}
+
+func Test_NodeConcurrency_DeviceProxies(t *testing.T) {
+	r, _, ids := newConcurrencyTestRoot(t, 8)
+	updateConcurrently(ids, 20, func(id string) (*Proxy, string) {
+		return r.node.CreateProxy("/devices/"+id, false), "/"
+	})
+
+	for _, id := range ids {
+		device := r.node.CreateProxy("/devices/"+id, false).Get("/", 0, false, "").(*voltha.Device)
+		if device.FirmwareVersion != "20" {
+			t.Errorf("Update lost for device %s - firmware: %s", id, device.FirmwareVersion)
+		}
+	}
+}
+
+// benchmarkConcurrentUpdates measures the updates made concurrently to distinct devices.  With one routine per
+// device, the time per update should drop as devices are added, up to the number of CPUs.
+func benchmarkConcurrentUpdates(b *testing.B, proxyOf func(r *root, id string) (*Proxy, string)) {
+	for _, devices := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("devices-%d", devices), func(b *testing.B) {
+			r, _, ids := newConcurrencyTestRoot(b, devices)
+			updates := b.N/devices + 1
+			b.ResetTimer()
+			updateConcurrently(ids, updates, func(id string) (*Proxy, string) {
+				return proxyOf(r, id)
+			})
+		})
+	}
+}
+
+func Benchmark_NodeConcurrency_RootProxyUpdates(b *testing.B) {
+	benchmarkConcurrentUpdates(b, func(r *root, id string) (*Proxy, string) {
+		return r.node.GetProxy(), "/devices/" + id
+	})
+}
+
+func Benchmark_NodeConcurrency_DeviceProxyUpdates(b *testing.B) {
+	benchmarkConcurrentUpdates(b, func(r *root, id string) (*Proxy, string) {
+		return r.node.CreateProxy("/devices/"+id, false), "/"
+	})
+}
@@ -129,11 +129,12 @@ func (npr *NonPersistedRevision) GetNode() *node {
 }
 
 func (npr *NonPersistedRevision) Finalize(skipOnExist bool) {
+	// The hash covers every child: compute it before taking the lock shared by all the revisions
+	npr.Hash = npr.hashContent()
+
 	GetRevCache().Lock()
 	defer GetRevCache().Unlock()
 
-	npr.Hash = npr.hashContent()
-
 	if _, exists := GetRevCache().Cache[npr.Hash]; !exists {
 		GetRevCache().Cache[npr.Hash] = npr
 	}
@@ -21,8 +21,9 @@ import (
 	"compress/gzip"
 	"github.com/golang/protobuf/proto"
 	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"io/ioutil"
 	"reflect"
-	"runtime/debug"
 	"strings"
 	"sync"
 )
@@ -33,6 +34,9 @@ type PersistedRevision struct {
 	Revision
 	Compress bool
 	kvStore  *Backend
+	// version of the KV entry stored under versionHash, as last read or written by this instance
+	version     int64
+	versionHash string
 }
 
 // NewPersistedRevision creates a new instance of a PersistentRevision structure
@@ -58,34 +62,129 @@ func (pr *PersistedRevision) store(skipOnExist bool) {
 		return
 	}
 
-	if pair, _ := pr.kvStore.Get(pr.GetHash()); pair != nil && skipOnExist {
-		log.Debugf("Config already exists - hash:%s, stack: %s", pr.GetConfig().Hash, string(debug.Stack()))
-		return
-		//}
+	pr.mutex.Lock()
+	defer pr.mutex.Unlock()
+
+	if skipOnExist {
+		if pr.kvStore.IsWritePending(pr.GetHash()) {
+			log.Debugf("Config already being stored - hash:%s", pr.GetConfig().Hash)
+			return
+		}
+		if pair, _ := pr.kvStore.Get(pr.GetHash()); pair != nil {
+			log.Debugf("Config already exists - hash:%s", pr.GetConfig().Hash)
+			pr.setVersion(pair.Version)
+			return
+		}
 	}
 
-	if blob, err := proto.Marshal(pr.GetConfig().Data.(proto.Message)); err != nil {
-		// TODO report error
+	if blob, err := pr.encode(); err != nil {
+		log.Errorf("Problem encoding revision config - error: %s, hash: %s", err.Error(), pr.GetHash())
 	} else {
-		if pr.Compress {
-			var b bytes.Buffer
-			w := gzip.NewWriter(&b)
-			w.Write(blob)
-			w.Close()
-			blob = b.Bytes()
+		// A fenced write is made along with its fencing token, without delay
+		if guard := pr.kvStore.getFence(pr.GetHash()); guard != nil {
+			version, err := pr.kvStore.writeFenced(guard, kvstore.TXN_PUT, blob, pr.expectedVersion())
+			pr.stored(blob, version, err)
+			return
+		}
+		// With write-behind, the write is made later along with others; its outcome is recorded once known
+		deferred := pr.kvStore.PutBehind(pr.GetHash(), blob, pr.expectedVersion(), func(version int64,
+			err error) error {
+			if err == ErrWriteDiscarded {
+				log.Debugf("Discarded revision config - hash: %s", pr.GetHash())
+				return nil
+			}
+			pr.mutex.Lock()
+			defer pr.mutex.Unlock()
+			return pr.stored(blob, version, err)
+		})
+		if !deferred {
+			version, err := pr.kvStore.PutIfVersion(pr.GetHash(), blob, pr.expectedVersion())
+			pr.stored(blob, version, err)
 		}
+	}
+}
 
-		if err := pr.kvStore.Put(pr.GetHash(), blob); err != nil {
-			log.Warnf("Problem storing revision config - error: %s, hash: %s, data: %+v", err.Error(),
-				pr.GetHash(),
-				pr.GetConfig().Data)
-		} else {
-			log.Debugf("Stored config - hash:%s, blob: %+v, stack: %s", pr.GetHash(), pr.GetConfig().Data,
-				string(debug.Stack()))
+// encode returns the blob of the config of the revision, as stored in the KV store
+func (pr *PersistedRevision) encode() ([]byte, error) {
+	blob, err := proto.Marshal(pr.GetConfig().Data.(proto.Message))
+	if err != nil || !pr.Compress {
+		return blob, err
+	}
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(blob)
+	w.Close()
+	return b.Bytes(), nil
+}
+
+// decode returns the config data held by a blob of the KV store, of the type of the config of the revision
+func (pr *PersistedRevision) decode(blob []byte) (proto.Message, error) {
+	if pr.Compress {
+		r, err := gzip.NewReader(bytes.NewReader(blob))
+		if err != nil {
+			return nil, err
 		}
+		defer r.Close()
+		if blob, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	data := reflect.New(reflect.TypeOf(pr.GetConfig().Data).Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(blob, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// stored records the outcome of writing the config of the revision and returns the failure it could not
+// resolve.  The revision lock must be held.
+func (pr *PersistedRevision) stored(blob []byte, version int64, err error) error {
+	if err == kvstore.ErrVersionMismatch {
+		if !pr.resolveConflict(blob) {
+			return err
+		}
+	} else if err != nil {
+		log.Warnf("Problem storing revision config - error: %s, hash: %s, data: %+v", err.Error(),
+			pr.GetHash(),
+			pr.GetConfig().Data)
+		return err
+	} else {
+		pr.setVersion(version)
+		log.Debugf("Stored config - hash:%s, blob: %+v", pr.GetHash(), pr.GetConfig().Data)
 	}
+	return nil
 }
 
+// resolveConflict is invoked when the stored revision was modified since it was last read or written
+// by this instance.  The revision is left untouched in the KV store; if the stored content differs,
+// the update is reported as lost.  It returns whether the stored content is the one of the revision.
+func (pr *PersistedRevision) resolveConflict(blob []byte) bool {
+	pair, err := pr.kvStore.Get(pr.GetHash())
+	if err != nil {
+		log.Warnf("Problem reading conflicting revision - error: %s, hash: %s", err.Error(), pr.GetHash())
+		return false
+	}
+	if pair == nil {
+		log.Errorw("lost-update", log.Fields{"hash": pr.GetHash(), "reason": "removed-by-other"})
+		return false
+	}
+	if stored, ok := pair.Value.([]byte); ok && bytes.Equal(stored, blob) {
+		// Someone else already stored the same content; adopt their version
+		pr.setVersion(pair.Version)
+		return true
+	}
+	log.Errorw("lost-update", log.Fields{
+		"hash":           pr.GetHash(),
+		"reason":         "modified-by-other",
+		"version":        pr.expectedVersion(),
+		"stored-version": pair.Version,
+		"data":           pr.GetConfig().Data,
+	})
+	return false
+}
+
+// LoadFromPersistence reads the revisions stored under the path, one page at a time so that the memory used
+// while loading a large number of items stays bounded
 func (pr *PersistedRevision) LoadFromPersistence(path string, txid string) []Revision {
 	var response []Revision
 	var rev Revision
@@ -93,7 +192,7 @@ func (pr *PersistedRevision) LoadFromPersistence(path string, txid string) []Rev
 	rev = pr
 
 	if pr.kvStore != nil {
-		blobMap, _ := pr.kvStore.List(path)
+		listPath := path
 
 		partition := strings.SplitN(path, "/", 2)
 		name := partition[0]
@@ -106,66 +205,83 @@ func (pr *PersistedRevision) LoadFromPersistence(path string, txid string) []Rev
 
 		field := ChildrenFields(rev.GetBranch().Node.Type)[name]
 
-		if field.IsContainer {
-			for _, blob := range blobMap {
-				output := blob.Value.([]byte)
+		// addChild makes the child stored in an entry the latest revision of its node
+		addChild := func(blob *kvstore.KVPair, data interface{}, key string) Revision {
+			children := make([]Revision, len(rev.GetChildren()[name]))
+			copy(children, rev.GetChildren()[name])
 
-				data := reflect.New(field.ClassType.Elem())
-
-				if err := proto.Unmarshal(output, data.Interface().(proto.Message)); err != nil {
-					// TODO report error
-				} else {
-
-					var children []Revision
-
-					if path == "" {
-						if field.Key != "" {
-							// e.g. /logical_devices/abcde --> path="" name=logical_devices key=abcde
-							if field.Key != "" {
-								children = make([]Revision, len(rev.GetChildren()[name]))
-								copy(children, rev.GetChildren()[name])
+			childRev := rev.GetBranch().Node.makeChildNode(name, field, data, txid).Latest(txid)
+			childRev.SetHash(name + "/" + key)
+			if pChildRev, ok := childRev.(*PersistedRevision); ok {
+				pChildRev.version = blob.Version
+				pChildRev.versionHash = childRev.GetHash()
+			}
+			children = append(children, childRev)
+			rev = rev.UpdateChildren(name, children, rev.GetBranch())
 
-								_, key := GetAttributeValue(data.Interface(), field.Key, 0)
+			rev.GetBranch().Node.makeLatest(rev.GetBranch(), rev, nil)
+			return childRev
+		}
 
-								childRev := rev.GetBranch().Node.MakeNode(data.Interface(), txid).Latest(txid)
-								childRev.SetHash(name + "/" + key.String())
-								children = append(children, childRev)
-								rev = rev.UpdateChildren(name, children, rev.GetBranch())
+		if field != nil && field.IsContainer {
+			err := pr.kvStore.Iterate(listPath, 0, false, func(blob *kvstore.KVPair) error {
+				output := blob.Value.([]byte)
 
-								rev.GetBranch().Node.makeLatest(rev.GetBranch(), rev, nil)
+				data := reflect.New(field.ClassType.Elem())
 
-								response = append(response, childRev)
-								continue
-							}
-						}
-					} else if field.Key != "" {
-						// e.g. /logical_devices/abcde/flows/vwxyz --> path=abcde/flows/vwxyz
+				if err := proto.Unmarshal(output, data.Interface().(proto.Message)); err != nil {
+					log.Warnw("load-from-persistence-unmarshal-failed", log.Fields{"key": blob.Key, "error": err})
+					return nil
+				}
+				if field.Key == "" {
+					return nil
+				}
+				_, keyValue := GetAttributeValue(data.Interface(), field.Key, 0)
+				key := keyValue.String()
 
-						partition := strings.SplitN(path, "/", 2)
-						key := partition[0]
-						if len(partition) < 2 {
-							path = ""
-						} else {
-							path = partition[1]
-						}
-						keyValue := field.KeyFromStr(key)
+				if path == "" {
+					// e.g. /logical_devices/abcde --> path="" name=logical_devices key=abcde
+					response = append(response, addChild(blob, data.Interface(), key))
+					return nil
+				}
 
-						children = make([]Revision, len(rev.GetChildren()[name]))
-						copy(children, rev.GetChildren()[name])
+				// e.g. /logical_devices/abcde/flows/vwxyz --> path=abcde/flows/vwxyz
+				subPartition := strings.SplitN(path, "/", 2)
+				if subPartition[0] != key {
+					// An entry of another child whose key starts with the same characters
+					return nil
+				}
+				subPath := ""
+				if len(subPartition) == 2 {
+					subPath = subPartition[1]
+				}
 
-						idx, childRev := rev.GetBranch().Node.findRevByKey(children, field.Key, keyValue)
+				children := make([]Revision, len(rev.GetChildren()[name]))
+				copy(children, rev.GetChildren()[name])
 
-						newChildRev := childRev.LoadFromPersistence(path, txid)
+				idx, childRev := rev.GetBranch().Node.findRevByKey(children, field.Key, field.KeyFromStr(key))
+				if childRev == nil {
+					// The child is not in memory, e.g. it was added by another core
+					if subPath == "" {
+						response = append(response, addChild(blob, data.Interface(), key))
+					}
+					return nil
+				}
 
-						children[idx] = newChildRev[0]
+				newChildRev := childRev.LoadFromPersistence(subPath, txid)
+				if len(newChildRev) == 0 {
+					return nil
+				}
+				children[idx] = newChildRev[0]
 
-						rev := rev.UpdateChildren(name, rev.GetChildren()[name], rev.GetBranch())
-						rev.GetBranch().Node.makeLatest(rev.GetBranch(), rev, nil)
+				rev = rev.UpdateChildren(name, children, rev.GetBranch())
+				rev.GetBranch().Node.makeLatest(rev.GetBranch(), rev, nil)
 
-						response = append(response, newChildRev[0])
-						continue
-					}
-				}
+				response = append(response, newChildRev[0])
+				return nil
+			})
+			if err != nil {
+				log.Warnw("load-from-persistence-failed", log.Fields{"path": listPath, "error": err})
 			}
 		}
 	}
@@ -182,6 +298,7 @@ func (pr *PersistedRevision) UpdateData(data interface{}, branch *Branch) Revisi
 		Compress: pr.Compress,
 		kvStore:  pr.kvStore,
 	}
+	newPR.version, newPR.versionHash = pr.getVersion()
 
 	return newPR
 }
@@ -195,6 +312,7 @@ func (pr *PersistedRevision) UpdateChildren(name string, children []Revision, br
 		Compress: pr.Compress,
 		kvStore:  pr.kvStore,
 	}
+	newPR.version, newPR.versionHash = pr.getVersion()
 
 	return newPR
 }
@@ -208,10 +326,32 @@ func (pr *PersistedRevision) UpdateAllChildren(children map[string][]Revision, b
 		Compress: pr.Compress,
 		kvStore:  pr.kvStore,
 	}
+	newPR.version, newPR.versionHash = pr.getVersion()
 
 	return newPR
 }
 
+func (pr *PersistedRevision) getVersion() (int64, string) {
+	pr.mutex.RLock()
+	defer pr.mutex.RUnlock()
+	return pr.version, pr.versionHash
+}
+
+// expectedVersion returns the version the KV entry of the revision is expected to be at, 0 when the
+// entry was never read or written by this instance.  The revision lock must be held.
+func (pr *PersistedRevision) expectedVersion() int64 {
+	if pr.versionHash != pr.GetHash() {
+		return 0
+	}
+	return pr.version
+}
+
+// setVersion records the version of the KV entry of the revision.  The revision lock must be held.
+func (pr *PersistedRevision) setVersion(version int64) {
+	pr.version = version
+	pr.versionHash = pr.GetHash()
+}
+
 // Drop takes care of eliminating a revision hash that is no longer needed
 // and its associated config when required
 func (pr *PersistedRevision) Drop(txid string, includeConfig bool) {
@@ -230,7 +370,11 @@ func (pr *PersistedRevision) Drop(txid string, includeConfig bool) {
 		}
 
 		log.Debugf("removing rev - hash: %s", pr.GetHash())
-		if err := pr.kvStore.Delete(pr.GetHash()); err != nil {
+		if guard := pr.kvStore.getFence(pr.GetHash()); guard != nil {
+			if _, err := pr.kvStore.writeFenced(guard, kvstore.TXN_DELETE, nil, kvstore.AnyVersion); err != nil {
+				log.Errorf("failed to remove rev - hash: %s, err: %s", pr.GetHash(), err.Error())
+			}
+		} else if err := pr.kvStore.Delete(pr.GetHash()); err != nil {
 			log.Errorf("failed to remove rev - hash: %s, err: %s", pr.GetHash(), err.Error())
 		}
 	} else {
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+)
+
+func Test_PersistedRevision_LoadAddedByOther(t *testing.T) {
+	owner := NewRoot(&voltha.Voltha{}, NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "load/test"))
+	other := NewRoot(&voltha.Voltha{}, NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "load/test"))
+
+	ownerProxy := owner.node.CreateProxy("/", false)
+	for _, id := range []string{"load-device", "load-device-2"} {
+		if ownerProxy.Add("/devices", &voltha.Device{Id: id, FirmwareVersion: "1"}, "") == nil {
+			t.Fatalf("failed to add device %s", id)
+		}
+	}
+
+	// The other root never saw the device: it is read from the kv store
+	otherProxy := other.node.CreateProxy("/", false)
+	loaded, ok := otherProxy.Get("/devices/load-device", 0, false, "").([]interface{})
+	if !ok || len(loaded) != 1 {
+		t.Fatalf("device should be loaded from the kv store - %+v", loaded)
+	}
+	if device := loaded[0].(*voltha.Device); device.Id != "load-device" || device.FirmwareVersion != "1" {
+		t.Errorf("unexpected loaded device - %+v", device)
+	}
+
+	// It is then in memory, without the device sharing the same key prefix
+	if device, ok := otherProxy.Get("/devices/load-device", 0, false, "").(*voltha.Device); !ok || device == nil {
+		t.Error("loaded device should be kept in memory")
+	}
+	if rev := other.node.revisionAt("/devices/load-device-2", NONE); rev != nil {
+		t.Error("device sharing the key prefix should not be loaded")
+	}
+}
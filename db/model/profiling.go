@@ -32,6 +32,8 @@ type profiling struct {
 	DatabaseStoreTime     float64
 	InMemoryLockTime      float64
 	InMemoryLockCount     int
+	CacheHitCount         int
+	CacheMissCount        int
 }
 
 var profilingInstance *profiling
@@ -88,6 +90,22 @@ func (p *profiling) AddToInMemoryLockTime(period float64) {
 	p.InMemoryLockCount++
 }
 
+// AddToCacheHitCount counts a backend read served from the cache
+func (p *profiling) AddToCacheHitCount() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.CacheHitCount++
+}
+
+// AddToCacheMissCount counts a backend read which had to reach the database
+func (p *profiling) AddToCacheMissCount() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.CacheMissCount++
+}
+
 // Reset initializes the profile counters
 func (p *profiling) Reset() {
 	p.Lock()
@@ -101,6 +119,8 @@ func (p *profiling) Reset() {
 	p.DatabaseStoreTime = 0
 	p.InMemoryLockTime = 0
 	p.InMemoryLockCount = 0
+	p.CacheHitCount = 0
+	p.CacheMissCount = 0
 }
 
 // Report will provide the current profile counter status
@@ -118,5 +138,7 @@ func (p *profiling) Report() {
 	log.Infof("In-Memory Locking : %f", p.InMemoryLockTime)
 	log.Infof("In-Memory Locking Count: %d", p.InMemoryLockCount)
 	log.Infof("Avg In-Memory Locking : %f", p.InMemoryLockTime/float64(p.InMemoryLockCount))
+	log.Infof("Cache Hit Count : %d", p.CacheHitCount)
+	log.Infof("Cache Miss Count : %d", p.CacheMissCount)
 
 }
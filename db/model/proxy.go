@@ -27,6 +27,9 @@ import (
 	"sync"
 )
 
+// ErrInvalidPath is returned when writing data at a path which does not start with "/"
+var ErrInvalidPath = errors.New("invalid-path")
+
 // OperationContext holds details on the information used during an operation
 type OperationContext struct {
 	Path      string
@@ -55,13 +58,16 @@ func (oc *OperationContext) Update(data interface{}) *OperationContext {
 // Proxy holds the information for a specific location with the data model
 type Proxy struct {
 	sync.RWMutex
-	Root        *root
-	Node        *node
-	ParentNode  *node
-	Path        string
-	FullPath    string
-	Exclusive   bool
-	Callbacks   map[CallbackType]map[string]*CallbackTuple
+	Root       *root
+	Node       *node
+	ParentNode *node
+	Path       string
+	FullPath   string
+	Exclusive  bool
+	Callbacks  map[CallbackType]map[string]*CallbackTuple
+
+	// invokeLock serializes the execution of the callbacks which are not asynchronous
+	invokeLock sync.Mutex
 }
 
 // NewProxy instantiates a new proxy to a specific location
@@ -71,13 +77,13 @@ func NewProxy(root *root, node *node, parentNode *node, path string, fullPath st
 		fullPath = ""
 	}
 	p := &Proxy{
-		Root:        root,
-		Node:        node,
-		ParentNode:  parentNode,
-		Exclusive:   exclusive,
-		Path:        path,
-		FullPath:    fullPath,
-		Callbacks:   callbacks,
+		Root:       root,
+		Node:       node,
+		ParentNode: parentNode,
+		Exclusive:  exclusive,
+		Path:       path,
+		FullPath:   fullPath,
+		Callbacks:  callbacks,
 	}
 	return p
 }
@@ -180,11 +186,38 @@ func (p *Proxy) Get(path string, depth int, deep bool, txid string) interface{}
 	return rv
 }
 
+// Query retrieves the entries of the list at the specified path location which are selected by a query
+func (p *Proxy) Query(path string, query *Query, txid string) ([]interface{}, error) {
+	var effectivePath string
+	if path == "/" {
+		effectivePath = p.getFullPath()
+	} else {
+		effectivePath = p.getFullPath() + path
+	}
+
+	pathLock, controlled := p.parseForControlledPath(effectivePath)
+
+	log.Debugf("Path: %s, Effective: %s, PathLock: %s", path, effectivePath, pathLock)
+
+	pac := PAC().ReservePath(effectivePath, p, pathLock)
+	defer PAC().ReleasePath(pathLock)
+	pac.SetProxy(p)
+
+	return pac.Query(path, query, txid, controlled)
+}
+
 // Update will modify information in the data model at the specified location with the provided data
 func (p *Proxy) Update(path string, data interface{}, strict bool, txid string) interface{} {
+	result, _ := p.UpdateWithError(path, data, strict, txid)
+	return result
+}
+
+// UpdateWithError will modify information in the data model at the specified location with the provided data,
+// as Update does, and returns the *ValidationError rejecting the data when it is invalid
+func (p *Proxy) UpdateWithError(path string, data interface{}, strict bool, txid string) (interface{}, error) {
 	if !strings.HasPrefix(path, "/") {
 		log.Errorf("invalid path: %s", path)
-		return nil
+		return nil, ErrInvalidPath
 	}
 	var fullPath string
 	var effectivePath string
@@ -204,16 +237,27 @@ func (p *Proxy) Update(path string, data interface{}, strict bool, txid string)
 	defer PAC().ReleasePath(pathLock)
 	pac.SetProxy(p)
 
-	return pac.Update(fullPath, data, strict, txid, controlled)
+	if err := p.validate(fullPath, data, txid, false); err != nil {
+		return nil, err
+	}
+
+	return pac.Update(fullPath, data, strict, txid, controlled), nil
 }
 
 // AddWithID will insert new data at specified location.
 // This method also allows the user to specify the ID of the data entry to ensure
 // that access control is active while inserting the information.
 func (p *Proxy) AddWithID(path string, id string, data interface{}, txid string) interface{} {
+	result, _ := p.AddWithIDWithError(path, id, data, txid)
+	return result
+}
+
+// AddWithIDWithError will insert new data at specified location, as AddWithID does, and returns the
+// *ValidationError rejecting the data when it is invalid
+func (p *Proxy) AddWithIDWithError(path string, id string, data interface{}, txid string) (interface{}, error) {
 	if !strings.HasPrefix(path, "/") {
 		log.Errorf("invalid path: %s", path)
-		return nil
+		return nil, ErrInvalidPath
 	}
 	var fullPath string
 	var effectivePath string
@@ -233,14 +277,25 @@ func (p *Proxy) AddWithID(path string, id string, data interface{}, txid string)
 	defer PAC().ReleasePath(pathLock)
 	pac.SetProxy(p)
 
-	return pac.Add(fullPath, data, txid, controlled)
+	if err := p.validate(fullPath, data, txid, true); err != nil {
+		return nil, err
+	}
+
+	return pac.Add(fullPath, data, txid, controlled), nil
 }
 
 // Add will insert new data at specified location.
 func (p *Proxy) Add(path string, data interface{}, txid string) interface{} {
+	result, _ := p.AddWithError(path, data, txid)
+	return result
+}
+
+// AddWithError will insert new data at specified location, as Add does, and returns the *ValidationError
+// rejecting the data when it is invalid
+func (p *Proxy) AddWithError(path string, data interface{}, txid string) (interface{}, error) {
 	if !strings.HasPrefix(path, "/") {
 		log.Errorf("invalid path: %s", path)
-		return nil
+		return nil, ErrInvalidPath
 	}
 	var fullPath string
 	var effectivePath string
@@ -260,7 +315,11 @@ func (p *Proxy) Add(path string, data interface{}, txid string) interface{} {
 	defer PAC().ReleasePath(pathLock)
 	pac.SetProxy(p)
 
-	return pac.Add(fullPath, data, txid, controlled)
+	if err := p.validate(fullPath, data, txid, true); err != nil {
+		return nil, err
+	}
+
+	return pac.Add(fullPath, data, txid, controlled), nil
 }
 
 // Remove will delete an entry at the specified location
@@ -306,6 +365,31 @@ func (p *Proxy) cancelTransaction(txid string) {
 	p.GetRoot().DeleteTxBranch(txid)
 }
 
+// Watch returns a channel receiving the changes made to the data model at a path relative to the proxy, and
+// beneath it.  Events are delivered in order without ever blocking the writers of the data model; a watch
+// whose listener falls too far behind is cancelled and its channel closed.  The changes made within a
+// transaction are delivered when the transaction is committed.
+func (p *Proxy) Watch(path string, filter *WatchFilter) chan *WatchEvent {
+	return p.GetRoot().watches.add(p.getFullPath()+"/"+path, filter)
+}
+
+// CloseWatch cancels a watch created with Watch and closes its channel
+func (p *Proxy) CloseWatch(ch chan *WatchEvent) {
+	if !p.GetRoot().watches.remove(ch) {
+		log.Warnw("watch-not-found", log.Fields{"path": p.getFullPath()})
+	}
+}
+
+// Flush waits for the changes made to the data model to be written to the KV store when its writes are
+// deferred, and returns the last error met by them.  Callers acknowledging a change as durable should flush
+// beforehand.
+func (p *Proxy) Flush() error {
+	if p.GetRoot().KvStore == nil {
+		return nil
+	}
+	return p.GetRoot().KvStore.Flush()
+}
+
 // CallbackFunction is a type used to define callback functions
 type CallbackFunction func(args ...interface{}) interface{}
 
@@ -313,6 +397,20 @@ type CallbackFunction func(args ...interface{}) interface{}
 type CallbackTuple struct {
 	callback CallbackFunction
 	args     []interface{}
+	name     string
+	options  CallbackOptions
+}
+
+// isAsync returns whether the callback is executed by the callback dispatcher for a type of change
+func (tuple *CallbackTuple) isAsync(callbackType CallbackType) bool {
+	if !tuple.options.Async {
+		return false
+	}
+	switch callbackType {
+	case POST_UPDATE, POST_ADD, POST_REMOVE, POST_LISTCHANGE:
+		return true
+	}
+	return false
 }
 
 // Execute will process the a callback with its provided arguments
@@ -334,6 +432,12 @@ func (tuple *CallbackTuple) Execute(contextArgs []interface{}) interface{} {
 
 // RegisterCallback associates a callback to the proxy
 func (p *Proxy) RegisterCallback(callbackType CallbackType, callback CallbackFunction, args ...interface{}) {
+	p.RegisterCallbackWithOptions(callbackType, callback, CallbackOptions{}, args...)
+}
+
+// RegisterCallbackWithOptions associates a callback to the proxy, with options selecting how it is executed
+func (p *Proxy) RegisterCallbackWithOptions(callbackType CallbackType, callback CallbackFunction,
+	options CallbackOptions, args ...interface{}) {
 	if p.getCallbacks(callbackType) == nil {
 		p.setCallbacks(callbackType, make(map[string]*CallbackTuple))
 	}
@@ -341,7 +445,7 @@ func (p *Proxy) RegisterCallback(callbackType CallbackType, callback CallbackFun
 	log.Debugf("value of function: %s", funcName)
 	funcHash := fmt.Sprintf("%x", md5.Sum([]byte(funcName)))[:12]
 
-	p.setCallback(callbackType, funcHash, &CallbackTuple{callback, args})
+	p.setCallback(callbackType, funcHash, &CallbackTuple{callback: callback, args: args, name: funcName, options: options})
 }
 
 // UnregisterCallback removes references to a callback within a proxy
@@ -378,7 +482,21 @@ func (p *Proxy) invoke(callback *CallbackTuple, context []interface{}) (result i
 	return result, err
 }
 
-// InvokeCallbacks executes all callbacks associated to a specific type
+// copyCallbacks returns the callbacks associated to a specific type, so that they can be executed without
+// holding the proxy lock
+func (p *Proxy) copyCallbacks(callbackType CallbackType) []*CallbackTuple {
+	p.RLock()
+	defer p.RUnlock()
+
+	callbacks := make([]*CallbackTuple, 0, len(p.Callbacks[callbackType]))
+	for _, callback := range p.Callbacks[callbackType] {
+		callbacks = append(callbacks, callback)
+	}
+	return callbacks
+}
+
+// InvokeCallbacks executes all callbacks associated to a specific type, except the asynchronous ones which are
+// handed to the callback dispatcher when the change is made
 func (p *Proxy) InvokeCallbacks(args ...interface{}) (result interface{}) {
 	callbackType := args[0].(CallbackType)
 	proceedOnError := args[1].(bool)
@@ -386,19 +504,35 @@ func (p *Proxy) InvokeCallbacks(args ...interface{}) (result interface{}) {
 
 	var err error
 
-	if callbacks := p.getCallbacks(callbackType); callbacks != nil {
-		p.Lock()
-		for _, callback := range callbacks {
-			if result, err = p.invoke(callback, context); err != nil {
-				if !proceedOnError {
-					log.Info("An error occurred.  Stopping callback invocation")
-					break
-				}
-				log.Info("An error occurred.  Invoking next callback")
+	p.invokeLock.Lock()
+	defer p.invokeLock.Unlock()
+	for _, callback := range p.copyCallbacks(callbackType) {
+		if callback.isAsync(callbackType) {
+			continue
+		}
+		if result, err = p.invoke(callback, context); err != nil {
+			if !proceedOnError {
+				log.Info("An error occurred.  Stopping callback invocation")
+				break
 			}
+			log.Info("An error occurred.  Invoking next callback")
 		}
-		p.Unlock()
 	}
 
 	return result
 }
+
+// dispatchCallbacks hands the asynchronous callbacks of a type to the callback dispatcher.  It is called as the
+// changes are made so that the callbacks of the proxy are dispatched in the order of the changes.
+func (p *Proxy) dispatchCallbacks(callbackType CallbackType, context ...interface{}) {
+	for _, callback := range p.copyCallbacks(callbackType) {
+		if callback.isAsync(callbackType) {
+			GetCallbackDispatcher().dispatch(&callbackTask{
+				path:         p.getFullPath(),
+				callbackType: callbackType,
+				tuple:        callback,
+				context:      context,
+			})
+		}
+	}
+}
@@ -18,14 +18,20 @@ package model
 
 import (
 	"github.com/opencord/voltha-go/common/log"
-	"runtime/debug"
 	"sync"
 	"time"
 )
 
 type singletonProxyAccessControl struct {
 	sync.RWMutex
-	cache map[string]ProxyAccessControl
+	cache map[string]*pathLockEntry
+}
+
+// pathLockEntry controls the access to a subtree of the data model, such as a device.  It is shared by the
+// reservations of the subtree and released along with the last of them.
+type pathLockEntry struct {
+	ch   chan struct{}
+	refs int
 }
 
 var instanceProxyAccessControl *singletonProxyAccessControl
@@ -34,40 +40,50 @@ var onceProxyAccessControl sync.Once
 // PAC provides access to the proxy access control singleton instance
 func PAC() *singletonProxyAccessControl {
 	onceProxyAccessControl.Do(func() {
-		instanceProxyAccessControl = &singletonProxyAccessControl{cache: make(map[string]ProxyAccessControl)}
+		instanceProxyAccessControl = &singletonProxyAccessControl{cache: make(map[string]*pathLockEntry)}
 	})
 	return instanceProxyAccessControl
 }
 
-// ReservePath will apply access control for a specific path within the model
+// ReservePath will apply access control for a specific path within the model.  Reservations of paths
+// within the same controlled subtree share its lock, while those of distinct subtrees proceed in parallel.
+// Every reservation must be released with ReleasePath.
 func (singleton *singletonProxyAccessControl) ReservePath(path string, proxy *Proxy, pathLock string) ProxyAccessControl {
 	singleton.Lock()
 	defer singleton.Unlock()
-	var pac ProxyAccessControl
-	var exists bool
-	if pac, exists = singleton.cache[path]; !exists {
-		pac = NewProxyAccessControl(proxy, pathLock)
-		singleton.cache[path] = pac
+
+	entry, exists := singleton.cache[pathLock]
+	if !exists {
+		entry = &pathLockEntry{ch: make(chan struct{}, 1)}
+		singleton.cache[pathLock] = entry
 	}
+	entry.refs++
 
-	if exists {
-		log.Debugf("PAC exists for path: %s... re-using", path)
-	} else {
-		log.Debugf("PAC does not exists for path: %s... creating", path)
+	log.Debugf("PAC reserved for path: %s, lock: %s, reservations: %d", path, pathLock, entry.refs)
+	return &proxyAccessControl{
+		Proxy:    proxy,
+		Path:     path,
+		PathLock: entry.ch,
 	}
-	return pac
 }
 
 // ReleasePath will remove access control for a specific path within the model
 func (singleton *singletonProxyAccessControl) ReleasePath(pathLock string) {
 	singleton.Lock()
 	defer singleton.Unlock()
-	delete(singleton.cache, pathLock)
+
+	if entry, exists := singleton.cache[pathLock]; exists {
+		if entry.refs--; entry.refs <= 0 {
+			delete(singleton.cache, pathLock)
+		}
+	}
 }
 
 // ProxyAccessControl is the abstraction interface to the base proxyAccessControl structure
 type ProxyAccessControl interface {
 	Get(path string, depth int, deep bool, txid string, control bool) interface{}
+	Query(path string, query *Query, txid string, control bool) ([]interface{}, error)
+	GetByIndex(path string, index string, value string, depth int, control bool) ([]interface{}, error)
 	Update(path string, data interface{}, strict bool, txid string, control bool) interface{}
 	Add(path string, data interface{}, txid string, control bool) interface{}
 	Remove(path string, txid string, control bool) interface{}
@@ -161,7 +177,7 @@ func (pac *proxyAccessControl) Get(path string, depth int, deep bool, txid strin
 	if control {
 		pac.lock()
 		defer pac.unlock()
-		log.Debugf("controlling get, stack = %s", string(debug.Stack()))
+		log.Debugf("controlling get - path: %s", path)
 	}
 
 	// FIXME: Forcing depth to 0 for now due to problems deep copying the data structure
@@ -170,12 +186,35 @@ func (pac *proxyAccessControl) Get(path string, depth int, deep bool, txid strin
 	return pac.getProxy().GetRoot().Get(path, "", depth, deep, txid)
 }
 
+// Query retrieves the entries of a list of the data model which are selected by a query
+func (pac *proxyAccessControl) Query(path string, query *Query, txid string, control bool) ([]interface{}, error) {
+	if control {
+		pac.lock()
+		defer pac.unlock()
+		log.Debugf("controlling query - path: %s", path)
+	}
+
+	return pac.getProxy().GetRoot().Query(path, query, txid)
+}
+
+// GetByIndex retrieves the entries of a list of the data model whose indexed attribute has a value
+func (pac *proxyAccessControl) GetByIndex(path string, index string, value string, depth int,
+	control bool) ([]interface{}, error) {
+	if control {
+		pac.lock()
+		defer pac.unlock()
+		log.Debugf("controlling get by index - path: %s", path)
+	}
+
+	return pac.getProxy().GetRoot().GetByIndex(path, index, value, depth)
+}
+
 // Update changes the content of the data model at the specified location with the provided data
 func (pac *proxyAccessControl) Update(path string, data interface{}, strict bool, txid string, control bool) interface{} {
 	if control {
 		pac.lock()
 		defer pac.unlock()
-		log.Debugf("controlling update, stack = %s", string(debug.Stack()))
+		log.Debugf("controlling update - path: %s", path)
 	}
 	result := pac.getProxy().GetRoot().Update(path, data, strict, txid, nil)
 
@@ -190,7 +229,7 @@ func (pac *proxyAccessControl) Add(path string, data interface{}, txid string, c
 	if control {
 		pac.lock()
 		defer pac.unlock()
-		log.Debugf("controlling add, stack = %s", string(debug.Stack()))
+		log.Debugf("controlling add - path: %s", path)
 	}
 	result := pac.getProxy().GetRoot().Add(path, data, txid, nil)
 
@@ -205,7 +244,7 @@ func (pac *proxyAccessControl) Remove(path string, txid string, control bool) in
 	if control {
 		pac.lock()
 		defer pac.unlock()
-		log.Debugf("controlling remove, stack = %s", string(debug.Stack()))
+		log.Debugf("controlling remove - path: %s", path)
 	}
 	return pac.getProxy().GetRoot().Remove(path, txid, nil)
 }
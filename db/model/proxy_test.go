@@ -18,6 +18,7 @@ package model
 import (
 	"encoding/hex"
 	"encoding/json"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
 	"github.com/opencord/voltha-go/protos/openflow_13"
 	"github.com/opencord/voltha-go/protos/voltha"
@@ -29,7 +30,7 @@ import (
 
 var (
 	ldevProxy *Proxy
-	devProxy *Proxy
+	devProxy  *Proxy
 	flowProxy *Proxy
 )
 
@@ -445,6 +446,133 @@ func Test_Proxy_2_4_1_Remove_Device(t *testing.T) {
 	}
 }
 
+// -----------------------------
+// Watch tests
+// -----------------------------
+
+func Test_Proxy_3_1_Watch_Devices(t *testing.T) {
+	devIDBin, _ := uuid.New().MarshalBinary()
+	watchedDevID := "0003" + hex.EncodeToString(devIDBin)[:12]
+	watchedDevice := proto.Clone(device).(*voltha.Device)
+	watchedDevice.Id = watchedDevID
+
+	allChanges := devProxy.Watch("/devices", nil)
+	defer devProxy.CloseWatch(allChanges)
+	removals := devProxy.Watch("/devices/"+watchedDevID, &WatchFilter{Types: []CallbackType{POST_REMOVE}})
+	defer devProxy.CloseWatch(removals)
+
+	if added := devProxy.Add("/devices", watchedDevice, ""); added == nil {
+		t.Fatal("Failed to add device")
+	}
+	if event := receiveWatchEvent(t, allChanges); event.Type != POST_ADD ||
+		event.Path != "/devices/"+watchedDevID || event.PreviousData != nil ||
+		event.LatestData.(*voltha.Device).Id != watchedDevID {
+		t.Errorf("Unexpected add event: %+v", event)
+	}
+
+	updated := proto.Clone(watchedDevice).(*voltha.Device)
+	updated.FirmwareVersion = "watched"
+	if afterUpdate := devProxy.Update("/devices/"+watchedDevID, updated, false, ""); afterUpdate == nil {
+		t.Fatal("Failed to update device")
+	}
+	if event := receiveWatchEvent(t, allChanges); event.Type != POST_UPDATE ||
+		event.PreviousData.(*voltha.Device).FirmwareVersion == "watched" ||
+		event.LatestData.(*voltha.Device).FirmwareVersion != "watched" || event.Hash == "" {
+		t.Errorf("Unexpected update event: %+v", event)
+	}
+
+	// An update without change is not reported
+	devProxy.Update("/devices/"+watchedDevID, updated, false, "")
+
+	if removed := devProxy.Remove("/devices/"+watchedDevID, ""); removed == nil {
+		t.Fatal("Failed to remove device")
+	}
+	for _, ch := range []chan *WatchEvent{allChanges, removals} {
+		if event := receiveWatchEvent(t, ch); event.Type != POST_REMOVE || event.LatestData != nil ||
+			event.PreviousData.(*voltha.Device).Id != watchedDevID {
+			t.Errorf("Unexpected remove event: %+v", event)
+		}
+	}
+	expectNoWatchEvent(t, allChanges)
+	expectNoWatchEvent(t, removals)
+}
+
+func Test_Proxy_3_2_Watch_Transaction(t *testing.T) {
+	devIDBin, _ := uuid.New().MarshalBinary()
+	watchedDevID := "0003" + hex.EncodeToString(devIDBin)[:12]
+	watchedDevice := proto.Clone(device).(*voltha.Device)
+	watchedDevice.Id = watchedDevID
+
+	ch := devProxy.Watch("/devices", nil)
+	defer devProxy.CloseWatch(ch)
+
+	cancelled := devProxy.OpenTransaction()
+	cancelled.Add("/devices", watchedDevice)
+	cancelled.Cancel()
+	expectNoWatchEvent(t, ch)
+
+	committed := devProxy.OpenTransaction()
+	committed.Add("/devices", watchedDevice)
+	expectNoWatchEvent(t, ch)
+	committed.Commit()
+	if event := receiveWatchEvent(t, ch); event.Type != POST_ADD || event.Path != "/devices/"+watchedDevID {
+		t.Errorf("Unexpected transaction event: %+v", event)
+	}
+
+	devProxy.Remove("/devices/"+watchedDevID, "")
+}
+
+func Test_Proxy_3_3_History_Device(t *testing.T) {
+	devIDBin, _ := uuid.New().MarshalBinary()
+	historyDevID := "0003" + hex.EncodeToString(devIDBin)[:12]
+	historyDevice := proto.Clone(device).(*voltha.Device)
+	historyDevice.Id = historyDevID
+	historyDevice.FirmwareVersion = "1.0"
+
+	if added := devProxy.Add("/devices", historyDevice, ""); added == nil {
+		t.Fatal("Failed to add device")
+	}
+	updated := proto.Clone(historyDevice).(*voltha.Device)
+	updated.FirmwareVersion = "2.0"
+	if afterUpdate := devProxy.Update("/devices/"+historyDevID, updated, false, ""); afterUpdate == nil {
+		t.Fatal("Failed to update device")
+	}
+	defer devProxy.Remove("/devices/"+historyDevID, "")
+
+	history := devProxy.History("/devices/" + historyDevID)
+	if len(history) < 2 {
+		t.Fatalf("Unexpected device history: %+v", history)
+	}
+	first := history[0].Hash
+	last := history[len(history)-1].Hash
+
+	if d := devProxy.GetAtRevision("/devices/"+historyDevID, first, 0); d == nil {
+		t.Error("Failed to read the first revision")
+	} else if d.(*voltha.Device).FirmwareVersion != "1.0" {
+		t.Errorf("Unexpected data at the first revision: %+v", d)
+	}
+	if d := devProxy.GetAtRevision("/devices/"+historyDevID, last, 0); d == nil {
+		t.Error("Failed to read the last revision")
+	} else if d.(*voltha.Device).FirmwareVersion != "2.0" {
+		t.Errorf("Unexpected data at the last revision: %+v", d)
+	}
+
+	diff, err := devProxy.Diff("/devices/"+historyDevID, first, last)
+	if err != nil {
+		t.Fatalf("Failed to compare revisions: %s", err.Error())
+	}
+	if len(diff.Fields) != 1 || diff.Fields[0].Name != "firmware_version" ||
+		diff.Fields[0].PreviousValue != "1.0" || diff.Fields[0].LatestValue != "2.0" {
+		t.Errorf("Unexpected field differences: %+v", diff.Fields)
+	}
+	if diff, err = devProxy.Diff("/devices/"+historyDevID, last, last); err != nil || !diff.IsEmpty() {
+		t.Errorf("Unexpected difference of a revision with itself: %+v, %v", diff, err)
+	}
+	if _, err = devProxy.Diff("/devices/"+historyDevID, first, "unknown"); err != ErrRevisionNotFound {
+		t.Errorf("Unexpected error for an unknown revision: %v", err)
+	}
+}
+
 // -----------------------------
 // Callback tests
 // -----------------------------
@@ -0,0 +1,406 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrQueryPathNotFound is returned when the path of a query does not exist
+	ErrQueryPathNotFound = errors.New("query-path-not-found")
+	// ErrQueryPathNotList is returned when the path of a query does not designate a list of children
+	ErrQueryPathNotList = errors.New("query-path-not-list")
+)
+
+// Query selects, orders and paginates the entries of a list of the data model, e.g. /devices
+type Query struct {
+	// Filter selects the entries to return: conditions separated by AND, each comparing an attribute to a
+	// value with = or !=, e.g. "oper_status=ACTIVE AND parent_id=abc".  Attributes are designated by their json
+	// name, using dots for the attributes of sub-messages, e.g. "proxy_address.device_id".  Enumerations may be
+	// compared to their name or number.  All the entries are selected when empty.
+	Filter string
+	// Fields lists the attributes returned, by json name; all the attributes are returned when empty
+	Fields []string
+	// OrderBy is the attribute the entries are sorted by; the order of the list is kept when empty
+	OrderBy    string
+	Descending bool
+	// Offset is the number of selected entries to skip and Limit the maximum number of entries to return, no
+	// limit being applied when 0
+	Offset int
+	Limit  int
+	// Depth of the children included with each entry, as for Proxy.Get
+	Depth int
+}
+
+// queryCondition compares the attribute found by following a path of struct fields to a value
+type queryCondition struct {
+	name   string
+	fields []int
+	negate bool
+	value  string
+}
+
+// compiledQuery is a query validated against the type of the entries of a list
+type compiledQuery struct {
+	*Query
+	conditions []*queryCondition
+	orderBy    []int
+	projection []int
+}
+
+var queryAnd = regexp.MustCompile(`(?i)\s+and\s+`)
+
+// compileQuery resolves the attributes of a query against the type of the entries of a list.  The attributes
+// held as children of the entries cannot be used to filter or sort as they are not part of the entry data.
+func compileQuery(query *Query, entryType reflect.Type, children map[string]*ChildType) (*compiledQuery, error) {
+	cq := &compiledQuery{Query: query}
+	if query == nil {
+		cq.Query = &Query{}
+		return cq, nil
+	}
+
+	if filter := strings.TrimSpace(query.Filter); filter != "" {
+		for _, expr := range queryAnd.Split(filter, -1) {
+			condition, err := parseQueryCondition(expr, entryType, children)
+			if err != nil {
+				return nil, err
+			}
+			cq.conditions = append(cq.conditions, condition)
+		}
+	}
+
+	if query.OrderBy != "" {
+		fields, err := resolveQueryField(query.OrderBy, entryType, children)
+		if err != nil {
+			return nil, err
+		}
+		cq.orderBy = fields
+	}
+
+	for _, name := range query.Fields {
+		index, ok := fieldByJSONName(entryType, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown-query-field: %s", name)
+		}
+		cq.projection = append(cq.projection, index)
+	}
+
+	if query.Offset < 0 || query.Limit < 0 {
+		return nil, fmt.Errorf("invalid-query-pagination: offset %d, limit %d", query.Offset, query.Limit)
+	}
+	return cq, nil
+}
+
+func parseQueryCondition(expr string, entryType reflect.Type, children map[string]*ChildType) (*queryCondition, error) {
+	condition := &queryCondition{}
+	index := strings.Index(expr, "!=")
+	if index >= 0 {
+		condition.negate = true
+	} else if index = strings.Index(expr, "="); index < 0 {
+		return nil, fmt.Errorf("invalid-query-condition: %s", expr)
+	}
+
+	name := strings.TrimSpace(expr[:index])
+	value := strings.TrimSpace(strings.TrimLeft(expr[index:], "!="))
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	condition.name = name
+	condition.value = value
+
+	fields, err := resolveQueryField(name, entryType, children)
+	if err != nil {
+		return nil, err
+	}
+	condition.fields = fields
+	return condition, nil
+}
+
+// resolveQueryField returns the indexes of the struct fields leading to an attribute designated by a dotted
+// path of json names
+func resolveQueryField(name string, entryType reflect.Type, children map[string]*ChildType) ([]int, error) {
+	if _, isChild := children[strings.Split(name, ".")[0]]; isChild {
+		return nil, fmt.Errorf("query-field-is-child: %s", name)
+	}
+
+	var fields []int
+	fieldType := entryType
+	for _, part := range strings.Split(name, ".") {
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unknown-query-field: %s", name)
+		}
+		index, ok := fieldByJSONName(fieldType, part)
+		if !ok {
+			return nil, fmt.Errorf("unknown-query-field: %s", name)
+		}
+		fields = append(fields, index)
+		fieldType = fieldType.Field(index).Type
+	}
+	switch fieldType.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface:
+		return nil, fmt.Errorf("query-field-not-comparable: %s", name)
+	}
+	return fields, nil
+}
+
+// fieldByJSONName returns the index of the field of a struct type with a json name
+func fieldByJSONName(structType reflect.Type, name string) (int, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if strings.Split(field.Tag.Get("json"), ",")[0] == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// queryValue returns the attribute of an entry, invalid when a sub-message on its path is not set
+func queryValue(entry interface{}, fields []int) reflect.Value {
+	value := reflect.ValueOf(entry)
+	for _, index := range fields {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Value{}
+			}
+			value = value.Elem()
+		}
+		value = value.Field(index)
+	}
+	return value
+}
+
+func (c *queryCondition) matches(entry interface{}) bool {
+	return c.equals(queryValue(entry, c.fields)) != c.negate
+}
+
+func (c *queryCondition) equals(value reflect.Value) bool {
+	if !value.IsValid() {
+		return c.value == ""
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Enumerations are also compared to their number
+		if strconv.FormatInt(value.Int(), 10) == c.value {
+			return true
+		}
+	}
+	return fmt.Sprintf("%v", value.Interface()) == c.value
+}
+
+func (cq *compiledQuery) matches(entry interface{}) bool {
+	for _, condition := range cq.conditions {
+		if !condition.matches(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the indexes of the entries selected by the query, sorted and paginated
+func (cq *compiledQuery) apply(entries []interface{}) []int {
+	var selected []int
+	for i, entry := range entries {
+		if cq.matches(entry) {
+			selected = append(selected, i)
+		}
+	}
+
+	if cq.orderBy != nil {
+		sort.SliceStable(selected, func(i, j int) bool {
+			a := queryValue(entries[selected[i]], cq.orderBy)
+			b := queryValue(entries[selected[j]], cq.orderBy)
+			if cq.Descending {
+				return compareQueryValues(b, a) < 0
+			}
+			return compareQueryValues(a, b) < 0
+		})
+	}
+
+	if cq.Offset >= len(selected) {
+		return nil
+	}
+	selected = selected[cq.Offset:]
+	if cq.Limit > 0 && cq.Limit < len(selected) {
+		selected = selected[:cq.Limit]
+	}
+	return selected
+}
+
+// compareQueryValues orders attribute values, unset values first
+func compareQueryValues(a reflect.Value, b reflect.Value) int {
+	if !a.IsValid() || !b.IsValid() {
+		switch {
+		case a.IsValid():
+			return 1
+		case b.IsValid():
+			return -1
+		}
+		return 0
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareInts(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch {
+		case a.Uint() < b.Uint():
+			return -1
+		case a.Uint() > b.Uint():
+			return 1
+		}
+		return 0
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case a.Float() < b.Float():
+			return -1
+		case a.Float() > b.Float():
+			return 1
+		}
+		return 0
+	case reflect.Bool:
+		return compareInts(int64(boolToInt(a.Bool())), int64(boolToInt(b.Bool())))
+	}
+	return strings.Compare(fmt.Sprintf("%v", a.Interface()), fmt.Sprintf("%v", b.Interface()))
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// project returns a copy of an entry holding only the attributes listed by the query
+func (cq *compiledQuery) project(entry interface{}) interface{} {
+	if len(cq.projection) == 0 || entry == nil {
+		return entry
+	}
+	source := reflect.ValueOf(entry).Elem()
+	projected := reflect.New(source.Type())
+	for _, index := range cq.projection {
+		projected.Elem().Field(index).Set(source.Field(index))
+	}
+	return projected.Interface()
+}
+
+// Query returns the entries of the list at a path which are selected by a query.  The entries are filtered
+// before they are copied, which avoids copying the whole list when only a few entries are needed.  An index of
+// the list is used when the query compares an indexed attribute to a value.
+func (r *root) Query(path string, query *Query, txid string) ([]interface{}, error) {
+	parent, name, err := r.listAt(path, txid)
+	if err != nil {
+		return nil, err
+	}
+	field := ChildrenFields(parent.GetData())[name]
+
+	entryType := field.ClassType
+	if entryType.Kind() == reflect.Ptr {
+		entryType = entryType.Elem()
+	}
+	cq, err := compileQuery(query, entryType, ChildrenFields(reflect.New(entryType).Interface()))
+	if err != nil {
+		return nil, err
+	}
+
+	children := parent.GetChildren()[name]
+	if len(children) == 0 && r.KvStore != nil {
+		// Entries not loaded in memory yet are read from persistence
+		var entries []interface{}
+		if list, ok := r.node.Get(path, "", cq.Depth, false, txid).([]interface{}); ok {
+			entries = list
+		}
+		var results []interface{}
+		for _, i := range cq.apply(entries) {
+			results = append(results, cq.project(entries[i]))
+		}
+		return results, nil
+	}
+
+	if txid == "" {
+		if children, err = cq.indexedChildren(parent, name, field, children); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]interface{}, len(children))
+	for i, child := range children {
+		entries[i] = child.GetBranch().GetLatest().GetData()
+	}
+	var results []interface{}
+	for _, i := range cq.apply(entries) {
+		results = append(results, cq.project(children[i].Get(cq.Depth)))
+	}
+	return results, nil
+}
+
+// indexedChildren narrows the children to those found by an index of the list for a condition of the query,
+// keeping their order; all the children are returned when no condition uses an index
+func (cq *compiledQuery) indexedChildren(parent Revision, name string, field *ChildType,
+	children []Revision) ([]Revision, error) {
+	for _, condition := range cq.conditions {
+		if condition.negate || !containsString(field.Indexes, condition.name) {
+			continue
+		}
+		nodes, err := parent.GetNode().findByIndex(name, condition.name, condition.value)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[*node]struct{}, len(nodes))
+		for _, n := range nodes {
+			found[n] = struct{}{}
+		}
+		var selected []Revision
+		for _, child := range children {
+			if _, exists := found[child.GetNode()]; exists {
+				selected = append(selected, child)
+			}
+		}
+		return selected, nil
+	}
+	return children, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"reflect"
+	"testing"
+)
+
+type queryTestStatus int32
+
+func (s queryTestStatus) String() string {
+	return map[queryTestStatus]string{0: "UNKNOWN", 1: "ACTIVE"}[s]
+}
+
+type queryTestAddress struct {
+	DeviceId string `json:"device_id,omitempty"`
+}
+
+type queryTestEntry struct {
+	Id       string            `json:"id,omitempty"`
+	ParentId string            `json:"parent_id,omitempty"`
+	Status   queryTestStatus   `json:"oper_status,omitempty"`
+	Port     uint32            `json:"port,omitempty"`
+	Address  *queryTestAddress `json:"proxy_address,omitempty"`
+	Ports    []string          `json:"ports,omitempty"`
+}
+
+var queryTestEntries = []interface{}{
+	&queryTestEntry{Id: "a", ParentId: "olt1", Status: 1, Port: 3},
+	&queryTestEntry{Id: "b", ParentId: "olt1", Status: 0, Port: 1, Address: &queryTestAddress{DeviceId: "olt1"}},
+	&queryTestEntry{Id: "c", ParentId: "olt2", Status: 1, Port: 2},
+	&queryTestEntry{Id: "d", ParentId: "olt1", Status: 1, Port: 2},
+}
+
+func runTestQuery(t *testing.T, query *Query) []string {
+	cq, err := compileQuery(query, reflect.TypeOf(queryTestEntry{}), nil)
+	if err != nil {
+		t.Fatalf("failed to compile query %+v: %s", query, err.Error())
+	}
+	var ids []string
+	for _, i := range cq.apply(queryTestEntries) {
+		ids = append(ids, queryTestEntries[i].(*queryTestEntry).Id)
+	}
+	return ids
+}
+
+func Test_Query_Filter(t *testing.T) {
+	for filter, expected := range map[string][]string{
+		"":               {"a", "b", "c", "d"},
+		"parent_id=olt1": {"a", "b", "d"},
+		"parent_id = 'olt1' and oper_status=ACTIVE": {"a", "d"},
+		"parent_id=olt1 AND oper_status!=1":         {"b"},
+		"port=2":                                    {"c", "d"},
+		"proxy_address.device_id=olt1":              {"b"},
+		"proxy_address.device_id=":                  {"a", "c", "d"},
+	} {
+		if ids := runTestQuery(t, &Query{Filter: filter}); !reflect.DeepEqual(ids, expected) {
+			t.Errorf("filter %q selected %v, expected %v", filter, ids, expected)
+		}
+	}
+}
+
+func Test_Query_OrderAndPagination(t *testing.T) {
+	if ids := runTestQuery(t, &Query{OrderBy: "port"}); !reflect.DeepEqual(ids, []string{"b", "c", "d", "a"}) {
+		t.Errorf("unexpected order: %v", ids)
+	}
+	if ids := runTestQuery(t, &Query{OrderBy: "id", Descending: true, Offset: 1, Limit: 2}); !reflect.DeepEqual(ids, []string{"c", "b"}) {
+		t.Errorf("unexpected page: %v", ids)
+	}
+	if ids := runTestQuery(t, &Query{Offset: 10}); len(ids) != 0 {
+		t.Errorf("unexpected page past the end: %v", ids)
+	}
+}
+
+func Test_Query_Projection(t *testing.T) {
+	cq, err := compileQuery(&Query{Fields: []string{"id", "proxy_address"}}, reflect.TypeOf(queryTestEntry{}), nil)
+	if err != nil {
+		t.Fatalf("failed to compile query: %s", err.Error())
+	}
+	projected := cq.project(queryTestEntries[1]).(*queryTestEntry)
+	if projected.Id != "b" || projected.Address == nil || projected.ParentId != "" || projected.Port != 0 {
+		t.Errorf("unexpected projection: %+v", projected)
+	}
+}
+
+func Test_Query_Errors(t *testing.T) {
+	children := map[string]*ChildType{"ports": {IsContainer: true}}
+	for _, query := range []*Query{
+		{Filter: "unknown=1"},
+		{Filter: "parent_id"},
+		{Filter: "ports=1"},
+		{Filter: "proxy_address=1"},
+		{OrderBy: "proxy_address.unknown"},
+		{Fields: []string{"unknown"}},
+		{Limit: -1},
+	} {
+		if _, err := compileQuery(query, reflect.TypeOf(queryTestEntry{}), children); err == nil {
+			t.Errorf("invalid query %+v accepted", query)
+		}
+	}
+}
+
+func Test_Query_Devices(t *testing.T) {
+	r := NewRoot(&voltha.Voltha{}, nil)
+	proxy := r.node.CreateProxy("/", false)
+	for i := 0; i < 6; i++ {
+		device := &voltha.Device{
+			Id:         fmt.Sprintf("query-%d", i),
+			ParentId:   fmt.Sprintf("olt-%d", i%2),
+			OperStatus: voltha.OperStatus_ACTIVE,
+		}
+		if i == 0 {
+			device.OperStatus = voltha.OperStatus_FAILED
+		}
+		if proxy.Add("/devices", device, "") == nil {
+			t.Fatalf("Failed to add device %s", device.Id)
+		}
+	}
+
+	devices, err := proxy.Query("/devices", &Query{
+		Filter:     "parent_id=olt-0 AND oper_status=ACTIVE",
+		Fields:     []string{"id"},
+		OrderBy:    "id",
+		Descending: true,
+	}, "")
+	if err != nil {
+		t.Fatalf("Failed to query devices: %s", err.Error())
+	}
+	if len(devices) != 2 || devices[0].(*voltha.Device).Id != "query-4" || devices[1].(*voltha.Device).Id != "query-2" {
+		t.Errorf("Unexpected devices: %+v", devices)
+	}
+	if devices[0].(*voltha.Device).ParentId != "" {
+		t.Errorf("Device not projected: %+v", devices[0])
+	}
+
+	if _, err = proxy.Query("/devices/query-1", nil, ""); err != ErrQueryPathNotList {
+		t.Errorf("Unexpected error for a path which is not a list: %v", err)
+	}
+	if _, err = proxy.Query("/unknown", nil, ""); err != ErrQueryPathNotFound {
+		t.Errorf("Unexpected error for an unknown path: %v", err)
+	}
+	if _, err = proxy.Query("/devices", &Query{Filter: "ports=1"}, ""); err == nil {
+		t.Error("Query filtering on children accepted")
+	}
+}
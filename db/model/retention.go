@@ -0,0 +1,254 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/common/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of revisions retained per node by default
+const default_MaxRevisions = 25
+
+// RetentionPolicy bounds the revisions kept in memory by the data model.  The latest revision of a node is
+// always retained; a zero value disables the corresponding limit.
+type RetentionPolicy struct {
+	// MaxRevisions is the number of revisions retained per node, the latest included
+	MaxRevisions int
+	// MaxAge is how long a revision is retained once it is no longer the latest
+	MaxAge time.Duration
+	// MaxBytes is the memory budget of the revisions of a data model, enforced by Root.Prune which evicts the
+	// oldest revisions first
+	MaxBytes int64
+}
+
+// RevisionStats reports the revisions held in memory by a data model
+type RevisionStats struct {
+	Nodes     int
+	Revisions int
+	// Bytes is the encoded size of the data of the revisions, an approximation of the memory they use
+	Bytes int64
+	// Pruned is the number of revisions evicted by the last call to Root.Prune
+	Pruned int
+}
+
+var retentionPolicy = RetentionPolicy{MaxRevisions: default_MaxRevisions}
+var retentionPolicyLock sync.RWMutex
+
+// SetRetentionPolicy sets the retention policy applied to the revisions of all the data models
+func SetRetentionPolicy(policy RetentionPolicy) {
+	retentionPolicyLock.Lock()
+	defer retentionPolicyLock.Unlock()
+
+	retentionPolicy = policy
+}
+
+// GetRetentionPolicy returns the retention policy applied to the revisions of all the data models
+func GetRetentionPolicy() RetentionPolicy {
+	retentionPolicyLock.RLock()
+	defer retentionPolicyLock.RUnlock()
+
+	return retentionPolicy
+}
+
+// revisionUsage accounts for the revisions retained by the branches of a data model.  Revisions sharing the
+// same data are only counted once towards the bytes.
+type revisionUsage struct {
+	branches  []*Branch
+	revisions map[Revision]struct{}
+	configs   map[*DataRevision]int
+	bytes     int64
+}
+
+func newRevisionUsage() *revisionUsage {
+	return &revisionUsage{
+		revisions: make(map[Revision]struct{}),
+		configs:   make(map[*DataRevision]int),
+	}
+}
+
+func (u *revisionUsage) add(rev Revision) {
+	if _, exists := u.revisions[rev]; exists {
+		return
+	}
+	u.revisions[rev] = struct{}{}
+	config := rev.GetConfig()
+	if config == nil {
+		return
+	}
+	if u.configs[config]++; u.configs[config] == 1 {
+		u.bytes += configSize(config)
+	}
+}
+
+func (u *revisionUsage) remove(rev Revision) {
+	if _, exists := u.revisions[rev]; !exists {
+		return
+	}
+	delete(u.revisions, rev)
+	config := rev.GetConfig()
+	if config == nil {
+		return
+	}
+	if u.configs[config]--; u.configs[config] == 0 {
+		delete(u.configs, config)
+		u.bytes -= configSize(config)
+	}
+}
+
+func configSize(config *DataRevision) int64 {
+	if msg, ok := config.Data.(proto.Message); ok {
+		return int64(proto.Size(msg))
+	}
+	return 0
+}
+
+// collectUsage walks the nodes of the data model reachable from their latest revision
+func (r *root) collectUsage() *revisionUsage {
+	usage := newRevisionUsage()
+	visited := make(map[*node]struct{})
+	pending := []*node{r.node}
+
+	for len(pending) > 0 {
+		n := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, exists := visited[n]; exists {
+			continue
+		}
+		visited[n] = struct{}{}
+
+		branch := n.GetBranch(NONE)
+		if branch == nil {
+			continue
+		}
+		usage.branches = append(usage.branches, branch)
+		for _, rev := range branch.retained() {
+			usage.add(rev)
+		}
+		if latest := branch.GetLatest(); latest != nil {
+			for _, children := range latest.GetChildren() {
+				for _, child := range children {
+					if child != nil && child.GetBranch() != nil {
+						pending = append(pending, child.GetBranch().Node)
+					}
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// GetRevisionStats reports the revisions currently held in memory by the data model
+func (r *root) GetRevisionStats() *RevisionStats {
+	usage := r.collectUsage()
+	return &RevisionStats{Nodes: len(usage.branches), Revisions: len(usage.revisions), Bytes: usage.bytes}
+}
+
+// Prune applies the retention policy to every node of the data model.  Revisions older than the policy allows
+// are dropped first; the oldest remaining revisions are then evicted until the memory budget is met.  Cached
+// revision data no longer used is released along the way.
+func (r *root) Prune() *RevisionStats {
+	policy := GetRetentionPolicy()
+	now := time.Now()
+
+	pruned := 0
+	for _, branch := range r.collectUsage().branches {
+		pruned += branch.prune(policy, now)
+	}
+
+	usage := r.collectUsage()
+	if policy.MaxBytes > 0 && usage.bytes > policy.MaxBytes {
+		pruned += evictOldest(usage, policy.MaxBytes)
+	}
+	r.releaseCachedRevisions(usage)
+
+	stats := &RevisionStats{
+		Nodes:     len(usage.branches),
+		Revisions: len(usage.revisions),
+		Bytes:     usage.bytes,
+		Pruned:    pruned,
+	}
+	log.Debugw("model-revisions-pruned", log.Fields{"stats": stats, "policy": policy})
+	return stats
+}
+
+// evictOldest drops the revisions which are no longer the latest of their node, oldest first, until the
+// revisions fit in the budget
+func evictOldest(usage *revisionUsage, budget int64) int {
+	type candidate struct {
+		branch *Branch
+		info   *RevisionInfo
+		// when the revision stopped being the latest of its node
+		since time.Time
+	}
+
+	var candidates []candidate
+	for _, branch := range usage.branches {
+		branch.RLock()
+		for i := 0; i < len(branch.History)-1; i++ {
+			candidates = append(candidates, candidate{branch, branch.History[i], branch.History[i+1].Time})
+		}
+		branch.RUnlock()
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].since.Before(candidates[j].since)
+	})
+
+	evicted := 0
+	for _, c := range candidates {
+		if usage.bytes <= budget {
+			break
+		}
+		for _, rev := range c.branch.evict(c.info) {
+			usage.remove(rev)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// releaseCachedRevisions removes from the revision cache the revisions of the data model which are no longer
+// retained, along with their data when no retained revision uses it.  The cache is shared by all the data
+// models: the entries of the others are left untouched.
+func (r *root) releaseCachedRevisions(usage *revisionUsage) {
+	used := make(map[string]struct{}, len(usage.revisions))
+	for rev := range usage.revisions {
+		used[rev.GetHash()] = struct{}{}
+	}
+
+	GetRevCache().Lock()
+	defer GetRevCache().Unlock()
+
+	for hash, entry := range GetRevCache().Cache {
+		npr, ok := entry.(*NonPersistedRevision)
+		if !ok || npr.Root != r {
+			continue
+		}
+		if _, retained := used[hash]; retained {
+			continue
+		}
+		delete(GetRevCache().Cache, hash)
+		if config := npr.Config; config != nil && GetRevCache().Cache[config.Hash] == config {
+			if _, retained := usage.configs[config]; !retained {
+				delete(GetRevCache().Cache, config.Hash)
+			}
+		}
+	}
+}
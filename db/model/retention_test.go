@@ -0,0 +1,117 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+)
+
+func newRetentionTestProxy(t *testing.T, devices int, updates int) (*root, *Proxy) {
+	r := NewRoot(&voltha.Voltha{}, nil)
+	proxy := r.node.CreateProxy("/", false)
+	for i := 0; i < devices; i++ {
+		id := fmt.Sprintf("retention-%d", i)
+		if added := proxy.Add("/devices", &voltha.Device{Id: id, Type: "simulated_olt"}, ""); added == nil {
+			t.Fatalf("Failed to add device %s", id)
+		}
+		for j := 0; j < updates; j++ {
+			updated := &voltha.Device{Id: id, Type: "simulated_olt", FirmwareVersion: fmt.Sprintf("%d", j)}
+			if proxy.Update("/devices/"+id, updated, false, "") == nil {
+				t.Fatalf("Failed to update device %s", id)
+			}
+		}
+	}
+	return r, proxy
+}
+
+func Test_Retention_MaxRevisions(t *testing.T) {
+	defer SetRetentionPolicy(GetRetentionPolicy())
+	SetRetentionPolicy(RetentionPolicy{MaxRevisions: 2})
+
+	_, proxy := newRetentionTestProxy(t, 1, 10)
+	if history := proxy.History("/devices/retention-0"); len(history) != 2 {
+		t.Errorf("Unexpected device history: %+v", history)
+	}
+	if history := proxy.History("/"); len(history) != 2 {
+		t.Errorf("Unexpected root history: %+v", history)
+	}
+	if d := proxy.Get("/devices/retention-0", 0, false, ""); d.(*voltha.Device).FirmwareVersion != "9" {
+		t.Errorf("Latest revision not retained: %+v", d)
+	}
+}
+
+func Test_Retention_MemoryBudget(t *testing.T) {
+	defer SetRetentionPolicy(GetRetentionPolicy())
+	SetRetentionPolicy(RetentionPolicy{})
+
+	r, _ := newRetentionTestProxy(t, 5, 5)
+	before := r.GetRevisionStats()
+	if before.Revisions == 0 || before.Bytes == 0 {
+		t.Fatalf("Unexpected revision stats: %+v", before)
+	}
+
+	SetRetentionPolicy(RetentionPolicy{MaxBytes: before.Bytes / 2})
+	after := r.Prune()
+	if after.Bytes > before.Bytes/2 || after.Pruned == 0 || after.Revisions >= before.Revisions {
+		t.Errorf("Memory budget not enforced - before: %+v, after: %+v", before, after)
+	}
+	if after.Nodes != before.Nodes {
+		t.Errorf("Unexpected number of nodes - before: %+v, after: %+v", before, after)
+	}
+
+	// The latest data is never evicted
+	SetRetentionPolicy(RetentionPolicy{MaxBytes: 1})
+	r.Prune()
+	devices := r.node.Get("/devices", "", 0, false, "").([]interface{})
+	if len(devices) != 5 {
+		t.Errorf("Unexpected devices after pruning: %+v", devices)
+	}
+}
+
+func cachedRevisions(r *root) int {
+	GetRevCache().Lock()
+	defer GetRevCache().Unlock()
+
+	cached := 0
+	for _, entry := range GetRevCache().Cache {
+		if npr, ok := entry.(*NonPersistedRevision); ok && npr.Root == r {
+			cached++
+		}
+	}
+	return cached
+}
+
+func Test_Retention_CacheOfOtherRoots(t *testing.T) {
+	defer SetRetentionPolicy(GetRetentionPolicy())
+	SetRetentionPolicy(RetentionPolicy{})
+
+	pruned, _ := newRetentionTestProxy(t, 2, 5)
+	other, _ := newRetentionTestProxy(t, 2, 5)
+	before := cachedRevisions(pruned)
+	otherBefore := cachedRevisions(other)
+
+	SetRetentionPolicy(RetentionPolicy{MaxBytes: 1})
+	pruned.Prune()
+	if after := cachedRevisions(pruned); after >= before {
+		t.Errorf("Cached revisions not released - before: %d, after: %d", before, after)
+	}
+	if after := cachedRevisions(other); after != otherBefore {
+		t.Errorf("Cached revisions of another root released - before: %d, after: %d", otherBefore, after)
+	}
+}
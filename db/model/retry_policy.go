@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default retry policy values
+const (
+	default_RetryMaxAttempts    = 3
+	default_RetryInitialBackoff = 100 * time.Millisecond
+	default_RetryMaxBackoff     = 2 * time.Second
+	default_RetryMultiplier     = 2.0
+	default_RetryJitter         = 0.2
+)
+
+// RetryPolicy defines how a failed KV operation is retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of times an operation is tried, the first attempt included
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it grows by Multiplier on every retry
+	// without exceeding MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of the backoff randomly added or removed to spread the retries of
+	// concurrent callers, e.g. 0.2 means +/- 20%
+	Jitter float64
+	// Deadline bounds the overall time spent on an operation, retries included.  Zero means no
+	// deadline; each attempt is still bounded by the backend timeout.
+	Deadline time.Duration
+}
+
+// NewRetryPolicy creates a retry policy with default values
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    default_RetryMaxAttempts,
+		InitialBackoff: default_RetryInitialBackoff,
+		MaxBackoff:     default_RetryMaxBackoff,
+		Multiplier:     default_RetryMultiplier,
+		Jitter:         default_RetryJitter,
+	}
+}
+
+// Backoff returns the delay to wait after a given failed attempt, starting at 1
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.Multiplier
+		if backoff >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
@@ -19,10 +19,14 @@ package model
 import (
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
 	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"io"
 	"reflect"
+	"strings"
 	"sync"
 )
 
@@ -33,6 +37,24 @@ type Root interface {
 	ExecuteCallbacks()
 	AddCallback(callback CallbackFunction, args ...interface{})
 	AddNotificationCallback(callback CallbackFunction, args ...interface{})
+
+	History(path string) []*RevisionInfo
+	GetAtRevision(path string, hash string, depth int) interface{}
+	Diff(path string, fromHash string, toHash string) (*RevisionDiff, error)
+
+	Prune() *RevisionStats
+	GetRevisionStats() *RevisionStats
+
+	Query(path string, query *Query, txid string) ([]interface{}, error)
+	GetByIndex(path string, index string, value string, depth int) ([]interface{}, error)
+
+	Snapshot(w io.Writer) (int, error)
+	Restore(r io.Reader) (int, error)
+
+	StartSync() error
+	StopSync()
+
+	Fsck(repair bool) (*FsckReport, error)
 }
 
 // root points to the top of the data model tree or sub-tree identified by a proxy
@@ -47,7 +69,10 @@ type root struct {
 	Loading       bool
 	RevisionClass interface{}
 
-	mutex sync.RWMutex
+	mutex     sync.RWMutex
+	fences    *fenceRegistry
+	watches   *watchRegistry
+	modelSync *synchronizer
 }
 
 // NewRoot creates an new instance of a root object
@@ -57,6 +82,8 @@ func NewRoot(initialData interface{}, kvStore *Backend) *root {
 	root.KvStore = kvStore
 	root.DirtyNodes = make(map[string][]*node)
 	root.Loading = false
+	root.fences = newFenceRegistry()
+	root.watches = newWatchRegistry()
 
 	// If there is no storage in place just revert to
 	// a non persistent mechanism
@@ -91,6 +118,7 @@ func (r *root) DeleteTxBranch(txid string) {
 		dirtyNode.DeleteBranch(txid)
 	}
 	delete(r.DirtyNodes, txid)
+	r.watches.discard(txid)
 }
 
 // FoldTxBranch will merge the contents of a transaction branch with the root object
@@ -103,6 +131,7 @@ func (r *root) FoldTxBranch(txid string) {
 	} else {
 		r.node.MergeBranch(txid, false)
 		r.ExecuteCallbacks()
+		r.watches.commit(txid)
 	}
 }
 
@@ -152,7 +181,7 @@ func (r *root) AddCallback(callback CallbackFunction, args ...interface{}) {
 	log.Debugf("AddCallback has the ROOT lock : %+v", r)
 	defer r.mutex.Unlock()
 	defer log.Debugf("AddCallback released the ROOT lock : %+v", r)
-	r.Callbacks = append(r.Callbacks, CallbackTuple{callback, args})
+	r.Callbacks = append(r.Callbacks, CallbackTuple{callback: callback, args: args})
 }
 
 // AddNotificationCallback inserts a new notification callback with its arguments
@@ -161,7 +190,7 @@ func (r *root) AddNotificationCallback(callback CallbackFunction, args ...interf
 	log.Debugf("AddNotificationCallback has the ROOT lock : %+v", r)
 	defer r.mutex.Unlock()
 	defer log.Debugf("AddNotificationCallback released the ROOT lock : %+v", r)
-	r.NotificationCallbacks = append(r.NotificationCallbacks, CallbackTuple{callback, args})
+	r.NotificationCallbacks = append(r.NotificationCallbacks, CallbackTuple{callback: callback, args: args})
 }
 
 func (r *root) syncParent(childRev Revision, txid string) {
@@ -179,7 +208,6 @@ func (r *root) syncParent(childRev Revision, txid string) {
 	r.Proxy.ParentNode.Latest(txid).Finalize(false)
 }
 
-
 // Update modifies the content of an object at a given path with the provided data
 func (r *root) Update(path string, data interface{}, strict bool, txid string, makeBranch MakeBranchFunction) Revision {
 	var result Revision
@@ -192,6 +220,12 @@ func (r *root) Update(path string, data interface{}, strict bool, txid string, m
 		// TODO: raise error
 	}
 
+	location := r.watchedPath(path)
+	var previous Revision
+	if location != "" {
+		previous = r.node.revisionAt(path, txid)
+	}
+
 	if txid != "" {
 		trackDirty := func(node *node) *Branch {
 			r.DirtyNodes[txid] = append(r.DirtyNodes[txid], node)
@@ -210,6 +244,10 @@ func (r *root) Update(path string, data interface{}, strict bool, txid string, m
 
 	r.node.GetRoot().ExecuteCallbacks()
 
+	if location != "" {
+		r.publishChange(location, txid, previous, r.node.revisionAt(path, txid))
+	}
+
 	return result
 }
 
@@ -225,6 +263,16 @@ func (r *root) Add(path string, data interface{}, txid string, makeBranch MakeBr
 		// TODO: raise error
 	}
 
+	var childPath, location string
+	var previous Revision
+	if r.watchedPath(path) != "" {
+		if childPath = r.addedPath(path, data, txid); childPath != "" {
+			if location = r.watchedPath(childPath); location != "" {
+				previous = r.node.revisionAt(childPath, txid)
+			}
+		}
+	}
+
 	if txid != "" {
 		trackDirty := func(node *node) *Branch {
 			r.DirtyNodes[txid] = append(r.DirtyNodes[txid], node)
@@ -238,6 +286,9 @@ func (r *root) Add(path string, data interface{}, txid string, makeBranch MakeBr
 	if result != nil {
 		result.Finalize(true)
 		r.node.GetRoot().ExecuteCallbacks()
+		if location != "" {
+			r.publishChange(location, txid, previous, r.node.revisionAt(childPath, txid))
+		}
 	}
 	return result
 }
@@ -254,6 +305,12 @@ func (r *root) Remove(path string, txid string, makeBranch MakeBranchFunction) R
 		// TODO: raise error
 	}
 
+	location := r.watchedPath(path)
+	var previous Revision
+	if location != "" {
+		previous = r.node.revisionAt(path, txid)
+	}
+
 	if txid != "" {
 		trackDirty := func(node *node) *Branch {
 			r.DirtyNodes[txid] = append(r.DirtyNodes[txid], node)
@@ -266,9 +323,68 @@ func (r *root) Remove(path string, txid string, makeBranch MakeBranchFunction) R
 
 	r.node.GetRoot().ExecuteCallbacks()
 
+	if location != "" {
+		r.publishChange(location, txid, previous, r.node.revisionAt(path, txid))
+	}
+
 	return result
 }
 
+// watchedPath returns the location within the whole data model of a path relative to the root, or an empty
+// string when no watch is interested in the changes made at that location
+func (r *root) watchedPath(path string) string {
+	prefix := ""
+	if proxy := r.GetProxy(); proxy != nil {
+		prefix = proxy.getFullPath()
+	}
+	location := normalizeWatchPath(prefix + "/" + path)
+	if !r.watches.interested(location) {
+		return ""
+	}
+	return location
+}
+
+// addedPath returns the path, relative to the root, of the child that adding data to a container creates
+func (r *root) addedPath(path string, data interface{}, txid string) string {
+	path = strings.TrimRight(path, "/")
+	separator := strings.LastIndex(path, "/")
+	parentRev := r.node.revisionAt(path[:separator+1], txid)
+	if parentRev == nil {
+		return ""
+	}
+	field := ChildrenFields(parentRev.GetNode().Type)[path[separator+1:]]
+	if field == nil || !field.IsContainer || field.Key == "" {
+		return ""
+	}
+	if _, key := GetAttributeValue(data, field.Key, 0); key.IsValid() {
+		return fmt.Sprintf("%s/%v", path, key.Interface())
+	}
+	return ""
+}
+
+// publishChange reports to the watches the change of a location from a revision to another
+func (r *root) publishChange(location string, txid string, previous Revision, latest Revision) {
+	event := &WatchEvent{Path: location}
+	switch {
+	case previous == latest:
+		return
+	case previous == nil:
+		event.Type = POST_ADD
+		event.LatestData = latest.GetData()
+		event.Hash = latest.GetBranch().hashInHistory(latest)
+	case latest == nil:
+		event.Type = POST_REMOVE
+		event.PreviousData = previous.GetData()
+		event.Hash = previous.GetBranch().hashInHistory(previous)
+	default:
+		event.Type = POST_UPDATE
+		event.PreviousData = previous.GetData()
+		event.LatestData = latest.GetData()
+		event.Hash = latest.GetBranch().hashInHistory(latest)
+	}
+	r.watches.publish(txid, event)
+}
+
 // MakeLatest updates a branch with the latest node revision
 func (r *root) MakeLatest(branch *Branch, revision Revision, changeAnnouncement []ChangeTuple) {
 	r.makeLatest(branch, revision, changeAnnouncement)
@@ -298,8 +414,11 @@ func (r *root) makeLatest(branch *Branch, revision Revision, changeAnnouncement
 			// TODO report error
 		} else {
 			log.Debugf("Changing root to : %s", string(blob))
-			if err := r.KvStore.Put("root", blob); err != nil {
-				log.Errorf("failed to properly put value in kvstore - err: %s", err.Error())
+			// With write-behind, queued after the revisions it refers to
+			if !r.KvStore.PutBehind("root", blob, kvstore.AnyVersion, nil) {
+				if err := r.KvStore.Put("root", blob); err != nil {
+					log.Errorf("failed to properly put value in kvstore - err: %s", err.Error())
+				}
 			}
 		}
 	}
@@ -308,4 +427,4 @@ func (r *root) makeLatest(branch *Branch, revision Revision, changeAnnouncement
 type rootData struct {
 	Latest string            `json:latest`
 	Tags   map[string]string `json:tags`
-}
\ No newline at end of file
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/common/log"
+	"io"
+	"reflect"
+	"time"
+)
+
+// SnapshotFormatVersion identifies the layout of the snapshots produced by this version
+const SnapshotFormatVersion = 1
+
+// SnapshotArchive is the portable representation of the in-memory tree of a data model
+type SnapshotArchive struct {
+	FormatVersion int
+	Created       time.Time
+	// Type is the name of the protobuf message held by the root of the snapshot
+	Type string
+	Root *SnapshotNode
+}
+
+// SnapshotNode holds the latest revision of a node of a snapshot.  Data is the protobuf encoding of the
+// revision data and Children holds the nodes of each child field, in the order of the revision.
+type SnapshotNode struct {
+	Hash     string
+	Data     []byte
+	Children map[string][]*SnapshotNode `json:",omitempty"`
+}
+
+// Snapshot writes the latest revision of every node of the data model, along with their hashes, as a JSON
+// encoded archive.  The number of nodes written is returned.
+func (r *root) Snapshot(w io.Writer) (int, error) {
+	latest := r.node.GetBranch(NONE).GetLatest()
+	count := 0
+	snapshotRoot, err := snapshotNode(latest, &count)
+	if err != nil {
+		return 0, err
+	}
+
+	archive := &SnapshotArchive{
+		FormatVersion: SnapshotFormatVersion,
+		Created:       time.Now().UTC(),
+		Type:          proto.MessageName(latest.GetData().(proto.Message)),
+		Root:          snapshotRoot,
+	}
+	if err := json.NewEncoder(w).Encode(archive); err != nil {
+		return 0, err
+	}
+
+	log.Infow("snapshot-complete", log.Fields{"type": archive.Type, "nodes": count})
+	return count, nil
+}
+
+func snapshotNode(rev Revision, count *int) (*SnapshotNode, error) {
+	blob, err := proto.Marshal(rev.GetData().(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	*count++
+
+	sn := &SnapshotNode{Hash: rev.GetHash(), Data: blob}
+	for name, children := range rev.GetChildren() {
+		if sn.Children == nil {
+			sn.Children = make(map[string][]*SnapshotNode)
+		}
+		sn.Children[name] = make([]*SnapshotNode, 0, len(children))
+		for _, child := range children {
+			// The list of the parent may lag behind changes made through the proxy of the child
+			snapshotChild, err := snapshotNode(child.GetBranch().GetLatest(), count)
+			if err != nil {
+				return nil, err
+			}
+			sn.Children[name] = append(sn.Children[name], snapshotChild)
+		}
+	}
+	return sn, nil
+}
+
+// ReadSnapshotArchive decodes an archive produced by Snapshot
+func ReadSnapshotArchive(r io.Reader) (*SnapshotArchive, error) {
+	archive := &SnapshotArchive{}
+	if err := json.NewDecoder(r).Decode(archive); err != nil {
+		return nil, err
+	}
+	if archive.FormatVersion != SnapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported-snapshot-format-%d", archive.FormatVersion)
+	}
+	if archive.Root == nil {
+		return nil, errors.New("empty-snapshot")
+	}
+	return archive, nil
+}
+
+// Restore rebuilds the tree of the data model from a snapshot, which becomes the latest revision of the root.
+// The revisions are restored with the hashes they were snapshot with and are not written to the KV store.
+// Proxies created beforehand on nodes below the root keep referring to the nodes which were replaced.  The
+// number of nodes restored is returned.
+func (r *root) Restore(reader io.Reader) (int, error) {
+	archive, err := ReadSnapshotArchive(reader)
+	if err != nil {
+		return 0, err
+	}
+	if expected := proto.MessageName(r.node.Type.(proto.Message)); archive.Type != expected {
+		return 0, fmt.Errorf("snapshot-type-mismatch: %s, expected %s", archive.Type, expected)
+	}
+
+	count := 0
+	data, children, err := restoreContent(r.node.Root, archive.Root, reflect.TypeOf(r.node.Type), &count)
+	if err != nil {
+		return 0, err
+	}
+
+	branch := r.node.GetBranch(NONE)
+	rev := r.node.MakeRevision(branch, data, children)
+	rev.SetHash(archive.Root.Hash)
+	r.node.makeLatest(branch, rev, nil)
+	// The latest revision is kept when the hashes match, which they do for roots never changed since their
+	// creation whatever their content
+	if branch.GetLatest() != rev {
+		branch.SetLatest(rev)
+	}
+
+	log.Infow("restore-complete", log.Fields{"type": archive.Type, "nodes": count, "created": archive.Created})
+	return count, nil
+}
+
+// restoreContent decodes the data of a snapshot node and rebuilds the nodes of its children
+func restoreContent(r *root, sn *SnapshotNode, dataType reflect.Type, count *int) (interface{}, map[string][]Revision, error) {
+	if dataType.Kind() == reflect.Ptr {
+		dataType = dataType.Elem()
+	}
+	data := reflect.New(dataType).Interface()
+	if err := proto.Unmarshal(sn.Data, data.(proto.Message)); err != nil {
+		return nil, nil, err
+	}
+	*count++
+
+	fields := ChildrenFields(data)
+	children := make(map[string][]Revision)
+	for name, list := range sn.Children {
+		field := fields[name]
+		if field == nil {
+			return nil, nil, fmt.Errorf("unknown-snapshot-child: %s", name)
+		}
+		for _, childSnapshot := range list {
+			childRev, err := restoreNode(r, childSnapshot, field.ClassType, count)
+			if err != nil {
+				return nil, nil, err
+			}
+			children[name] = append(children[name], childRev)
+		}
+	}
+	return data, children, nil
+}
+
+// restoreNode creates a node holding the content of a snapshot node and returns its latest revision
+func restoreNode(r *root, sn *SnapshotNode, dataType reflect.Type, count *int) (Revision, error) {
+	n := &node{
+		Root:      r,
+		Branches:  make(map[string]*Branch),
+		Tags:      make(map[string]Revision),
+		AutoPrune: true,
+	}
+	data, children, err := restoreContent(r, sn, dataType, count)
+	if err != nil {
+		return nil, err
+	}
+	n.Type = data
+
+	branch := NewBranch(n, "", nil, n.AutoPrune)
+	rev := n.MakeRevision(branch, data, children)
+	rev.SetHash(sn.Hash)
+	n.makeLatest(branch, rev, nil)
+	n.SetBranch(NONE, branch)
+	return rev, nil
+}
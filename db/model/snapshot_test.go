@@ -0,0 +1,92 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+)
+
+func Test_Snapshot_Restore(t *testing.T) {
+	source := NewRoot(&voltha.Voltha{}, nil)
+	sourceProxy := source.node.CreateProxy("/", false)
+	for i := 0; i < 3; i++ {
+		device := &voltha.Device{
+			Id:    fmt.Sprintf("snapshot-%d", i),
+			Type:  "simulated_olt",
+			Ports: []*voltha.Port{{PortNo: 1, Label: "pon"}},
+		}
+		if sourceProxy.Add("/devices", device, "") == nil {
+			t.Fatalf("Failed to add device %s", device.Id)
+		}
+	}
+	device := sourceProxy.Get("/devices/snapshot-1", 0, false, "").(*voltha.Device)
+	device.FirmwareVersion = "2.0"
+	if sourceProxy.Update("/devices/snapshot-1", device, false, "") == nil {
+		t.Fatal("Failed to update device snapshot-1")
+	}
+
+	var content bytes.Buffer
+	count, err := source.Snapshot(&content)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %s", err.Error())
+	}
+	if count < 4 {
+		t.Errorf("Unexpected number of nodes in the snapshot: %d", count)
+	}
+
+	target := NewRoot(&voltha.Voltha{}, nil)
+	if restored, err := target.Restore(bytes.NewReader(content.Bytes())); err != nil {
+		t.Fatalf("Restore failed: %s", err.Error())
+	} else if restored != count {
+		t.Errorf("Unexpected number of restored nodes: %d, expected %d", restored, count)
+	}
+
+	targetProxy := target.node.CreateProxy("/", false)
+	expected := sourceProxy.Get("/", -1, false, "")
+	if restored := targetProxy.Get("/", -1, false, ""); !proto.Equal(expected.(proto.Message), restored.(proto.Message)) {
+		t.Errorf("Unexpected restored tree: %+v, expected %+v", restored, expected)
+	}
+	sourceDevice := source.node.Latest().GetChildren()["devices"][1]
+	targetDevice := target.node.Latest().GetChildren()["devices"][1]
+	if sourceDevice.GetHash() != targetDevice.GetHash() {
+		t.Errorf("Hash not preserved: %s, expected %s", targetDevice.GetHash(), sourceDevice.GetHash())
+	}
+
+	// The restored tree can be modified like any other
+	device = targetProxy.Get("/devices/snapshot-2", 0, false, "").(*voltha.Device)
+	device.FirmwareVersion = "3.0"
+	if targetProxy.Update("/devices/snapshot-2", device, false, "") == nil {
+		t.Error("Failed to update a restored device")
+	}
+}
+
+func Test_Snapshot_RestoreErrors(t *testing.T) {
+	var content bytes.Buffer
+	if _, err := NewRoot(&voltha.Voltha{}, nil).Snapshot(&content); err != nil {
+		t.Fatalf("Snapshot failed: %s", err.Error())
+	}
+	if _, err := NewRoot(&voltha.CoreInstance{}, nil).Restore(bytes.NewReader(content.Bytes())); err == nil {
+		t.Error("Snapshot restored into a data model of another type")
+	}
+	if _, err := NewRoot(&voltha.Voltha{}, nil).Restore(bytes.NewReader([]byte(`{"FormatVersion":99}`))); err == nil {
+		t.Error("Snapshot of an unsupported format restored")
+	}
+}
@@ -0,0 +1,287 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrSyncWithoutKvStore is returned when synchronizing a data model which is not persisted
+var ErrSyncWithoutKvStore = errors.New("sync-without-kv-store")
+
+// writeTracker records the writes a backend makes to each key, so that the watch notifications of those
+// writes can be told apart from the changes made by other parties.  A nil tracker records nothing.
+type writeTracker struct {
+	sync.Mutex
+	writes map[string]*trackedWrite
+}
+
+// trackedWrite is the last write made to a key.  Version is the highest version of the key known to the
+// writer: the notifications up to that version are either the writer's own or superseded by them.
+type trackedWrite struct {
+	value    []byte
+	version  int64
+	inFlight int
+}
+
+func newWriteTracker() *writeTracker {
+	return &writeTracker{writes: make(map[string]*trackedWrite)}
+}
+
+// begin records a write about to be made to a key, expected to be at a version
+func (t *writeTracker) begin(key string, value interface{}, version int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	write, exists := t.writes[key]
+	if !exists {
+		write = &trackedWrite{}
+		t.writes[key] = write
+	}
+	write.value, _ = value.([]byte)
+	if version > write.version {
+		write.version = version
+	}
+	write.inFlight++
+}
+
+// end records the version a key was brought to by a write, 0 when unknown or when the write failed
+func (t *writeTracker) end(key string, version int64) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	if write, exists := t.writes[key]; exists {
+		if version > write.version {
+			write.version = version
+		}
+		write.inFlight--
+	}
+}
+
+// isOwn returns whether the change of a key notified at a version results from a write of the tracker owner.
+// While a write is being made, every notification of its key is deemed its own: those of other parties make
+// the write fail and are reported as lost updates.
+func (t *writeTracker) isOwn(key string, value []byte, version int64) bool {
+	if t == nil {
+		return false
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	write, exists := t.writes[key]
+	if !exists {
+		return false
+	}
+	return write.inFlight > 0 || (version > 0 && version <= write.version) ||
+		(write.value != nil && bytes.Equal(write.value, value))
+}
+
+// synchronizer keeps a data model up to date with the changes made to its KV store by other cores, such as
+// the active core of a pair whose standby holds the model.  The changes are those of the keyed children of
+// the root, e.g. /devices/{id}; each is merged into the model as a transaction so that the model callbacks
+// and watches are raised as for a local change.
+type synchronizer struct {
+	root     *root
+	proxy    *Proxy
+	backend  *Backend
+	prefix   string
+	watchKey string
+	watchCh  chan *kvstore.Event
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// StartSync merges into the data model the changes made to its KV store by others, until StopSync is called
+func (r *root) StartSync() error {
+	if r.KvStore == nil {
+		return ErrSyncWithoutKvStore
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.modelSync != nil {
+		return nil
+	}
+
+	b := r.KvStore
+	b.Lock()
+	if b.writes == nil {
+		b.writes = newWriteTracker()
+	}
+	b.Unlock()
+
+	s := &synchronizer{
+		root:     r,
+		proxy:    r.node.CreateProxy("/", false),
+		backend:  b,
+		prefix:   b.makePath(""),
+		watchKey: b.makePath(""),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	s.watchCh = b.Client.Watch(s.watchKey)
+	r.modelSync = s
+	go s.run()
+
+	log.Infow("model-sync-started", log.Fields{"key": s.watchKey})
+	return nil
+}
+
+// StopSync stops merging the changes made to the KV store by others
+func (r *root) StopSync() {
+	r.mutex.Lock()
+	s := r.modelSync
+	r.modelSync = nil
+	r.mutex.Unlock()
+
+	if s == nil {
+		return
+	}
+	close(s.done)
+	s.backend.Client.CloseWatch(s.watchKey, s.watchCh)
+	<-s.stopped
+
+	log.Infow("model-sync-stopped", log.Fields{"key": s.watchKey})
+}
+
+func (s *synchronizer) run() {
+	defer close(s.stopped)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case event, ok := <-s.watchCh:
+			if !ok {
+				return
+			}
+			s.handle(event)
+		}
+	}
+}
+
+// handle merges the change notified by an event, unless it is of no interest to the model or already in it
+func (s *synchronizer) handle(event *kvstore.Event) {
+	key, err := kvstore.ToString(event.Key)
+	if err != nil {
+		log.Warnw("sync-unexpected-key-type", log.Fields{"key": event.Key})
+		return
+	}
+	if event.EventType != kvstore.PUT && event.EventType != kvstore.DELETE {
+		log.Warnw("sync-watch-interrupted", log.Fields{"key": key, "type": event.EventType})
+		return
+	}
+
+	// Only the keyed children of the root are synchronized, e.g. devices/{id}
+	partition := strings.Split(strings.TrimPrefix(key, s.prefix), "/")
+	if len(partition) != 2 {
+		return
+	}
+	name, id := partition[0], partition[1]
+	field := ChildrenFields(s.root.node.Type)[name]
+	if field == nil || !field.IsContainer || field.Key == "" {
+		return
+	}
+
+	value, _ := event.Value.([]byte)
+	if s.backend.IsWritePending(name+"/"+id) || s.backend.getWriteTracker().isOwn(key, value, event.Version) {
+		log.Debugw("sync-own-change-skipped", log.Fields{"key": key, "version": event.Version})
+		return
+	}
+
+	path := "/" + name + "/" + id
+	previous := s.root.node.revisionAt(path, NONE)
+
+	if event.EventType == kvstore.DELETE {
+		if previous == nil {
+			return
+		}
+		log.Debugw("sync-remove", log.Fields{"path": path, "version": event.Version})
+		tx := s.proxy.OpenTransaction()
+		tx.Remove(path)
+		tx.Commit()
+		return
+	}
+
+	data := reflect.New(field.ClassType.Elem())
+	if err := proto.Unmarshal(value, data.Interface().(proto.Message)); err != nil {
+		log.Warnw("sync-unmarshal-failed", log.Fields{"key": key, "error": err})
+		return
+	}
+	if previous != nil && proto.Equal(previous.GetData().(proto.Message), data.Interface().(proto.Message)) {
+		s.adoptVersion(path, event.Version)
+		return
+	}
+
+	log.Debugw("sync-change", log.Fields{"path": path, "version": event.Version, "added": previous == nil})
+	tx := s.proxy.OpenTransaction()
+	if previous == nil {
+		tx.Add("/"+name, data.Interface())
+	} else {
+		tx.Update(path, data.Interface(), false)
+	}
+	tx.Commit()
+
+	if previous != nil {
+		s.announceUpdate(path, previous)
+	}
+	s.adoptVersion(path, event.Version)
+}
+
+// announceUpdate brings the node of an updated child up to date and raises its update callbacks.  A keyed
+// child keeps its hash across revisions, so the merge of the transaction does not see it as changed.
+func (s *synchronizer) announceUpdate(path string, previous Revision) {
+	latest := s.root.node.revisionAt(path, NONE)
+	if latest == nil {
+		return
+	}
+	childNode := latest.GetNode()
+	branch := childNode.GetBranch(NONE)
+	if branch == nil {
+		return
+	}
+	latest.SetBranch(branch)
+	childNode.makeLatest(branch, latest, []ChangeTuple{{POST_UPDATE, previous.GetData(), latest.GetData()}})
+	s.root.ExecuteCallbacks()
+}
+
+// adoptVersion records the version of the KV entry of a child, so that the next local change of the child
+// is stored against the entry written by the other core
+func (s *synchronizer) adoptVersion(path string, version int64) {
+	if version == 0 {
+		return
+	}
+	if pr, ok := s.root.node.revisionAt(path, NONE).(*PersistedRevision); ok {
+		pr.mutex.Lock()
+		defer pr.mutex.Unlock()
+		pr.setVersion(version)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+	"time"
+)
+
+// newSyncTestRoots creates the data models of an active core and of its standby, persisted to the same store
+func newSyncTestRoots(t *testing.T) (*root, *root) {
+	active := NewRoot(&voltha.Voltha{}, NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "sync/test"))
+	standby := NewRoot(&voltha.Voltha{}, NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "sync/test"))
+	if err := standby.StartSync(); err != nil {
+		t.Fatalf("failed to start sync - %s", err.Error())
+	}
+	return active, standby
+}
+
+// waitForDevice waits for a device of a data model to satisfy a condition
+func waitForDevice(r *root, id string, condition func(device *voltha.Device) bool) bool {
+	for i := 0; i < 100; i++ {
+		var device *voltha.Device
+		if rev := r.node.revisionAt("/devices/"+id, NONE); rev != nil {
+			device = rev.GetData().(*voltha.Device)
+		}
+		if condition(device) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func Test_Synchronizer_NotPersisted(t *testing.T) {
+	if err := NewRoot(&voltha.Voltha{}, nil).StartSync(); err != ErrSyncWithoutKvStore {
+		t.Errorf("sync of a model without kv store should fail - err: %v", err)
+	}
+}
+
+func Test_Synchronizer_Changes(t *testing.T) {
+	active, standby := newSyncTestRoots(t)
+	defer standby.StopSync()
+
+	added := make(chan interface{}, 1)
+	standby.node.CreateProxy("/", false).RegisterCallback(POST_ADD, func(args ...interface{}) interface{} {
+		added <- args[1]
+		return nil
+	})
+
+	activeProxy := active.node.CreateProxy("/", false)
+	if activeProxy.Add("/devices", &voltha.Device{Id: "sync-device", FirmwareVersion: "1"}, "") == nil {
+		t.Fatal("failed to add device")
+	}
+	if !waitForDevice(standby, "sync-device", func(device *voltha.Device) bool {
+		return device != nil && device.FirmwareVersion == "1"
+	}) {
+		t.Fatal("added device was not synchronized")
+	}
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Error("add callback was not raised")
+	}
+
+	updated := make(chan interface{}, 1)
+	standby.node.CreateProxy("/devices/sync-device", false).RegisterCallback(POST_UPDATE,
+		func(args ...interface{}) interface{} {
+			updated <- args[1]
+			return nil
+		})
+	activeProxy.Update("/devices/sync-device", &voltha.Device{Id: "sync-device", FirmwareVersion: "2"}, false, "")
+	if !waitForDevice(standby, "sync-device", func(device *voltha.Device) bool {
+		return device != nil && device.FirmwareVersion == "2"
+	}) {
+		t.Fatal("updated device was not synchronized")
+	}
+	select {
+	case latest := <-updated:
+		if latest.(*voltha.Device).FirmwareVersion != "2" {
+			t.Errorf("unexpected update callback data - %+v", latest)
+		}
+	case <-time.After(time.Second):
+		t.Error("update callback was not raised")
+	}
+
+	activeProxy.Remove("/devices/sync-device", "")
+	if !waitForDevice(standby, "sync-device", func(device *voltha.Device) bool {
+		return device == nil
+	}) {
+		t.Error("removed device was not synchronized")
+	}
+}
+
+func Test_Synchronizer_OwnChanges(t *testing.T) {
+	b := NewBackend(MEMORY_KV, t.Name(), memory_port, timeout, "sync/test")
+	b.writes = newWriteTracker()
+	formattedPath := b.makePath("devices/own")
+
+	version, err := b.PutIfVersion("devices/own", []byte("one"), 0)
+	if err != nil {
+		t.Fatalf("backend put failed - %s", err.Error())
+	}
+	if !b.writes.isOwn(formattedPath, []byte("one"), version) {
+		t.Error("own write should be recognized")
+	}
+	// A later write of another party is not
+	b.Client.Put(formattedPath, []byte("other"), timeout)
+	if b.writes.isOwn(formattedPath, []byte("other"), version+1) {
+		t.Error("write of another party should not be recognized as own")
+	}
+	// Neither is any write of a key never written
+	if b.writes.isOwn(b.makePath("devices/other"), []byte("one"), version) {
+		t.Error("write of an untracked key should not be recognized as own")
+	}
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"fmt"
+	desc "github.com/golang/protobuf/descriptor"
+	"github.com/golang/protobuf/proto"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/protos/common"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Rules broken by the fields of the data written to the model
+const (
+	RULE_REQUIRED   = "required"
+	RULE_IMMUTABLE  = "immutable"
+	RULE_RANGE      = "range"
+	RULE_TRANSITION = "transition"
+)
+
+// FieldViolation is a rule broken by a field of the data written to the model
+type FieldViolation struct {
+	Field  string
+	Rule   string
+	Reason string
+}
+
+// ValidationError is returned when the data written to a location of the model breaks some rules.  Path is
+// the location relative to the root of the proxy and Type the name of the protobuf message written.
+type ValidationError struct {
+	Path       string
+	Type       string
+	Violations []*FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	violations := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		violations = append(violations, fmt.Sprintf("%s %s: %s", v.Field, v.Rule, v.Reason))
+	}
+	return fmt.Sprintf("invalid-data: path %s, type %s - %s", e.Path, e.Type, strings.Join(violations, "; "))
+}
+
+// Validator checks the data written to the model.  Previous is the data it replaces, nil when it is added.
+type Validator func(previous interface{}, data interface{}) []*FieldViolation
+
+// fieldConstraint is the constraint declared by the options of a field of a protobuf message
+type fieldConstraint struct {
+	name       string
+	index      int
+	constraint *common.Constraint
+}
+
+// validatorRegistry holds the rules checked for each type of data written to the model
+type validatorRegistry struct {
+	sync.RWMutex
+	constraints map[reflect.Type][]*fieldConstraint
+	validators  map[reflect.Type][]Validator
+}
+
+var validatorsInstance = &validatorRegistry{
+	constraints: make(map[reflect.Type][]*fieldConstraint),
+	validators:  make(map[reflect.Type][]Validator),
+}
+
+// RegisterValidator adds a validator of the data of the type of a sample, e.g. &voltha.Device{}, run whenever
+// such data is added or updated in addition to the constraints declared by the options of its fields
+func RegisterValidator(sample interface{}, validator Validator) {
+	validatorsInstance.Lock()
+	defer validatorsInstance.Unlock()
+
+	t := reflect.TypeOf(sample)
+	validatorsInstance.validators[t] = append(validatorsInstance.validators[t], validator)
+}
+
+// EnumTransitions returns a validator restricting the changes of an enum field.  Allowed maps a value to the
+// values the field may change to; the changes from a value which is not mapped are not restricted.
+func EnumTransitions(field string, allowed map[int32][]int32) Validator {
+	return func(previous interface{}, data interface{}) []*FieldViolation {
+		if previous == nil {
+			return nil
+		}
+		from, to := fieldValue(previous, field), fieldValue(data, field)
+		if !from.IsValid() || !to.IsValid() || from.Kind() != reflect.Int32 {
+			return nil
+		}
+		targets, restricted := allowed[int32(from.Int())]
+		if !restricted || from.Int() == to.Int() {
+			return nil
+		}
+		for _, target := range targets {
+			if int64(target) == to.Int() {
+				return nil
+			}
+		}
+		return []*FieldViolation{{
+			Field:  field,
+			Rule:   RULE_TRANSITION,
+			Reason: fmt.Sprintf("cannot change from %v to %v", from.Interface(), to.Interface()),
+		}}
+	}
+}
+
+// Validate checks data meant to be written at a path of the proxy against the constraints of its fields and
+// the registered validators, without writing it.  A *ValidationError is returned when the data is invalid.
+func (p *Proxy) Validate(path string, data interface{}, txid string) error {
+	fullPath := p.getPath() + path
+	if path == "/" {
+		fullPath = p.getPath()
+	}
+	return p.validate(fullPath, data, txid, false)
+}
+
+// validate checks data meant to be added or updated at a path relative to the root of the proxy
+func (p *Proxy) validate(fullPath string, data interface{}, txid string, added bool) error {
+	if _, ok := data.(proto.Message); !ok {
+		return nil
+	}
+	var previous interface{}
+	if !added {
+		if rev := p.Root.node.revisionAt(fullPath, txid); rev != nil {
+			previous = rev.GetData()
+		}
+	}
+
+	violations := validatorsInstance.check(previous, data)
+	if len(violations) == 0 {
+		return nil
+	}
+	err := &ValidationError{
+		Path:       fullPath,
+		Type:       proto.MessageName(data.(proto.Message)),
+		Violations: violations,
+	}
+	log.Warnw("model-write-rejected", log.Fields{"path": fullPath, "txid": txid, "error": err.Error()})
+	return err
+}
+
+// check returns the rules broken by data replacing previous, nil when it is added
+func (v *validatorRegistry) check(previous interface{}, data interface{}) []*FieldViolation {
+	t := reflect.TypeOf(data)
+	if previous != nil && reflect.TypeOf(previous) != t {
+		previous = nil
+	}
+
+	var violations []*FieldViolation
+	for _, fc := range v.fieldConstraints(data) {
+		violations = append(violations, fc.check(previous, data)...)
+	}
+
+	v.RLock()
+	validators := v.validators[t]
+	v.RUnlock()
+	for _, validator := range validators {
+		violations = append(violations, validator(previous, data)...)
+	}
+	return violations
+}
+
+// fieldConstraints returns the constraints declared by the fields of the type of some data
+func (v *validatorRegistry) fieldConstraints(data interface{}) []*fieldConstraint {
+	t := reflect.TypeOf(data)
+
+	v.RLock()
+	constraints, exists := v.constraints[t]
+	v.RUnlock()
+	if exists {
+		return constraints
+	}
+
+	if message, ok := data.(desc.Message); ok && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		_, md := desc.ForMessage(message)
+		for _, field := range md.Field {
+			options := field.GetOptions()
+			if options == nil || field.OneofIndex != nil || !proto.HasExtension(options, common.E_Constraint) {
+				continue
+			}
+			constraint, err := proto.GetExtension(options, common.E_Constraint)
+			if err != nil {
+				log.Warnw("invalid-field-constraint", log.Fields{"type": t.String(), "field": field.GetName()})
+				continue
+			}
+			if index := fieldIndex(t.Elem(), field.GetName()); index >= 0 {
+				constraints = append(constraints, &fieldConstraint{
+					name:       field.GetName(),
+					index:      index,
+					constraint: constraint.(*common.Constraint),
+				})
+			}
+		}
+	}
+
+	v.Lock()
+	v.constraints[t] = constraints
+	v.Unlock()
+	return constraints
+}
+
+// check returns the rules of the constraint broken by a field of data replacing previous
+func (fc *fieldConstraint) check(previous interface{}, data interface{}) []*FieldViolation {
+	var violations []*FieldViolation
+	value := reflect.ValueOf(data).Elem().Field(fc.index)
+
+	if fc.constraint.GetRequired() && isZeroValue(value) {
+		violations = append(violations, &FieldViolation{Field: fc.name, Rule: RULE_REQUIRED, Reason: "not set"})
+	}
+
+	if fc.constraint.GetImmutable() && previous != nil {
+		before := reflect.ValueOf(previous).Elem().Field(fc.index)
+		if !equalValues(before, value) {
+			violations = append(violations, &FieldViolation{
+				Field:  fc.name,
+				Rule:   RULE_IMMUTABLE,
+				Reason: fmt.Sprintf("cannot change from %v to %v", before.Interface(), value.Interface()),
+			})
+		}
+	}
+
+	if r := fc.constraint.GetRange(); r != nil {
+		var outside bool
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			outside = value.Int() < r.GetMin() || value.Int() > r.GetMax()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			outside = (r.GetMin() > 0 && value.Uint() < uint64(r.GetMin())) ||
+				r.GetMax() < 0 || value.Uint() > uint64(r.GetMax())
+		case reflect.Float32, reflect.Float64:
+			outside = value.Float() < float64(r.GetMin()) || value.Float() > float64(r.GetMax())
+		}
+		if outside {
+			violations = append(violations, &FieldViolation{
+				Field:  fc.name,
+				Rule:   RULE_RANGE,
+				Reason: fmt.Sprintf("%v not within [%d, %d]", value.Interface(), r.GetMin(), r.GetMax()),
+			})
+		}
+	}
+	return violations
+}
+
+// fieldIndex returns the index of the field of a generated protobuf struct holding a protobuf field, -1 if
+// there is none
+func fieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		if tag := strings.Split(t.Field(i).Tag.Get("json"), ","); tag[0] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// fieldValue returns the value of a protobuf field of some data, an invalid value if there is no such field
+func fieldValue(data interface{}, name string) reflect.Value {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	if index := fieldIndex(v.Elem().Type(), name); index >= 0 {
+		return v.Elem().Field(index)
+	}
+	return reflect.Value{}
+}
+
+func isZeroValue(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
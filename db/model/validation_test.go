@@ -0,0 +1,100 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package model
+
+import (
+	"github.com/opencord/voltha-go/protos/voltha"
+	"testing"
+)
+
+// violatedRules returns the rule broken by each field reported by a validation error
+func violatedRules(t *testing.T, err error) map[string]string {
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("unexpected validation error - %v", err)
+	}
+	rules := make(map[string]string)
+	for _, v := range validationErr.Violations {
+		rules[v.Field] = v.Rule
+	}
+	return rules
+}
+
+func Test_Validation_Constraints(t *testing.T) {
+	proxy := NewRoot(&voltha.Voltha{}, nil).node.CreateProxy("/", false)
+
+	if result, err := proxy.AddWithError("/devices", &voltha.Device{Type: "simulated_olt"}, ""); result != nil {
+		t.Error("device without id should be rejected")
+	} else if rules := violatedRules(t, err); rules["id"] != RULE_REQUIRED {
+		t.Errorf("rejected add should report the violations - %+v", rules)
+	}
+	if proxy.Add("/devices", &voltha.Device{Id: "vlan-device", Vlan: 4096}, "") != nil {
+		t.Error("device with out of range vlan should be rejected")
+	}
+	if proxy.Add("/devices", &voltha.Device{Id: "valid-device", Type: "simulated_olt", Vlan: 4095}, "") == nil {
+		t.Fatal("valid device should be added")
+	}
+
+	changed := &voltha.Device{Id: "valid-device", Type: "simulated_onu", Vlan: 5000}
+	rules := violatedRules(t, proxy.Validate("/devices/valid-device", changed, ""))
+	if len(rules) != 2 || rules["type"] != RULE_IMMUTABLE || rules["vlan"] != RULE_RANGE {
+		t.Errorf("unexpected violations - %+v", rules)
+	}
+	if result, err := proxy.UpdateWithError("/devices/valid-device", changed, false, ""); result != nil {
+		t.Error("invalid update should be rejected")
+	} else if rules := violatedRules(t, err); len(rules) != 2 {
+		t.Errorf("rejected update should report the violations - %+v", rules)
+	}
+	if device := proxy.Get("/devices/valid-device", 0, false, "").(*voltha.Device); device.Type != "simulated_olt" {
+		t.Errorf("rejected update should leave the device untouched - %+v", device)
+	}
+
+	if proxy.Update("/devices/valid-device", &voltha.Device{Id: "valid-device", Type: "simulated_olt", Vlan: 10},
+		false, "") == nil {
+		t.Error("valid update should be applied")
+	}
+}
+
+func Test_Validation_Validators(t *testing.T) {
+	RegisterValidator(&voltha.ImageDownload{}, EnumTransitions("state", map[int32][]int32{
+		int32(voltha.ImageDownload_DOWNLOAD_SUCCEEDED): {},
+		int32(voltha.ImageDownload_DOWNLOAD_REQUESTED): {
+			int32(voltha.ImageDownload_DOWNLOAD_STARTED),
+			int32(voltha.ImageDownload_DOWNLOAD_FAILED),
+		},
+	}))
+
+	requested := &voltha.ImageDownload{Name: "image", State: voltha.ImageDownload_DOWNLOAD_REQUESTED}
+	started := &voltha.ImageDownload{Name: "image", State: voltha.ImageDownload_DOWNLOAD_STARTED}
+	succeeded := &voltha.ImageDownload{Name: "image", State: voltha.ImageDownload_DOWNLOAD_SUCCEEDED}
+
+	if violations := validatorsInstance.check(nil, succeeded); len(violations) != 0 {
+		t.Errorf("added data should not be checked against transitions - %+v", violations)
+	}
+	if violations := validatorsInstance.check(requested, started); len(violations) != 0 {
+		t.Errorf("allowed transition should be accepted - %+v", violations)
+	}
+	if violations := validatorsInstance.check(started, requested); len(violations) != 0 {
+		t.Errorf("transition from an unrestricted value should be accepted - %+v", violations)
+	}
+	if violations := validatorsInstance.check(requested, succeeded); len(violations) != 1 ||
+		violations[0].Field != "state" || violations[0].Rule != RULE_TRANSITION {
+		t.Errorf("disallowed transition should be rejected - %+v", violations)
+	}
+	if violations := validatorsInstance.check(succeeded, started); len(violations) != 1 {
+		t.Errorf("transition from a final value should be rejected - %+v", violations)
+	}
+}
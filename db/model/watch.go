@@ -0,0 +1,270 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"github.com/opencord/voltha-go/common/log"
+	"strings"
+	"sync"
+)
+
+const (
+	// Number of events buffered in the channel of a watch
+	default_WatchChannelSize = 100
+	// Number of events queued for a watch whose channel is full before the watch is cancelled
+	maxWatchPendingEvents = 10000
+)
+
+// WatchEvent describes a change made to the data model.  The type is one of POST_ADD, POST_UPDATE or
+// POST_REMOVE; the previous data is nil for an addition and the latest data is nil for a removal.  The data
+// do not include the children of the changed location and are shared with the data model: they must not be
+// modified.  The hash identifies the revision in the history of the location, see Proxy.History.
+type WatchEvent struct {
+	Type         CallbackType
+	Path         string
+	PreviousData interface{}
+	LatestData   interface{}
+	Hash         string
+}
+
+// WatchFilter restricts the events delivered to a watch
+type WatchFilter struct {
+	// Types lists the types of change to deliver; all the types are delivered when empty
+	Types []CallbackType
+	// Match, when set, selects the events to deliver.  It is called from the routine feeding the watch
+	// channel, never while the data model is locked.
+	Match func(event *WatchEvent) bool
+}
+
+func (f *WatchFilter) acceptsType(eventType CallbackType) bool {
+	if f == nil || len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *WatchFilter) matches(event *WatchEvent) bool {
+	return f == nil || f.Match == nil || f.Match(event)
+}
+
+// modelWatcher forwards the events of a watched path to its channel.  Events are queued so that the writers
+// of the data model are never blocked by a slow listener.
+type modelWatcher struct {
+	path    string
+	filter  *WatchFilter
+	channel chan *WatchEvent
+	mutex   sync.Mutex
+	pending []*WatchEvent
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newModelWatcher(path string, filter *WatchFilter) *modelWatcher {
+	return &modelWatcher{
+		path:    path,
+		filter:  filter,
+		channel: make(chan *WatchEvent, default_WatchChannelSize),
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// push queues an event for delivery; it returns false when the queue is full
+func (w *modelWatcher) push(event *WatchEvent) bool {
+	w.mutex.Lock()
+	if len(w.pending) >= maxWatchPendingEvents {
+		w.mutex.Unlock()
+		return false
+	}
+	w.pending = append(w.pending, event)
+	w.mutex.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (w *modelWatcher) forward() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		}
+		for {
+			w.mutex.Lock()
+			if len(w.pending) == 0 {
+				w.mutex.Unlock()
+				break
+			}
+			event := w.pending[0]
+			w.pending = w.pending[1:]
+			w.mutex.Unlock()
+
+			if !w.filter.matches(event) {
+				continue
+			}
+			select {
+			case w.channel <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// stop terminates the forwarding routine and closes the channel
+func (w *modelWatcher) stop() {
+	close(w.done)
+	<-w.stopped
+	close(w.channel)
+}
+
+// watchRegistry tracks the watches of a data model.  It is shared by the root of the model and the roots of
+// its proxies.
+type watchRegistry struct {
+	sync.RWMutex
+	watchers map[chan *WatchEvent]*modelWatcher
+	// Events of the changes made within transactions, delivered when the transaction is committed
+	pending map[string][]*WatchEvent
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{
+		watchers: make(map[chan *WatchEvent]*modelWatcher),
+		pending:  make(map[string][]*WatchEvent),
+	}
+}
+
+// add creates a watch for a path and its descendants
+func (wr *watchRegistry) add(path string, filter *WatchFilter) chan *WatchEvent {
+	w := newModelWatcher(normalizeWatchPath(path), filter)
+	go w.forward()
+
+	wr.Lock()
+	defer wr.Unlock()
+	wr.watchers[w.channel] = w
+	return w.channel
+}
+
+// remove cancels a watch and closes its channel
+func (wr *watchRegistry) remove(ch chan *WatchEvent) bool {
+	wr.Lock()
+	w, ok := wr.watchers[ch]
+	delete(wr.watchers, ch)
+	wr.Unlock()
+	if ok {
+		w.stop()
+	}
+	return ok
+}
+
+// interested reports whether a change at a path may be delivered to a watch.  Changes made beneath the path
+// are included as the location of an added child is only known once it is added.
+func (wr *watchRegistry) interested(path string) bool {
+	wr.RLock()
+	defer wr.RUnlock()
+	for _, w := range wr.watchers {
+		if isWatchedPath(w.path, path) || isWatchedPath(path, w.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish delivers the events of changes made outside of a transaction; the events of a transaction are
+// kept until it is committed
+func (wr *watchRegistry) publish(txid string, events ...*WatchEvent) {
+	if len(events) == 0 {
+		return
+	}
+	if txid != "" {
+		wr.Lock()
+		wr.pending[txid] = append(wr.pending[txid], events...)
+		wr.Unlock()
+		return
+	}
+	wr.deliver(events)
+}
+
+// commit delivers the events of a committed transaction
+func (wr *watchRegistry) commit(txid string) {
+	wr.Lock()
+	events := wr.pending[txid]
+	delete(wr.pending, txid)
+	wr.Unlock()
+	wr.deliver(events)
+}
+
+// discard drops the events of a cancelled transaction
+func (wr *watchRegistry) discard(txid string) {
+	wr.Lock()
+	defer wr.Unlock()
+	delete(wr.pending, txid)
+}
+
+func (wr *watchRegistry) deliver(events []*WatchEvent) {
+	var overflowed []chan *WatchEvent
+
+	wr.RLock()
+	for ch, w := range wr.watchers {
+		for _, event := range events {
+			if !isWatchedPath(w.path, event.Path) || !w.filter.acceptsType(event.Type) {
+				continue
+			}
+			if !w.push(event) {
+				overflowed = append(overflowed, ch)
+				break
+			}
+		}
+	}
+	wr.RUnlock()
+
+	// A listener which does not keep up loses its watch rather than holding an unbounded backlog
+	for _, ch := range overflowed {
+		log.Warnw("watch-cancelled-on-overflow", log.Fields{"pending": maxWatchPendingEvents})
+		wr.remove(ch)
+	}
+}
+
+// normalizeWatchPath returns a path starting with a single slash and without a trailing slash
+func normalizeWatchPath(path string) string {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// isWatchedPath reports whether a path is the watched path or one of its descendants
+func isWatchedPath(watched string, path string) bool {
+	if watched == "/" || watched == path {
+		return true
+	}
+	return strings.HasPrefix(path, watched+"/")
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func receiveWatchEvent(t *testing.T, ch chan *WatchEvent) *WatchEvent {
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for watch event")
+	}
+	return nil
+}
+
+func expectNoWatchEvent(t *testing.T, ch chan *WatchEvent) {
+	select {
+	case event := <-ch:
+		t.Errorf("unexpected watch event: %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_Watch_Paths(t *testing.T) {
+	for path, expected := range map[string]string{
+		"":                 "/",
+		"/":                "/",
+		"devices":          "/devices",
+		"//devices/":       "/devices",
+		"/devices//abc/":   "/devices/abc",
+		"/devices/abc/123": "/devices/abc/123",
+	} {
+		if normalized := normalizeWatchPath(path); normalized != expected {
+			t.Errorf("path %q normalized to %q, expected %q", path, normalized, expected)
+		}
+	}
+
+	if !isWatchedPath("/", "/devices/abc") || !isWatchedPath("/devices", "/devices") ||
+		!isWatchedPath("/devices", "/devices/abc") {
+		t.Error("descendant path not watched")
+	}
+	if isWatchedPath("/devices", "/devices_types") || isWatchedPath("/devices/abc", "/devices") {
+		t.Error("unrelated path watched")
+	}
+}
+
+func Test_Watch_DeliverByPath(t *testing.T) {
+	wr := newWatchRegistry()
+	all := wr.add("/", nil)
+	devices := wr.add("/devices", nil)
+	device := wr.add("devices/abc/", nil)
+
+	if !wr.interested("/devices") || !wr.interested("/logical_devices/xyz") {
+		t.Error("registry not interested in watched paths")
+	}
+
+	wr.publish("",
+		&WatchEvent{Type: POST_ADD, Path: "/devices/abc"},
+		&WatchEvent{Type: POST_UPDATE, Path: "/devices/abc"},
+		&WatchEvent{Type: POST_ADD, Path: "/logical_devices/xyz"})
+
+	for _, ch := range []chan *WatchEvent{all, devices, device} {
+		if event := receiveWatchEvent(t, ch); event.Type != POST_ADD || event.Path != "/devices/abc" {
+			t.Errorf("unexpected first event: %+v", event)
+		}
+		if event := receiveWatchEvent(t, ch); event.Type != POST_UPDATE {
+			t.Errorf("unexpected second event: %+v", event)
+		}
+	}
+	if event := receiveWatchEvent(t, all); event.Path != "/logical_devices/xyz" {
+		t.Errorf("unexpected third event: %+v", event)
+	}
+	expectNoWatchEvent(t, devices)
+	expectNoWatchEvent(t, device)
+
+	for _, ch := range []chan *WatchEvent{all, devices, device} {
+		wr.remove(ch)
+		if _, open := <-ch; open {
+			t.Error("channel not closed")
+		}
+	}
+	if wr.interested("/devices") {
+		t.Error("registry still interested after removal")
+	}
+	if wr.remove(all) {
+		t.Error("watch removed twice")
+	}
+}
+
+func Test_Watch_Filters(t *testing.T) {
+	wr := newWatchRegistry()
+	removals := wr.add("/devices", &WatchFilter{Types: []CallbackType{POST_REMOVE}})
+	matched := wr.add("/devices", &WatchFilter{
+		Match: func(event *WatchEvent) bool {
+			return event.Path == "/devices/def"
+		},
+	})
+	defer wr.remove(removals)
+	defer wr.remove(matched)
+
+	wr.publish("",
+		&WatchEvent{Type: POST_ADD, Path: "/devices/abc"},
+		&WatchEvent{Type: POST_ADD, Path: "/devices/def"},
+		&WatchEvent{Type: POST_REMOVE, Path: "/devices/abc"})
+
+	if event := receiveWatchEvent(t, removals); event.Type != POST_REMOVE || event.Path != "/devices/abc" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	expectNoWatchEvent(t, removals)
+	if event := receiveWatchEvent(t, matched); event.Type != POST_ADD || event.Path != "/devices/def" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	expectNoWatchEvent(t, matched)
+}
+
+func Test_Watch_Transactions(t *testing.T) {
+	wr := newWatchRegistry()
+	ch := wr.add("/", nil)
+	defer wr.remove(ch)
+
+	wr.publish("committed", &WatchEvent{Type: POST_ADD, Path: "/devices/abc"})
+	wr.publish("cancelled", &WatchEvent{Type: POST_ADD, Path: "/devices/def"})
+	expectNoWatchEvent(t, ch)
+
+	wr.discard("cancelled")
+	wr.commit("committed")
+	if event := receiveWatchEvent(t, ch); event.Path != "/devices/abc" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	expectNoWatchEvent(t, ch)
+}
+
+func Test_Watch_Overflow(t *testing.T) {
+	wr := newWatchRegistry()
+	ch := wr.add("/devices", nil)
+
+	// Nobody reads from the channel: its buffer and then the queue fill up
+	for i := 0; i < default_WatchChannelSize+maxWatchPendingEvents+10; i++ {
+		wr.publish("", &WatchEvent{Type: POST_UPDATE, Path: "/devices/abc"})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	if received == 0 || received > default_WatchChannelSize+maxWatchPendingEvents {
+		t.Errorf("unexpected number of events received before cancellation: %d", received)
+	}
+	if wr.interested("/devices") {
+		t.Error("overflowed watch not cancelled")
+	}
+}
@@ -0,0 +1,504 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import (
+	"errors"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default write-behind values
+const (
+	default_WriteBehindMaxBatch = 100
+	default_WriteBehindDelay    = 20 * time.Millisecond
+)
+
+// ErrWriteDiscarded is reported to the writers of a key deleted before their write was made
+var ErrWriteDiscarded = errors.New("write-discarded")
+
+// WriteBehindPolicy defines how the writes of a backend are deferred and batched
+type WriteBehindPolicy struct {
+	// MaxBatch is the maximum number of keys written by a single KV transaction, lowered to the maximum number
+	// of operations of a transaction of the KV store
+	MaxBatch int
+	// Delay is how long a write waits for others to be batched with it
+	Delay time.Duration
+}
+
+// NewWriteBehindPolicy creates a write-behind policy with default values
+func NewWriteBehindPolicy() *WriteBehindPolicy {
+	return &WriteBehindPolicy{
+		MaxBatch: default_WriteBehindMaxBatch,
+		Delay:    default_WriteBehindDelay,
+	}
+}
+
+// WriteCompletion is called once a deferred write was made, with the version of the key or the failure.  It
+// returns the failure left unresolved by the writer, which is reported by the flushes waiting for the write.
+type WriteCompletion func(version int64, err error) error
+
+// pendingWrite is the latest value waiting to be written to a key.  The writes made to a key while it waits
+// are coalesced: the value of the last one is written, conditioned on the version expected by the first one.
+// The seq of the first write is kept to let the flushes issued since wait for the key.
+type pendingWrite struct {
+	seq     uint64
+	key     string
+	value   []byte
+	version int64
+	done    []WriteCompletion
+}
+
+// flushWaiter is a flush waiting for the writes queued up to a seq, recording the failures they leave unresolved
+type flushWaiter struct {
+	seq uint64
+	err error
+}
+
+// versionChange records the version a key was brought to by the last write of the pipeline, until its writers
+// are notified of it
+type versionChange struct {
+	from int64
+	to   int64
+}
+
+// writeBehind defers the writes of a backend and makes them in batches, each batch being a single KV
+// transaction.  Writes are made in the order their keys were last written to, so that a key referring to
+// others, such as the root of the model, is never made before them.
+type writeBehind struct {
+	sync.Mutex
+	backend *Backend
+	policy  WriteBehindPolicy
+
+	seq      uint64
+	queue    []*pendingWrite
+	pending  map[string]*pendingWrite
+	inFlight []*pendingWrite
+	// completing holds the writes made whose writers are being notified
+	completing []*pendingWrite
+	versions   map[string]versionChange
+	changed    *sync.Cond
+
+	flushes []*flushWaiter
+	stopped bool
+	done    chan struct{}
+}
+
+func newWriteBehind(backend *Backend, policy WriteBehindPolicy) *writeBehind {
+	if policy.MaxBatch <= 0 {
+		policy.MaxBatch = default_WriteBehindMaxBatch
+	}
+	// A batch is a single transaction, which the KV store may limit
+	if max := backend.Client.MaxTxnOps(); max > 0 && policy.MaxBatch > max {
+		log.Infow("write-behind-batch-limited", log.Fields{"max-batch": policy.MaxBatch, "max-txn-ops": max})
+		policy.MaxBatch = max
+	}
+	wb := &writeBehind{
+		backend:  backend,
+		policy:   policy,
+		pending:  make(map[string]*pendingWrite),
+		versions: make(map[string]versionChange),
+		done:     make(chan struct{}),
+	}
+	wb.changed = sync.NewCond(&wb.Mutex)
+	go wb.run()
+	return wb
+}
+
+// put queues the write of a value to a key, expected to be at a version.  It returns false, without queuing the
+// write, once the pipeline is stopped.
+func (wb *writeBehind) put(key string, value []byte, version int64, done WriteCompletion) bool {
+	wb.Lock()
+	defer wb.Unlock()
+
+	if wb.stopped {
+		return false
+	}
+	// A revision created before the previous write of its key was made expects the version it replaced
+	if change, exists := wb.versions[key]; exists && change.from == version {
+		version = change.to
+	}
+	if write, exists := wb.pending[key]; exists {
+		write.value = value
+		if done != nil {
+			write.done = append(write.done, done)
+		}
+		wb.moveToBack(write)
+		return true
+	}
+
+	wb.seq++
+	write := &pendingWrite{seq: wb.seq, key: key, value: value, version: version}
+	if done != nil {
+		write.done = append(write.done, done)
+	}
+	wb.pending[key] = write
+	wb.queue = append(wb.queue, write)
+	wb.changed.Broadcast()
+	return true
+}
+
+// moveToBack moves a queued write after those made since.  The lock must be held.
+func (wb *writeBehind) moveToBack(write *pendingWrite) {
+	for i, queued := range wb.queue {
+		if queued == write {
+			copy(wb.queue[i:], wb.queue[i+1:])
+			wb.queue[len(wb.queue)-1] = write
+			return
+		}
+	}
+}
+
+// get returns the value waiting to be written to a key and whether one is
+func (wb *writeBehind) get(key string) ([]byte, bool) {
+	wb.Lock()
+	defer wb.Unlock()
+
+	if write, exists := wb.pending[key]; exists {
+		return write.value, true
+	}
+	for _, write := range wb.inFlight {
+		if write.key == key {
+			return write.value, true
+		}
+	}
+	return nil, false
+}
+
+// isPending returns whether a write to a key has yet to be made
+func (wb *writeBehind) isPending(key string) bool {
+	_, pending := wb.get(key)
+	return pending
+}
+
+// discard drops the writes waiting for the keys with a prefix, about to be deleted, and waits for those
+// being made
+func (wb *writeBehind) discard(prefix string) {
+	wb.Lock()
+	var discarded []*pendingWrite
+	queue := wb.queue[:0]
+	for _, write := range wb.queue {
+		if strings.HasPrefix(write.key, prefix) {
+			discarded = append(discarded, write)
+			delete(wb.pending, write.key)
+		} else {
+			queue = append(queue, write)
+		}
+	}
+	wb.queue = queue
+	for wb.isInFlight(prefix) {
+		wb.changed.Wait()
+	}
+	for key := range wb.versions {
+		if strings.HasPrefix(key, prefix) {
+			delete(wb.versions, key)
+		}
+	}
+	wb.changed.Broadcast()
+	wb.Unlock()
+
+	// The deleting routine may hold locks the writers need to handle the failure
+	if len(discarded) > 0 {
+		go func() {
+			for _, write := range discarded {
+				write.complete(0, ErrWriteDiscarded)
+			}
+		}()
+	}
+}
+
+// isInFlight returns whether a key with a prefix is being written.  The lock must be held.
+func (wb *writeBehind) isInFlight(prefix string) bool {
+	for _, write := range wb.inFlight {
+		if strings.HasPrefix(write.key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush waits for the writes queued before the call to be made and their writers notified.  The last failure
+// left unresolved by these writes is returned; those of the writes queued since are not.
+func (wb *writeBehind) flush() error {
+	wb.Lock()
+	defer wb.Unlock()
+
+	waiter := &flushWaiter{seq: wb.seq}
+	wb.flushes = append(wb.flushes, waiter)
+	wb.changed.Broadcast()
+	for wb.isWaiting(waiter.seq) {
+		wb.changed.Wait()
+	}
+	for i, flush := range wb.flushes {
+		if flush == waiter {
+			wb.flushes = append(wb.flushes[:i], wb.flushes[i+1:]...)
+			break
+		}
+	}
+	return waiter.err
+}
+
+// failed records the failure left unresolved by a write for the flushes waiting for it.  The lock must be held.
+func (wb *writeBehind) failed(write *pendingWrite, err error) {
+	for _, flush := range wb.flushes {
+		if write.seq <= flush.seq {
+			flush.err = err
+		}
+	}
+}
+
+// isWaiting returns whether a write queued up to a seq has yet to be made.  The lock must be held.
+func (wb *writeBehind) isWaiting(seq uint64) bool {
+	for _, write := range wb.inFlight {
+		if write.seq <= seq {
+			return true
+		}
+	}
+	for _, write := range wb.queue {
+		if write.seq <= seq {
+			return true
+		}
+	}
+	for _, write := range wb.completing {
+		if write.seq <= seq {
+			return true
+		}
+	}
+	return false
+}
+
+// stop makes the pending writes and stops the pipeline
+func (wb *writeBehind) stop() error {
+	wb.Lock()
+	wb.stopped = true
+	wb.changed.Broadcast()
+	wb.Unlock()
+
+	<-wb.done
+	return wb.flush()
+}
+
+// run makes the queued writes in batches until the pipeline is stopped and no write is left
+func (wb *writeBehind) run() {
+	defer close(wb.done)
+
+	for {
+		wb.Lock()
+		for len(wb.queue) == 0 && !wb.stopped {
+			wb.changed.Wait()
+		}
+		if len(wb.queue) == 0 {
+			wb.Unlock()
+			return
+		}
+		if !wb.stopped && len(wb.queue) < wb.policy.MaxBatch {
+			// Let other writes join the batch
+			wb.Unlock()
+			time.Sleep(wb.policy.Delay)
+			wb.Lock()
+			if len(wb.queue) == 0 {
+				// The writes were discarded meanwhile
+				wb.Unlock()
+				continue
+			}
+		}
+
+		size := len(wb.queue)
+		if size > wb.policy.MaxBatch {
+			size = wb.policy.MaxBatch
+		}
+		batch := make([]*pendingWrite, size)
+		copy(batch, wb.queue)
+		wb.queue = wb.queue[size:]
+		for _, write := range batch {
+			delete(wb.pending, write.key)
+		}
+		wb.inFlight = batch
+		wb.Unlock()
+
+		results := wb.write(batch)
+
+		wb.Lock()
+		for i, write := range batch {
+			if results[i].err != nil {
+				continue
+			}
+			if write.version == kvstore.AnyVersion {
+				continue
+			}
+			wb.versions[write.key] = versionChange{from: write.version, to: results[i].version}
+			// A write queued since expects the version this one replaced
+			if next, exists := wb.pending[write.key]; exists && next.version == write.version {
+				next.version = results[i].version
+			}
+		}
+		// The batch is made, but flushes wait for its writers to be notified
+		wb.inFlight = nil
+		wb.completing = batch
+		wb.changed.Broadcast()
+		wb.Unlock()
+
+		unresolved := make([]error, len(batch))
+		for i, write := range batch {
+			unresolved[i] = write.complete(results[i].version, results[i].err)
+		}
+
+		wb.Lock()
+		for i, write := range batch {
+			if unresolved[i] != nil {
+				wb.failed(write, unresolved[i])
+			}
+			// The writers now know the version of the key, which only a write queued meanwhile may still expect
+			if _, pending := wb.pending[write.key]; !pending {
+				delete(wb.versions, write.key)
+			}
+		}
+		wb.completing = nil
+		wb.changed.Broadcast()
+		wb.Unlock()
+	}
+}
+
+type writeResult struct {
+	version int64
+	err     error
+}
+
+// write makes a batch of writes as a single KV transaction.  When some key is not at its expected version,
+// the writes are made one by one so that only those of the conflicting keys fail.
+func (wb *writeBehind) write(batch []*pendingWrite) []writeResult {
+	results := make([]writeResult, len(batch))
+
+	ops := make([]*kvstore.TxnOp, len(batch))
+	for i, write := range batch {
+		ops[i] = kvstore.NewTxnOp(kvstore.TXN_PUT, write.key, write.value, write.version)
+	}
+	version, err := wb.backend.Txn(ops)
+	if err == nil {
+		for i := range batch {
+			results[i].version = version
+		}
+		log.Debugw("write-behind-batch-written", log.Fields{"count": len(batch), "version": version})
+		return results
+	}
+	if err != kvstore.ErrVersionMismatch {
+		log.Warnw("write-behind-batch-failed", log.Fields{"count": len(batch), "error": err})
+		for i := range batch {
+			results[i].err = err
+		}
+		return results
+	}
+
+	for i, write := range batch {
+		if write.version == kvstore.AnyVersion {
+			results[i].err = wb.backend.Put(write.key, write.value)
+		} else {
+			results[i].version, results[i].err = wb.backend.PutIfVersion(write.key, write.value, write.version)
+		}
+	}
+	return results
+}
+
+// complete notifies the writers of the outcome of a write and returns the failure they left unresolved.  A
+// failed write without writer to handle it is unresolved.
+func (write *pendingWrite) complete(version int64, err error) error {
+	if len(write.done) == 0 {
+		return err
+	}
+	var unresolved error
+	for _, done := range write.done {
+		if doneErr := done(version, err); doneErr != nil {
+			unresolved = doneErr
+		}
+	}
+	return unresolved
+}
+
+// EnableWriteBehind defers the writes made with PutBehind, which are then made in batches by a background
+// routine according to the policy.  Reads of a key with a deferred write return the value to be written; List
+// and Iterate first wait for the deferred writes to be made.
+func (b *Backend) EnableWriteBehind(policy *WriteBehindPolicy) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.writeBehind != nil {
+		return
+	}
+	if policy == nil {
+		policy = NewWriteBehindPolicy()
+	}
+	b.writeBehind = newWriteBehind(b, *policy)
+
+	log.Debugw("write-behind-enabled", log.Fields{"max-batch": policy.MaxBatch, "delay": policy.Delay})
+}
+
+// DisableWriteBehind makes the deferred writes and stops deferring the following ones
+func (b *Backend) DisableWriteBehind() error {
+	b.Lock()
+	wb := b.writeBehind
+	b.writeBehind = nil
+	b.Unlock()
+
+	if wb == nil {
+		return nil
+	}
+	log.Debugw("write-behind-disabled", log.Fields{})
+	return wb.stop()
+}
+
+// IsWriteBehind reports whether the writes made with PutBehind are deferred
+func (b *Backend) IsWriteBehind() bool {
+	return b.getWriteBehind() != nil
+}
+
+func (b *Backend) getWriteBehind() *writeBehind {
+	b.RLock()
+	defer b.RUnlock()
+	return b.writeBehind
+}
+
+// PutBehind defers the storage of an item value under the specified key if the key is still at the given
+// version, as PutIfVersion does, or whatever its version with kvstore.AnyVersion.  Done is called from a
+// background routine once the write was made.  PutBehind returns false, without making the write nor calling
+// done, when write-behind is disabled; the caller is then left to make the write itself.
+func (b *Backend) PutBehind(key string, value []byte, version int64, done WriteCompletion) bool {
+	if wb := b.getWriteBehind(); wb != nil {
+		return wb.put(key, value, version, done)
+	}
+	return false
+}
+
+// IsWritePending reports whether a deferred write to the key has yet to be made
+func (b *Backend) IsWritePending(key string) bool {
+	if wb := b.getWriteBehind(); wb != nil {
+		return wb.isPending(key)
+	}
+	return false
+}
+
+// Flush waits for the writes deferred before the call to be made, and returns the last failure they left
+// unresolved.
+// It returns at once when write-behind is disabled.
+func (b *Backend) Flush() error {
+	if wb := b.getWriteBehind(); wb != nil {
+		return wb.flush()
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"github.com/opencord/voltha-go/db/model"
+	"os"
+)
+
+// kv_backup exports the content of a KV store path prefix to an archive, or restores such an archive into an
+// empty KV store.  Restoring into another type of KV store (e.g. etcd to consul) translates the keys to the
+// conventions of the target store.
+//
+//   kv_backup -mode backup -kv_store_type etcd -kv_store_port 2379 -file voltha.bak
+//   kv_backup -mode restore -kv_store_type consul -kv_store_port 8500 -file voltha.bak
+//
+// A bolt database file can only be opened by one process: stop the core using it before running kv_backup.
+
+const (
+	default_Mode           = "backup"
+	default_KVStoreType    = "etcd"
+	default_KVStoreHost    = "127.0.0.1"
+	default_KVStorePort    = 2379
+	default_KVStorePath    = "voltha.db"
+	default_KVStoreTimeout = 5 //in seconds
+	default_KVStorePrefix  = "service/voltha"
+	default_File           = "voltha-kv.bak"
+	default_Force          = false
+	default_LogLevel       = 2
+)
+
+type backupFlags struct {
+	Mode           string
+	KVStoreType    string
+	KVStoreHost    string
+	KVStorePort    int
+	KVStorePath    string
+	KVStoreTimeout int
+	KVStorePrefix  string
+	Security       kvstore.SecurityConfig
+	File           string
+	Force          bool
+	LogLevel       int
+}
+
+func init() {
+	log.AddPackage(log.JSON, log.InfoLevel, nil)
+}
+
+func parseCommandArguments() *backupFlags {
+	bf := &backupFlags{}
+
+	help := fmt.Sprintf("Operation to perform (backup or restore)")
+	flag.StringVar(&(bf.Mode), "mode", default_Mode, help)
+
+	help = fmt.Sprintf("KV store type (etcd, consul or bolt)")
+	flag.StringVar(&(bf.KVStoreType), "kv_store_type", default_KVStoreType, help)
+
+	help = fmt.Sprintf("KV store host")
+	flag.StringVar(&(bf.KVStoreHost), "kv_store_host", default_KVStoreHost, help)
+
+	help = fmt.Sprintf("KV store port")
+	flag.IntVar(&(bf.KVStorePort), "kv_store_port", default_KVStorePort, help)
+
+	help = fmt.Sprintf("KV store database file (bolt)")
+	flag.StringVar(&(bf.KVStorePath), "kv_store_path", default_KVStorePath, help)
+
+	help = fmt.Sprintf("The default timeout when making a kv store request")
+	flag.IntVar(&(bf.KVStoreTimeout), "kv_store_request_timeout", default_KVStoreTimeout, help)
+
+	help = fmt.Sprintf("Path prefix of the keys to backup or restore")
+	flag.StringVar(&(bf.KVStorePrefix), "kv_store_prefix", default_KVStorePrefix, help)
+
+	help = fmt.Sprintf("KV store client certificate file (enables TLS)")
+	flag.StringVar(&(bf.Security.CertFile), "kv_store_cert", "", help)
+
+	help = fmt.Sprintf("KV store client key file")
+	flag.StringVar(&(bf.Security.KeyFile), "kv_store_key", "", help)
+
+	help = fmt.Sprintf("KV store certificate authority file used to verify the server")
+	flag.StringVar(&(bf.Security.CAFile), "kv_store_ca", "", help)
+
+	help = fmt.Sprintf("KV store username (etcd)")
+	flag.StringVar(&(bf.Security.Username), "kv_store_username", "", help)
+
+	help = fmt.Sprintf("KV store password (etcd); defaults to $KV_STORE_PASSWORD")
+	flag.StringVar(&(bf.Security.Password), "kv_store_password", os.Getenv("KV_STORE_PASSWORD"), help)
+
+	help = fmt.Sprintf("KV store ACL token (consul); defaults to $KV_STORE_TOKEN")
+	flag.StringVar(&(bf.Security.Token), "kv_store_token", os.Getenv("KV_STORE_TOKEN"), help)
+
+	help = fmt.Sprintf("Archive file")
+	flag.StringVar(&(bf.File), "file", default_File, help)
+
+	help = fmt.Sprintf("Restore even if the KV store already holds keys under the prefix")
+	flag.BoolVar(&(bf.Force), "force", default_Force, help)
+
+	help = fmt.Sprintf("Log level")
+	flag.IntVar(&(bf.LogLevel), "log_level", default_LogLevel, help)
+
+	flag.Parse()
+	return bf
+}
+
+func backup(backend *model.Backend, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := backend.Backup(f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("exported %d keys from %s to %s\n", count, backend.PathPrefix, file)
+	return nil
+}
+
+func restore(backend *model.Backend, file string, force bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := backend.Restore(f, force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %d keys from %s to %s\n", count, file, backend.PathPrefix)
+	return nil
+}
+
+func main() {
+	bf := parseCommandArguments()
+
+	if _, err := log.SetDefaultLogger(log.JSON, bf.LogLevel, nil); err != nil {
+		log.With(log.Fields{"error": err}).Fatal("Cannot setup logging")
+	}
+	defer log.CleanUp()
+
+	prefix := model.NormalizePathPrefix(bf.KVStorePrefix, bf.KVStoreType)
+	host := bf.KVStoreHost
+	if bf.KVStoreType == "bolt" {
+		// The backend of a bolt store takes the path of its database file as host
+		host = bf.KVStorePath
+	}
+	backend := model.NewSecureBackend(bf.KVStoreType, host, bf.KVStorePort, bf.KVStoreTimeout, prefix,
+		&bf.Security)
+	if backend.Client == nil {
+		fmt.Fprintf(os.Stderr, "cannot connect to the %s kv store\n", bf.KVStoreType)
+		os.Exit(1)
+	}
+	defer backend.Client.Close()
+
+	var err error
+	switch bf.Mode {
+	case "backup":
+		err = backup(backend, bf.File)
+	case "restore":
+		err = restore(backend, bf.File, bf.Force)
+	default:
+		err = fmt.Errorf("unsupported-mode-%s", bf.Mode)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %s\n", bf.Mode, err.Error())
+		os.Exit(1)
+	}
+}
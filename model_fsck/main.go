@@ -0,0 +1,204 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
+	"github.com/opencord/voltha-go/db/model"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"os"
+)
+
+// model_fsck checks the consistency of the voltha data model with the KV store it is persisted to, reporting
+// the entries which are missing, orphaned or whose content does not match the model.  The model is read from
+// a snapshot of a running core when one is given; otherwise it is loaded from the KV store itself, which then
+// only finds the entries that cannot be decoded or are stored under the wrong key.  Repairing then makes the
+// KV store agree with itself rather than with an independent model, so -repair requires a snapshot.
+//
+//   model_fsck -kv_store_type etcd -kv_store_port 2379 -snapshot voltha-model.json
+//   model_fsck -kv_store_type etcd -kv_store_port 2379 -snapshot voltha-model.json -repair
+//
+// The command exits with a non-zero status when issues remain unrepaired.
+
+const (
+	default_KVStoreType    = "etcd"
+	default_KVStoreHost    = "127.0.0.1"
+	default_KVStorePort    = 2379
+	default_KVStorePath    = "voltha.db"
+	default_KVStoreTimeout = 5 //in seconds
+	default_KVStorePrefix  = "service/voltha"
+	default_Snapshot       = ""
+	default_Repair         = false
+	default_LogLevel       = 2
+)
+
+type fsckFlags struct {
+	KVStoreType    string
+	KVStoreHost    string
+	KVStorePort    int
+	KVStorePath    string
+	KVStoreTimeout int
+	KVStorePrefix  string
+	Security       kvstore.SecurityConfig
+	Snapshot       string
+	Repair         bool
+	LogLevel       int
+}
+
+func init() {
+	log.AddPackage(log.JSON, log.InfoLevel, nil)
+}
+
+func parseCommandArguments() *fsckFlags {
+	ff := &fsckFlags{}
+
+	help := fmt.Sprintf("KV store type (etcd, consul or bolt)")
+	flag.StringVar(&(ff.KVStoreType), "kv_store_type", default_KVStoreType, help)
+
+	help = fmt.Sprintf("KV store host")
+	flag.StringVar(&(ff.KVStoreHost), "kv_store_host", default_KVStoreHost, help)
+
+	help = fmt.Sprintf("KV store port")
+	flag.IntVar(&(ff.KVStorePort), "kv_store_port", default_KVStorePort, help)
+
+	help = fmt.Sprintf("KV store database file (bolt)")
+	flag.StringVar(&(ff.KVStorePath), "kv_store_path", default_KVStorePath, help)
+
+	help = fmt.Sprintf("The default timeout when making a kv store request")
+	flag.IntVar(&(ff.KVStoreTimeout), "kv_store_request_timeout", default_KVStoreTimeout, help)
+
+	help = fmt.Sprintf("Path prefix of the keys of the data model")
+	flag.StringVar(&(ff.KVStorePrefix), "kv_store_prefix", default_KVStorePrefix, help)
+
+	help = fmt.Sprintf("KV store client certificate file (enables TLS)")
+	flag.StringVar(&(ff.Security.CertFile), "kv_store_cert", "", help)
+
+	help = fmt.Sprintf("KV store client key file")
+	flag.StringVar(&(ff.Security.KeyFile), "kv_store_key", "", help)
+
+	help = fmt.Sprintf("KV store certificate authority file used to verify the server")
+	flag.StringVar(&(ff.Security.CAFile), "kv_store_ca", "", help)
+
+	help = fmt.Sprintf("KV store username (etcd)")
+	flag.StringVar(&(ff.Security.Username), "kv_store_username", "", help)
+
+	help = fmt.Sprintf("KV store password (etcd); defaults to $KV_STORE_PASSWORD")
+	flag.StringVar(&(ff.Security.Password), "kv_store_password", os.Getenv("KV_STORE_PASSWORD"), help)
+
+	help = fmt.Sprintf("KV store ACL token (consul); defaults to $KV_STORE_TOKEN")
+	flag.StringVar(&(ff.Security.Token), "kv_store_token", os.Getenv("KV_STORE_TOKEN"), help)
+
+	help = fmt.Sprintf("Snapshot file of the data model to check; the model is loaded from the KV store if none")
+	flag.StringVar(&(ff.Snapshot), "snapshot", default_Snapshot, help)
+
+	help = fmt.Sprintf("Bring the KV store in line with the data model")
+	flag.BoolVar(&(ff.Repair), "repair", default_Repair, help)
+
+	help = fmt.Sprintf("Log level")
+	flag.IntVar(&(ff.LogLevel), "log_level", default_LogLevel, help)
+
+	flag.Parse()
+	return ff
+}
+
+// checkArguments reports the invalid combinations of command arguments
+func checkArguments(ff *fsckFlags) error {
+	if ff.Repair && ff.Snapshot == "" {
+		return fmt.Errorf("-repair requires a -snapshot of the data model, not loaded from the KV store it repairs")
+	}
+	return nil
+}
+
+// loadModel fills the data model from a snapshot file, or from the KV store when no file is given
+func loadModel(root model.Root, snapshot string) error {
+	if snapshot == "" {
+		proxy := root.CreateProxy("/", false)
+		for name, field := range model.ChildrenFields(&voltha.Voltha{}) {
+			if field.IsContainer && field.Key != "" {
+				proxy.Get("/"+name, 0, false, "")
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count, err := root.Restore(f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %d nodes from %s\n", count, snapshot)
+	return nil
+}
+
+func main() {
+	ff := parseCommandArguments()
+	if err := checkArguments(ff); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(2)
+	}
+
+	if _, err := log.SetDefaultLogger(log.JSON, ff.LogLevel, nil); err != nil {
+		log.With(log.Fields{"error": err}).Fatal("Cannot setup logging")
+	}
+	defer log.CleanUp()
+
+	prefix := model.NormalizePathPrefix(ff.KVStorePrefix, ff.KVStoreType)
+	host := ff.KVStoreHost
+	if ff.KVStoreType == "bolt" {
+		// The backend of a bolt store takes the path of its database file as host
+		host = ff.KVStorePath
+	}
+	backend := model.NewSecureBackend(ff.KVStoreType, host, ff.KVStorePort, ff.KVStoreTimeout, prefix,
+		&ff.Security)
+	if backend.Client == nil {
+		fmt.Fprintf(os.Stderr, "cannot connect to the %s kv store\n", ff.KVStoreType)
+		os.Exit(1)
+	}
+	defer backend.Client.Close()
+
+	root := model.NewRoot(&voltha.Voltha{}, backend)
+	if err := loadModel(root, ff.Snapshot); err != nil {
+		fmt.Fprintf(os.Stderr, "loading the data model failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	report, err := root.Fsck(ff.Repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck failed: %s\n", err.Error())
+		os.Exit(1)
+	}
+	for _, issue := range report.Issues {
+		status := ""
+		if issue.Repaired {
+			status = " (repaired)"
+		}
+		fmt.Printf("%-10s %s %s%s\n", issue.Type.String(), issue.Key, issue.Detail, status)
+	}
+	fmt.Printf("checked %d revisions and %d entries under %s: %d issues, %d repaired\n", report.Checked,
+		report.Stored, backend.PathPrefix, len(report.Issues), report.Repaired())
+
+	if report.Repaired() < len(report.Issues) {
+		os.Exit(1)
+	}
+}
@@ -26,6 +26,8 @@ import (
 const (
 	ConsulStoreName               = "consul"
 	EtcdStoreName                 = "etcd"
+	MemoryStoreName               = "memory"
+	BoltStoreName                 = "bolt"
 	default_InstanceID            = "rwcore001"
 	default_GrpcPort              = 50057
 	default_GrpcHost              = ""
@@ -37,7 +39,26 @@ const (
 	default_KVStoreTimeout        = 5 //in seconds
 	default_KVStoreHost           = "127.0.0.1"
 	default_KVStorePort           = 2379 // Consul = 8500; Etcd = 2379
+	default_KVStorePath           = "voltha.db"
+	default_KVStorePrefix         = "service/voltha"
+	default_KVStoreCert           = ""
+	default_KVStoreKey            = ""
+	default_KVStoreCA             = ""
+	default_KVStoreUsername       = ""
 	default_KVTxnKeyDelTime       = 60
+	default_KVStoreCache          = false
+	default_ModelPersist          = false
+	default_ModelWriteBehind      = false
+	default_ModelWriteBatch       = 100
+	default_ModelWriteDelay       = 20 // in milliseconds
+	default_ModelMaxRevisions     = 25
+	default_ModelMaxRevisionAge   = 0  // in seconds
+	default_ModelMemoryBudget     = 0  // in MB
+	default_ModelPruneInterval    = 60 // in seconds
+	default_DeviceIdleTimeout     = 0  // in seconds
+	default_ModelEventsTopic      = ""
+	default_ModelCallbackWorkers  = 8
+	default_ModelCallbackTimeout  = 10 // in seconds
 	default_LogLevel              = 0
 	default_Banner                = false
 	default_CoreTopic             = "rwcore"
@@ -48,29 +69,56 @@ const (
 	default_Affinity_Router_Topic = "affinityRouter"
 )
 
+// Environment variables used to supply KV store secrets without exposing them on the command line
+const (
+	KVStorePasswordEnv = "KV_STORE_PASSWORD"
+	KVStoreTokenEnv    = "KV_STORE_TOKEN"
+)
+
 // RWCoreFlags represents the set of configurations used by the read-write core service
 type RWCoreFlags struct {
 	// Command line parameters
-	InstanceID          string
-	RWCoreEndpoint      string
-	GrpcHost            string
-	GrpcPort            int
-	KafkaAdapterHost    string
-	KafkaAdapterPort    int
-	KafkaClusterHost    string
-	KafkaClusterPort    int
-	KVStoreType         string
-	KVStoreTimeout      int // in seconds
-	KVStoreHost         string
-	KVStorePort         int
-	KVTxnKeyDelTime     int
-	CoreTopic           string
-	LogLevel            int
-	Banner              bool
-	RWCoreKey           string
-	RWCoreCert          string
-	RWCoreCA            string
-	AffinityRouterTopic string
+	InstanceID           string
+	RWCoreEndpoint       string
+	GrpcHost             string
+	GrpcPort             int
+	KafkaAdapterHost     string
+	KafkaAdapterPort     int
+	KafkaClusterHost     string
+	KafkaClusterPort     int
+	KVStoreType          string
+	KVStoreTimeout       int // in seconds
+	KVStoreHost          string
+	KVStorePort          int
+	KVStorePath          string
+	KVStorePrefix        string
+	KVStoreCert          string
+	KVStoreKey           string
+	KVStoreCA            string
+	KVStoreUsername      string
+	KVStorePassword      string
+	KVStoreToken         string
+	KVTxnKeyDelTime      int
+	KVStoreCache         bool
+	ModelPersist         bool
+	ModelWriteBehind     bool
+	ModelWriteBatch      int
+	ModelWriteDelay      int // in milliseconds
+	ModelMaxRevisions    int
+	ModelMaxRevisionAge  int // in seconds
+	ModelMemoryBudget    int // in MB
+	ModelPruneInterval   int // in seconds
+	DeviceIdleTimeout    int // in seconds
+	ModelEventsTopic     string
+	ModelCallbackWorkers int
+	ModelCallbackTimeout int // in seconds
+	CoreTopic            string
+	LogLevel             int
+	Banner               bool
+	RWCoreKey            string
+	RWCoreCert           string
+	RWCoreCA             string
+	AffinityRouterTopic  string
 }
 
 func init() {
@@ -80,26 +128,47 @@ func init() {
 // NewRWCoreFlags returns a new RWCore config
 func NewRWCoreFlags() *RWCoreFlags {
 	var rwCoreFlag = RWCoreFlags{ // Default values
-		InstanceID:          default_InstanceID,
-		RWCoreEndpoint:      default_RWCoreEndpoint,
-		GrpcHost:            default_GrpcHost,
-		GrpcPort:            default_GrpcPort,
-		KafkaAdapterHost:    default_KafkaAdapterHost,
-		KafkaAdapterPort:    default_KafkaAdapterPort,
-		KafkaClusterHost:    default_KafkaClusterHost,
-		KafkaClusterPort:    default_KafkaClusterPort,
-		KVStoreType:         default_KVStoreType,
-		KVStoreTimeout:      default_KVStoreTimeout,
-		KVStoreHost:         default_KVStoreHost,
-		KVStorePort:         default_KVStorePort,
-		KVTxnKeyDelTime:     default_KVTxnKeyDelTime,
-		CoreTopic:           default_CoreTopic,
-		LogLevel:            default_LogLevel,
-		Banner:              default_Banner,
-		RWCoreKey:           default_RWCoreKey,
-		RWCoreCert:          default_RWCoreCert,
-		RWCoreCA:            default_RWCoreCA,
-		AffinityRouterTopic: default_Affinity_Router_Topic,
+		InstanceID:           default_InstanceID,
+		RWCoreEndpoint:       default_RWCoreEndpoint,
+		GrpcHost:             default_GrpcHost,
+		GrpcPort:             default_GrpcPort,
+		KafkaAdapterHost:     default_KafkaAdapterHost,
+		KafkaAdapterPort:     default_KafkaAdapterPort,
+		KafkaClusterHost:     default_KafkaClusterHost,
+		KafkaClusterPort:     default_KafkaClusterPort,
+		KVStoreType:          default_KVStoreType,
+		KVStoreTimeout:       default_KVStoreTimeout,
+		KVStoreHost:          default_KVStoreHost,
+		KVStorePort:          default_KVStorePort,
+		KVStorePath:          default_KVStorePath,
+		KVStorePrefix:        default_KVStorePrefix,
+		KVStoreCert:          default_KVStoreCert,
+		KVStoreKey:           default_KVStoreKey,
+		KVStoreCA:            default_KVStoreCA,
+		KVStoreUsername:      default_KVStoreUsername,
+		KVStorePassword:      os.Getenv(KVStorePasswordEnv),
+		KVStoreToken:         os.Getenv(KVStoreTokenEnv),
+		KVTxnKeyDelTime:      default_KVTxnKeyDelTime,
+		KVStoreCache:         default_KVStoreCache,
+		ModelPersist:         default_ModelPersist,
+		ModelWriteBehind:     default_ModelWriteBehind,
+		ModelWriteBatch:      default_ModelWriteBatch,
+		ModelWriteDelay:      default_ModelWriteDelay,
+		ModelMaxRevisions:    default_ModelMaxRevisions,
+		ModelMaxRevisionAge:  default_ModelMaxRevisionAge,
+		ModelMemoryBudget:    default_ModelMemoryBudget,
+		ModelPruneInterval:   default_ModelPruneInterval,
+		DeviceIdleTimeout:    default_DeviceIdleTimeout,
+		ModelEventsTopic:     default_ModelEventsTopic,
+		ModelCallbackWorkers: default_ModelCallbackWorkers,
+		ModelCallbackTimeout: default_ModelCallbackTimeout,
+		CoreTopic:            default_CoreTopic,
+		LogLevel:             default_LogLevel,
+		Banner:               default_Banner,
+		RWCoreKey:            default_RWCoreKey,
+		RWCoreCert:           default_RWCoreCert,
+		RWCoreCA:             default_RWCoreCA,
+		AffinityRouterTopic:  default_Affinity_Router_Topic,
 	}
 	return &rwCoreFlag
 }
@@ -136,7 +205,7 @@ func (cf *RWCoreFlags) ParseCommandArguments() {
 	help = fmt.Sprintf("Affinity Router topic")
 	flag.StringVar(&(cf.AffinityRouterTopic), "affinity_router_topic", default_Affinity_Router_Topic, help)
 
-	help = fmt.Sprintf("KV store type")
+	help = fmt.Sprintf("KV store type (etcd, consul, bolt or memory)")
 	flag.StringVar(&(cf.KVStoreType), "kv_store_type", default_KVStoreType, help)
 
 	help = fmt.Sprintf("The default timeout when making a kv store request")
@@ -148,9 +217,72 @@ func (cf *RWCoreFlags) ParseCommandArguments() {
 	help = fmt.Sprintf("KV store port")
 	flag.IntVar(&(cf.KVStorePort), "kv_store_port", default_KVStorePort, help)
 
+	help = fmt.Sprintf("KV store database file (bolt)")
+	flag.StringVar(&(cf.KVStorePath), "kv_store_path", default_KVStorePath, help)
+
+	help = fmt.Sprintf("Path prefix of the keys the data model is persisted to")
+	flag.StringVar(&(cf.KVStorePrefix), "kv_store_prefix", default_KVStorePrefix, help)
+
+	help = fmt.Sprintf("KV store client certificate file (enables TLS)")
+	flag.StringVar(&(cf.KVStoreCert), "kv_store_cert", default_KVStoreCert, help)
+
+	help = fmt.Sprintf("KV store client key file")
+	flag.StringVar(&(cf.KVStoreKey), "kv_store_key", default_KVStoreKey, help)
+
+	help = fmt.Sprintf("KV store certificate authority file used to verify the server")
+	flag.StringVar(&(cf.KVStoreCA), "kv_store_ca", default_KVStoreCA, help)
+
+	help = fmt.Sprintf("KV store username (etcd)")
+	flag.StringVar(&(cf.KVStoreUsername), "kv_store_username", default_KVStoreUsername, help)
+
+	help = fmt.Sprintf("KV store password (etcd); defaults to $%s", KVStorePasswordEnv)
+	flag.StringVar(&(cf.KVStorePassword), "kv_store_password", os.Getenv(KVStorePasswordEnv), help)
+
+	help = fmt.Sprintf("KV store ACL token (consul); defaults to $%s", KVStoreTokenEnv)
+	flag.StringVar(&(cf.KVStoreToken), "kv_store_token", os.Getenv(KVStoreTokenEnv), help)
+
 	help = fmt.Sprintf("The time to wait before deleting a completed transaction key")
 	flag.IntVar(&(cf.KVTxnKeyDelTime), "kv_txn_delete_time", default_KVTxnKeyDelTime, help)
 
+	help = fmt.Sprintf("Cache the data model items read from the KV store, kept coherent by watching the store")
+	flag.BoolVar(&(cf.KVStoreCache), "kv_store_cache", default_KVStoreCache, help)
+
+	help = fmt.Sprintf("Persist the cluster data model to the KV store, sharing the devices across the cores")
+	flag.BoolVar(&(cf.ModelPersist), "model_persist", default_ModelPersist, help)
+
+	help = fmt.Sprintf("Defer the writes of the data model to the KV store and make them in batches")
+	flag.BoolVar(&(cf.ModelWriteBehind), "model_write_behind", default_ModelWriteBehind, help)
+
+	help = fmt.Sprintf("Maximum number of deferred model writes made by a single KV transaction")
+	flag.IntVar(&(cf.ModelWriteBatch), "model_write_batch", default_ModelWriteBatch, help)
+
+	help = fmt.Sprintf("Milliseconds a deferred model write waits for others to be batched with it")
+	flag.IntVar(&(cf.ModelWriteDelay), "model_write_delay", default_ModelWriteDelay, help)
+
+	help = fmt.Sprintf("Number of revisions kept in memory per model node (0 for no limit)")
+	flag.IntVar(&(cf.ModelMaxRevisions), "model_max_revisions", default_ModelMaxRevisions, help)
+
+	help = fmt.Sprintf("Seconds an outdated model revision is kept in memory (0 for no limit)")
+	flag.IntVar(&(cf.ModelMaxRevisionAge), "model_max_revision_age", default_ModelMaxRevisionAge, help)
+
+	help = fmt.Sprintf("Memory budget in MB of the revisions of each model (0 for no limit)")
+	flag.IntVar(&(cf.ModelMemoryBudget), "model_memory_budget", default_ModelMemoryBudget, help)
+
+	help = fmt.Sprintf("Seconds between the pruning of the model revisions")
+	flag.IntVar(&(cf.ModelPruneInterval), "model_prune_interval", default_ModelPruneInterval, help)
+
+	help = fmt.Sprintf("Seconds after which an unused device is evicted from memory, 0 to never evict")
+	flag.IntVar(&(cf.DeviceIdleTimeout), "device_idle_timeout", default_DeviceIdleTimeout, help)
+
+	help = fmt.Sprintf("Kafka topic the model configuration changes are published on, empty to not publish them")
+	flag.StringVar(&(cf.ModelEventsTopic), "model_events_topic", default_ModelEventsTopic, help)
+
+	help = fmt.Sprintf("Number of workers running the asynchronous model callbacks")
+	flag.IntVar(&(cf.ModelCallbackWorkers), "model_callback_workers", default_ModelCallbackWorkers, help)
+
+	help = fmt.Sprintf("Seconds after which an asynchronous model callback is reported as failed")
+	flag.IntVar(&(cf.ModelCallbackTimeout), "model_callback_timeout", default_ModelCallbackTimeout, help)
+
 	help = fmt.Sprintf("Log level")
 	flag.IntVar(&(cf.LogLevel), "log_level", default_LogLevel, help)
 
@@ -25,6 +25,7 @@ import (
 	"github.com/opencord/voltha-go/protos/voltha"
 	"github.com/opencord/voltha-go/rw_core/config"
 	"google.golang.org/grpc"
+	"time"
 )
 
 type Core struct {
@@ -42,12 +43,20 @@ type Core struct {
 	exitChannel       chan int
 	kvClient          kvstore.Client
 	kafkaClient       kafka.Client
+	backend           *model.Backend
 }
 
 func init() {
 	log.AddPackage(log.JSON, log.WarnLevel, nil)
 }
 
+func init() {
+	// A deleted device can only be removed from the model
+	model.RegisterValidator(&voltha.Device{}, model.EnumTransitions("admin_state", map[int32][]int32{
+		int32(voltha.AdminState_DELETED): {},
+	}))
+}
+
 func NewCore(id string, cf *config.RWCoreFlags, kvClient kvstore.Client, kafkaClient kafka.Client) *Core {
 	var core Core
 	core.instanceId = id
@@ -56,18 +65,29 @@ func NewCore(id string, cf *config.RWCoreFlags, kvClient kvstore.Client, kafkaCl
 	core.kvClient = kvClient
 	core.kafkaClient = kafkaClient
 
-	// Setup the KV store
-	// Do not call NewBackend constructor; it creates its own KV client
-	// Commented the backend for now until the issue between the model and the KV store
-	// is resolved.
-	//backend := model.Backend{
-	//	MsgClient:     kvClient,
-	//	StoreType:  cf.KVStoreType,
-	//	Host:       cf.KVStoreHost,
-	//	Port:       cf.KVStorePort,
-	//	Timeout:    cf.KVStoreTimeout,
-	//	PathPrefix: "service/voltha"}
-	core.clusterDataRoot = model.NewRoot(&voltha.Voltha{}, nil)
+	// Setup the KV store the cluster data is persisted to, when enabled.  The backend shares the KV client of the
+	// core rather than creating its own, which a bolt store would not allow.
+	if kvClient != nil && cf.ModelPersist {
+		core.backend = model.NewBackendFromClient(kvClient, cf.KVStoreType, cf.KVStoreTimeout,
+			model.NormalizePathPrefix(cf.KVStorePrefix, cf.KVStoreType))
+		if cf.KVStoreCache {
+			core.backend.EnableCache()
+		}
+		if cf.ModelWriteBehind {
+			core.backend.EnableWriteBehind(&model.WriteBehindPolicy{
+				MaxBatch: cf.ModelWriteBatch,
+				Delay:    time.Duration(cf.ModelWriteDelay) * time.Millisecond,
+			})
+		}
+	}
+	model.SetRetentionPolicy(model.RetentionPolicy{
+		MaxRevisions: cf.ModelMaxRevisions,
+		MaxAge:       time.Duration(cf.ModelMaxRevisionAge) * time.Second,
+		MaxBytes:     int64(cf.ModelMemoryBudget) * 1024 * 1024,
+	})
+	model.SetCallbackDispatcher(model.NewCallbackDispatcher(cf.ModelCallbackWorkers,
+		time.Duration(cf.ModelCallbackTimeout)*time.Second))
+	core.clusterDataRoot = model.NewRoot(&voltha.Voltha{}, core.backend)
 	core.localDataRoot = model.NewRoot(&voltha.CoreInstance{}, nil)
 	core.clusterDataProxy = core.clusterDataRoot.CreateProxy("/", false)
 	core.localDataProxy = core.localDataRoot.CreateProxy("/", false)
@@ -78,12 +98,17 @@ func (core *Core) Start(ctx context.Context) {
 	log.Info("starting-adaptercore", log.Fields{"coreId": core.instanceId})
 	core.startKafkaMessagingProxy(ctx)
 	log.Info("values", log.Fields{"kmp": core.kmp})
-	core.deviceMgr = newDeviceManager(core.kmp, core.clusterDataProxy, core.instanceId)
+	core.startModelEventPublisher()
+	core.deviceMgr = newDeviceManager(core.kmp, core.clusterDataProxy, core.instanceId,
+		time.Duration(core.config.DeviceIdleTimeout)*time.Second, core.kvClient,
+		model.NormalizePathPrefix(core.config.KVStorePrefix, core.config.KVStoreType), core.config.KVStoreTimeout)
 	core.logicalDeviceMgr = newLogicalDeviceManager(core.deviceMgr, core.kmp, core.clusterDataProxy)
 	core.registerAdapterRequestHandler(ctx, core.instanceId, core.deviceMgr, core.logicalDeviceMgr, core.clusterDataProxy, core.localDataProxy)
 	go core.startDeviceManager(ctx)
 	go core.startLogicalDeviceManager(ctx)
 	go core.startGRPCService(ctx)
+	go core.startModelPruning(ctx)
+	core.startModelSync()
 
 	log.Info("adaptercore-started")
 }
@@ -95,10 +120,70 @@ func (core *Core) Stop(ctx context.Context) {
 	core.grpcServer.Stop()
 	core.logicalDeviceMgr.stop(ctx)
 	core.deviceMgr.stop(ctx)
+	if core.backend != nil {
+		core.clusterDataRoot.StopSync()
+		// Make the deferred writes of the model before the KV client is closed
+		if err := core.backend.DisableWriteBehind(); err != nil {
+			log.Warnw("model-flush-failed", log.Fields{"error": err})
+		}
+		core.backend.DisableCache()
+	}
+	model.GetEventBusClient().Stop()
+	model.GetCallbackDispatcher().Stop()
 	core.kmp.Stop()
 	log.Info("adaptercore-stopped")
 }
 
+// startModelEventPublisher publishes the configuration changes of the data models on the kafka bus
+func (core *Core) startModelEventPublisher() {
+	if core.config.ModelEventsTopic == "" {
+		return
+	}
+	model.SetEventBusClient(model.NewEventBusClient(
+		model.EventBusKafkaClient(core.kafkaClient),
+		model.EventBusTopic(core.config.ModelEventsTopic)))
+	log.Infow("model-event-publisher-started", log.Fields{"topic": core.config.ModelEventsTopic})
+}
+
+// startModelSync keeps the cluster data model up to date with the changes made to the KV store by the other
+// cores, such as the active core of the pair when this one is the standby
+func (core *Core) startModelSync() {
+	if core.backend == nil {
+		return
+	}
+	if err := core.clusterDataRoot.StartSync(); err != nil {
+		log.Errorw("model-sync-failed", log.Fields{"error": err})
+	}
+}
+
+// startModelPruning periodically drops the model revisions exceeding the retention policy
+func (core *Core) startModelPruning(ctx context.Context) {
+	if core.config.ModelPruneInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(core.config.ModelPruneInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cluster := core.clusterDataRoot.Prune()
+			local := core.localDataRoot.Prune()
+			log.Debugw("model-revision-stats", log.Fields{
+				"cluster-revisions": cluster.Revisions,
+				"cluster-bytes":     cluster.Bytes,
+				"cluster-pruned":    cluster.Pruned,
+				"local-revisions":   local.Revisions,
+				"local-bytes":       local.Bytes,
+				"local-pruned":      local.Pruned,
+			})
+		case <-core.exitChannel:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 //startGRPCService creates the grpc service handlers, registers it to the grpc server
 // and starts the server
 func (core *Core) startGRPCService(ctx context.Context) {
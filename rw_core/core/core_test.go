@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package core
+
+import (
+	"github.com/opencord/voltha-go/db/kvstore"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"github.com/opencord/voltha-go/rw_core/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// newModelSyncTestCore creates a core whose cluster data model is persisted to a memory KV store shared by name
+func newModelSyncTestCore(t *testing.T, id string) *Core {
+	cf := config.NewRWCoreFlags()
+	cf.KVStoreType = "memory"
+	cf.ModelPersist = true
+	kvClient, err := kvstore.NewMemoryClient(t.Name(), cf.KVStoreTimeout)
+	if err != nil {
+		t.Fatalf("failed to create kv client - %s", err.Error())
+	}
+	return NewCore(id, cf, kvClient, nil)
+}
+
+func TestModelSyncFromActiveCore(t *testing.T) {
+	active := newModelSyncTestCore(t, "active")
+	standby := newModelSyncTestCore(t, "standby")
+	standby.startModelSync()
+	defer standby.clusterDataRoot.StopSync()
+
+	device := &voltha.Device{Id: "sync-device", FirmwareVersion: "1"}
+	assert.NotNil(t, active.clusterDataProxy.Add("/devices", device, ""))
+	assert.Nil(t, active.clusterDataProxy.Flush())
+
+	// The standby keeps the device it knows of up to date with the changes of the active core
+	firmwareVersion := func() string {
+		switch data := standby.clusterDataProxy.Get("/devices/sync-device", 0, false, "").(type) {
+		case *voltha.Device:
+			return data.FirmwareVersion
+		case []interface{}:
+			// The device is first loaded from the KV store
+			if len(data) == 1 {
+				return data[0].(*voltha.Device).FirmwareVersion
+			}
+		}
+		return ""
+	}
+	assert.Equal(t, "1", firmwareVersion())
+
+	updated := &voltha.Device{Id: "sync-device", FirmwareVersion: "2"}
+	assert.NotNil(t, active.clusterDataProxy.Update("/devices/sync-device", updated, false, ""))
+	assert.Nil(t, active.clusterDataProxy.Flush())
+	for i := 0; i < 100 && firmwareVersion() != "2"; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "2", firmwareVersion())
+}
+
+func TestModelNotPersistedByDefault(t *testing.T) {
+	cf := config.NewRWCoreFlags()
+	cf.KVStoreType = "memory"
+	kvClient, err := kvstore.NewMemoryClient(t.Name(), cf.KVStoreTimeout)
+	if err != nil {
+		t.Fatalf("failed to create kv client - %s", err.Error())
+	}
+	core := NewCore("core", cf, kvClient, nil)
+	assert.Nil(t, core.backend)
+
+	device := &voltha.Device{Id: "local-device"}
+	assert.NotNil(t, core.clusterDataProxy.Add("/devices", device, ""))
+	pairs, err := kvClient.List("", cf.KVStoreTimeout)
+	assert.Nil(t, err)
+	assert.Empty(t, pairs)
+}
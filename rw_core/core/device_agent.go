@@ -29,9 +29,21 @@ import (
 	"google.golang.org/grpc/status"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Suffix of the KV store prefix giving the key prefix of the cluster-wide locks guarding device operations
+	deviceLockSuffix = "/locks/devices/"
+	// Time, in seconds, after which a device lock held by an unresponsive core is released
+	deviceLockTTL = 30
 )
 
 type DeviceAgent struct {
+	// lastAccess is the time, in nanoseconds, the agent was last used.  It is accessed atomically and kept first
+	// for its alignment.
+	lastAccess       int64
 	deviceId         string
 	deviceType       string
 	lastData         *voltha.Device
@@ -72,13 +84,22 @@ func newDeviceAgent(ap *AdapterProxy, device *voltha.Device, deviceMgr *DeviceMa
 	return &agent
 }
 
-// start save the device to the data model and registers for callbacks on that device
-func (agent *DeviceAgent) start(ctx context.Context) {
+// start save the device to the data model and registers for callbacks on that device.  When loadFromDb is set, the
+// device is instead loaded from the data model, which retrieves it from the KV store if it is not in memory.
+func (agent *DeviceAgent) start(ctx context.Context, loadFromDb bool) error {
 	agent.lockDevice.Lock()
 	defer agent.lockDevice.Unlock()
-	log.Debugw("starting-device-agent", log.Fields{"device": agent.lastData})
-	// Add the initial device to the local model
-	if added := agent.clusterDataProxy.Add("/devices", agent.lastData, ""); added == nil {
+	log.Debugw("starting-device-agent", log.Fields{"device": agent.lastData, "loadFromDb": loadFromDb})
+	if loadFromDb {
+		device, err := agent.loadDevice()
+		if err != nil {
+			log.Errorw("failed-to-load-device", log.Fields{"deviceId": agent.deviceId})
+			return err
+		}
+		agent.lastData = device
+		agent.deviceType = device.Type
+	} else if added := agent.clusterDataProxy.Add("/devices", agent.lastData, ""); added == nil {
+		// Add the initial device to the local model
 		log.Errorw("failed-to-add-device", log.Fields{"deviceId": agent.deviceId})
 	}
 	agent.deviceProxy = agent.clusterDataProxy.Root.CreateProxy("/devices/"+agent.deviceId, false)
@@ -91,21 +112,52 @@ func (agent *DeviceAgent) start(ctx context.Context) {
 		fmt.Sprintf("/devices/%s/flow_groups", agent.deviceId),
 		false)
 
-	agent.flowProxy.RegisterCallback(model.POST_UPDATE, agent.flowTableUpdated)
-	agent.groupProxy.RegisterCallback(model.POST_UPDATE, agent.groupTableUpdated)
+	// Pushing the flows to the adapters may be slow: do it without holding up the other callbacks
+	agent.flowProxy.RegisterCallbackWithOptions(model.POST_UPDATE, agent.flowTableUpdated, model.CallbackOptions{Async: true})
+	agent.groupProxy.RegisterCallbackWithOptions(model.POST_UPDATE, agent.groupTableUpdated, model.CallbackOptions{Async: true})
 
+	agent.touch()
 	log.Debug("device-agent-started")
+	return nil
 }
 
-// stop stops the device agent.  Not much to do for now
+// stop stops the device agent and unregisters its callbacks.  The device is left in the data model.
 func (agent *DeviceAgent) stop(ctx context.Context) {
 	agent.lockDevice.Lock()
 	defer agent.lockDevice.Unlock()
 	log.Debug("stopping-device-agent")
+	if agent.deviceProxy != nil {
+		agent.deviceProxy.UnregisterCallback(model.POST_UPDATE, agent.processUpdate)
+		agent.flowProxy.UnregisterCallback(model.POST_UPDATE, agent.flowTableUpdated)
+		agent.groupProxy.UnregisterCallback(model.POST_UPDATE, agent.groupTableUpdated)
+	}
 	agent.exitChannel <- 1
 	log.Debug("device-agent-stopped")
 }
 
+// loadDevice retrieves the device, along with its ports and flows, from the data model.  A device loaded from the
+// KV store is returned as a list by the data model.
+func (agent *DeviceAgent) loadDevice() (*voltha.Device, error) {
+	data := agent.clusterDataProxy.Get("/devices/"+agent.deviceId, 1, false, "")
+	if entries, ok := data.([]interface{}); ok && len(entries) > 0 {
+		data = entries[0]
+	}
+	if d, ok := data.(*voltha.Device); ok && d != nil {
+		return proto.Clone(d).(*voltha.Device), nil
+	}
+	return nil, status.Errorf(codes.NotFound, "device-%s", agent.deviceId)
+}
+
+// touch records that the device agent was used
+func (agent *DeviceAgent) touch() {
+	atomic.StoreInt64(&agent.lastAccess, time.Now().UnixNano())
+}
+
+// idleSince returns when the device agent was last used
+func (agent *DeviceAgent) idleSince() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&agent.lastAccess))
+}
+
 // GetDevice retrieves the latest device information from the data model
 func (agent *DeviceAgent) getDevice() (*voltha.Device, error) {
 	agent.lockDevice.Lock()
@@ -131,11 +183,37 @@ func (agent *DeviceAgent) getDeviceWithoutLock() (*voltha.Device, error) {
 	return nil, status.Errorf(codes.NotFound, "device-%s", agent.deviceId)
 }
 
+// acquireClusterLock acquires the lock guarding the device across the cores and returns its fencing token.
+// The lock cannot be acquired when the core runs without a KV store.
+func (agent *DeviceAgent) acquireClusterLock() (int64, error) {
+	if agent.deviceMgr.kvClient == nil {
+		return 0, status.Errorf(codes.FailedPrecondition, "no-kv-store:%s", agent.deviceId)
+	}
+	return agent.deviceMgr.kvClient.Lock(agent.deviceMgr.lockPrefix+agent.deviceId, deviceLockTTL,
+		agent.deviceMgr.kvOperationTimeout)
+}
+
+// releaseClusterLock releases the lock guarding the device across the cores
+func (agent *DeviceAgent) releaseClusterLock() {
+	if err := agent.deviceMgr.kvClient.Unlock(agent.deviceMgr.lockPrefix + agent.deviceId); err != nil {
+		log.Warnw("cannot-release-device-lock", log.Fields{"id": agent.deviceId, "error": err})
+	}
+}
+
 // enableDevice activates a preprovisioned or disable device
 func (agent *DeviceAgent) enableDevice(ctx context.Context) error {
 	agent.lockDevice.Lock()
 	defer agent.lockDevice.Unlock()
 	log.Debugw("enableDevice", log.Fields{"id": agent.deviceId})
+	token, err := agent.acquireClusterLock()
+	if err != nil {
+		log.Warnw("cannot-acquire-device-lock", log.Fields{"id": agent.deviceId, "error": err})
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		return status.Errorf(codes.Unavailable, "device-locked:%s", agent.deviceId)
+	}
+	defer agent.releaseClusterLock()
 	if device, err := agent.getDeviceWithoutLock(); err != nil {
 		return status.Errorf(codes.NotFound, "%s", agent.deviceId)
 	} else {
@@ -165,7 +243,11 @@ func (agent *DeviceAgent) enableDevice(ctx context.Context) error {
 		cloned := proto.Clone(device).(*voltha.Device)
 		cloned.AdminState = voltha.AdminState_ENABLED
 		cloned.OperStatus = voltha.OperStatus_ACTIVATING
-		if afterUpdate := agent.clusterDataProxy.Update("/devices/"+agent.deviceId, cloned, false, ""); afterUpdate == nil {
+		afterUpdate, err := agent.clusterDataProxy.WithFence(token).Update("/devices/"+agent.deviceId, cloned, false, "")
+		if err == model.ErrStaleFencingToken {
+			return status.Errorf(codes.Aborted, "device-updated-by-other-core:%s", agent.deviceId)
+		}
+		if afterUpdate == nil {
 			return status.Errorf(codes.Internal, "failed-update-device:%s", agent.deviceId)
 		}
 	}
@@ -395,17 +477,22 @@ func (agent *DeviceAgent) updateDevice(device *voltha.Device) error {
 	defer agent.lockDevice.Unlock()
 	log.Debugw("updateDevice", log.Fields{"deviceId": device.Id})
 	cloned := proto.Clone(device).(*voltha.Device)
-	afterUpdate := agent.clusterDataProxy.Update("/devices/"+device.Id, cloned, false, "")
-	if afterUpdate == nil {
-		return status.Errorf(codes.Internal, "%s", device.Id)
-	}
-	return nil
+	return agent.updateDeviceInStoreWithoutLock(cloned)
 }
 
 func (agent *DeviceAgent) updateDeviceWithoutLock(device *voltha.Device) error {
 	log.Debugw("updateDevice", log.Fields{"deviceId": device.Id})
 	cloned := proto.Clone(device).(*voltha.Device)
-	afterUpdate := agent.clusterDataProxy.Update("/devices/"+device.Id, cloned, false, "")
+	return agent.updateDeviceInStoreWithoutLock(cloned)
+}
+
+// updateDeviceInStoreWithoutLock updates the device in the model, reporting the update rejected as invalid
+func (agent *DeviceAgent) updateDeviceInStoreWithoutLock(device *voltha.Device) error {
+	afterUpdate, err := agent.clusterDataProxy.UpdateWithError("/devices/"+device.Id, device, false, "")
+	if err != nil {
+		log.Errorw("device-update-rejected", log.Fields{"deviceId": device.Id, "error": err})
+		return status.Errorf(codes.InvalidArgument, "%s", err.Error())
+	}
 	if afterUpdate == nil {
 		return status.Errorf(codes.Internal, "%s", device.Id)
 	}
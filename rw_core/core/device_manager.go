@@ -18,7 +18,9 @@ package core
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/opencord/voltha-go/common/log"
+	"github.com/opencord/voltha-go/db/kvstore"
 	"github.com/opencord/voltha-go/db/model"
 	"github.com/opencord/voltha-go/kafka"
 	ic "github.com/opencord/voltha-go/protos/inter_container"
@@ -29,6 +31,7 @@ import (
 	"reflect"
 	"runtime"
 	"sync"
+	"time"
 )
 
 type DeviceManager struct {
@@ -41,9 +44,19 @@ type DeviceManager struct {
 	coreInstanceId      string
 	exitChannel         chan int
 	lockDeviceAgentsMap sync.RWMutex
-}
-
-func newDeviceManager(kafkaICProxy *kafka.InterContainerProxy, cdProxy *model.Proxy, coreInstanceId string) *DeviceManager {
+	// lockLoading serializes the loading and eviction of device agents, as the agents of a device share the
+	// callbacks registered on its proxies
+	lockLoading sync.Mutex
+	// idleTimeout is how long an agent is kept in memory once no longer used; 0 keeps the agents forever
+	idleTimeout time.Duration
+	// lockPrefix is the KV store key prefix of the cluster-wide locks guarding the devices
+	lockPrefix string
+	// kvClient holds the cluster-wide locks; without it, the operations needing a lock are rejected
+	kvClient           kvstore.Client
+	kvOperationTimeout int
+}
+
+func newDeviceManager(kafkaICProxy *kafka.InterContainerProxy, cdProxy *model.Proxy, coreInstanceId string, idleTimeout time.Duration, kvClient kvstore.Client, kvStorePrefix string, kvOperationTimeout int) *DeviceManager {
 	var deviceMgr DeviceManager
 	deviceMgr.exitChannel = make(chan int, 1)
 	deviceMgr.deviceAgents = make(map[string]*DeviceAgent)
@@ -52,6 +65,10 @@ func newDeviceManager(kafkaICProxy *kafka.InterContainerProxy, cdProxy *model.Pr
 	deviceMgr.coreInstanceId = coreInstanceId
 	deviceMgr.clusterDataProxy = cdProxy
 	deviceMgr.lockDeviceAgentsMap = sync.RWMutex{}
+	deviceMgr.idleTimeout = idleTimeout
+	deviceMgr.lockPrefix = kvStorePrefix + deviceLockSuffix
+	deviceMgr.kvClient = kvClient
+	deviceMgr.kvOperationTimeout = kvOperationTimeout
 	return &deviceMgr
 }
 
@@ -59,6 +76,9 @@ func (dMgr *DeviceManager) start(ctx context.Context, logicalDeviceMgr *LogicalD
 	log.Info("starting-device-manager")
 	dMgr.logicalDeviceMgr = logicalDeviceMgr
 	dMgr.stateTransitions = NewTransitionMap(dMgr)
+	if dMgr.idleTimeout > 0 {
+		go dMgr.evictIdleDeviceAgents(ctx)
+	}
 	log.Info("device-manager-started")
 }
 
@@ -94,14 +114,118 @@ func (dMgr *DeviceManager) deleteDeviceAgentToMap(agent *DeviceAgent) {
 	delete(dMgr.deviceAgents, agent.deviceId)
 }
 
+// getDeviceAgent returns the agent of a device, loading the device first when its agent is not in memory
 func (dMgr *DeviceManager) getDeviceAgent(deviceId string) *DeviceAgent {
-	// TODO If the device is not in memory it needs to be loaded first
+	if agent := dMgr.touchDeviceAgent(deviceId); agent != nil {
+		return agent
+	}
+	agent, err := dMgr.load(deviceId)
+	if err != nil {
+		log.Debugw("device-not-loaded", log.Fields{"deviceId": deviceId, "error": err})
+		return nil
+	}
+	return agent
+}
+
+// touchDeviceAgent returns the agent of a device if it is in memory, after recording that it was used.  The
+// agent is looked up and touched under the lock of the map so that it cannot be evicted in between.
+func (dMgr *DeviceManager) touchDeviceAgent(deviceId string) *DeviceAgent {
+	dMgr.lockDeviceAgentsMap.RLock()
+	defer dMgr.lockDeviceAgentsMap.RUnlock()
+	agent, ok := dMgr.deviceAgents[deviceId]
+	if !ok {
+		return nil
+	}
+	agent.touch()
+	return agent
+}
+
+// IsDeviceInCache returns whether the agent of a device is in memory
+func (dMgr *DeviceManager) IsDeviceInCache(deviceId string) bool {
+	dMgr.lockDeviceAgentsMap.RLock()
+	defer dMgr.lockDeviceAgentsMap.RUnlock()
+	_, exist := dMgr.deviceAgents[deviceId]
+	return exist
+}
+
+// load creates and starts the agent of a device from the data model, which retrieves the device from the KV
+// store when it is not in memory, e.g. a device owned by another core until it failed
+func (dMgr *DeviceManager) load(deviceId string) (*DeviceAgent, error) {
+	dMgr.lockLoading.Lock()
+	defer dMgr.lockLoading.Unlock()
+
+	// The device may have been loaded while waiting
+	if agent := dMgr.touchDeviceAgent(deviceId); agent != nil {
+		return agent, nil
+	}
+
+	log.Debugw("loading-device", log.Fields{"deviceId": deviceId})
+	agent := newDeviceAgent(dMgr.adapterProxy, &voltha.Device{Id: deviceId}, dMgr, dMgr.clusterDataProxy)
+	if err := agent.start(nil, true); err != nil {
+		return nil, err
+	}
+	dMgr.addDeviceAgentToMap(agent)
+	log.Debugw("device-loaded", log.Fields{"deviceId": deviceId})
+	return agent, nil
+}
+
+// evictIdleDeviceAgents periodically stops the device agents which were not used for longer than the idle
+// timeout.  The devices stay in the data model and their agents are loaded again on their next use.
+func (dMgr *DeviceManager) evictIdleDeviceAgents(ctx context.Context) {
+	ticker := time.NewTicker(dMgr.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dMgr.evictDeviceAgentsIdleSince(time.Now().Add(-dMgr.idleTimeout))
+		case <-dMgr.exitChannel:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evictDeviceAgentsIdleSince stops the device agents last used before a time
+func (dMgr *DeviceManager) evictDeviceAgentsIdleSince(since time.Time) {
+	dMgr.lockLoading.Lock()
+	defer dMgr.lockLoading.Unlock()
+
+	var candidates []*DeviceAgent
+	dMgr.lockDeviceAgentsMap.RLock()
+	for _, agent := range dMgr.deviceAgents {
+		if agent.idleSince().Before(since) {
+			candidates = append(candidates, agent)
+		}
+	}
+	dMgr.lockDeviceAgentsMap.RUnlock()
+
+	evicted := 0
+	for _, agent := range candidates {
+		if dMgr.evictDeviceAgentIdleSince(agent, since) {
+			agent.stop(nil)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		log.Debugw("idle-device-agents-evicted", log.Fields{"count": evicted})
+	}
+}
+
+// evictDeviceAgentIdleSince removes an agent from the map if it is still unused since a time.  The agent lock is
+// taken first so that the operations in progress on the device, which may touch the agent, complete before the
+// check.
+func (dMgr *DeviceManager) evictDeviceAgentIdleSince(agent *DeviceAgent, since time.Time) bool {
+	agent.lockDevice.Lock()
+	defer agent.lockDevice.Unlock()
 	dMgr.lockDeviceAgentsMap.Lock()
 	defer dMgr.lockDeviceAgentsMap.Unlock()
-	if agent, ok := dMgr.deviceAgents[deviceId]; ok {
-		return agent
+
+	if dMgr.deviceAgents[agent.deviceId] != agent || !agent.idleSince().Before(since) {
+		return false
 	}
-	return nil
+	delete(dMgr.deviceAgents, agent.deviceId)
+	return true
 }
 
 func (dMgr *DeviceManager) createDevice(ctx context.Context, device *voltha.Device, ch chan interface{}) {
@@ -110,7 +234,7 @@ func (dMgr *DeviceManager) createDevice(ctx context.Context, device *voltha.Devi
 	// Create and start a device agent for that device
 	agent := newDeviceAgent(dMgr.adapterProxy, device, dMgr, dMgr.clusterDataProxy)
 	dMgr.addDeviceAgentToMap(agent)
-	agent.start(ctx)
+	agent.start(ctx, false)
 
 	sendResponse(ctx, ch, agent.lastData)
 }
@@ -185,17 +309,13 @@ func (dMgr *DeviceManager) IsRootDevice(id string) (bool, error) {
 	return device.Root, nil
 }
 
-// GetDevice retrieves the latest device information from the data model
+// ListDevices retrieves the latest information of all the devices from the data model.  The device agents are
+// only loaded when a device is used.
 func (dMgr *DeviceManager) ListDevices() (*voltha.Devices, error) {
 	log.Debug("ListDevices")
 	result := &voltha.Devices{}
 	if devices := dMgr.clusterDataProxy.Get("/devices", 0, false, ""); devices != nil {
 		for _, device := range devices.([]interface{}) {
-			if agent := dMgr.getDeviceAgent(device.(*voltha.Device).Id); agent == nil {
-				agent = newDeviceAgent(dMgr.adapterProxy, device.(*voltha.Device), dMgr, dMgr.clusterDataProxy)
-				dMgr.addDeviceAgentToMap(agent)
-				agent.start(nil)
-			}
 			result.Items = append(result.Items, device.(*voltha.Device))
 		}
 	}
@@ -351,10 +471,16 @@ func (dMgr *DeviceManager) childDeviceDetected(parentDeviceId string, parentPort
 
 	childDevice.ProxyAddress = &voltha.Device_ProxyAddress{DeviceId: parentDeviceId, DeviceType: parent.Type, ChannelId: uint32(channelId)}
 
+	// Ignore a child device which was already detected on the same port and channel
+	if existing := dMgr.findChildDevice(parentDeviceId, childDevice.ParentPortNo, childDevice.ProxyAddress.ChannelId); existing != nil {
+		log.Warnw("child-device-already-detected", log.Fields{"parentDeviceId": parentDeviceId, "deviceId": existing.Id})
+		return nil
+	}
+
 	// Create and start a device agent for that device
 	agent := newDeviceAgent(dMgr.adapterProxy, childDevice, dMgr, dMgr.clusterDataProxy)
 	dMgr.addDeviceAgentToMap(agent)
-	agent.start(nil)
+	agent.start(nil, false)
 
 	// Activate the child device
 	if agent := dMgr.getDeviceAgent(agent.deviceId); agent != nil {
@@ -367,6 +493,22 @@ func (dMgr *DeviceManager) childDeviceDetected(parentDeviceId string, parentPort
 	return nil
 }
 
+// findChildDevice returns the child device of a parent which is connected to a port and channel, if any
+func (dMgr *DeviceManager) findChildDevice(parentDeviceId string, parentPortNo uint32, channelId uint32) *voltha.Device {
+	children, err := dMgr.clusterDataProxy.GetByIndex("/devices", "parent_id", parentDeviceId, 0)
+	if err != nil {
+		log.Errorw("failed-to-get-child-devices", log.Fields{"parentDeviceId": parentDeviceId, "error": err})
+		return nil
+	}
+	for _, child := range children {
+		device := child.(*voltha.Device)
+		if device.ParentPortNo == parentPortNo && device.ProxyAddress != nil && device.ProxyAddress.ChannelId == channelId {
+			return device
+		}
+	}
+	return nil
+}
+
 func (dMgr *DeviceManager) processTransition(previous *voltha.Device, current *voltha.Device) error {
 	// This will be triggered on every update to the device.
 	handlers := dMgr.stateTransitions.GetTransitionHandler(previous, current)
@@ -527,16 +669,34 @@ func (dMgr *DeviceManager) deleteAllChildDevices(parentDevice *voltha.Device) er
 func (dMgr *DeviceManager) getAllChildDeviceIds(parentDevice *voltha.Device) ([]string, error) {
 	log.Debugw("getAllChildDeviceIds", log.Fields{"parentDeviceId": parentDevice.Id})
 	childDeviceIds := make([]string, 0)
-	if parentDevice != nil {
-		for _, port := range parentDevice.Ports {
-			for _, peer := range port.Peers {
-				childDeviceIds = append(childDeviceIds, peer.DeviceId)
-			}
-		}
+	children, err := dMgr.queryDevices(&model.Query{
+		Filter: fmt.Sprintf("parent_id=%s", parentDevice.Id),
+		Fields: []string{"id"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		childDeviceIds = append(childDeviceIds, child.Id)
 	}
 	return childDeviceIds, nil
 }
 
+// queryDevices retrieves the devices selected by a query from the data model, without their children unless
+// the query sets a depth
+func (dMgr *DeviceManager) queryDevices(query *model.Query) ([]*voltha.Device, error) {
+	entries, err := dMgr.clusterDataProxy.Query("/devices", query, "")
+	if err != nil {
+		log.Errorw("failed-to-query-devices", log.Fields{"query": query, "error": err})
+		return nil, err
+	}
+	devices := make([]*voltha.Device, 0, len(entries))
+	for _, entry := range entries {
+		devices = append(devices, entry.(*voltha.Device))
+	}
+	return devices, nil
+}
+
 func (dMgr *DeviceManager) addUNILogicalPort(cDevice *voltha.Device) error {
 	log.Info("addUNILogicalPort")
 	if err := dMgr.logicalDeviceMgr.addUNILogicalPort(nil, cDevice); err != nil {
@@ -583,7 +743,7 @@ func funcName(f interface{}) string {
 }
 
 func (dMgr *DeviceManager) UpdateDeviceAttribute(deviceId string, attribute string, value interface{}) {
-	if agent, ok := dMgr.deviceAgents[deviceId]; ok {
+	if agent := dMgr.getDeviceAgent(deviceId); agent != nil {
 		agent.updateDeviceAttribute(attribute, value)
 	}
 }
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018-present Open Networking Foundation
+
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+
+ * http://www.apache.org/licenses/LICENSE-2.0
+
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package core
+
+import (
+	"github.com/opencord/voltha-go/db/model"
+	"github.com/opencord/voltha-go/protos/voltha"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// newTestDeviceManager creates a device manager over an in-memory data model holding an OLT and its ONUs
+func newTestDeviceManager(t *testing.T, onus ...*voltha.Device) *DeviceManager {
+	proxy := model.NewRoot(&voltha.Voltha{}, nil).CreateProxy("/", false)
+	olt := &voltha.Device{Id: "olt", Type: "olt-adapter", Root: true}
+	assert.NotNil(t, proxy.Add("/devices", olt, ""))
+	for _, onu := range onus {
+		assert.NotNil(t, proxy.Add("/devices", onu, ""))
+	}
+	return newDeviceManager(nil, proxy, "core", 0, nil, "", 0)
+}
+
+func newTestOnu(id string, portNo uint32, channelId uint32) *voltha.Device {
+	return &voltha.Device{
+		Id:           id,
+		Type:         "onu-adapter",
+		ParentId:     "olt",
+		ParentPortNo: portNo,
+		ProxyAddress: &voltha.Device_ProxyAddress{DeviceId: "olt", DeviceType: "olt-adapter", ChannelId: channelId},
+	}
+}
+
+func TestFindChildDevice(t *testing.T) {
+	dMgr := newTestDeviceManager(t, newTestOnu("onu1", 1, 10), newTestOnu("onu2", 1, 11), newTestOnu("onu3", 2, 10))
+
+	child := dMgr.findChildDevice("olt", 1, 11)
+	if assert.NotNil(t, child) {
+		assert.Equal(t, "onu2", child.Id)
+	}
+	child = dMgr.findChildDevice("olt", 2, 10)
+	if assert.NotNil(t, child) {
+		assert.Equal(t, "onu3", child.Id)
+	}
+	assert.Nil(t, dMgr.findChildDevice("olt", 2, 11))
+	assert.Nil(t, dMgr.findChildDevice("other-olt", 1, 10))
+}
+
+func TestChildDeviceDetectedTwice(t *testing.T) {
+	dMgr := newTestDeviceManager(t, newTestOnu("onu1", 1, 10))
+
+	// The child device already detected on the port and channel is neither created nor activated again
+	assert.Nil(t, dMgr.childDeviceDetected("olt", 1, "onu-adapter", 10))
+	devices, err := dMgr.ListDevices()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(devices.Items))
+	assert.False(t, dMgr.IsDeviceInCache("onu1"))
+}
+
+func TestGetAllChildDeviceIds(t *testing.T) {
+	other := newTestOnu("onu3", 1, 10)
+	other.ParentId = "other-olt"
+	dMgr := newTestDeviceManager(t, newTestOnu("onu1", 1, 10), newTestOnu("onu2", 2, 10), other)
+
+	// The children are found by their parent id, whether or not the ports of the parent list them as peers
+	ids, err := dMgr.getAllChildDeviceIds(&voltha.Device{Id: "olt"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"onu1", "onu2"}, ids)
+
+	ids, err = dMgr.getAllChildDeviceIds(&voltha.Device{Id: "onu1"})
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+}
@@ -83,11 +83,11 @@ func (handler *APIHandler) createKvTransaction(ctx context.Context) (*KVTransact
 
 // waitForNilResponseOnSuccess is a helper function to wait for a response on channel ch where an nil
 // response is expected in a successful scenario
-func waitForNilResponseOnSuccess(ctx context.Context, ch chan interface{}) (*empty.Empty, error) {
+func (handler *APIHandler) waitForNilResponseOnSuccess(ctx context.Context, ch chan interface{}) (*empty.Empty, error) {
 	select {
 	case res := <-ch:
 		if res == nil {
-			return new(empty.Empty), nil
+			return new(empty.Empty), handler.flushModel()
 		} else if err, ok := res.(error); ok {
 			return new(empty.Empty), err
 		} else {
@@ -101,6 +101,15 @@ func waitForNilResponseOnSuccess(ctx context.Context, ch chan interface{}) (*emp
 	}
 }
 
+// flushModel waits for the changes made to the data model to be stored before a request is acknowledged
+func (handler *APIHandler) flushModel() error {
+	if err := handler.deviceMgr.clusterDataProxy.Flush(); err != nil {
+		log.Errorw("model-flush-failed", log.Fields{"error": err})
+		return status.Errorf(codes.Unavailable, "%s", err)
+	}
+	return nil
+}
+
 func (handler *APIHandler) UpdateLogLevel(ctx context.Context, logging *voltha.Logging) (*empty.Empty, error) {
 	log.Debugw("UpdateLogLevel-request", log.Fields{"newloglevel": logging.Level, "intval": int(logging.Level)})
 	out := new(empty.Empty)
@@ -117,7 +126,7 @@ func (handler *APIHandler) EnableLogicalDevicePort(ctx context.Context, id *volt
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.logicalDeviceMgr.enableLogicalPort(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 func (handler *APIHandler) DisableLogicalDevicePort(ctx context.Context, id *voltha.LogicalPortId) (*empty.Empty, error) {
@@ -129,7 +138,7 @@ func (handler *APIHandler) DisableLogicalDevicePort(ctx context.Context, id *vol
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.logicalDeviceMgr.disableLogicalPort(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 func (handler *APIHandler) UpdateLogicalDeviceFlowTable(ctx context.Context, flow *openflow_13.FlowTableUpdate) (*empty.Empty, error) {
@@ -141,7 +150,7 @@ func (handler *APIHandler) UpdateLogicalDeviceFlowTable(ctx context.Context, flo
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.logicalDeviceMgr.updateFlowTable(ctx, flow.Id, flow.FlowMod, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 func (handler *APIHandler) UpdateLogicalDeviceFlowGroupTable(ctx context.Context, flow *openflow_13.FlowGroupTableUpdate) (*empty.Empty, error) {
@@ -153,7 +162,7 @@ func (handler *APIHandler) UpdateLogicalDeviceFlowGroupTable(ctx context.Context
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.logicalDeviceMgr.updateGroupTable(ctx, flow.Id, flow.GroupMod, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 // GetDevice must be implemented in the read-only containers - should it also be implemented here?
@@ -212,6 +221,9 @@ func (handler *APIHandler) CreateDevice(ctx context.Context, device *voltha.Devi
 				return &voltha.Device{}, err
 			}
 			if d, ok := res.(*voltha.Device); ok {
+				if err := handler.flushModel(); err != nil {
+					return &voltha.Device{}, err
+				}
 				return d, nil
 			}
 		}
@@ -243,7 +255,7 @@ func (handler *APIHandler) EnableDevice(ctx context.Context, id *voltha.ID) (*em
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.deviceMgr.enableDevice(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 // DisableDevice disables a device along with any child device it may have
@@ -255,7 +267,7 @@ func (handler *APIHandler) DisableDevice(ctx context.Context, id *voltha.ID) (*e
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.deviceMgr.disableDevice(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 //RebootDevice invoked the reboot API to the corresponding adapter
@@ -267,7 +279,7 @@ func (handler *APIHandler) RebootDevice(ctx context.Context, id *voltha.ID) (*em
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.deviceMgr.rebootDevice(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 // DeleteDevice removes a device from the data model
@@ -279,7 +291,7 @@ func (handler *APIHandler) DeleteDevice(ctx context.Context, id *voltha.ID) (*em
 	ch := make(chan interface{})
 	defer close(ch)
 	go handler.deviceMgr.deleteDevice(ctx, id, ch)
-	return waitForNilResponseOnSuccess(ctx, ch)
+	return handler.waitForNilResponseOnSuccess(ctx, ch)
 }
 
 func (handler *APIHandler) DownloadImage(ctx context.Context, img *voltha.ImageDownload) (*common.OperationResp, error) {
@@ -35,6 +35,7 @@
 package core
 
 import (
+	"errors"
 	log "github.com/opencord/voltha-go/common/log"
 	"github.com/opencord/voltha-go/db/kvstore"
 	"time"
@@ -47,6 +48,7 @@ const (
 	COMPLETED_BY_OTHER
 	ABANDONED_BY_OTHER
 	STOPPED_WAITING_FOR_OTHER
+	SEIZED_BY_OTHER
 )
 
 const (
@@ -68,7 +70,8 @@ var txnState = []string{
 	"SEIZED-BY-SELF",
 	"COMPLETED-BY-OTHER",
 	"ABANDONED-BY-OTHER",
-	"STOPPED-WAITING-FOR-OTHER"}
+	"STOPPED-WAITING-FOR-OTHER",
+	"SEIZED-BY-OTHER"}
 
 func init() {
 	log.AddPackage(log.JSON, log.WarnLevel, nil)
@@ -137,7 +140,8 @@ func NewKVTransaction(txnId string) *KVTransaction {
  * the request. True is returned in one of two cases:
  * (1) The current core successfully reserved the request's serial number with the KV store
  * (2) The current core failed in its reservation attempt but observed that the serving core
- *     has abandoned processing the request
+ *     has abandoned processing the request, and it managed to take over the transaction key
+ *     before any other core did
  *
  * :param duration: The duration of the reservation in milliseconds
  * :return: true - reservation acquired, process the request
@@ -207,6 +211,10 @@ func (c *KVTransaction) Acquired(duration int64) bool {
 			}
 		}
 	}
+	if res == ABANDONED_BY_OTHER || res == STOPPED_WAITING_FOR_OTHER {
+		// Take over the transaction key; only one of the cores stepping up may succeed
+		res = c.seize(res)
+	}
 	// Clean-up: delete the transaction key after a long delay
 	go c.deleteTransactionKey()
 
@@ -220,6 +228,37 @@ func (c *KVTransaction) Acquired(duration int64) bool {
 	return acquired
 }
 
+/*
+ * Conditionally writes the current core as the owner of a transaction key which was abandoned,
+ * or is held for too long, by the core that reserved it.  The write only succeeds if the key
+ * has not changed since it was last read, which guarantees that two standby cores cannot both
+ * step up for the same request.
+ *
+ * :param res: The acquisition result observed while waiting for the other core
+ * :return: the given result when the key was seized, SEIZED_BY_OTHER or COMPLETED_BY_OTHER otherwise
+ */
+func (c *KVTransaction) seize(res int) int {
+	var version int64
+	kvp, err := ctx.kvClient.Get(c.txnKey, ctx.kvOperationTimeout)
+	if err != nil {
+		log.Errorw("seize-transaction-read-failed", log.Fields{"key": c.txnKey, "error": err})
+		return res
+	}
+	if kvp != nil {
+		if val, err := kvstore.ToString(kvp.Value); err == nil && val == TRANSACTION_COMPLETE {
+			return COMPLETED_BY_OTHER
+		}
+		version = kvp.Version
+	}
+	if _, err = ctx.kvClient.PutIfVersion(c.txnKey, ctx.owner, version, ctx.kvOperationTimeout); err != nil {
+		log.Debugw("seize-transaction-failed", log.Fields{"key": c.txnKey, "version": version, "error": err})
+		if err == kvstore.ErrVersionMismatch {
+			return SEIZED_BY_OTHER
+		}
+	}
+	return res
+}
+
 func (c *KVTransaction) deleteTransactionKey() {
 	log.Debugw("schedule-key-deletion", log.Fields{"key": c.txnKey})
 	time.Sleep(time.Duration(ctx.timeToDeleteCompletedKeys) * time.Second)
@@ -227,9 +266,26 @@ func (c *KVTransaction) deleteTransactionKey() {
 	ctx.kvClient.Delete(c.txnKey, ctx.kvOperationTimeout)
 }
 
+/*
+ * Marks the transaction as complete.  An error is returned when another core has taken over
+ * the transaction key in the meantime, in which case the key is left untouched.
+ */
 func (c *KVTransaction) Close() error {
+	var version int64
 	log.Debugw("close", log.Fields{"key": c.txnKey})
-	return ctx.kvClient.Put(c.txnKey, TRANSACTION_COMPLETE, ctx.kvOperationTimeout)
+	kvp, err := ctx.kvClient.Get(c.txnKey, ctx.kvOperationTimeout)
+	if err != nil {
+		return err
+	}
+	if kvp != nil {
+		if owner, err := kvstore.ToString(kvp.Value); err == nil && owner != ctx.owner && owner != TRANSACTION_COMPLETE {
+			log.Warnw("transaction-owned-by-other", log.Fields{"key": c.txnKey, "owner": owner})
+			return errors.New("transaction-owned-by-other")
+		}
+		version = kvp.Version
+	}
+	_, err = ctx.kvClient.PutIfVersion(c.txnKey, TRANSACTION_COMPLETE, version, ctx.kvOperationTimeout)
+	return err
 }
 
 func (c *KVTransaction) Delete() error {
@@ -50,14 +50,23 @@ func init() {
 	log.AddPackage(log.JSON, log.DebugLevel, nil)
 }
 
-func newKVClient(storeType string, address string, timeout int) (kvstore.Client, error) {
+func newKVClient(storeType string, address string, timeout int, security *kvstore.SecurityConfig) (kvstore.Client, error) {
 
 	log.Infow("kv-store-type", log.Fields{"store": storeType})
 	switch storeType {
 	case "consul":
-		return kvstore.NewConsulClient(address, timeout)
+		return kvstore.NewConsulClientWithSecurity(address, timeout, security)
 	case "etcd":
-		return kvstore.NewEtcdClient(address, timeout)
+		return kvstore.NewEtcdClientWithSecurity(address, timeout, security)
+	case "memory":
+		return kvstore.NewMemoryClient(address, timeout)
+	case "bolt":
+		// The address is the path of the database file
+		client, err := kvstore.NewBoltClient(address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
 	}
 	return nil, errors.New("unsupported-kv-store")
 }
@@ -89,7 +98,18 @@ func newRWCore(cf *config.RWCoreFlags) *rwCore {
 
 func (rw *rwCore) setKVClient() error {
 	addr := rw.config.KVStoreHost + ":" + strconv.Itoa(rw.config.KVStorePort)
-	client, err := newKVClient(rw.config.KVStoreType, addr, rw.config.KVStoreTimeout)
+	if rw.config.KVStoreType == config.BoltStoreName {
+		addr = rw.config.KVStorePath
+	}
+	security := &kvstore.SecurityConfig{
+		CertFile: rw.config.KVStoreCert,
+		KeyFile:  rw.config.KVStoreKey,
+		CAFile:   rw.config.KVStoreCA,
+		Username: rw.config.KVStoreUsername,
+		Password: rw.config.KVStorePassword,
+		Token:    rw.config.KVStoreToken,
+	}
+	client, err := newKVClient(rw.config.KVStoreType, addr, rw.config.KVStoreTimeout, security)
 	if err != nil {
 		rw.kvClient = nil
 		log.Error(err)
@@ -119,7 +139,7 @@ func (rw *rwCore) start(ctx context.Context) {
 	if err == nil {
 		// Setup KV transaction context
 		c.SetTransactionContext(rw.config.InstanceID,
-			"service/voltha/transactions/",
+			rw.config.KVStorePrefix+"/transactions/",
 			rw.kvClient,
 			rw.config.KVStoreTimeout,
 			rw.config.KVTxnKeyDelTime)
@@ -144,6 +164,9 @@ func (rw *rwCore) stop() {
 	// send exit signal
 	rw.exitChannel <- 0
 
+	// The core stores its pending model changes before the DB connection is closed
+	rw.core.Stop(nil)
+
 	// Cleanup - applies only if we had a kvClient
 	if rw.kvClient != nil {
 		// Release all reservations
@@ -154,8 +177,6 @@ func (rw *rwCore) stop() {
 		rw.kvClient.Close()
 	}
 
-	rw.core.Stop(nil)
-
 	//if rw.kafkaClient != nil {
 	//	rw.kafkaClient.Stop()
 	//}